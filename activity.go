@@ -0,0 +1,77 @@
+package viamroomba
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// activity records what the robot is doing, so sensor readings can be
+// tagged with the operation that was running when they were taken. It is
+// shared by every component on a port.
+type activity struct {
+	mu   sync.Mutex
+	kind string
+	id   string
+	// docked is whether the robot was last seen on its dock since the
+	// operation started.
+	docked bool
+}
+
+// set records an open-ended operation, such as a cleaning cycle the robot
+// runs by itself, which lasts until the next one is set. "idle" clears it.
+func (a *activity) set(kind string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.kind = kind
+	a.id = ""
+	a.docked = false
+	if kind != "idle" {
+		a.id = uuid.NewString()
+	}
+}
+
+// begin records an operation that the module runs to completion and
+// returns the function that marks it finished. Finishing does nothing if a
+// newer operation has started since.
+func (a *activity) begin(kind string) func() {
+	id := uuid.NewString()
+	a.mu.Lock()
+	a.kind, a.id, a.docked = kind, id, false
+	a.mu.Unlock()
+	return func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if a.id == id {
+			a.kind, a.id, a.docked = "idle", "", false
+		}
+	}
+}
+
+// current returns the running operation's kind and ID. The ID is empty
+// while idle.
+func (a *activity) current() (string, string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.kind == "" {
+		return "idle", ""
+	}
+	return a.kind, a.id
+}
+
+// noteDocked records whether a reading of the charging sources (packet 34)
+// found the robot on its dock.
+func (a *activity) noteDocked(docked bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.docked = docked
+}
+
+// resting reports whether the robot is doing nothing that needs watching
+// closely: it is idle, or it is back on its dock, as at the end of a
+// cleaning cycle it ran by itself.
+func (a *activity) resting() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.kind == "" || a.kind == "idle" || a.docked
+}
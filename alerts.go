@@ -0,0 +1,155 @@
+package viamroomba
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.viam.com/rdk/logging"
+)
+
+const (
+	defaultAlertBatteryPercent         = 20.0
+	defaultAlertBatteryCriticalPercent = 10.0
+	// The temperature alerts default to the battery temperature limit, and
+	// to this much above it for the critical one.
+	alertTemperatureCriticalMarginC = 10
+)
+
+// alertRule is one condition the alert tracker watches for. level is
+// "warn" or "error", the log level it is raised at.
+type alertRule struct {
+	kind  string
+	level string
+	// check returns whether the condition holds, the reading that was
+	// checked, and a message for the log and the alert.
+	check func(readings map[string]any) (bool, any, string)
+}
+
+// alert is a raised alert, kept until it is acknowledged.
+type alert struct {
+	kind    string
+	level   string
+	message string
+	value   any
+	since   time.Time
+}
+
+// alertTracker raises an alert when one of its rules starts to hold,
+// logging it at the rule's level so that Viam surfaces it. Alerts are
+// sticky: they stay in Readings after the condition clears, until
+// acknowledged. An acknowledged alert is raised again the next time its
+// condition starts to hold.
+type alertTracker struct {
+	logger logging.Logger
+	rules  []alertRule
+
+	mu     sync.Mutex
+	active map[string]alert
+	// holding is whether each rule held at the last reading.
+	holding map[string]bool
+}
+
+func newAlertTracker(logger logging.Logger, batteryPercent, batteryCriticalPercent float64, tempC, tempCriticalC int) *alertTracker {
+	battery := func(limit float64) func(map[string]any) (bool, any, string) {
+		return func(readings map[string]any) (bool, any, string) {
+			pct, ok := readings["battery_percent"].(float64)
+			return ok && pct < limit, pct, fmt.Sprintf("battery at %.0f%%, below %.0f%%", pct, limit)
+		}
+	}
+	temperature := func(limit int) func(map[string]any) (bool, any, string) {
+		return func(readings map[string]any) (bool, any, string) {
+			c, ok := readings["temperature_c"].(int)
+			return ok && c > limit, c, fmt.Sprintf("battery temperature %d°C, above %d°C", c, limit)
+		}
+	}
+	return &alertTracker{
+		logger: logger,
+		rules: []alertRule{
+			{kind: "low_battery", level: "warn", check: battery(batteryPercent)},
+			{kind: "critical_battery", level: "error", check: battery(batteryCriticalPercent)},
+			{kind: "high_temperature", level: "warn", check: temperature(tempC)},
+			{kind: "critical_temperature", level: "error", check: temperature(tempCriticalC)},
+			{kind: "charging_fault", level: "error", check: func(readings map[string]any) (bool, any, string) {
+				state, _ := readings["charging_state"].(string)
+				return state == "charging_fault", state, "the robot reports a charging fault"
+			}},
+		},
+		active:  map[string]alert{},
+		holding: map[string]bool{},
+	}
+}
+
+// update checks every rule against a reading and raises the alerts whose
+// condition has just started to hold.
+func (t *alertTracker) update(now time.Time, readings map[string]any) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, rule := range t.rules {
+		holds, value, message := rule.check(readings)
+		if holds && !t.holding[rule.kind] {
+			if _, raised := t.active[rule.kind]; !raised {
+				t.active[rule.kind] = alert{kind: rule.kind, level: rule.level, message: message, value: value, since: now}
+			}
+			if rule.level == "error" {
+				t.logger.Errorf("Alert %s: %s", rule.kind, message)
+			} else {
+				t.logger.Warnf("Alert %s: %s", rule.kind, message)
+			}
+		}
+		t.holding[rule.kind] = holds
+	}
+}
+
+// list returns the raised alerts for Readings, oldest first.
+func (t *alertTracker) list() []any {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	alerts := make([]alert, 0, len(t.active))
+	for _, a := range t.active {
+		alerts = append(alerts, a)
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].since.Before(alerts[j].since) })
+	list := make([]any, 0, len(alerts))
+	for _, a := range alerts {
+		list = append(list, map[string]any{
+			"kind":    a.kind,
+			"level":   a.level,
+			"message": a.message,
+			"value":   a.value,
+			"since":   a.since.Format(time.RFC3339),
+			"active":  t.holding[a.kind],
+		})
+	}
+	return list
+}
+
+// acknowledgeAlertsArgs are the parameters of acknowledge_alerts.
+type acknowledgeAlertsArgs struct {
+	Kind string `json:"kind" doc:"Only acknowledge alerts of this kind; all if omitted"`
+}
+
+// acknowledge clears raised alerts, all of them or one kind.
+func (t *alertTracker) acknowledge(_ context.Context, args acknowledgeAlertsArgs) (map[string]any, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if args.Kind != "" {
+		known := false
+		for _, rule := range t.rules {
+			known = known || rule.kind == args.Kind
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown alert kind: %s", args.Kind)
+		}
+	}
+	n := 0
+	for kind := range t.active {
+		if args.Kind == "" || kind == args.Kind {
+			delete(t.active, kind)
+			n++
+		}
+	}
+	return map[string]any{"acknowledged": n}, nil
+}
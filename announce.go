@@ -0,0 +1,195 @@
+package viamroomba
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	// defaultEventSongInterval is how long the same event's song is held
+	// back after it has played, so a robot sitting on a cliff or bumping
+	// along a wall doesn't beep constantly.
+	defaultEventSongInterval = 30 * time.Second
+	// maxEventSong is the highest song slot event_songs may use; slot 4 is
+	// the module's reverse beep.
+	maxEventSong = 3
+)
+
+// presetSongs are played for a slot in event_songs that songs doesn't
+// define: a rising arpeggio, a falling one, a three-beep alarm, and a
+// two-note chime.
+var presetSongs = [maxEventSong + 1][]songNote{
+	{{72, 12}, {76, 12}, {79, 12}, {84, 24}},
+	{{79, 12}, {76, 12}, {72, 12}, {67, 24}},
+	{{93, 10}, {0, 6}, {93, 10}, {0, 6}, {93, 10}},
+	{{88, 16}, {84, 24}},
+}
+
+// errorEvents are the events the "error" key of event_songs stands for.
+var errorEvents = []string{
+	"cliff_reflex", "wheel_drop", "thermal_stop", "full_mode_reverted", "geofence", "estop", "disconnected",
+}
+
+// announceableEvents are the keys event_songs accepts.
+var announceableEvents = []string{
+	"bump", "cliff", "wheel_drop", "button_pressed", "dock_detected", "docked", "low_battery",
+	"stuck", "full_mode_reverted", "cliff_reflex", "bump_reflex", "idle_sleep", "idle_wake",
+	"thermal_stop", "thermal_resume", "geofence", "estop", "estop_released", "slip", "disconnected",
+	"reconnected", "error",
+}
+
+// parseSongs checks the songs attribute and converts it to notes by slot.
+func parseSongs(songs map[string][][]int) (map[byte][]songNote, error) {
+	parsed := map[byte][]songNote{}
+	for key, notes := range songs {
+		slot, err := strconv.Atoi(key)
+		if err != nil || slot < 0 || slot > maxEventSong {
+			return nil, fmt.Errorf("songs: %q is not a song number in [0, %d]", key, maxEventSong)
+		}
+		if len(notes) == 0 || len(notes) > 16 {
+			return nil, fmt.Errorf("songs %s: must have between 1 and 16 notes, got %d", key, len(notes))
+		}
+		for i, n := range notes {
+			if len(n) != 2 {
+				return nil, fmt.Errorf("songs %s: note %d must be [note, duration]", key, i)
+			}
+			if n[0] != 0 && (n[0] < 31 || n[0] > 107) {
+				return nil, fmt.Errorf("songs %s: note %d must be a MIDI note in [31, 107], or 0 for a rest", key, i)
+			}
+			if n[1] < 1 || n[1] > 255 {
+				return nil, fmt.Errorf("songs %s: note %d duration must be in [1, 255] 64ths of a second", key, i)
+			}
+			parsed[byte(slot)] = append(parsed[byte(slot)], songNote{note: byte(n[0]), duration: byte(n[1])})
+		}
+	}
+	return parsed, nil
+}
+
+// validateEventSongs checks the event_songs attribute.
+func validateEventSongs(eventSongs map[string]int) error {
+	for kind, slot := range eventSongs {
+		known := false
+		for _, k := range announceableEvents {
+			known = known || k == kind
+		}
+		if !known {
+			return fmt.Errorf("event_songs: unknown event type %q", kind)
+		}
+		if slot < 0 || slot > maxEventSong {
+			return fmt.Errorf("event_songs %s: song must be in [0, %d]", kind, maxEventSong)
+		}
+	}
+	return nil
+}
+
+// songFor returns the song slot and notes to play for an event kind, and
+// whether it has one. An event named in event_songs wins over "error".
+func (s *viamRoombaBase) songFor(kind string) (byte, []songNote, bool) {
+	slot, ok := s.eventSongs[kind]
+	if !ok {
+		for _, k := range errorEvents {
+			if k == kind {
+				slot, ok = s.eventSongs["error"]
+				break
+			}
+		}
+	}
+	if !ok {
+		return 0, nil, false
+	}
+	notes, defined := s.songs[byte(slot)]
+	if !defined {
+		notes = presetSongs[slot]
+	}
+	return byte(slot), notes, true
+}
+
+// announceEvents plays the configured song for each event the base's
+// observer queues, until the base is closed. An event is dropped if its
+// song played less than eventSongInterval ago, or another song is still
+// playing.
+func (s *viamRoombaBase) announceEvents() {
+	lastPlayed := map[string]time.Time{}
+	var playingUntil time.Time
+	for {
+		var kind string
+		select {
+		case <-s.cancelCtx.Done():
+			return
+		case kind = <-s.announcements:
+		}
+
+		slot, notes, ok := s.songFor(kind)
+		if !ok || s.quiet() {
+			continue
+		}
+		now := s.clk.Now()
+		if now.Before(playingUntil) || now.Sub(lastPlayed[kind]) < s.eventSongInterval {
+			continue
+		}
+		played, err := s.playEventSong(kind, slot, notes)
+		if err != nil {
+			s.logger.Warnf("Failed to play the song for a %s event: %v", kind, err)
+			continue
+		}
+		if !played {
+			continue
+		}
+		lastPlayed[kind], playingUntil = now, now.Add(songLength(notes))
+	}
+}
+
+// playEventSong plays an event's song and reports whether it did. Songs
+// only play in Safe or Full mode, so in Passive mode the OI is switched to
+// Safe for the song and back to Passive after it, unless the robot is
+// cleaning or looking for its dock, which Safe mode would abort. Once the
+// robot has docked, though, the search is over. If a command takes the
+// robot over while the song plays, the OI is left as that command set it.
+func (s *viamRoombaBase) playEventSong(kind string, slot byte, notes []songNote) (bool, error) {
+	if err := s.conn.mu.LockContext(s.cancelCtx); err != nil {
+		return false, nil
+	}
+	passive := s.conn.mode == oiPassive
+	activity, _ := s.conn.activity.current()
+	switch {
+	case s.conn.mode == oiSafe || s.conn.mode == oiFull:
+	case !passive, activity == "clean", activity == "docking" && kind != "docked":
+		s.conn.mu.Unlock()
+		return false, nil
+	default:
+		if err := s.conn.setMode(oiSafe); err != nil {
+			s.conn.mu.Unlock()
+			return false, err
+		}
+	}
+	err := s.conn.defineSong(slot, notes)
+	if err == nil {
+		err = s.conn.playSong(slot)
+	}
+	if !passive {
+		s.conn.mu.Unlock()
+		return err == nil, err
+	}
+	if err == nil {
+		// Leaving Safe mode cuts the song short, so wait for it to finish
+		// without holding the bus.
+		s.conn.mu.Unlock()
+		timer := s.clk.Timer(songLength(notes))
+		select {
+		case <-timer.C:
+		case <-s.cancelCtx.Done():
+			timer.Stop()
+		}
+		if err := s.conn.mu.LockContext(s.cancelCtx); err != nil {
+			return true, nil
+		}
+	}
+	defer s.conn.mu.Unlock()
+	if current, _ := s.conn.activity.current(); s.conn.mode == oiSafe && current == activity {
+		if err := s.conn.setMode(oiPassive); err != nil {
+			s.logger.Warnf("Failed to return to Passive mode after an event song: %v", err)
+		}
+	}
+	return err == nil, err
+}
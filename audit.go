@@ -0,0 +1,139 @@
+package viamroomba
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAuditLogMaxMB = 10
+	defaultAuditLogFiles = 3
+)
+
+// auditEntry is one line of the audit log.
+type auditEntry struct {
+	Time    time.Time      `json:"time"`
+	Kind    string         `json:"kind"` // motion, do_command, mode_change, or event
+	Command string         `json:"command"`
+	Params  map[string]any `json:"params,omitempty"`
+	Outcome string         `json:"outcome"` // ok or error
+	Error   string         `json:"error,omitempty"`
+}
+
+// auditLog appends JSON lines to a file, rotating it to path.1, path.2, ...
+// once it grows past maxBytes and keeping at most keep old files. A nil
+// auditLog discards everything, so callers needn't check whether it's on.
+type auditLog struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	keep     int
+	f        *os.File
+	size     int64
+}
+
+// auditLogPath returns where a component's audit log goes by default: the
+// module data directory, or "" if there is none.
+func auditLogPath(name string) string {
+	dir := os.Getenv("VIAM_MODULE_DATA")
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "audit_"+unsafeFileChars.ReplaceAllString(name, "_")+".jsonl")
+}
+
+func openAuditLog(path string, maxBytes int64, keep int) (*auditLog, error) {
+	a := &auditLog{path: path, maxBytes: maxBytes, keep: keep}
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *auditLog) open() error {
+	f, err := os.OpenFile(a.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	a.f, a.size = f, info.Size()
+	return nil
+}
+
+// write appends an entry, rotating first if the file is full. Errors are
+// returned rather than logged so the caller can decide how loud to be.
+func (a *auditLog) write(entry auditEntry) error {
+	if a == nil {
+		return nil
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.f == nil {
+		return fmt.Errorf("audit log is closed")
+	}
+	if a.size > 0 && a.size+int64(len(line)) > a.maxBytes {
+		if err := a.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := a.f.Write(line)
+	a.size += int64(n)
+	return err
+}
+
+// rotate shifts path.N-1 to path.N (dropping the oldest), moves the current
+// file to path.1, and starts a new one. Callers must hold a.mu.
+func (a *auditLog) rotate() error {
+	a.f.Close()
+	a.f = nil
+	os.Remove(fmt.Sprintf("%s.%d", a.path, a.keep))
+	for i := a.keep - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", a.path, i), fmt.Sprintf("%s.%d", a.path, i+1))
+	}
+	if a.keep > 0 {
+		os.Rename(a.path, a.path+".1")
+	} else {
+		os.Remove(a.path)
+	}
+	return a.open()
+}
+
+func (a *auditLog) Close() error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.f == nil {
+		return nil
+	}
+	err := a.f.Close()
+	a.f = nil
+	return err
+}
+
+// audit records a command and its outcome in the base's audit log, if any.
+func (s *viamRoombaBase) audit(kind, command string, params map[string]any, err error) {
+	entry := auditEntry{Time: time.Now().UTC(), Kind: kind, Command: command, Params: params, Outcome: "ok"}
+	if err != nil {
+		entry.Outcome = "error"
+		entry.Error = err.Error()
+	}
+	if werr := s.auditLog.write(entry); werr != nil {
+		s.warnings.Warnf("audit", "Failed to write audit log: %v", werr)
+	}
+}
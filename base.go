@@ -1,105 +1,539 @@
 package viamroomba
 
 import (
+	"cmp"
 	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"math"
+	"reflect"
 	"time"
 
+	"github.com/benbjohnson/clock"
 	"github.com/golang/geo/r3"
 	base "go.viam.com/rdk/components/base"
+	"go.viam.com/rdk/components/movementsensor"
 	"go.viam.com/rdk/logging"
 	"go.viam.com/rdk/operation"
 	"go.viam.com/rdk/resource"
 	"go.viam.com/rdk/spatialmath"
 )
 
-var (
-	Base             = resource.NewModel("jalen", "viam-roomba", "base")
-	errUnimplemented = errors.New("unimplemented")
-)
-
-func init() {
-	resource.RegisterComponent(base.API, Base,
-		resource.Registration[base.Base, *Config]{
-			Constructor: newViamRoombaBase,
-		},
-	)
-}
+var errUnimplemented = errors.New("unimplemented")
 
 type Config struct {
-	SerialPort           string `json:"serial_port"`
+	SerialPort           string `json:"serial_port,omitempty"`
+	Controller           string `json:"controller,omitempty"`
+	StartAttempts        int    `json:"start_attempts,omitempty"`
+	OIProfile            string `json:"oi_profile,omitempty"`
+	SyncClockOnConnect   bool   `json:"sync_clock_on_connect,omitempty"`
 	WidthMM              int    `json:"width_mm,omitempty"`
 	WheelCircumferenceMM int    `json:"wheel_circumference_mm,omitempty"`
+	DiameterMM           int    `json:"diameter_mm,omitempty"`
+	HeightMM             int    `json:"height_mm,omitempty"`
+
+	PowerDeadband     float64 `json:"power_deadband,omitempty"`
+	PowerExpo         float64 `json:"power_expo,omitempty"`
+	LinearPowerScale  float64 `json:"linear_power_scale,omitempty"`
+	AngularPowerScale float64 `json:"angular_power_scale,omitempty"`
+	DriveStyle        string  `json:"drive_style,omitempty"`
+
+	MaxReverseVelocityMMPerSec int  `json:"max_reverse_velocity_mm_s,omitempty"`
+	ReverseBeep                bool `json:"reverse_beep,omitempty"`
+
+	OnClose string `json:"on_close,omitempty"`
+
+	MetricsLogIntervalSec int  `json:"metrics_log_interval_sec,omitempty"`
+	ModeCheckIntervalSec  int  `json:"mode_check_interval_sec,omitempty"`
+	ReassertMode          bool `json:"reassert_mode,omitempty"`
+	DebugSerial           bool `json:"debug_serial,omitempty"`
+
+	StopRetries int `json:"stop_retries,omitempty"`
+
+	NonBlockingMotion bool `json:"non_blocking_motion,omitempty"`
+
+	CliffReflex bool `json:"cliff_reflex,omitempty"`
+	BumpReflex  bool `json:"bump_reflex,omitempty"`
+
+	HeadingHold   bool    `json:"heading_hold,omitempty"`
+	HeadingHoldKp float64 `json:"heading_hold_kp,omitempty"`
+	HeadingHoldKi float64 `json:"heading_hold_ki,omitempty"`
+	HeadingHoldKd float64 `json:"heading_hold_kd,omitempty"`
+
+	AdaptiveSpeed             bool `json:"adaptive_speed,omitempty"`
+	CarpetMaxVelocityMMPerSec int  `json:"carpet_max_velocity_mm_s,omitempty"`
+	CarpetSignalThreshold     int  `json:"carpet_signal_threshold,omitempty"`
+	WheelCurrentLimitMA       int  `json:"wheel_current_limit_ma,omitempty"`
+
+	AuditLog      bool   `json:"audit_log,omitempty"`
+	AuditLogPath  string `json:"audit_log_path,omitempty"`
+	AuditLogMaxMB int    `json:"audit_log_max_mb,omitempty"`
+	AuditLogFiles int    `json:"audit_log_files,omitempty"`
+
+	AllowFullMode          bool   `json:"allow_full_mode,omitempty"`
+	FullModeToken          string `json:"full_mode_token,omitempty"`
+	FullModeTimeoutSec     int    `json:"full_mode_timeout_sec,omitempty"`
+	FullModeCliffThreshold int    `json:"full_mode_cliff_threshold,omitempty"`
+
+	IdleTimeoutMin float64 `json:"idle_timeout_min,omitempty"`
+	IdleAction     string  `json:"idle_action,omitempty"`
+
+	KeepAwake            string `json:"keep_awake,omitempty"`
+	KeepAwakeIntervalSec int    `json:"keep_awake_interval_sec,omitempty"`
+	BRCLine              string `json:"brc_line,omitempty"`
+
+	ThermalLimitC  int `json:"thermal_limit_c,omitempty"`
+	ThermalResumeC int `json:"thermal_resume_c,omitempty"`
+
+	StrictLimits bool    `json:"strict_limits,omitempty"`
+	PayloadKg    float64 `json:"payload_kg,omitempty"`
+	DryRun       bool    `json:"dry_run,omitempty"`
+
+	GeofenceRadiusMM float64 `json:"geofence_radius_mm,omitempty"`
+
+	MovementSensor       string  `json:"movement_sensor,omitempty"`
+	MovementSensorWeight float64 `json:"movement_sensor_weight,omitempty"`
+
+	EStop *EStopConfig `json:"estop,omitempty"`
+
+	QuietHours *QuietHoursConfig `json:"quiet_hours,omitempty"`
+
+	SpeedZones []SpeedZoneConfig `json:"speed_zones,omitempty"`
+
+	DistanceScale float64 `json:"distance_scale,omitempty"`
+	AngleScale    float64 `json:"angle_scale,omitempty"`
+
+	ClosedLoopMotion  bool    `json:"closed_loop_motion,omitempty"`
+	LinearAccelMMS2   float64 `json:"linear_accel_mm_s2,omitempty"`
+	AngularAccelDegS2 float64 `json:"angular_accel_deg_s2,omitempty"`
+
+	Songs                map[string][][]int `json:"songs,omitempty"`
+	EventSongs           map[string]int     `json:"event_songs,omitempty"`
+	EventSongIntervalSec int                `json:"event_song_interval_sec,omitempty"`
 }
 
 func (cfg *Config) Validate(path string) ([]string, []string, error) {
-	if cfg.SerialPort == "" {
-		return nil, nil, fmt.Errorf("%s: serial_port is required", path)
+	deps, err := validateConnection(cfg.SerialPort, cfg.Controller)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateStartAttempts(cfg.StartAttempts); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateOIProfile(cfg.OIProfile); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
 	}
 
-	if cfg.WidthMM < 0 {
-		return nil, nil, fmt.Errorf("%s: width_mm must be a positive number", path)
+	// Zero means "use the default"; anything else must be physically plausible.
+	if cfg.WidthMM != 0 && (cfg.WidthMM < 100 || cfg.WidthMM > 500) {
+		return nil, nil, fmt.Errorf("%s: width_mm must be between 100 and 500, got %d", path, cfg.WidthMM)
+	}
+	if cfg.WheelCircumferenceMM != 0 && (cfg.WheelCircumferenceMM < 100 || cfg.WheelCircumferenceMM > 600) {
+		return nil, nil, fmt.Errorf("%s: wheel_circumference_mm must be between 100 and 600, got %d", path, cfg.WheelCircumferenceMM)
+	}
+	if cfg.DiameterMM < 0 {
+		return nil, nil, fmt.Errorf("%s: diameter_mm must be a positive number", path)
+	}
+	if cfg.HeightMM < 0 {
+		return nil, nil, fmt.Errorf("%s: height_mm must be a positive number", path)
+	}
+	if cfg.PowerDeadband < 0 || cfg.PowerDeadband >= 1 {
+		return nil, nil, fmt.Errorf("%s: power_deadband must be in [0, 1)", path)
+	}
+	if cfg.PowerExpo < 0 || cfg.PowerExpo > 1 {
+		return nil, nil, fmt.Errorf("%s: power_expo must be in [0, 1]", path)
+	}
+	if cfg.LinearPowerScale < 0 || cfg.LinearPowerScale > 1 {
+		return nil, nil, fmt.Errorf("%s: linear_power_scale must be in [0, 1]", path)
+	}
+	if cfg.AngularPowerScale < 0 || cfg.AngularPowerScale > 1 {
+		return nil, nil, fmt.Errorf("%s: angular_power_scale must be in [0, 1]", path)
+	}
+	switch cfg.DriveStyle {
+	case "", "arcade", "curvature":
+	default:
+		return nil, nil, fmt.Errorf("%s: drive_style must be one of arcade, curvature", path)
+	}
+	if cfg.MaxReverseVelocityMMPerSec < 0 || cfg.MaxReverseVelocityMMPerSec > 500 {
+		return nil, nil, fmt.Errorf("%s: max_reverse_velocity_mm_s must be in [0, 500]", path)
+	}
+	switch cfg.OnClose {
+	case "", "stop", "passive", "seek_dock", "power_off":
+	default:
+		return nil, nil, fmt.Errorf("%s: on_close must be one of stop, passive, seek_dock, power_off", path)
+	}
+	if cfg.MetricsLogIntervalSec < 0 {
+		return nil, nil, fmt.Errorf("%s: metrics_log_interval_sec must be a positive number", path)
+	}
+	if cfg.StopRetries < 0 {
+		return nil, nil, fmt.Errorf("%s: stop_retries must be a positive number", path)
+	}
+	if cfg.HeadingHoldKp < 0 || cfg.HeadingHoldKi < 0 || cfg.HeadingHoldKd < 0 {
+		return nil, nil, fmt.Errorf("%s: heading_hold_kp, heading_hold_ki, and heading_hold_kd must be positive numbers", path)
+	}
+	if cfg.CarpetMaxVelocityMMPerSec < 0 || cfg.CarpetMaxVelocityMMPerSec > 500 {
+		return nil, nil, fmt.Errorf("%s: carpet_max_velocity_mm_s must be in [0, 500]", path)
+	}
+	if cfg.CarpetSignalThreshold < 0 {
+		return nil, nil, fmt.Errorf("%s: carpet_signal_threshold must be a positive number", path)
+	}
+	if cfg.WheelCurrentLimitMA < 0 {
+		return nil, nil, fmt.Errorf("%s: wheel_current_limit_ma must be a positive number", path)
+	}
+	if cfg.AuditLogMaxMB < 0 {
+		return nil, nil, fmt.Errorf("%s: audit_log_max_mb must be a positive number", path)
+	}
+	if cfg.AuditLogFiles < 0 {
+		return nil, nil, fmt.Errorf("%s: audit_log_files must be a positive number", path)
 	}
-	if cfg.WheelCircumferenceMM < 0 {
-		return nil, nil, fmt.Errorf("%s: wheel_circumference_mm must be a positive number", path)
+	if cfg.FullModeTimeoutSec < 0 {
+		return nil, nil, fmt.Errorf("%s: full_mode_timeout_sec must be a positive number", path)
+	}
+	if cfg.FullModeCliffThreshold < 0 || cfg.FullModeCliffThreshold > 4095 {
+		return nil, nil, fmt.Errorf("%s: full_mode_cliff_threshold must be in [0, 4095]", path)
+	}
+	if cfg.IdleTimeoutMin < 0 {
+		return nil, nil, fmt.Errorf("%s: idle_timeout_min must be a positive number", path)
+	}
+	switch cfg.IdleAction {
+	case "", "passive", "power_off":
+	default:
+		return nil, nil, fmt.Errorf("%s: idle_action must be one of passive, power_off", path)
+	}
+	if cfg.IdleAction != "" && cfg.IdleTimeoutMin == 0 {
+		return nil, nil, fmt.Errorf("%s: idle_action requires idle_timeout_min", path)
+	}
+	switch cfg.KeepAwake {
+	case "", "opcode", "brc":
+	default:
+		return nil, nil, fmt.Errorf("%s: keep_awake must be one of opcode, brc", path)
+	}
+	switch cfg.BRCLine {
+	case "", "rts", "dtr":
+	default:
+		return nil, nil, fmt.Errorf("%s: brc_line must be one of rts, dtr", path)
+	}
+	if cfg.ModeCheckIntervalSec < 0 || cfg.ModeCheckIntervalSec > 300 {
+		return nil, nil, fmt.Errorf("%s: mode_check_interval_sec must be in [0, 300]", path)
+	}
+	if cfg.KeepAwakeIntervalSec < 0 || cfg.KeepAwakeIntervalSec >= 300 {
+		return nil, nil, fmt.Errorf("%s: keep_awake_interval_sec must be in [0, 300)", path)
+	}
+	if cfg.KeepAwake == "" && (cfg.KeepAwakeIntervalSec != 0 || cfg.BRCLine != "") {
+		return nil, nil, fmt.Errorf("%s: keep_awake_interval_sec and brc_line require keep_awake", path)
+	}
+	if cfg.KeepAwake != "" && cfg.IdleTimeoutMin != 0 {
+		return nil, nil, fmt.Errorf("%s: keep_awake and idle_timeout_min cannot both be set", path)
+	}
+	if cfg.ThermalLimitC < 0 || cfg.ThermalLimitC > 127 {
+		return nil, nil, fmt.Errorf("%s: thermal_limit_c must be in [0, 127]", path)
+	}
+	if cfg.ThermalResumeC < 0 {
+		return nil, nil, fmt.Errorf("%s: thermal_resume_c must be a positive number", path)
+	}
+	if cfg.ThermalResumeC != 0 && cfg.ThermalLimitC == 0 {
+		return nil, nil, fmt.Errorf("%s: thermal_resume_c requires thermal_limit_c", path)
+	}
+	if cfg.ThermalResumeC != 0 && cfg.ThermalResumeC >= cfg.ThermalLimitC {
+		return nil, nil, fmt.Errorf("%s: thermal_resume_c must be below thermal_limit_c", path)
+	}
+	if cfg.MovementSensor != "" {
+		deps = append(deps, cfg.MovementSensor)
+	}
+	if cfg.EStop != nil {
+		dep, err := cfg.EStop.validate()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", path, err)
+		}
+		deps = append(deps, dep)
+	}
+	if cfg.QuietHours != nil {
+		if err := cfg.QuietHours.validate(); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if err := validateSpeedZones(cfg.SpeedZones); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateOdometryScale("distance_scale", cfg.DistanceScale); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateOdometryScale("angle_scale", cfg.AngleScale); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if cfg.MovementSensorWeight < 0 || cfg.MovementSensorWeight > 1 {
+		return nil, nil, fmt.Errorf("%s: movement_sensor_weight must be in [0, 1]", path)
+	}
+	if cfg.MovementSensorWeight != 0 && cfg.MovementSensor == "" {
+		return nil, nil, fmt.Errorf("%s: movement_sensor_weight requires movement_sensor", path)
+	}
+	if cfg.PayloadKg < 0 || cfg.PayloadKg > maxPayloadKg {
+		return nil, nil, fmt.Errorf("%s: payload_kg must be in [0, %g]", path, maxPayloadKg)
+	}
+	if cfg.GeofenceRadiusMM < 0 {
+		return nil, nil, fmt.Errorf("%s: geofence_radius_mm must be a positive number", path)
+	}
+	if cfg.LinearAccelMMS2 < 0 || cfg.AngularAccelDegS2 < 0 {
+		return nil, nil, fmt.Errorf("%s: linear_accel_mm_s2 and angular_accel_deg_s2 must be positive numbers", path)
+	}
+	if !cfg.ClosedLoopMotion && (cfg.LinearAccelMMS2 != 0 || cfg.AngularAccelDegS2 != 0) {
+		return nil, nil, fmt.Errorf("%s: linear_accel_mm_s2 and angular_accel_deg_s2 require closed_loop_motion", path)
+	}
+	if _, err := parseSongs(cfg.Songs); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateEventSongs(cfg.EventSongs); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if cfg.EventSongIntervalSec < 0 {
+		return nil, nil, fmt.Errorf("%s: event_song_interval_sec must be a positive number", path)
+	}
+	if len(cfg.EventSongs) == 0 && (len(cfg.Songs) != 0 || cfg.EventSongIntervalSec != 0) {
+		return nil, nil, fmt.Errorf("%s: songs and event_song_interval_sec require event_songs", path)
+	}
+	if !cfg.AllowFullMode && (cfg.FullModeToken != "" || cfg.FullModeTimeoutSec != 0 || cfg.FullModeCliffThreshold != 0) {
+		return nil, nil, fmt.Errorf("%s: full_mode_token, full_mode_timeout_sec, and full_mode_cliff_threshold require allow_full_mode", path)
 	}
 
-	return nil, nil, nil
+	return deps, nil, nil
 }
 
-type viamRoombaBase struct {
-	resource.AlwaysRebuild
+// warnings returns human-readable notes about settings that are valid but
+// probably not what the user meant. They are logged when the base is built.
+func (cfg *Config) warnings() []string {
+	var warnings []string
+	if cfg.DiameterMM != 0 && cfg.WidthMM != 0 && cfg.DiameterMM < cfg.WidthMM {
+		warnings = append(warnings, fmt.Sprintf(
+			"diameter_mm (%d) is smaller than width_mm (%d); the collision geometry won't cover the wheels",
+			cfg.DiameterMM, cfg.WidthMM))
+	}
+	if cfg.WidthMM != 0 && math.Abs(float64(cfg.WidthMM)-235) > 235*0.2 {
+		warnings = append(warnings, fmt.Sprintf(
+			"width_mm (%d) is more than 20%% off the Roomba 600 series' 235mm; spin and turn rates will be scaled to match",
+			cfg.WidthMM))
+	}
+	if cfg.WheelCircumferenceMM != 0 && math.Abs(float64(cfg.WheelCircumferenceMM)-220) > 220*0.2 {
+		warnings = append(warnings, fmt.Sprintf(
+			"wheel_circumference_mm (%d) is more than 20%% off the Roomba 600 series' 220mm",
+			cfg.WheelCircumferenceMM))
+	}
+	if cfg.PowerDeadband > 0.5 {
+		warnings = append(warnings, fmt.Sprintf(
+			"power_deadband (%.2f) ignores more than half of the SetPower input range", cfg.PowerDeadband))
+	}
+	return warnings
+}
 
+type viamRoombaBase struct {
 	name   resource.Name
 	logger logging.Logger
-	cfg    *Config
+	// warnings logs the warnings that can repeat with every call, such as
+	// clamping, without flooding the log.
+	warnings *logDamper
+	cfg      *Config
+	// withDefaults fills in the model's default dimensions, so Reconfigure
+	// compares configs the way the constructor saw them.
+	withDefaults func(*Config) *Config
+	// model is the model the base was built as, or empty if it was built
+	// by NewBase directly.
+	model string
 
 	conn       *roombaConn
 	serialPort string
 
 	widthMM              int
 	wheelCircumferenceMM int
+	diameterMM           int
+	heightMM             int
+
+	powerDeadband     float64
+	powerExpo         float64
+	linearPowerScale  float64
+	angularPowerScale float64
+	curvatureDrive    bool
+
+	maxReverseVelocity int16
+	reverseBeep        bool
+	reversing          bool
+	// forward is whether the last drive command moves the robot forward,
+	// the only motion the reflexes guard. Guarded by conn.mu.
+	forward     bool
+	cliffReflex bool
+	bumpReflex  bool
+
+	onClose     string
+	stopRetries int
+
+	nonBlockingMotion bool
+	motion            motionState
+	motions           chan *motionGoal
+	path              pathProgress
+
+	headingHold   bool
+	headingHoldKp float64
+	headingHoldKi float64
+	headingHoldKd float64
+
+	// speedLimit caps drive speed on thick carpet when adaptive_speed is
+	// enabled; otherwise it never limits.
+	speedLimit            speedLimiter
+	carpetSignalThreshold int
+	wheelCurrentLimitMA   int
+
+	removeModeObserver  func()
+	removeEventObserver func()
+	removeTracer        func()
+
+	// modeMismatches carries the mode the robot dropped out of to
+	// watchMode, if reassert_mode is set; nil otherwise.
+	modeMismatches chan oiMode
+
+	// auditLog is nil unless audit_log is enabled.
+	auditLog *auditLog
+
+	commands commandSet
+
+	// Full mode interlocks. stopFullModeWatch ends the watchdog started by
+	// the last enter_full_mode, and is guarded by conn.mu.
+	allowFullMode          bool
+	fullModeToken          string
+	fullModeTimeout        time.Duration
+	fullModeCliffThreshold int
+	stopFullModeWatch      func()
+
+	// Idle policy; idleTimeout is zero when disabled. asleep is whether the
+	// policy put the robot to sleep, and is guarded by conn.mu.
+	idleTimeout time.Duration
+	idleAction  string
+	idleSince   time.Time
+	asleep      bool
+
+	// keepAwakeMethod is "opcode" or "brc" if keep_awake is enabled.
+	keepAwakeMethod string
+	brcLine         string
+
+	thermal thermalState
+	estop   estopState
+	// quietHours is nil unless quiet_hours is configured.
+	quietHours *quietHours
+
+	// closedLoopMotion ends MoveStraight and Spin on odometry, following a
+	// trapezoidal profile with these accelerations.
+	closedLoopMotion bool
+	linearAccel      float64
+	angularAccel     float64
+
+	// strictLimits refuses out-of-range commands instead of clamping them.
+	strictLimits bool
+	// maxVelocity is the fastest the base drives a wheel, in mm/s: the
+	// Drive command's limit, derated for payload_kg. stuckFactor is how
+	// many times its nominal time a closed-loop segment may take.
+	maxVelocity float64
+	stuckFactor float64
+	// dryRun is the simulation motion commands drive instead of the robot,
+	// or nil unless dry_run is enabled.
+	dryRun *simulation
+	// routes records teleop sessions for replay.
+	routes *routeRecorder
+
+	geofence   geofenceState
+	speedZones speedZoneState
+
+	// gyro is the movement sensor's heading, fused with the angle packet,
+	// or nil unless movement_sensor is set.
+	gyro *gyroHeading
+
+	// Event songs. announcements queues event kinds from the event observer
+	// for announceEvents, and is nil when event_songs is empty.
+	songs             map[byte][]songNote
+	eventSongs        map[string]int
+	eventSongInterval time.Duration
+	announcements     chan string
+
+	// lastCounts is the encoder counts IsMoving last read, and calibration
+	// the odometry calibration run in progress. Guarded by conn.mu.
+	lastCounts  countsSample
+	calibration odometryCalibration
 
 	opMgr *operation.SingleOperationManager
 
+	// clk drives motion timers so they can be replaced by a mock clock.
+	clk clock.Clock
+
 	cancelCtx  context.Context
 	cancelFunc func()
 }
 
-func newViamRoombaBase(ctx context.Context, deps resource.Dependencies, rawConf resource.Config, logger logging.Logger) (base.Base, error) {
-	conf, err := resource.NativeConfig[*Config](rawConf)
+// baseClock returns the clock a new base runs its timers on. Tests replace it
+// with a mock to step through timed motions.
+var baseClock = clock.New
+
+func NewBase(ctx context.Context, deps resource.Dependencies, name resource.Name, conf *Config, logger logging.Logger) (base.Base, error) {
+	for _, w := range conf.warnings() {
+		logger.Warnf("Suspicious config: %s", w)
+	}
+
+	serialPort, err := resolveSerialPort(deps, conf.SerialPort, conf.Controller)
+	if err != nil {
+		return nil, err
+	}
+	var imu movementsensor.MovementSensor
+	var gyro *gyroHeading
+	if conf.MovementSensor != "" {
+		if imu, gyro, err = resolveGyro(ctx, deps, conf); err != nil {
+			return nil, err
+		}
+	}
+	var estop *estopInput
+	if conf.EStop != nil {
+		if estop, err = resolveEStop(deps, conf.EStop); err != nil {
+			return nil, err
+		}
+	}
+	var quiet *quietHours
+	if conf.QuietHours != nil {
+		if quiet, err = conf.QuietHours.build(); err != nil {
+			return nil, err
+		}
+	}
+	profile, err := lookupOIProfile(conf.OIProfile)
 	if err != nil {
 		return nil, err
 	}
 
-	return NewBase(ctx, deps, rawConf.ResourceName(), conf, logger)
-}
-
-func NewBase(ctx context.Context, deps resource.Dependencies, name resource.Name, conf *Config, logger logging.Logger) (base.Base, error) {
 	cancelCtx, cancelFunc := context.WithCancel(context.Background())
 
-	conn, err := acquireConn(conf.SerialPort)
+	conn, err := acquireConn(serialPort, conf.StartAttempts, profile)
 	if err != nil {
 		cancelFunc()
 		return nil, err
 	}
+	warnProfile(logger, conn, profile)
+	if conf.SyncClockOnConnect {
+		conn.enableClockSync(ctx, logger)
+	}
+	// The scales correct the shared odometry, so every component on the
+	// port sees the same corrected pose.
+	conn.odom.setScales(conf.DistanceScale, conf.AngleScale)
 
 	// Only enter Safe mode if the OI is currently off (mode == 0).
 	// If it's already in Passive/Safe/Full, leave the current mode alone so
 	// that a component rebuild (AlwaysRebuild) doesn't silently override a
 	// mode the user intentionally set (e.g. Passive for charging).
-	conn.mu.Lock()
-	modeData, modeErr := conn.roomba.Sensors(35)
-	if modeErr != nil || len(modeData) == 0 || modeData[0] == 0 {
+	if err := conn.mu.LockContext(ctx); err != nil {
+		cancelFunc()
+		releaseConn(conn)
+		return nil, err
+	}
+	mode, modeErr := conn.syncMode()
+	if modeErr != nil || mode == oiOff {
 		// OI is off (or unreadable) — send Safe to start it up.
-		if err := conn.roomba.Safe(); err != nil {
+		if err := conn.setMode(oiSafe); err != nil {
 			conn.mu.Unlock()
 			cancelFunc()
-			releaseConn(conf.SerialPort)
-			return nil, fmt.Errorf("failed to enter Safe mode: %w", err)
+			releaseConn(conn)
+			return nil, err
 		}
 	}
 	conn.mu.Unlock()
@@ -112,22 +546,286 @@ func NewBase(ctx context.Context, deps resource.Dependencies, name resource.Name
 	if wheelCircumferenceMM == 0 {
 		wheelCircumferenceMM = 220
 	}
+	diameterMM := conf.DiameterMM
+	if diameterMM == 0 {
+		diameterMM = 340
+	}
+	heightMM := conf.HeightMM
+	if heightMM == 0 {
+		heightMM = 92
+	}
+	linearPowerScale := conf.LinearPowerScale
+	if linearPowerScale == 0 {
+		linearPowerScale = 1
+	}
+	angularPowerScale := conf.AngularPowerScale
+	if angularPowerScale == 0 {
+		angularPowerScale = 1
+	}
+	onClose := conf.OnClose
+	if onClose == "" {
+		onClose = "stop"
+	}
+	stopRetries := conf.StopRetries
+	if stopRetries == 0 {
+		stopRetries = 3
+	}
+	// A payload derates the top speed and the default accelerations, and
+	// gives closed-loop segments longer before they count as stuck.
+	derate := payloadDerate(conf.PayloadKg)
+	maxVelocity := math.Round(maxWheelVelocity * derate)
+	// The Roomba has no rear-facing sensors, so reverse is limited more
+	// tightly than forward by default.
+	maxReverseVelocity := conf.MaxReverseVelocityMMPerSec
+	if maxReverseVelocity == 0 {
+		maxReverseVelocity = 250
+	}
+	maxReverseVelocity = min(maxReverseVelocity, int(maxVelocity))
+	// Gains are only defaulted together, so setting any one of them (e.g.
+	// kd alone) doesn't silently keep the others.
+	headingHoldKp, headingHoldKi, headingHoldKd := conf.HeadingHoldKp, conf.HeadingHoldKi, conf.HeadingHoldKd
+	if headingHoldKp == 0 && headingHoldKi == 0 && headingHoldKd == 0 {
+		headingHoldKp, headingHoldKi, headingHoldKd = defaultHeadingHoldKp, defaultHeadingHoldKi, defaultHeadingHoldKd
+	}
+	carpetMaxVelocity := conf.CarpetMaxVelocityMMPerSec
+	if carpetMaxVelocity == 0 {
+		carpetMaxVelocity = defaultCarpetMaxVelocity
+	}
+	carpetSignalThreshold := conf.CarpetSignalThreshold
+	if carpetSignalThreshold == 0 {
+		carpetSignalThreshold = defaultCarpetSignalThreshold
+	}
+	wheelCurrentLimitMA := conf.WheelCurrentLimitMA
+	if wheelCurrentLimitMA == 0 {
+		wheelCurrentLimitMA = defaultWheelCurrentLimitMA + int(payloadCurrentMAPerKg*conf.PayloadKg)
+	}
+	fullModeCliffThreshold := conf.FullModeCliffThreshold
+	if fullModeCliffThreshold == 0 {
+		fullModeCliffThreshold = defaultEdgeSignalThreshold
+	}
+	idleAction := conf.IdleAction
+	if idleAction == "" {
+		idleAction = "passive"
+	}
+	keepAwakeInterval := time.Duration(conf.KeepAwakeIntervalSec) * time.Second
+	if keepAwakeInterval == 0 {
+		keepAwakeInterval = defaultKeepAwakeInterval
+	}
+	brcLine := conf.BRCLine
+	if brcLine == "" {
+		brcLine = "rts"
+	}
+	thermalResumeC := conf.ThermalResumeC
+	if thermalResumeC == 0 {
+		thermalResumeC = conf.ThermalLimitC - defaultThermalHysteresisC
+	}
+	linearAccel := conf.LinearAccelMMS2
+	if linearAccel == 0 {
+		linearAccel = defaultLinearAccel * derate
+	}
+	angularAccel := conf.AngularAccelDegS2
+	if angularAccel == 0 {
+		angularAccel = defaultAngularAccel * derate
+	}
+	songs, err := parseSongs(conf.Songs)
+	if err != nil {
+		cancelFunc()
+		releaseConn(conn)
+		return nil, err
+	}
+	routes, err := newRouteRecorder(newStateStore("base_" + name.Name))
+	if err != nil {
+		cancelFunc()
+		releaseConn(conn)
+		return nil, err
+	}
+	eventSongInterval := time.Duration(conf.EventSongIntervalSec) * time.Second
+	if eventSongInterval == 0 {
+		eventSongInterval = defaultEventSongInterval
+	}
 
 	s := &viamRoombaBase{
-		name:                 name,
-		logger:               logger,
-		cfg:                  conf,
-		conn:                 conn,
-		serialPort:           conf.SerialPort,
-		widthMM:              widthMM,
-		wheelCircumferenceMM: wheelCircumferenceMM,
-		opMgr:                operation.NewSingleOperationManager(),
-		cancelCtx:            cancelCtx,
-		cancelFunc:           cancelFunc,
+		name:                   name,
+		logger:                 logger,
+		warnings:               newLogDamper(logger),
+		cfg:                    conf,
+		withDefaults:           func(c *Config) *Config { return c },
+		conn:                   conn,
+		serialPort:             serialPort,
+		widthMM:                widthMM,
+		wheelCircumferenceMM:   wheelCircumferenceMM,
+		diameterMM:             diameterMM,
+		heightMM:               heightMM,
+		powerDeadband:          conf.PowerDeadband,
+		powerExpo:              conf.PowerExpo,
+		linearPowerScale:       linearPowerScale,
+		angularPowerScale:      angularPowerScale,
+		curvatureDrive:         conf.DriveStyle == "curvature",
+		maxReverseVelocity:     int16(maxReverseVelocity),
+		reverseBeep:            conf.ReverseBeep,
+		onClose:                onClose,
+		stopRetries:            stopRetries,
+		nonBlockingMotion:      conf.NonBlockingMotion,
+		cliffReflex:            conf.CliffReflex,
+		bumpReflex:             conf.BumpReflex,
+		headingHold:            conf.HeadingHold,
+		headingHoldKp:          headingHoldKp,
+		headingHoldKi:          headingHoldKi,
+		headingHoldKd:          headingHoldKd,
+		speedLimit:             speedLimiter{maxSpeed: int16(carpetMaxVelocity)},
+		carpetSignalThreshold:  carpetSignalThreshold,
+		wheelCurrentLimitMA:    wheelCurrentLimitMA,
+		allowFullMode:          conf.AllowFullMode,
+		fullModeToken:          conf.FullModeToken,
+		fullModeTimeout:        time.Duration(conf.FullModeTimeoutSec) * time.Second,
+		fullModeCliffThreshold: fullModeCliffThreshold,
+		stopFullModeWatch:      func() {},
+		idleTimeout:            time.Duration(conf.IdleTimeoutMin * float64(time.Minute)),
+		idleAction:             idleAction,
+		idleSince:              time.Now(),
+		keepAwakeMethod:        conf.KeepAwake,
+		brcLine:                brcLine,
+		thermal:                thermalState{limitC: conf.ThermalLimitC, resumeC: thermalResumeC},
+		estop:                  estopState{input: estop},
+		quietHours:             quiet,
+		geofence:               geofenceState{radiusMM: conf.GeofenceRadiusMM},
+		speedZones:             speedZoneState{zones: buildSpeedZones(conf.SpeedZones)},
+		gyro:                   gyro,
+		closedLoopMotion:       conf.ClosedLoopMotion,
+		strictLimits:           conf.StrictLimits,
+		maxVelocity:            maxVelocity,
+		stuckFactor:            payloadStuckFactor(conf.PayloadKg),
+		linearAccel:            linearAccel,
+		angularAccel:           angularAccel,
+		routes:                 routes,
+		songs:                  songs,
+		eventSongs:             conf.EventSongs,
+		eventSongInterval:      eventSongInterval,
+		motions:                make(chan *motionGoal),
+		opMgr:                  operation.NewSingleOperationManager(),
+		clk:                    baseClock(),
+		cancelCtx:              cancelCtx,
+		cancelFunc:             cancelFunc,
+	}
+
+	if conf.AuditLog {
+		path := conf.AuditLogPath
+		if path == "" {
+			path = auditLogPath("base_" + name.Name)
+		}
+		maxMB := conf.AuditLogMaxMB
+		if maxMB == 0 {
+			maxMB = defaultAuditLogMaxMB
+		}
+		files := conf.AuditLogFiles
+		if files == 0 {
+			files = defaultAuditLogFiles
+		}
+		if path == "" {
+			logger.Warn("audit_log is enabled but the module has no data directory and audit_log_path is unset; not auditing")
+		} else if s.auditLog, err = openAuditLog(path, int64(maxMB)<<20, files); err != nil {
+			logger.Warnf("Not auditing: %v", err)
+		}
+	}
+
+	if conf.DryRun {
+		s.dryRun = newSimulation(s.clk, widthMM, cmp.Or(conf.DiameterMM, 340), wheelCircumferenceMM)
+		logger.Warn("dry_run is enabled: motion commands are simulated and never sent to the robot")
+	}
+	if s.geofence.radiusMM > 0 {
+		s.recenter()
+	}
+
+	s.commands = s.newCommands()
+
+	s.removeModeObserver = conn.addModeObserver(func(from, to oiMode) {
+		logger.Infof("OI mode changed from %s to %s", from, to)
+		s.audit("mode_change", to.String(), map[string]any{"from": from.String()}, nil)
+	})
+	if len(s.eventSongs) > 0 {
+		s.announcements = make(chan string, 8)
+	}
+	if conf.ReassertMode {
+		s.modeMismatches = make(chan oiMode, 1)
+	}
+	s.removeEventObserver = conn.events.addObserver(func(e event) {
+		s.audit("event", e.kind, e.detail, nil)
+		if e.kind == "mode_mismatch" {
+			s.noteModeMismatch(e)
+		}
+		if e.kind == "docked" && s.geofence.radiusMM > 0 {
+			s.recenter()
+		}
+		if s.announcements != nil {
+			// The event may be recorded with the bus held, so the song
+			// is played elsewhere; if the queue is full it is dropped.
+			select {
+			case s.announcements <- e.kind:
+			default:
+			}
+		}
+	})
+
+	s.removeTracer = func() {}
+	if conf.DebugSerial {
+		s.removeTracer = conn.addTracer(logger)
+	}
+
+	goSafe(s.runMotions)
+
+	if conf.MetricsLogIntervalSec > 0 {
+		goSafe(func() { s.logMetrics(time.Duration(conf.MetricsLogIntervalSec) * time.Second) })
+	}
+
+	if conf.AdaptiveSpeed {
+		goSafe(s.monitorFloor)
+	}
+
+	if s.idleTimeout > 0 {
+		goSafe(s.watchIdle)
+	}
+
+	if s.keepAwakeMethod != "" {
+		goSafe(func() { s.keepAwake(keepAwakeInterval) })
+	}
+
+	if s.thermal.limitC > 0 {
+		goSafe(s.watchThermal)
+	}
+
+	if s.estop.input != nil {
+		goSafe(s.watchEStop)
+	}
+
+	if s.geofence.radiusMM > 0 {
+		goSafe(s.watchGeofence)
+	}
+
+	if s.quietHours != nil {
+		goSafe(s.watchQuietHours)
+	}
+
+	if len(s.speedZones.zones) > 0 {
+		goSafe(s.watchSpeedZones)
+	}
+
+	modeCheckInterval := time.Duration(conf.ModeCheckIntervalSec) * time.Second
+	if modeCheckInterval == 0 {
+		modeCheckInterval = defaultModeCheckInterval
+	}
+	goSafe(func() { s.watchMode(modeCheckInterval) })
+
+	if s.gyro != nil {
+		conn.odom.setGyro(s.gyro)
+		goSafe(func() { s.watchGyro(imu) })
+	}
+
+	if s.announcements != nil {
+		goSafe(s.announceEvents)
 	}
 
 	logger.Infof("Roomba base initialized on %s (width: %dmm, wheel circumference: %dmm)",
-		conf.SerialPort, widthMM, wheelCircumferenceMM)
+		serialPort, widthMM, wheelCircumferenceMM)
 
 	return s, nil
 }
@@ -136,67 +834,122 @@ func (s *viamRoombaBase) Name() resource.Name {
 	return s.name
 }
 
+// Reconfigure moves the base to a new serial port in place when that is the
+// only change, so its watchers, observers, and any data capture keep
+// running. Any other change rebuilds the base.
+func (s *viamRoombaBase) Reconfigure(ctx context.Context, deps resource.Dependencies, rawConf resource.Config) error {
+	conf, err := resource.NativeConfig[*Config](rawConf)
+	if err != nil {
+		return err
+	}
+	conf = s.withDefaults(conf)
+	unchanged := *conf
+	unchanged.SerialPort = s.cfg.SerialPort
+	if !reflect.DeepEqual(&unchanged, s.cfg) {
+		return resource.NewMustRebuildError(rawConf.ResourceName())
+	}
+
+	serialPort, err := resolveSerialPort(deps, conf.SerialPort, conf.Controller)
+	if err != nil {
+		return err
+	}
+	if connKey(serialPort) != connKey(s.serialPort) {
+		// Nothing may keep driving blind while the port changes hands.
+		s.opMgr.CancelRunning(ctx)
+		if err := moveConn(ctx, s.conn, serialPort); err != nil {
+			return err
+		}
+		s.logger.Infof("Roomba base moved from %s to %s", s.serialPort, serialPort)
+	}
+	s.cfg = conf
+	s.serialPort = serialPort
+	return nil
+}
+
 // MoveStraight moves the robot straight a given distance at a given speed.
 // If a distance or speed of zero is given, the base will stop.
-// This method blocks until completed or cancelled.
-func (s *viamRoombaBase) MoveStraight(ctx context.Context, distanceMm int, mmPerSec float64, extra map[string]any) error {
-	ctx, done := s.opMgr.New(ctx)
-	defer done()
-
+// This method blocks until completed or cancelled, unless extra["non_blocking"]
+// (or the non_blocking_motion config default) is set.
+func (s *viamRoombaBase) MoveStraight(ctx context.Context, distanceMm int, mmPerSec float64, extra map[string]any) (err error) {
+	defer RecoverToSafeState()
+	defer func() {
+		s.audit("motion", "move_straight", map[string]any{"distance_mm": distanceMm, "mm_per_sec": mmPerSec}, err)
+	}()
 	if distanceMm == 0 || mmPerSec == 0 {
-		return s.Stop(ctx, extra)
+		return s.stop(ctx, extra)
 	}
 
-	duration := math.Abs(float64(distanceMm) / mmPerSec)
-
-	var velocity int16
-	if distanceMm > 0 {
-		velocity = int16(mmPerSec)
-	} else {
-		velocity = -int16(mmPerSec)
+	maxSpeed := s.maxVelocity
+	if distanceMm < 0 {
+		maxSpeed = float64(s.maxReverseVelocity)
 	}
-
-	if velocity > 500 {
-		velocity = 500
-	} else if velocity < -500 {
-		velocity = -500
+	speed, err := s.limit("mm_per_sec", math.Abs(mmPerSec), 0, maxSpeed)
+	if err != nil {
+		return err
 	}
+	velocity := int16(speed)
+	if distanceMm < 0 {
+		velocity = -velocity
+	}
+	velocity = s.speedLimit.clamp(velocity)
 
-	s.conn.mu.Lock()
-	if err := s.conn.roomba.Drive(velocity, 32767); err != nil {
-		s.conn.mu.Unlock()
-		return fmt.Errorf("failed to start straight movement: %w", err)
+	if velocity == 0 {
+		return s.stop(ctx, extra)
 	}
-	s.conn.mu.Unlock()
 
-	s.logger.Debugf("MoveStraight: distance=%d mm, velocity=%d mm/sec, duration=%.2f sec", distanceMm, velocity, duration)
+	if s.closedLoopMotion {
+		seg := pathSegment{StraightMM: float64(distanceMm), Speed: math.Abs(float64(velocity))}
+		return s.moveClosedLoop(ctx, seg, "move_straight", extra)
+	}
 
-	sleepCtx, cancel := context.WithTimeout(ctx, time.Duration(duration*1000)*time.Millisecond)
-	defer cancel()
+	// Derive the duration from the clamped velocity so the distance is still covered.
+	duration := math.Abs(float64(distanceMm) / float64(velocity))
 
-	select {
-	case <-sleepCtx.Done():
-	case <-ctx.Done():
-		s.Stop(ctx, extra)
-		return ctx.Err()
-	case <-s.cancelCtx.Done():
-		s.Stop(ctx, extra)
-		return s.cancelCtx.Err()
+	start := func() error {
+		if err := s.drive(velocity, 32767); err != nil {
+			return fmt.Errorf("failed to start straight movement: %w", err)
+		}
+		s.logger.Debugf("MoveStraight: distance=%d mm, velocity=%d mm/sec, duration=%.2f sec", distanceMm, velocity, duration)
+		return nil
 	}
-
-	return s.Stop(ctx, extra)
+	return s.runMotion(ctx, extra, "move_straight", start, func(ctx context.Context) error {
+		d := time.Duration(duration * float64(time.Second))
+		if !s.headingHold {
+			return s.waitThenStop(ctx, d, extra)
+		}
+		if err := s.holdHeading(ctx, velocity, d); err != nil {
+			s.stop(ctx, extra)
+			return err
+		}
+		return s.stop(ctx, extra)
+	})
 }
 
 // Spin spins the robot by a given angle in degrees at a given speed.
 // If a speed of 0 the base will stop.
 // Given a positive speed and a positive angle, the base turns to the left (for built-in RDK drivers).
-// This method blocks until completed or cancelled.
-func (s *viamRoombaBase) Spin(ctx context.Context, angleDeg float64, degsPerSec float64, extra map[string]any) error {
-	ctx, done := s.opMgr.New(ctx)
-	defer done()
-
+// This method blocks until completed or cancelled, unless extra["non_blocking"]
+// (or the non_blocking_motion config default) is set.
+func (s *viamRoombaBase) Spin(ctx context.Context, angleDeg float64, degsPerSec float64, extra map[string]any) (err error) {
+	defer RecoverToSafeState()
+	defer func() {
+		s.audit("motion", "spin", map[string]any{"angle_deg": angleDeg, "degs_per_sec": degsPerSec}, err)
+	}()
 	if angleDeg == 0 || degsPerSec == 0 {
-		return s.Stop(ctx, extra)
+		return s.stop(ctx, extra)
+	}
+
+	if radius, ok := extra["radius_mm"]; ok {
+		return s.spinArc(ctx, angleDeg, degsPerSec, radius, extra)
+	}
+
+	// With a movement sensor, spins are closed-loop on the fused heading.
+	if s.closedLoopMotion || s.gyro != nil {
+		speed, err := s.limit("degs_per_sec", math.Abs(degsPerSec), 0, s.maxSpinDegsPerSec())
+		if err != nil {
+			return err
+		}
+		return s.moveClosedLoop(ctx, pathSegment{SpinDeg: angleDeg, Speed: speed}, "spin", extra)
 	}
 
 	duration := math.Abs(angleDeg / degsPerSec)
@@ -208,53 +961,119 @@ func (s *viamRoombaBase) Spin(ctx context.Context, angleDeg float64, degsPerSec
 		radius = -1 // Spin in place CW
 	}
 
-	s.conn.mu.Lock()
-	if err := s.conn.roomba.Drive(100, radius); err != nil {
-		s.conn.mu.Unlock()
-		return fmt.Errorf("failed to start spin: %w", err)
-	}
-	s.conn.mu.Unlock()
-
-	s.logger.Debugf("Spin: angle=%.2f deg, speed=%.2f deg/sec, duration=%.2f sec", angleDeg, degsPerSec, duration)
-
-	sleepCtx, cancel := context.WithTimeout(ctx, time.Duration(duration*1000)*time.Millisecond)
-	defer cancel()
-
-	select {
-	case <-sleepCtx.Done():
-	case <-ctx.Done():
-		s.Stop(ctx, extra)
-		return ctx.Err()
-	case <-s.cancelCtx.Done():
-		s.Stop(ctx, extra)
-		return s.cancelCtx.Err()
+	start := func() error {
+		if err := s.drive(100, radius); err != nil {
+			return fmt.Errorf("failed to start spin: %w", err)
+		}
+		s.logger.Debugf("Spin: angle=%.2f deg, speed=%.2f deg/sec, duration=%.2f sec", angleDeg, degsPerSec, duration)
+		return nil
 	}
-
-	return s.Stop(ctx, extra)
+	return s.runMotion(ctx, extra, "spin", start, func(ctx context.Context) error {
+		return s.waitThenStop(ctx, time.Duration(duration*float64(time.Second)), extra)
+	})
 }
 
 // SetPower sets the power of the base.
 // For linear power, positive Y moves forwards for built-in RDK drivers.
 // For angular power, positive Z turns to the left for built-in RDK drivers.
+// Each axis is passed through the configured deadband, expo curve, and scale.
+// With drive_style "curvature", angular power sets the path's curvature
+// rather than its turn rate; see curvatureDrive.
 func (s *viamRoombaBase) SetPower(ctx context.Context, linear r3.Vector, angular r3.Vector, extra map[string]any) error {
-	const maxWheelSpeed = 500.0
-	maxAngularDegPerSec := maxWheelSpeed * 180.0 / (math.Pi * float64(s.widthMM) / 2.0)
+	defer RecoverToSafeState()
+	// Full power is the fastest the base drives, so full stick isn't
+	// clamped when a payload derates it.
+	maxAngularDegPerSec := s.maxSpinDegsPerSec()
+
+	linearPower := shapePower(linear.Y, s.powerDeadband, s.powerExpo, s.linearPowerScale)
+	angularPower := shapePower(angular.Z, s.powerDeadband, s.powerExpo, s.angularPowerScale)
+	if s.curvatureDrive {
+		angularPower = curvatureDrive(linearPower, angularPower)
+	}
 
-	linearVel := r3.Vector{X: 0, Y: linear.Y * maxWheelSpeed, Z: 0}
-	angularVel := r3.Vector{X: 0, Y: 0, Z: angular.Z * maxAngularDegPerSec}
+	linearVel := r3.Vector{X: 0, Y: linearPower * s.maxVelocity, Z: 0}
+	angularVel := r3.Vector{X: 0, Y: 0, Z: angularPower * maxAngularDegPerSec}
 
-	return s.SetVelocity(ctx, linearVel, angularVel, extra)
+	return s.applyVelocity(ctx, linearVel, angularVel, extra)
 }
 
 // SetVelocity sets the velocity of the base.
 // linear is in mmPerSec (positive Y moves forwards for built-in RDK drivers).
 // angular is in degsPerSec (positive Z turns to the left for built-in RDK drivers).
+// With heading_hold enabled, a straight drive (angular 0) is kept on its
+// heading in the background until the next command.
 func (s *viamRoombaBase) SetVelocity(ctx context.Context, linear r3.Vector, angular r3.Vector, extra map[string]any) error {
-	s.conn.mu.Lock()
-	defer s.conn.mu.Unlock()
+	defer RecoverToSafeState()
+	return s.applyVelocity(ctx, linear, angular, extra)
+}
+
+// applyVelocity is SetVelocity for callers that already recover to the
+// safe state.
+func (s *viamRoombaBase) applyVelocity(ctx context.Context, linear r3.Vector, angular r3.Vector, extra map[string]any) (err error) {
+	// Teleop streams these, so don't build the audit entry for nothing.
+	if s.auditLog != nil {
+		defer func() {
+			s.audit("motion", "set_velocity", map[string]any{"linear_mm_s": linear.Y, "angular_deg_s": angular.Z}, err)
+		}()
+	}
+	// A timed motion still running would stop the base when its timer fires.
+	s.opMgr.CancelRunning(ctx)
 
+	if err := s.conn.mu.LockContext(ctx); err != nil {
+		return err
+	}
+	velocity, radius, err := s.setVelocity(linear, angular)
+	s.conn.mu.Unlock()
+	if err == nil {
+		s.routes.record(time.Now(), linear.Y, angular.Z)
+		// A stream of SetVelocity calls, as from teleop, is one operation.
+		if velocity == 0 {
+			s.conn.activity.set("idle")
+		} else if kind, _ := s.conn.activity.current(); kind != "set_velocity" {
+			s.conn.activity.set("set_velocity")
+		}
+	}
+	hold := s.headingHold && radius == 32767
+	guard := s.reflexes() && velocity > 0
+	if err != nil || velocity == 0 || !hold && !guard {
+		return err
+	}
+
+	// Heading hold and the reflexes run until the next command.
+	opCtx, done := s.opMgr.New(context.WithoutCancel(ctx))
+	run := func(ctx context.Context) error {
+		if hold {
+			return s.holdHeading(ctx, velocity, 0)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.cancelCtx.Done():
+			return s.cancelCtx.Err()
+		}
+	}
+	if guard {
+		run = s.withReflexes(run)
+	}
+	goSafe(func() {
+		defer done()
+		err := run(opCtx)
+		var reflex *reflexError
+		switch {
+		case errors.As(err, &reflex):
+			s.conn.activity.set("idle")
+		case err != nil && opCtx.Err() == nil && s.cancelCtx.Err() == nil:
+			s.logger.Warnf("Heading hold stopped, driving uncorrected: %v", err)
+		}
+	})
+	return nil
+}
+
+// setVelocity sends the Drive command for SetVelocity and returns the
+// velocity and radius it sent. Callers must hold s.conn.mu.
+func (s *viamRoombaBase) setVelocity(linear r3.Vector, angular r3.Vector) (int16, int16, error) {
 	if linear.Y == 0 && angular.Z == 0 {
-		return s.conn.roomba.Stop()
+		return 0, 0, s.conn.stop()
 	}
 
 	linearMM := linear.Y
@@ -264,114 +1083,558 @@ func (s *viamRoombaBase) SetVelocity(ctx context.Context, linear r3.Vector, angu
 	var radius int16
 
 	if linearMM == 0 && angularVel != 0 {
-		angularRadPerSec := math.Abs(angularVel) * math.Pi / 180.0
-		wheelSpeed := angularRadPerSec * float64(s.widthMM) / 2.0
-		velocity = int16(math.Min(500, wheelSpeed))
+		degsPerSec, err := s.limit("angular velocity", math.Abs(angularVel), 0, s.maxSpinDegsPerSec())
+		if err != nil {
+			return 0, 0, err
+		}
+		wheelSpeed := degsPerSec * math.Pi / 180.0 * float64(s.widthMM) / 2.0
+		velocity = int16(math.Min(s.maxVelocity, wheelSpeed))
 		if angularVel > 0 {
 			radius = 1
 		} else {
 			radius = -1
 		}
 	} else {
-		velocity = int16(linearMM)
-		if velocity > 500 {
-			s.logger.Warnf("Clamping velocity from %d to 500 mm/sec", velocity)
-			velocity = 500
-		} else if velocity < -500 {
-			s.logger.Warnf("Clamping velocity from %d to -500 mm/sec", velocity)
-			velocity = -500
+		linearMM, err := s.limit("linear velocity", linearMM, -float64(s.maxReverseVelocity), s.maxVelocity)
+		if err != nil {
+			return 0, 0, err
 		}
+		velocity = int16(linearMM)
 
 		if angularVel == 0 {
 			radius = 32767 // Drive straight
 		} else {
 			radiusFloat := (float64(velocity) * 180.0) / (angularVel * math.Pi)
-			radius = int16(math.Max(-2000, math.Min(2000, radiusFloat)))
+			// Gentler curves than the Drive command allows are driven at
+			// its largest radius; that is only worth a warning when strict.
+			if s.strictLimits && math.Abs(radiusFloat) > maxDriveRadius {
+				return 0, 0, fmt.Errorf("turn radius %.0f mm is outside the supported range [-%.0f, %.0f]",
+					radiusFloat, maxDriveRadius, maxDriveRadius)
+			}
+			radius = int16(math.Max(-maxDriveRadius, math.Min(maxDriveRadius, radiusFloat)))
 		}
 	}
 
-	if err := s.conn.roomba.Drive(velocity, radius); err != nil {
-		return fmt.Errorf("failed to drive Roomba: %w", err)
+	if err := s.drive(velocity, radius); err != nil {
+		return 0, 0, fmt.Errorf("failed to drive Roomba: %w", err)
 	}
 
 	s.logger.Debugf("SetVelocity: velocity=%d mm/sec, radius=%d mm", velocity, radius)
-	return nil
+	return velocity, radius, nil
+}
+
+// drive sends a Drive command if the OI and the geofence allow it, waking the robot first
+// if the idle policy put it to sleep, and beeping first if the robot is starting to
+// reverse and reverse_beep is enabled. The velocity is capped by the adaptive
+// speed limit, quiet hours, and the speed zone the robot is in. Callers must
+// hold s.conn.mu.
+func (s *viamRoombaBase) drive(velocity, radius int16) error {
+	if err := s.checkThermal(); err != nil {
+		return err
+	}
+	if err := s.checkEStop(); err != nil {
+		return err
+	}
+	if err := s.checkGeofence(velocity, radius); err != nil {
+		return err
+	}
+	if err := s.wake(); err != nil {
+		return err
+	}
+	if err := s.conn.requireControl("drive"); err != nil {
+		return err
+	}
+	s.noteDrive(velocity, radius)
+	if s.dryRun != nil {
+		s.simulateDrive(s.zoneClamp(s.quietClamp(s.speedLimit.clamp(velocity))), radius)
+		return nil
+	}
+	reversing := velocity < 0 && radius != 1 && radius != -1
+	if reversing && !s.reversing && s.reverseBeep && !s.quiet() {
+		if err := s.conn.defineSong(reverseBeepSong, reverseBeepNotes); err != nil {
+			s.warnings.Warnf("reverse_beep", "Failed to beep for reverse: %v", err)
+		} else if err := s.conn.playSong(reverseBeepSong); err != nil {
+			s.warnings.Warnf("reverse_beep", "Failed to beep for reverse: %v", err)
+		}
+	}
+	s.reversing = reversing
+	s.forward = velocity > 0 && radius != 1 && radius != -1
+	return s.conn.drive(s.zoneClamp(s.quietClamp(s.speedLimit.clamp(velocity))), radius)
 }
 
 func (s *viamRoombaBase) Stop(ctx context.Context, extra map[string]any) error {
-	s.conn.mu.Lock()
-	defer s.conn.mu.Unlock()
+	defer RecoverToSafeState()
+	return s.stop(ctx, extra)
+}
+
+// stop is Stop for callers that already recover to the safe state, so a
+// panic enters it once.
+func (s *viamRoombaBase) stop(ctx context.Context, extra map[string]any) (err error) {
+	defer func() { s.audit("motion", "stop", nil, err) }()
+	// Interrupt any timed motion first; it stops the base itself on the way out.
+	s.opMgr.CancelRunning(ctx)
+	s.cancelDeferredCleaning()
 
-	if err := s.conn.roomba.Stop(); err != nil {
+	if err := s.lockToWindDown(ctx); err != nil {
 		return fmt.Errorf("failed to stop Roomba: %w", err)
 	}
+	defer s.conn.mu.Unlock()
+
+	if err := s.stopVerified(); err != nil {
+		return err
+	}
+	s.conn.activity.set("idle")
+	s.routes.record(time.Now(), 0, 0)
 
 	s.logger.Debug("Roomba stopped")
 	return nil
 }
 
+// windDownWait bounds how long a caller whose context is already done waits
+// for the bus to leave the robot in a safe state; see lockToWindDown.
+const windDownWait = 2 * time.Second
+
+// lockToWindDown takes the bus for a caller that must still reach the robot
+// once ctx is done, such as a motion stopping the base on its way out after
+// it was cancelled. A done ctx bounds the wait to windDownWait rather than
+// skipping it: whoever holds the bus may be waiting on that motion to end,
+// and without a bound the two would wait on each other for good.
+func (s *viamRoombaBase) lockToWindDown(ctx context.Context) error {
+	if ctx.Err() == nil {
+		return s.conn.mu.LockContext(ctx)
+	}
+	waitCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+	timer := s.clk.AfterFunc(windDownWait, cancel)
+	defer timer.Stop()
+	return s.conn.mu.LockContext(waitCtx)
+}
+
+// stopVerified stops the wheels and reads back the requested velocity
+// (packet 39) to confirm the robot accepted it. If it still reports motion,
+// the stop is retried up to stopRetries times, escalating from a plain
+// resend to re-entering Safe mode and finally dropping to Passive mode, which
+// halts the drive motors regardless. Callers must hold s.conn.mu.
+func (s *viamRoombaBase) stopVerified() error {
+	if s.dryRun != nil {
+		s.simulateDrive(0, 0)
+		return nil
+	}
+	escalations := []struct {
+		name string
+		run  func() error
+	}{
+		{"resend stop", func() error { return nil }},
+		{"re-enter Safe mode", func() error { return s.conn.setMode(oiSafe) }},
+		{"drop to Passive mode", func() error { return s.conn.setMode(oiPassive) }},
+	}
+
+	var velocity int16
+	for attempt := 0; attempt <= s.stopRetries; attempt++ {
+		if attempt > 0 {
+			step := escalations[min(attempt-1, len(escalations)-1)]
+			s.logger.Warnf("Stop not confirmed (requested velocity %d mm/s), attempt %d: %s", velocity, attempt, step.name)
+			if err := step.run(); err != nil {
+				s.logger.Warnf("Stop escalation %q failed: %v", step.name, err)
+			}
+		}
+
+		if err := s.conn.stop(); err != nil {
+			return fmt.Errorf("failed to stop Roomba: %w", err)
+		}
+		s.reversing = false
+
+		data, err := s.conn.sensor(39)
+		if err != nil || len(data) < 2 {
+			// The stop was sent; an unreadable verification isn't a stop failure.
+			s.logger.Debugf("Could not verify stop: %v", err)
+			return nil
+		}
+		velocity = int16(binary.BigEndian.Uint16(data))
+		if velocity == 0 {
+			return nil
+		}
+	}
+
+	s.logger.Errorf("Stop verification failed: robot still reports requested velocity %d mm/s after %d retries", velocity, s.stopRetries)
+	return fmt.Errorf("stop verification failed: requested velocity still %d mm/s", velocity)
+}
+
 func (s *viamRoombaBase) DoCommand(ctx context.Context, cmd map[string]any) (map[string]any, error) {
-	s.conn.mu.Lock()
+	names := batchNames(cmd)
+	resp, err := s.commands.dispatch(ctx, cmd)
+	name, _ := cmd["command"].(string)
+	if names != nil {
+		name = "batch"
+	}
+	params := make(map[string]any, len(cmd))
+	for k, v := range cmd {
+		if k != "command" {
+			params[k] = v
+		}
+	}
+	s.audit("do_command", name, params, err)
+	return resp, err
+}
+
+// newCommands builds the base's DoCommands.
+func (s *viamRoombaBase) newCommands() commandSet {
+	cmds := connCommands(s.conn)
+	return append(cmds,
+		newCommand("enter_full_mode", "Switch the OI to Full mode, if allow_full_mode is set", s.enterFullMode),
+		newCommand("enter_safe_mode", "Switch the OI to Safe mode", func(ctx context.Context, _ noArgs) (map[string]any, error) {
+			return s.enterMode(ctx, oiSafe, "Entered Safe mode (safety features enabled)", "safe_mode_enabled")
+		}),
+		newCommand("enter_passive_mode", "Switch the OI to Passive mode", func(ctx context.Context, _ noArgs) (map[string]any, error) {
+			return s.enterMode(ctx, oiPassive, "Entered Passive mode (charging allowed)", "passive_mode_enabled")
+		}),
+		newCommand("seek_dock", "Drive to the charging dock", s.seekDock),
+		newCommand("clean", "Start a normal cleaning cycle", func(ctx context.Context, _ noArgs) (map[string]any, error) {
+			return s.startCleaning(ctx, opClean, "Started cleaning mode", "cleaning")
+		}),
+		newCommand("spot_clean", "Start spot cleaning", func(ctx context.Context, _ noArgs) (map[string]any, error) {
+			return s.startCleaning(ctx, opSpot, "Started spot cleaning", "spot_cleaning")
+		}),
+		newCommand("max_clean", "Clean until the battery is low", func(ctx context.Context, _ noArgs) (map[string]any, error) {
+			return s.startCleaning(ctx, opMax, "Started max cleaning", "max_cleaning")
+		}),
+		// stop waits for the running motion to wind down, which needs the
+		// bus, so it can't run in a batch holding it.
+		newCommand("stop", "Stop any motion, path, or arc", func(ctx context.Context, _ noArgs) (map[string]any, error) {
+			// Cancel any running motion or path before stopping.
+			s.opMgr.CancelRunning(ctx)
+			s.cancelDeferredCleaning()
+			if err := s.conn.mu.LockContext(ctx); err != nil {
+				return nil, err
+			}
+			defer s.conn.mu.Unlock()
+			if err := s.stopVerified(); err != nil {
+				return nil, err
+			}
+			s.conn.activity.set("idle")
+			return map[string]any{"status": "stopped"}, nil
+		}).alone(),
+		newCommand("face_dock", "Spin in place until facing the dock", s.faceDock).alone(),
+		newCommand("is_motion_complete", "Whether the last non-blocking motion has finished", func(context.Context, noArgs) (map[string]any, error) {
+			return s.motionStatus(), nil
+		}),
+		newCommand("wait_for_motion", "Wait for the last non-blocking motion to finish", s.waitForMotion).alone(),
+		newCommand("execute_path", "Drive a list of straight, spin, and arc segments", s.executePath).alone(),
+		newCommand("get_path_progress", "Progress of the last execute_path", func(context.Context, noArgs) (map[string]any, error) {
+			return s.path.snapshot(), nil
+		}),
+		newCommand("move_arc", "Drive an arc around a center to one side", s.moveArc).alone(),
+		newCommand("get_thermal_state", "Battery temperature and whether thermal protection is holding the robot", s.thermalSnapshot),
+		newCommand("get_simulated_pose", "Where dry_run has driven the simulated robot", s.simulatedPose),
+		newCommand("start_recording", "Record SetVelocity, SetPower, and Stop commands as a route", s.routes.start),
+		newCommand("stop_recording", "Finish and save the route being recorded", s.routes.stop),
+		newCommand("list_recordings", "The saved routes and any recording in progress", s.routes.list),
+		newCommand("replay", "Drive a recorded route again, stopping on any bump, wheel drop, or cliff", s.replay).alone(),
+		newCommand("get_geofence", "The geofence's center and radius, and whether the robot is outside it", s.geofenceSnapshot),
+		newCommand("override_geofence", "Allow motion outside the geofence until the robot is back inside", s.overrideGeofence),
+		newCommand("reset_geofence", "Move the geofence's center to the robot's current position", s.resetGeofence),
+		newCommand("get_heading_fusion", "Whether the movement sensor's heading is being fused with odometry", s.gyroSnapshot),
+		newCommand("get_estop", "Whether the external e-stop is asserted", s.estopSnapshot),
+		newCommand("start_odometry_calibration", "Start measuring the distance and angle the robot reports", s.startCalibration),
+		newCommand("finish_odometry_calibration", "Compute distance_scale and angle_scale from measured travel", s.finishCalibration),
+		newCommand("get_features", "What this base provides as configured, for clients to adapt to", s.featureMatrix),
+		newCommand("get_quiet_hours", "Whether quiet hours are in effect, until when, and any deferred cleaning", s.quietHoursSnapshot),
+		newCommand("get_speed_zones", "The speed zones, and which the robot is in", s.speedZonesSnapshot),
+		newCommand("self_test", "Check the serial link, battery, faults, and optionally the wheels, with a pass/fail report", s.selfTest),
+	)
+}
+
+// enterMode serves the enter_*_mode commands.
+func (s *viamRoombaBase) enterMode(ctx context.Context, mode oiMode, msg, status string) (map[string]any, error) {
+	if err := s.conn.mu.LockContext(ctx); err != nil {
+		return nil, err
+	}
 	defer s.conn.mu.Unlock()
+	if err := s.conn.setMode(mode); err != nil {
+		return nil, err
+	}
+	// Any cleaning or docking the robot was doing stops on a mode change.
+	s.conn.activity.set("idle")
+	s.logger.Info(msg)
+	return map[string]any{"status": status}, nil
+}
 
-	cmdName, ok := cmd["command"].(string)
-	if !ok {
-		return nil, fmt.Errorf("command must be a string")
+// startCleaning sends one of the built-in cleaning commands. Like Seek Dock,
+// they all hand control to the robot and leave the OI in Passive mode.
+func (s *viamRoombaBase) startCleaning(ctx context.Context, opcode byte, msg, status string) (map[string]any, error) {
+	if err := s.conn.mu.LockContext(ctx); err != nil {
+		return nil, err
+	}
+	defer s.conn.mu.Unlock()
+	if err := s.checkThermal(); err != nil {
+		return nil, err
+	}
+	if err := s.checkEStop(); err != nil {
+		return nil, err
+	}
+	if s.dryRun != nil {
+		return nil, errDryRun
+	}
+	if resp, err := s.checkQuietCleaning(opcode, msg, status); resp != nil || err != nil {
+		return resp, err
+	}
+	if err := s.conn.write(opcode, nil); err != nil {
+		return nil, fmt.Errorf("failed to start cleaning (%s): %w", opcodeName(opcode), err)
 	}
+	s.conn.noteMode(oiPassive)
+	s.conn.activity.set("clean")
+	s.logger.Info(msg)
+	return map[string]any{"status": status}, nil
+}
+
+// dockArgs are the parameters of seek_dock and face_dock.
+type dockArgs struct {
+	TimeoutMS *float64 `json:"timeout_ms" doc:"Stop and fail if the dock isn't reached after this long"`
+}
 
-	switch cmdName {
-	case "enter_full_mode":
-		if err := s.conn.roomba.Full(); err != nil {
-			return nil, fmt.Errorf("failed to enter Full mode: %w", err)
+// dockPollInterval is how often seek_dock with a timeout checks whether the
+// robot has reached the dock.
+const dockPollInterval = time.Second
+
+// seekDock serves seek_dock. The robot drives itself to the dock, so it
+// returns once the search has started, unless timeout_ms is given: then it
+// waits until the robot reports the home base as a charging source (packet
+// 34), and if that takes longer than the timeout calls the search off,
+// leaving the robot stopped in Safe mode.
+func (s *viamRoombaBase) seekDock(ctx context.Context, args dockArgs) (map[string]any, error) {
+	var timeout time.Duration
+	if args.TimeoutMS != nil {
+		var err error
+		if timeout, err = parseTimeoutMS(*args.TimeoutMS); err != nil {
+			return nil, err
 		}
-		s.logger.Info("Entered Full mode (safety features disabled)")
-		return map[string]any{"status": "full_mode_enabled"}, nil
+		if inBatch(ctx) {
+			return nil, errors.New("seek_dock with timeout_ms can't run in a batch; send it on its own")
+		}
+	}
+
+	if err := s.conn.mu.LockContext(ctx); err != nil {
+		return nil, err
+	}
+	err := s.startDockSearch()
+	_, id := s.conn.activity.current()
+	s.conn.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if timeout == 0 {
+		return map[string]any{"status": "seeking_dock"}, nil
+	}
 
-	case "enter_safe_mode":
-		if err := s.conn.roomba.Safe(); err != nil {
-			return nil, fmt.Errorf("failed to enter Safe mode: %w", err)
+	deadline := s.clk.Timer(timeout)
+	defer deadline.Stop()
+	ticker := s.clk.Ticker(dockPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-s.cancelCtx.Done():
+			return nil, s.cancelCtx.Err()
+		case <-deadline.C:
+			return nil, s.callOffDockSearch(ctx, id, timeout)
+		case <-ticker.C:
+		}
+		if err := s.conn.mu.LockContext(ctx); err != nil {
+			return nil, err
+		}
+		kind, current := s.conn.activity.current()
+		data, err := s.conn.sensor(34)
+		s.conn.mu.Unlock()
+		if kind != "docking" || current != id {
+			return nil, errors.New("the dock search was interrupted by another command")
+		}
+		if err != nil {
+			s.logger.Debugf("seek_dock failed to read the charging sources: %v", err)
+			continue
+		}
+		if data[0]&0x02 != 0 {
+			s.conn.activity.noteDocked(true)
+			s.logger.Info("Reached the charging dock")
+			return map[string]any{"status": "docked"}, nil
 		}
-		s.logger.Info("Entered Safe mode (safety features enabled)")
-		return map[string]any{"status": "safe_mode_enabled"}, nil
+	}
+}
 
-	case "enter_passive_mode":
-		if err := s.conn.roomba.Passive(); err != nil {
-			return nil, fmt.Errorf("failed to enter Passive mode: %w", err)
+// startDockSearch sends Seek Dock. Callers must hold s.conn.mu.
+func (s *viamRoombaBase) startDockSearch() error {
+	if err := s.checkThermal(); err != nil {
+		return err
+	}
+	if err := s.checkEStop(); err != nil {
+		return err
+	}
+	if s.dryRun != nil {
+		return errDryRun
+	}
+	if err := s.conn.seekDock(); err != nil {
+		return fmt.Errorf("failed to seek dock: %w", err)
+	}
+	s.conn.activity.set("docking")
+	s.logger.Info("Seeking charging dock")
+	return nil
+}
+
+// callOffDockSearch ends a dock search that ran past seek_dock's timeout,
+// unless another command has taken over since. Seek Dock hands the robot
+// its own behavior, which Drive can't stop, so it enters Safe mode first.
+func (s *viamRoombaBase) callOffDockSearch(ctx context.Context, id string, timeout time.Duration) error {
+	if err := s.conn.mu.LockContext(ctx); err != nil {
+		return err
+	}
+	defer s.conn.mu.Unlock()
+	if kind, current := s.conn.activity.current(); kind != "docking" || current != id {
+		return errors.New("the dock search was interrupted by another command")
+	}
+	s.logger.Warnf("The robot didn't reach the dock within %v; stopping it", timeout)
+	if err := s.conn.setMode(oiSafe); err != nil {
+		return fmt.Errorf("seek_dock timed out after %v, and calling off the search failed: %w", timeout, err)
+	}
+	if err := s.conn.stop(); err != nil {
+		return fmt.Errorf("seek_dock timed out after %v, and stopping failed: %w", timeout, err)
+	}
+	s.conn.activity.set("idle")
+	return fmt.Errorf("seek_dock timed out after %v: %w", timeout, context.DeadlineExceeded)
+}
+
+// faceDock spins in place until both directional IR receivers see the dock,
+// turning toward whichever side last reported it. It gives up after roughly
+// one and a half revolutions, or timeout_ms if that is sooner.
+func (s *viamRoombaBase) faceDock(ctx context.Context, args dockArgs) (map[string]any, error) {
+	var timeout time.Duration
+	if args.TimeoutMS != nil {
+		var err error
+		if timeout, err = parseTimeoutMS(*args.TimeoutMS); err != nil {
+			return nil, err
 		}
-		s.logger.Info("Entered Passive mode (charging allowed)")
-		return map[string]any{"status": "passive_mode_enabled"}, nil
+	}
+	if !s.conn.caps.hasPacket(52) {
+		return nil, errors.New("face_dock needs the directional IR receivers (packets 52-53), which this robot doesn't report")
+	}
+	ctx, done := s.opMgr.New(ctx)
+	defer done()
+	defer s.conn.activity.begin("docking")()
 
-	case "seek_dock":
-		if err := s.conn.roomba.SeekDock(); err != nil {
-			return nil, fmt.Errorf("failed to seek dock: %w", err)
+	const (
+		spinVelocity = 60 // mm/s per wheel; slow enough not to overshoot the beam
+		pollInterval = 50 * time.Millisecond
+	)
+	revolution := math.Pi * float64(s.widthMM) / spinVelocity
+	deadline := s.clk.Now().Add(time.Duration(1.5 * revolution * float64(time.Second)))
+	giveUp := errors.New("dock not found: center beam never detected")
+	if timeout > 0 && s.clk.Now().Add(timeout).Before(deadline) {
+		deadline = s.clk.Now().Add(timeout)
+		giveUp = fmt.Errorf("face_dock timed out after %v: %w", timeout, context.DeadlineExceeded)
+	}
+
+	var radius int16 = 1 // CCW unless the dock is seen on the right
+	driving := false
+	ticker := s.clk.Ticker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.conn.mu.LockContext(ctx); err != nil {
+			s.stop(ctx, nil)
+			return nil, err
+		}
+		data, err := s.conn.query([]byte{52, 53})
+		s.conn.mu.Unlock()
+		if err != nil {
+			s.stop(ctx, nil)
+			return nil, fmt.Errorf("failed to read IR receivers: %w", err)
 		}
-		s.logger.Info("Seeking charging dock")
-		return map[string]any{"status": "seeking_dock"}, nil
 
-	case "clean":
-		if err := s.conn.roomba.Clean(); err != nil {
-			return nil, fmt.Errorf("failed to start cleaning: %w", err)
+		bearing := dockBearing(data[0][0], data[1][0])
+		if bearing == "center" {
+			if err := s.stop(ctx, nil); err != nil {
+				return nil, err
+			}
+			s.logger.Info("Facing dock")
+			return map[string]any{"status": "facing_dock"}, nil
 		}
-		s.logger.Info("Started cleaning mode")
-		return map[string]any{"status": "cleaning"}, nil
 
-	case "stop":
-		if err := s.conn.roomba.Stop(); err != nil {
-			return nil, fmt.Errorf("failed to stop: %w", err)
+		want := radius
+		if bearing == "right" {
+			want = -1
+		} else if bearing == "left" {
+			want = 1
+		}
+		if !driving || want != radius {
+			radius = want
+			if err := s.conn.mu.LockContext(ctx); err != nil {
+				s.stop(ctx, nil)
+				return nil, err
+			}
+			err := s.drive(spinVelocity, radius)
+			s.conn.mu.Unlock()
+			if err != nil {
+				return nil, fmt.Errorf("failed to spin toward dock: %w", err)
+			}
+			driving = true
 		}
-		return map[string]any{"status": "stopped"}, nil
 
-	default:
-		return nil, fmt.Errorf("unknown command: %s", cmdName)
+		if s.clk.Now().After(deadline) {
+			s.stop(ctx, nil)
+			return nil, giveUp
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			s.stop(ctx, nil)
+			return nil, ctx.Err()
+		case <-s.cancelCtx.Done():
+			s.stop(ctx, nil)
+			return nil, s.cancelCtx.Err()
+		}
+	}
+}
+
+// logMetrics periodically logs serial link metrics until the base is closed.
+func (s *viamRoombaBase) logMetrics(interval time.Duration) {
+	ticker := s.clk.Ticker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.cancelCtx.Done():
+			return
+		case <-ticker.C:
+			s.logger.Infof("Serial link metrics: %v", s.conn.metrics.snapshot())
+		}
 	}
 }
 
 func (s *viamRoombaBase) IsMoving(ctx context.Context) (bool, error) {
-	s.conn.mu.Lock()
+	defer RecoverToSafeState()
+	if s.dryRun != nil {
+		return s.dryRun.moving(), nil
+	}
+
+	// The encoders say whether the wheels are actually turning: a stalled
+	// robot isn't moving, and one coasting after Stop still is.
+	if s.conn.caps.hasPacket(43) {
+		moving, err := s.wheelsTurning(ctx)
+		if err == nil {
+			return moving, nil
+		}
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		s.logger.Debugf("IsMoving: failed to read the encoders, using the requested velocity: %v", err)
+	}
+
+	if err := s.conn.mu.LockContext(ctx); err != nil {
+		return false, err
+	}
 	defer s.conn.mu.Unlock()
 
 	// Packet 39: last requested velocity (0 after Stop(), non-zero while driving)
-	data, err := s.conn.roomba.Sensors(39)
+	data, err := s.conn.sensor(39)
 	if err != nil {
 		return false, fmt.Errorf("failed to read requested velocity: %w", err)
 	}
@@ -396,8 +1659,15 @@ func (s *viamRoombaBase) Properties(ctx context.Context, extra map[string]any) (
 }
 
 func (s *viamRoombaBase) Geometries(ctx context.Context, extra map[string]any) ([]spatialmath.Geometry, error) {
-	// Roomba 650: 340mm diameter, 92mm height. Sphere approximation preserves the circular footprint.
-	geom, err := spatialmath.NewSphere(spatialmath.NewZeroPose(), 170.0, s.name.Name)
+	// spatialmath has no cylinder, and a vertical capsule can't be shorter than its
+	// diameter, so use the box that bounds the body, resting on the floor.
+	d := float64(s.diameterMM)
+	h := float64(s.heightMM)
+	geom, err := spatialmath.NewBox(
+		spatialmath.NewPoseFromPoint(r3.Vector{X: 0, Y: 0, Z: h / 2}),
+		r3.Vector{X: d, Y: d, Z: h},
+		s.name.Name,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -405,15 +1675,71 @@ func (s *viamRoombaBase) Geometries(ctx context.Context, extra map[string]any) (
 }
 
 func (s *viamRoombaBase) Close(ctx context.Context) error {
-	s.conn.mu.Lock()
-	if err := s.conn.roomba.Stop(); err != nil {
-		s.logger.Warnf("Failed to stop Roomba during close: %v", err)
+	// Let any background motion stop before the port is given up.
+	s.opMgr.CancelRunning(ctx)
+
+	if err := s.lockToWindDown(ctx); err != nil {
+		s.logger.Warnf("Couldn't get the serial port to stop the robot on close: %v", err)
+	} else {
+		if s.dryRun != nil {
+			// Nothing is written to the robot with dry_run, not even on close.
+			s.simulateDrive(0, 0)
+			if s.onClose != "stop" {
+				s.logger.Infof("Dry run: on_close would have sent %s", onCloseCommand(s.onClose))
+			}
+		} else {
+			s.closeRobot()
+		}
+		s.conn.mu.Unlock()
 	}
-	s.conn.mu.Unlock()
 
+	if s.gyro != nil {
+		s.conn.odom.clearGyro(s.gyro)
+	}
+	s.removeModeObserver()
+	s.removeEventObserver()
+	s.removeTracer()
+	s.auditLog.Close()
 	s.cancelFunc()
-	releaseConn(s.serialPort)
+	releaseConn(s.conn)
 
 	s.logger.Info("Roomba base closed")
 	return nil
 }
+
+// closeRobot stops the robot and runs the on_close action, leaving it in a
+// known state once the module lets go of it. Callers must hold s.conn.mu.
+func (s *viamRoombaBase) closeRobot() {
+	if err := s.conn.stop(); err != nil {
+		s.logger.Warnf("Failed to stop Roomba during close: %v", err)
+	}
+	var err error
+	switch s.onClose {
+	case "passive":
+		err = s.conn.setMode(oiPassive)
+	case "seek_dock":
+		err = s.conn.seekDock()
+	case "power_off":
+		if err = s.conn.write(opPower, nil); err == nil {
+			s.conn.noteMode(oiOff)
+		}
+	}
+	if err != nil {
+		s.logger.Warnf("Failed to run on_close action %q: %v", s.onClose, err)
+	}
+}
+
+// onCloseCommand names what an on_close action sends the robot, for dry_run
+// to log.
+func onCloseCommand(action string) string {
+	switch action {
+	case "passive":
+		return "Start (Passive mode)"
+	case "seek_dock":
+		return "Seek Dock"
+	case "power_off":
+		return "Power"
+	default:
+		return "Stop"
+	}
+}
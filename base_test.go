@@ -0,0 +1,89 @@
+package viamroomba
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/golang/geo/r3"
+)
+
+// BenchmarkSetVelocity times a teleop stream of SetVelocity calls on a
+// fakeRobot. Alternating speeds keep every call sending a Drive, so the
+// Drive rate budget sets the pace once the burst is spent.
+func BenchmarkSetVelocity(b *testing.B) {
+	s, _ := baseOnFakeRobot(b, clock.New())
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := range b.N {
+		if err := s.SetVelocity(ctx, r3.Vector{Y: float64(200 + i%2*10)}, r3.Vector{}, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// TestCancelledMotionGivesUpOnHeldBus holds the bus, as a DoCommand batch
+// does, while the running motion is cancelled and waited for. The motion
+// needs the bus to stop the base on its way out, so it must give up on it
+// after windDownWait; otherwise it and the canceller wait on each other for
+// good.
+func TestCancelledMotionGivesUpOnHeldBus(t *testing.T) {
+	clk := newTimerClock()
+	s, robot := baseOnFakeRobot(t, clk)
+	m := timedMotions[0]
+	errc := startMotion(context.Background(), t, s, robot, clk, m.run, m.drive, nil)
+
+	b := &busBatch{}
+	if err := s.conn.mu.LockContext(context.WithValue(context.Background(), batchKey{}, b)); err != nil {
+		t.Fatal(err)
+	}
+	cancelled := make(chan struct{})
+	go func() {
+		s.opMgr.CancelRunning(context.Background())
+		close(cancelled)
+	}()
+	// The motion arms its wait for the bus at some point after the cancel,
+	// so keep moving the clock until it gives up.
+	deadline := time.After(5 * time.Second)
+	for waiting := true; waiting; {
+		select {
+		case <-cancelled:
+			waiting = false
+		case <-deadline:
+			t.Fatal("the cancelled motion is still waiting for the bus")
+		case <-time.After(10 * time.Millisecond):
+			clk.Add(windDownWait)
+		}
+	}
+	if err := waitResult(t, errc); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+
+	b.release()
+	if err := s.Stop(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	checkStopped(t, robot)
+}
+
+// TestBatchRejectsStop checks that stop, which waits for the running motion
+// to wind down, can't be batched, and that nothing is sent when it is.
+func TestBatchRejectsStop(t *testing.T) {
+	s, robot := baseOnFakeRobot(t, clock.New())
+	before := robot.opcodes()
+	_, err := s.DoCommand(context.Background(), map[string]any{"commands": []any{
+		map[string]any{"command": "enter_safe_mode"},
+		map[string]any{"command": "stop"},
+	}})
+	if err == nil || !strings.Contains(err.Error(), "can't run in a batch") {
+		t.Fatalf("got %v, want stop refused in a batch", err)
+	}
+	if after := robot.opcodes(); !bytes.Equal(after, before) {
+		t.Errorf("sent %v for a refused batch", after[len(before):])
+	}
+}
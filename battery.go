@@ -0,0 +1,218 @@
+package viamroomba
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBatteryTempLimitC = 45
+	// maxBatteryHistory bounds each persisted history list.
+	maxBatteryHistory = 365
+	// batteryTrendWindow is how far back the charge trend used for battery
+	// ETAs looks, and batteryTrendMin how much of it is needed before the
+	// trend is trusted over the instantaneous current.
+	batteryTrendWindow = 10 * time.Minute
+	batteryTrendMin    = 2 * time.Minute
+	// batteryCurrentSmoothing is the weight of each new current reading in
+	// its moving average; the current jumps as motors start and stop.
+	batteryCurrentSmoothing = 0.2
+)
+
+// batterySample is the battery capacity (packet 26) recorded at the end of a
+// charge, when the robot's estimate of it is freshest.
+type batterySample struct {
+	Time        time.Time `json:"time"`
+	CapacityMAh int       `json:"capacity_mah"`
+}
+
+// tempExcursion is a period spent above the temperature limit.
+type tempExcursion struct {
+	Start time.Time `json:"start"`
+	PeakC int       `json:"peak_c"`
+}
+
+// batteryHistory is the persisted part of the battery tracker.
+type batteryHistory struct {
+	ChargeSessions  int             `json:"charge_sessions"`
+	DischargedMAh   float64         `json:"discharged_mah"`
+	PeakCapacityMAh int             `json:"peak_capacity_mah"`
+	Capacity        []batterySample `json:"capacity"`
+	TempExcursions  []tempExcursion `json:"temp_excursions"`
+}
+
+// batteryTracker follows charge/discharge cycles, capacity, and temperature.
+// Its history is persisted with the rest of the sensor's state.
+type batteryTracker struct {
+	mu        sync.Mutex
+	tempLimit int
+	designMAh int
+
+	history batteryHistory
+
+	charging   bool
+	lastCharge int // mAh; -1 until the first reading
+	overTemp   bool
+
+	// ETA state, reset whenever charging starts or stops.
+	trend           []chargeSample
+	smoothCurrentMA float64
+}
+
+// chargeSample is one battery charge (packet 25) reading, for the trend.
+type chargeSample struct {
+	at        time.Time
+	chargeMAh int
+}
+
+func newBatteryTracker(history batteryHistory, tempLimitC, designMAh int) *batteryTracker {
+	return &batteryTracker{history: history, tempLimit: tempLimitC, designMAh: designMAh, lastCharge: -1}
+}
+
+// update records one battery reading. chargingState is packet 21, where 1-3
+// mean charging.
+func (t *batteryTracker) update(now time.Time, chargingState byte, chargeMAh, capacityMAh, tempC int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	charging := chargingState >= 1 && chargingState <= 3
+	if charging && !t.charging {
+		t.history.ChargeSessions++
+	}
+	if !charging && t.charging && capacityMAh > 0 {
+		t.history.Capacity = appendCapped(t.history.Capacity, batterySample{Time: now, CapacityMAh: capacityMAh})
+	}
+	if charging != t.charging {
+		t.trend, t.smoothCurrentMA = nil, 0
+	}
+	t.charging = charging
+
+	if t.lastCharge >= 0 && chargeMAh < t.lastCharge && !charging {
+		t.history.DischargedMAh += float64(t.lastCharge - chargeMAh)
+	}
+	t.lastCharge = chargeMAh
+
+	if capacityMAh > t.history.PeakCapacityMAh {
+		t.history.PeakCapacityMAh = capacityMAh
+	}
+
+	if tempC > t.tempLimit {
+		n := len(t.history.TempExcursions)
+		if !t.overTemp {
+			t.history.TempExcursions = appendCapped(t.history.TempExcursions, tempExcursion{Start: now, PeakC: tempC})
+		} else if n > 0 && tempC > t.history.TempExcursions[n-1].PeakC {
+			t.history.TempExcursions[n-1].PeakC = tempC
+		}
+	}
+	t.overTemp = tempC > t.tempLimit
+}
+
+// eta estimates the minutes until the battery is full while charging, or
+// empty otherwise, from the current (packet 23; negative when discharging)
+// and the charge trend. The trend over the last batteryTrendWindow is used
+// once it spans batteryTrendMin, since it includes everything the robot
+// draws; until then, the smoothed current. ok is false while the battery
+// isn't filling (charging) or draining (discharging).
+func (t *batteryTracker) eta(now time.Time, chargeMAh, capacityMAh, currentMA int) (minutes float64, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.trend) == 0 {
+		t.smoothCurrentMA = float64(currentMA)
+	} else {
+		t.smoothCurrentMA += batteryCurrentSmoothing * (float64(currentMA) - t.smoothCurrentMA)
+	}
+	t.trend = append(t.trend, chargeSample{at: now, chargeMAh: chargeMAh})
+	for len(t.trend) > 1 && now.Sub(t.trend[0].at) > batteryTrendWindow {
+		t.trend = t.trend[1:]
+	}
+
+	// Charge rate in mA: positive filling, negative draining.
+	rate := t.smoothCurrentMA
+	if span := now.Sub(t.trend[0].at); span >= batteryTrendMin && t.trend[0].chargeMAh != chargeMAh {
+		rate = float64(chargeMAh-t.trend[0].chargeMAh) / span.Hours()
+	}
+	switch {
+	case t.charging && rate > 0:
+		return math.Round(float64(max(0, capacityMAh-chargeMAh))/rate*60*10) / 10, true
+	case !t.charging && rate < 0:
+		return math.Round(float64(chargeMAh)/-rate*60*10) / 10, true
+	}
+	return 0, false
+}
+
+func appendCapped[T any](list []T, v T) []T {
+	if len(list) >= maxBatteryHistory {
+		list = list[1:]
+	}
+	return append(list, v)
+}
+
+// snapshotHistory returns a copy of the history for persisting.
+func (t *batteryTracker) snapshotHistory() batteryHistory {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	h := t.history
+	h.Capacity = append([]batterySample(nil), h.Capacity...)
+	h.TempExcursions = append([]tempExcursion(nil), h.TempExcursions...)
+	return h
+}
+
+// health grades the battery from its latest end-of-charge capacity relative
+// to its design capacity (or the highest capacity seen): at least 80% is
+// good, at least 60% degraded, and anything lower should be replaced.
+// Repeated overheating marks an otherwise good battery degraded.
+func (t *batteryTracker) health() (string, float64) {
+	reference := t.designMAh
+	if reference == 0 {
+		reference = t.history.PeakCapacityMAh
+	}
+	n := len(t.history.Capacity)
+	if n == 0 || reference == 0 {
+		return "unknown", 0
+	}
+	ratio := float64(t.history.Capacity[n-1].CapacityMAh) / float64(reference)
+	switch {
+	case ratio < 0.6:
+		return "replace", ratio
+	case ratio < 0.8 || len(t.history.TempExcursions) >= 10:
+		return "degraded", ratio
+	default:
+		return "good", ratio
+	}
+}
+
+// snapshot returns the health grade and, if withHistory is set, the full
+// capacity and temperature history.
+func (t *batteryTracker) snapshot(withHistory bool) map[string]any {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	health, ratio := t.health()
+	cycles := 0.0
+	if t.history.PeakCapacityMAh > 0 {
+		cycles = t.history.DischargedMAh / float64(t.history.PeakCapacityMAh)
+	}
+	out := map[string]any{
+		"battery_health":    health,
+		"capacity_ratio":    ratio,
+		"charge_sessions":   t.history.ChargeSessions,
+		"equivalent_cycles": math.Round(cycles*10) / 10,
+		"temp_excursions":   len(t.history.TempExcursions),
+	}
+	if !withHistory {
+		return out
+	}
+	capacity := make([]any, 0, len(t.history.Capacity))
+	for _, c := range t.history.Capacity {
+		capacity = append(capacity, map[string]any{"time": c.Time.Format(time.RFC3339), "capacity_mah": c.CapacityMAh})
+	}
+	excursions := make([]any, 0, len(t.history.TempExcursions))
+	for _, e := range t.history.TempExcursions {
+		excursions = append(excursions, map[string]any{"start": e.Start.Format(time.RFC3339), "peak_c": e.PeakC})
+	}
+	out["capacity_history"] = capacity
+	out["temp_excursion_history"] = excursions
+	return out
+}
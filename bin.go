@@ -0,0 +1,37 @@
+package viamroomba
+
+import "time"
+
+const (
+	defaultBinFullCurrentThresholdMA = 400
+	defaultBinFullWindow             = 2 * time.Minute
+)
+
+// binFullDetector infers a full bin on robots with no bin sensor. The OI
+// doesn't report vacuum motor current, so it watches the main brush motor
+// (packet 56), which works harder as debris backs up from a full bin. A full
+// bin also stops debris reaching the dirt detect sensor, so the detector
+// fires when the brush current stays high with no dirt detected for the
+// whole window. Any dirt, or the brush current dropping (e.g. because the
+// robot stopped cleaning), resets it.
+type binFullDetector struct {
+	currentThresholdMA int
+	window             time.Duration
+	since              time.Time // start of the current suspicious run; zero if none
+}
+
+// update feeds one reading into the detector and reports whether a full bin
+// is suspected.
+func (d *binFullDetector) update(now time.Time, brushCurrentMA, dirt int) bool {
+	if brushCurrentMA < 0 {
+		brushCurrentMA = -brushCurrentMA
+	}
+	if brushCurrentMA < d.currentThresholdMA || dirt > 0 {
+		d.since = time.Time{}
+		return false
+	}
+	if d.since.IsZero() {
+		d.since = now
+	}
+	return now.Sub(d.since) >= d.window
+}
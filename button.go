@@ -0,0 +1,229 @@
+package viamroomba
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.viam.com/rdk/components/button"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+)
+
+const (
+	defaultLongPress = time.Second
+	// buttonPollInterval is how often the Buttons packet is read; a quick
+	// tap lasts about 100ms.
+	buttonPollInterval = 50 * time.Millisecond
+	// buttonActionTimeout bounds how long a press's DoCommand may run.
+	buttonActionTimeout = time.Minute
+)
+
+// ButtonAction is a DoCommand sent to another resource when the button is
+// pressed.
+type ButtonAction struct {
+	Resource string         `json:"resource"`
+	Command  map[string]any `json:"command"`
+}
+
+// ButtonConfig configures the Clean button component.
+type ButtonConfig struct {
+	SerialPort  string        `json:"serial_port,omitempty"`
+	Controller  string        `json:"controller,omitempty"`
+	ShortPress  *ButtonAction `json:"short_press,omitempty"`
+	LongPress   *ButtonAction `json:"long_press,omitempty"`
+	LongPressMS int           `json:"long_press_ms,omitempty"`
+}
+
+func (cfg *ButtonConfig) Validate(path string) ([]string, []string, error) {
+	deps, err := validateConnection(cfg.SerialPort, cfg.Controller)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for name, action := range map[string]*ButtonAction{"short_press": cfg.ShortPress, "long_press": cfg.LongPress} {
+		if action == nil {
+			continue
+		}
+		if action.Resource == "" {
+			return nil, nil, fmt.Errorf("%s: %s.resource is required", path, name)
+		}
+		if len(action.Command) == 0 {
+			return nil, nil, fmt.Errorf("%s: %s.command is required", path, name)
+		}
+		deps = append(deps, action.Resource)
+	}
+	if cfg.LongPressMS < 0 {
+		return nil, nil, fmt.Errorf("%s: long_press_ms must be a positive number", path)
+	}
+	return deps, nil, nil
+}
+
+// buttonTarget is a resolved ButtonAction.
+type buttonTarget struct {
+	res     resource.Resource
+	command map[string]any
+}
+
+// cleanButton watches the robot's Clean button and runs a DoCommand on
+// another resource when it is pressed, with separate actions for a short
+// and a long press. Push runs the short press action, as if the button
+// had been tapped.
+type cleanButton struct {
+	resource.AlwaysRebuild
+
+	name       resource.Name
+	logger     logging.Logger
+	conn       *roombaConn
+	longPress  time.Duration
+	shortPress *buttonTarget
+	longAction *buttonTarget
+
+	cancelCtx  context.Context
+	cancelFunc func()
+	done       chan struct{}
+}
+
+// resolveButtonAction finds the resource an action is sent to among deps.
+func resolveButtonAction(deps resource.Dependencies, action *ButtonAction) (*buttonTarget, error) {
+	if action == nil {
+		return nil, nil
+	}
+	for name, res := range deps {
+		if name.ShortName() == action.Resource || name.Name == action.Resource {
+			return &buttonTarget{res: res, command: action.Command}, nil
+		}
+	}
+	return nil, fmt.Errorf("resource %q not found", action.Resource)
+}
+
+func newCleanButton(ctx context.Context, deps resource.Dependencies, rawConf resource.Config, logger logging.Logger) (button.Button, error) {
+	conf, err := resource.NativeConfig[*ButtonConfig](rawConf)
+	if err != nil {
+		return nil, err
+	}
+	serialPort, err := resolveSerialPort(deps, conf.SerialPort, conf.Controller)
+	if err != nil {
+		return nil, err
+	}
+	shortPress, err := resolveButtonAction(deps, conf.ShortPress)
+	if err != nil {
+		return nil, fmt.Errorf("short_press: %w", err)
+	}
+	longAction, err := resolveButtonAction(deps, conf.LongPress)
+	if err != nil {
+		return nil, fmt.Errorf("long_press: %w", err)
+	}
+	conn, err := acquireConn(serialPort, 0, defaultOIProfile)
+	if err != nil {
+		return nil, err
+	}
+
+	longPress := time.Duration(conf.LongPressMS) * time.Millisecond
+	if longPress == 0 {
+		longPress = defaultLongPress
+	}
+	cancelCtx, cancelFunc := context.WithCancel(context.Background())
+	b := &cleanButton{
+		name:       rawConf.ResourceName(),
+		logger:     logger,
+		conn:       conn,
+		longPress:  longPress,
+		shortPress: shortPress,
+		longAction: longAction,
+		cancelCtx:  cancelCtx,
+		cancelFunc: cancelFunc,
+		done:       make(chan struct{}),
+	}
+	goSafe(b.watch)
+
+	logger.Infof("Roomba Clean button on %s", serialPort)
+	return b, nil
+}
+
+func (b *cleanButton) Name() resource.Name {
+	return b.name
+}
+
+// watch polls the Buttons packet (18) until the button is closed. A press
+// held for longPress is a long press, acted on as soon as it has been held
+// that long; one released sooner is a short press, acted on at release.
+func (b *cleanButton) watch() {
+	defer close(b.done)
+	ticker := time.NewTicker(buttonPollInterval)
+	defer ticker.Stop()
+	var pressedAt time.Time
+	longFired := false
+	for {
+		select {
+		case <-ticker.C:
+		case <-b.cancelCtx.Done():
+			return
+		}
+
+		if err := b.conn.mu.LockContext(b.cancelCtx); err != nil {
+			return
+		}
+		data, err := b.conn.sensor(18)
+		b.conn.mu.Unlock()
+		if err != nil || len(data) < 1 {
+			continue
+		}
+		pressed := data[0]&0x01 != 0
+		now := time.Now()
+		switch {
+		case pressed && pressedAt.IsZero():
+			pressedAt, longFired = now, false
+		case pressed && !longFired && now.Sub(pressedAt) >= b.longPress:
+			longFired = true
+			goSafe(func() { b.run("long", b.longAction) })
+		case !pressed && !pressedAt.IsZero():
+			if !longFired {
+				goSafe(func() { b.run("short", b.shortPress) })
+			}
+			pressedAt = time.Time{}
+		}
+	}
+}
+
+// run sends a press's DoCommand, logging the outcome.
+func (b *cleanButton) run(press string, target *buttonTarget) error {
+	if target == nil {
+		b.logger.Debugf("Clean button %s press has no action", press)
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(b.cancelCtx, buttonActionTimeout)
+	defer cancel()
+	b.logger.Infof("Clean button %s press: sending %v to %s", press, target.command, target.res.Name())
+	if _, err := target.res.DoCommand(ctx, target.command); err != nil {
+		b.logger.Warnf("Clean button %s press action on %s failed: %v", press, target.res.Name(), err)
+		return err
+	}
+	return nil
+}
+
+// Push runs the short press action, or the long press action if
+// extra["long"] is true, and returns its error.
+func (b *cleanButton) Push(ctx context.Context, extra map[string]any) error {
+	if long, _ := extra["long"].(bool); long {
+		if b.longAction == nil {
+			return errors.New("no long_press action is configured")
+		}
+		return b.run("long", b.longAction)
+	}
+	if b.shortPress == nil {
+		return errors.New("no short_press action is configured")
+	}
+	return b.run("short", b.shortPress)
+}
+
+func (b *cleanButton) DoCommand(ctx context.Context, cmd map[string]any) (map[string]any, error) {
+	return nil, errUnimplemented
+}
+
+func (b *cleanButton) Close(ctx context.Context) error {
+	b.cancelFunc()
+	<-b.done
+	releaseConn(b.conn)
+	return nil
+}
@@ -0,0 +1,116 @@
+package viamroomba
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+)
+
+const (
+	// minCalibrationDistanceMM and minCalibrationAngleDeg are the least
+	// travel a calibration run must cover for the packets' 1mm and 1°
+	// resolution to matter little.
+	minCalibrationDistanceMM = 500.0
+	minCalibrationAngleDeg   = 180.0
+	// minOdometryScale and maxOdometryScale bound distance_scale and
+	// angle_scale; firmware errors are a few percent, and anything far off
+	// is a failed calibration run.
+	minOdometryScale = 0.5
+	maxOdometryScale = 2.0
+)
+
+// validateOdometryScale checks distance_scale or angle_scale.
+func validateOdometryScale(name string, scale float64) error {
+	if scale != 0 && (scale < minOdometryScale || scale > maxOdometryScale) {
+		return fmt.Errorf("%s must be in [%g, %g]", name, minOdometryScale, maxOdometryScale)
+	}
+	return nil
+}
+
+// odometryCalibration is a calibration run in progress: the raw distance
+// and angle when it started. Guarded by conn.mu.
+type odometryCalibration struct {
+	started              bool
+	distanceMM, angleDeg float64
+}
+
+// startCalibration serves start_odometry_calibration.
+func (s *viamRoombaBase) startCalibration(ctx context.Context, _ noArgs) (map[string]any, error) {
+	if s.dryRun != nil {
+		return nil, errors.New("odometry can't be calibrated with dry_run")
+	}
+	if err := s.conn.mu.LockContext(ctx); err != nil {
+		return nil, err
+	}
+	defer s.conn.mu.Unlock()
+	if _, _, err := s.conn.readOdometry(); err != nil {
+		return nil, fmt.Errorf("failed to read odometry: %w", err)
+	}
+	distance, angle := s.conn.odom.raw()
+	s.calibration = odometryCalibration{started: true, distanceMM: distance, angleDeg: angle}
+	return map[string]any{"status": "started"}, nil
+}
+
+// finishCalibrationArgs are the parameters of finish_odometry_calibration.
+type finishCalibrationArgs struct {
+	ActualDistanceMM *float64 `json:"actual_distance_mm" doc:"How far the robot actually traveled, measured"`
+	ActualAngleDeg   *float64 `json:"actual_angle_deg" doc:"How far the robot actually turned, measured; positive is counterclockwise"`
+	Apply            bool     `json:"apply" doc:"Use the new scales until the module restarts"`
+}
+
+// finishCalibration serves finish_odometry_calibration: it compares the
+// distance or angle the robot reported since start_odometry_calibration
+// with what was measured, and returns the scales that make them agree.
+func (s *viamRoombaBase) finishCalibration(ctx context.Context, args finishCalibrationArgs) (map[string]any, error) {
+	if args.ActualDistanceMM == nil && args.ActualAngleDeg == nil {
+		return nil, errors.New("finish_odometry_calibration needs actual_distance_mm, actual_angle_deg, or both")
+	}
+	if err := s.conn.mu.LockContext(ctx); err != nil {
+		return nil, err
+	}
+	defer s.conn.mu.Unlock()
+	if !s.calibration.started {
+		return nil, errors.New("send start_odometry_calibration first")
+	}
+	if _, _, err := s.conn.readOdometry(); err != nil {
+		return nil, fmt.Errorf("failed to read odometry: %w", err)
+	}
+	distance, angle := s.conn.odom.raw()
+	rawDistance := distance - s.calibration.distanceMM
+	rawAngle := angle - s.calibration.angleDeg
+	distanceScale, angleScale := s.conn.odom.scales()
+	out := map[string]any{
+		"raw_distance_mm": rawDistance,
+		"raw_angle_deg":   rawAngle,
+	}
+
+	if args.ActualDistanceMM != nil {
+		if math.Abs(rawDistance) < minCalibrationDistanceMM {
+			return nil, fmt.Errorf("the robot reported only %.0fmm of travel; drive at least %.0fmm straight", rawDistance, minCalibrationDistanceMM)
+		}
+		distanceScale = *args.ActualDistanceMM / rawDistance
+		if err := validateOdometryScale("distance_scale", distanceScale); err != nil {
+			return nil, fmt.Errorf("the measured distance gives a distance_scale of %.3f; check the measurement: %w", distanceScale, err)
+		}
+		out["distance_scale"] = distanceScale
+	}
+	if args.ActualAngleDeg != nil {
+		if math.Abs(rawAngle) < minCalibrationAngleDeg {
+			return nil, fmt.Errorf("the robot reported only %.0f° of turning; spin at least %.0f°", rawAngle, minCalibrationAngleDeg)
+		}
+		angleScale = *args.ActualAngleDeg / rawAngle
+		if err := validateOdometryScale("angle_scale", angleScale); err != nil {
+			return nil, fmt.Errorf("the measured angle gives an angle_scale of %.3f; check the measurement: %w", angleScale, err)
+		}
+		out["angle_scale"] = angleScale
+	}
+	s.calibration = odometryCalibration{}
+	if args.Apply {
+		s.conn.odom.setScales(distanceScale, angleScale)
+		s.logger.Infof("Odometry scales set to distance %.3f, angle %.3f until the module restarts; "+
+			"set distance_scale and angle_scale to keep them", distanceScale, angleScale)
+	}
+	out["applied"] = args.Apply
+	return out, nil
+}
@@ -0,0 +1,107 @@
+package viamroomba
+
+import (
+	"strconv"
+	"time"
+)
+
+// probeReadTimeout bounds each capability probe, so a robot that ignores an
+// unsupported packet costs a fraction of a second rather than the normal
+// read timeout.
+const probeReadTimeout = 200 * time.Millisecond
+
+// capabilityProbes are the packets probed on connect. Each was added in a
+// later OI revision than the basic 7-42 set that every Roomba answers.
+var capabilityProbes = []byte{
+	41,  // Requested Right Velocity; present exactly when Drive Direct (145) is supported
+	43,  // Left Encoder Counts
+	45,  // Light Bumper
+	52,  // IR Opcode Left
+	56,  // Main Brush Motor Current
+	58,  // Stasis
+	100, // Group packet 7-58
+}
+
+// capabilities records which optional packets the attached robot answers.
+type capabilities struct {
+	probed  bool
+	packets map[byte]bool
+}
+
+// hasPacket reports whether a packet is supported. Packets that weren't
+// probed are covered by the probe for the same OI revision.
+func (c capabilities) hasPacket(id byte) bool {
+	switch {
+	case id <= 40:
+		return true
+	case id == 42:
+		id = 41
+	case id == 44:
+		id = 43
+	case id >= 46 && id <= 51:
+		id = 45
+	case id == 53:
+		id = 52
+	case id >= 54 && id <= 57:
+		id = 56
+	case id == 101 || id >= 106 && id <= 107:
+		id = 100
+	}
+	return c.packets[id]
+}
+
+// features names what the probed packets enable, for get_capabilities.
+func (c capabilities) features() map[string]bool {
+	return map[string]bool{
+		"drive_direct":   c.hasPacket(41),
+		"encoders":       c.hasPacket(43),
+		"light_bumper":   c.hasPacket(45),
+		"directional_ir": c.hasPacket(52),
+		"motor_currents": c.hasPacket(56),
+		"stasis":         c.hasPacket(58),
+		"group_packets":  c.hasPacket(100),
+	}
+}
+
+// report formats the capability set for DoCommand.
+func (c capabilities) report() map[string]any {
+	packets := map[string]any{}
+	for _, id := range capabilityProbes {
+		packets[strconv.Itoa(int(id))] = c.packets[id]
+	}
+	features := map[string]any{}
+	for name, ok := range c.features() {
+		features[name] = ok
+	}
+	return map[string]any{
+		"probed":   c.probed,
+		"packets":  packets,
+		"features": features,
+	}
+}
+
+// discoverCapabilities probes which optional packets the robot answers. On
+// platforms where a serial read can't time out, an unanswered probe would
+// hang, so every packet is assumed supported (as on a 600-series robot)
+// instead. Callers must hold c.mu.
+func (c *roombaConn) discoverCapabilities() capabilities {
+	caps := capabilities{packets: map[byte]bool{}}
+	if !canTimeoutReads {
+		for _, id := range capabilityProbes {
+			caps.packets[id] = true
+		}
+		return caps
+	}
+	caps.probed = true
+	c.setReadTimeout(probeReadTimeout)
+	defer c.setReadTimeout(2 * time.Second)
+	for _, id := range capabilityProbes {
+		c.flushRx()
+		data, err := c.sensorOnce(id)
+		if err == nil && validateResponse([]byte{id}, [][]byte{data}) == nil {
+			caps.packets[id] = true
+		}
+	}
+	c.flushRx()
+	return caps
+}
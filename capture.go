@@ -0,0 +1,174 @@
+package viamroomba
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// captureLinkType is the pcap link type of capture files, LINKTYPE_USER0,
+	// which is reserved for private formats: each record is a direction byte
+	// (captureTX or captureRX) followed by the bytes sent or received.
+	captureLinkType = 147
+	captureTX       = 0
+	captureRX       = 1
+
+	defaultCaptureMaxMB = 16
+	maxCaptureMaxMB     = 256
+)
+
+// byteCapture records the raw bytes exchanged with the robot to a pcap file
+// in the module data directory, so a user can send maintainers exactly what
+// went over the wire instead of describing it. Each read or write on the port
+// is one record, timestamped to the microsecond. Recording stops by itself
+// once the file reaches maxBytes. Bytes the handshake exchanges before the
+// port is installed, and stray bytes flushed while resyncing, aren't seen.
+type byteCapture struct {
+	mu       sync.Mutex
+	f        *os.File
+	path     string
+	started  time.Time
+	size     int64
+	maxBytes int64
+	records  int
+	tx, rx   uint64
+	// full is set once the file reached maxBytes, and err once a write
+	// failed; either stops the recording but leaves the file open until
+	// stop_capture.
+	full bool
+	err  error
+}
+
+// start opens a new capture file at path and writes the pcap header.
+func (b *byteCapture) start(path string, maxBytes int64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.f != nil {
+		return fmt.Errorf("a capture is already running to %s", b.path)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create capture file: %w", err)
+	}
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:], 0xa1b2c3d4)
+	binary.LittleEndian.PutUint16(header[4:], 2)
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], 65535)
+	binary.LittleEndian.PutUint32(header[20:], captureLinkType)
+	if _, err := f.Write(header); err != nil {
+		f.Close()
+		os.Remove(path)
+		return fmt.Errorf("failed to write capture file: %w", err)
+	}
+	b.f, b.path, b.started = f, path, time.Now()
+	b.size, b.maxBytes = int64(len(header)), maxBytes
+	b.records, b.tx, b.rx = 0, 0, 0
+	b.full, b.err = false, nil
+	return nil
+}
+
+// record appends one read or write to the capture, if one is running.
+func (b *byteCapture) record(dir byte, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.f == nil || b.full || b.err != nil {
+		return
+	}
+	now := time.Now()
+	rec := make([]byte, 16, 17+len(data))
+	binary.LittleEndian.PutUint32(rec[0:], uint32(now.Unix()))
+	binary.LittleEndian.PutUint32(rec[4:], uint32(now.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(rec[8:], uint32(1+len(data)))
+	binary.LittleEndian.PutUint32(rec[12:], uint32(1+len(data)))
+	rec = append(append(rec, dir), data...)
+	if b.size+int64(len(rec)) > b.maxBytes {
+		b.full = true
+		return
+	}
+	if _, err := b.f.Write(rec); err != nil {
+		b.err = err
+		return
+	}
+	b.size += int64(len(rec))
+	b.records++
+	if dir == captureTX {
+		b.tx += uint64(len(data))
+	} else {
+		b.rx += uint64(len(data))
+	}
+}
+
+// status describes the running capture. Callers must hold b.mu.
+func (b *byteCapture) status() map[string]any {
+	out := map[string]any{
+		"path":          b.path,
+		"duration_sec":  time.Since(b.started).Seconds(),
+		"records":       b.records,
+		"bytes_written": b.tx,
+		"bytes_read":    b.rx,
+		"size_bytes":    b.size,
+		"full":          b.full,
+	}
+	if b.err != nil {
+		out["error"] = b.err.Error()
+	}
+	return out
+}
+
+// stop closes the capture file and returns what was recorded.
+func (b *byteCapture) stop() (map[string]any, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.f == nil {
+		return nil, errors.New("no capture is running")
+	}
+	out := b.status()
+	err := b.f.Close()
+	b.f = nil
+	if err != nil {
+		return nil, fmt.Errorf("failed to close capture file %s: %w", b.path, err)
+	}
+	return out, nil
+}
+
+// captureArgs are the parameters of start_capture.
+type captureArgs struct {
+	MaxMB *float64 `json:"max_mb" doc:"Stop recording once the file reaches this size; defaults to 16, up to 256"`
+}
+
+// startCapture serves start_capture.
+func (c *roombaConn) startCapture(_ context.Context, args captureArgs) (map[string]any, error) {
+	maxMB := float64(defaultCaptureMaxMB)
+	if args.MaxMB != nil {
+		maxMB = *args.MaxMB
+		if maxMB <= 0 || maxMB > maxCaptureMaxMB {
+			return nil, fmt.Errorf("max_mb must be in (0, %d]", maxCaptureMaxMB)
+		}
+	}
+	dir := os.Getenv("VIAM_MODULE_DATA")
+	if dir == "" {
+		return nil, errors.New("start_capture needs the module data directory ($VIAM_MODULE_DATA)")
+	}
+	name := fmt.Sprintf("capture_%s_%s.pcap",
+		unsafeFileChars.ReplaceAllString(filepath.Base(c.serialPort), "_"), time.Now().Format("20060102-150405"))
+	path := filepath.Join(dir, name)
+	if err := c.capture.start(path, int64(maxMB*1024*1024)); err != nil {
+		return nil, err
+	}
+	return map[string]any{"path": path}, nil
+}
+
+// stopCapture serves stop_capture.
+func (c *roombaConn) stopCapture(context.Context, noArgs) (map[string]any, error) {
+	return c.capture.stop()
+}
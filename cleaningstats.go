@@ -0,0 +1,231 @@
+package viamroomba
+
+import (
+	"context"
+	"encoding/binary"
+	"time"
+)
+
+const (
+	// maxCleaningSessions bounds the cleaning history kept and persisted.
+	maxCleaningSessions = 50
+	// cleaningStillTimeout is how long the robot may sit still before a
+	// cleaning cycle is taken to have ended. The robot doesn't report the
+	// end of a cycle that stops short of the dock.
+	cleaningStillTimeout = time.Minute
+)
+
+// cleaningSession is the statistics of one cleaning cycle, from the clean,
+// spot_clean, or max_clean command that started it until the robot reaches
+// the dock, sits still for cleaningStillTimeout, or is sent another
+// command.
+type cleaningSession struct {
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end,omitempty"`
+	RuntimeSec float64   `json:"runtime_sec"`
+	DistanceMM float64   `json:"distance_mm"`
+	// AreaM2 is the area of the coverage cells swept during the session.
+	AreaM2     float64 `json:"area_m2"`
+	DirtEvents int     `json:"dirt_events"`
+	// BatteryUsedMAh is the charge the session drew, which is 0 if the
+	// battery couldn't be read at both ends.
+	BatteryUsedMAh int `json:"battery_used_mah"`
+	// EnergyUsedMWh is the energy the session drew, integrated from the
+	// battery's voltage and current.
+	EnergyUsedMWh float64 `json:"energy_used_mwh"`
+	// EndedBy is how the cycle ended: "docked", "stopped", or the
+	// operation the robot was sent next, such as "idle" or "docking".
+	EndedBy string `json:"ended_by,omitempty"`
+}
+
+// cleaningStats tracks cleaning sessions for the coverage service, from the
+// shared activity, odometry, and the packets the service samples. It
+// relies only on the OI, not on the robot's firmware or app, so it works
+// on every model. Guarded by the coverage service's mu.
+type cleaningStats struct {
+	store   *stateStore
+	history []cleaningSession
+	// cellM2 is the area of one coverage cell.
+	cellM2 float64
+
+	// current is nil between sessions.
+	current *cleaningSession
+	cells   map[cell]bool
+	// startTotals and startChargeMAh are the odometry totals and battery
+	// charge when the session started; startChargeMAh is -1 if the
+	// battery couldn't be read then.
+	startTotals    odometryTotals
+	startChargeMAh int
+	lastChargeMAh  int
+	// dirty is whether dirt was detected at the last sample, so a patch of
+	// dirt counts as one event rather than one per sample.
+	dirty bool
+	// offDock is whether the robot has left the dock since the session
+	// started, so reaching it again ends the session. lastMoved is when
+	// the odometry last moved.
+	offDock   bool
+	lastMoved time.Time
+	// over is set when a session ended by itself while the activity is
+	// still "clean", so no new one starts until the robot is sent
+	// something else.
+	over bool
+}
+
+// cleaningState is what the coverage service persists.
+type cleaningState struct {
+	Sessions []cleaningSession `json:"cleaning_sessions"`
+	// Energy is the energy statistics' totals by kind of operation.
+	Energy map[string]operationEnergy `json:"energy,omitempty"`
+}
+
+// cleaningPackets are read with the odometry while a session runs: Dirt
+// Detect (15), Battery Charge (25), and Charging Sources Available (34).
+var cleaningPackets = []byte{15, 25, 34}
+
+// sample records one pose sample: kind is the running operation, and data,
+// if not nil, cleaningPackets read with it. It reports whether a session
+// ended, so the history should be saved.
+func (c *cleaningStats) sample(now time.Time, kind string, totals odometryTotals, data [][]byte) bool {
+	dirt, charge, docked := 0, -1, false
+	if data != nil {
+		dirt, charge, docked = int(data[0][0]), int(binary.BigEndian.Uint16(data[1])), data[2][0]&0x02 != 0
+	}
+
+	switch {
+	case kind != "clean":
+		c.over = false
+		if c.current == nil {
+			return false
+		}
+		c.current.EndedBy = kind
+		c.finish(now, totals)
+		return true
+	case c.over:
+		return false
+	case c.current == nil:
+		c.current = &cleaningSession{Start: now}
+		c.cells = map[cell]bool{}
+		c.startTotals = totals
+		c.startChargeMAh, c.lastChargeMAh = charge, charge
+		c.dirty, c.offDock, c.lastMoved = false, data != nil && !docked, now
+	}
+
+	if totals.DistanceMM != c.current.DistanceMM+c.startTotals.DistanceMM {
+		c.lastMoved = now
+	}
+	if dirt > 0 && !c.dirty {
+		c.current.DirtEvents++
+	}
+	c.dirty = dirt > 0
+	if charge >= 0 {
+		c.lastChargeMAh = charge
+		if c.startChargeMAh < 0 {
+			c.startChargeMAh = charge
+		}
+	}
+	c.update(now, totals)
+
+	switch {
+	case docked && c.offDock:
+		c.current.EndedBy = "docked"
+	case now.Sub(c.lastMoved) >= cleaningStillTimeout:
+		c.current.EndedBy = "stopped"
+		now = c.lastMoved
+	default:
+		c.offDock = c.offDock || data != nil && !docked
+		return false
+	}
+	c.finish(now, totals)
+	c.over = true
+	return true
+}
+
+// update brings the running session's figures up to date.
+func (c *cleaningStats) update(now time.Time, totals odometryTotals) {
+	c.current.RuntimeSec = now.Sub(c.current.Start).Seconds()
+	c.current.DistanceMM = totals.DistanceMM - c.startTotals.DistanceMM
+	c.current.AreaM2 = float64(len(c.cells)) * c.cellM2
+	if c.startChargeMAh >= 0 {
+		c.current.BatteryUsedMAh = max(0, c.startChargeMAh-c.lastChargeMAh)
+	}
+}
+
+// finish ends the running session and adds it to the history.
+func (c *cleaningStats) finish(now time.Time, totals odometryTotals) {
+	c.update(now, totals)
+	c.current.End = now
+	c.history = append(c.history, *c.current)
+	if len(c.history) > maxCleaningSessions {
+		c.history = c.history[len(c.history)-maxCleaningSessions:]
+	}
+	c.current, c.cells = nil, nil
+}
+
+// addEnergy counts energy drawn toward the running session.
+func (c *cleaningStats) addEnergy(mwh float64) {
+	if c.current != nil {
+		c.current.EnergyUsedMWh += mwh
+	}
+}
+
+// sweep counts a coverage cell toward the running session's area.
+func (c *cleaningStats) sweep(at cell) {
+	if c.cells != nil {
+		c.cells[at] = true
+	}
+}
+
+// cleaningStats serves get_cleaning_stats.
+func (s *coverageService) cleaningStats(context.Context, noArgs) (map[string]any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := &s.stats
+
+	sessions := make([]any, 0, len(c.history))
+	var runtimeSec, distanceMM, areaM2 float64
+	var dirtEvents, batteryMAh int
+	var energyMWh float64
+	for _, session := range c.history {
+		sessions = append(sessions, sessionMap(session))
+		runtimeSec += session.RuntimeSec
+		distanceMM += session.DistanceMM
+		areaM2 += session.AreaM2
+		dirtEvents += session.DirtEvents
+		batteryMAh += session.BatteryUsedMAh
+		energyMWh += session.EnergyUsedMWh
+	}
+	out := map[string]any{
+		"sessions": sessions,
+		"totals": map[string]any{
+			"sessions":         len(c.history),
+			"runtime_sec":      runtimeSec,
+			"distance_mm":      distanceMM,
+			"area_m2":          areaM2,
+			"dirt_events":      dirtEvents,
+			"battery_used_mah": batteryMAh,
+			"energy_used_mwh":  energyMWh,
+		},
+	}
+	if c.current != nil {
+		out["current"] = sessionMap(*c.current)
+	}
+	return out, nil
+}
+
+// sessionMap converts a session for DoCommand output.
+func sessionMap(session cleaningSession) map[string]any {
+	out := map[string]any{
+		"start":            session.Start.Format(time.RFC3339),
+		"runtime_sec":      session.RuntimeSec,
+		"distance_mm":      session.DistanceMM,
+		"area_m2":          session.AreaM2,
+		"dirt_events":      session.DirtEvents,
+		"battery_used_mah": session.BatteryUsedMAh,
+		"energy_used_mwh":  session.EnergyUsedMWh,
+	}
+	if !session.End.IsZero() {
+		out["end"] = session.End.Format(time.RFC3339)
+		out["ended_by"] = session.EndedBy
+	}
+	return out
+}
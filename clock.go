@@ -0,0 +1,67 @@
+package viamroomba
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.viam.com/rdk/logging"
+)
+
+// opSetDayTime sets the robot's clock. go-roomba doesn't wrap it.
+const opSetDayTime = 168
+
+// setDayTime sets the robot's clock, which keeps only the day of the week,
+// hour, and minute, to t. Callers must hold c.mu.
+func (c *roombaConn) setDayTime(t time.Time) error {
+	return c.write(opSetDayTime, []byte{byte(t.Weekday()), byte(t.Hour()), byte(t.Minute())})
+}
+
+// enableClockSync sets the robot's clock to the host's time now and again
+// every time the port is reopened after a link fault, for
+// sync_clock_on_connect. The robot loses its clock when the battery is
+// out, and the OI has no way to read it back, so setting it whenever the
+// module connects is the only way to keep it right. A failure is only
+// logged: a wrong clock shouldn't keep the component from starting.
+func (c *roombaConn) enableClockSync(ctx context.Context, logger logging.Logger) {
+	if err := c.mu.LockContext(ctx); err != nil {
+		logger.Warnf("Failed to set the robot's clock: %v", err)
+		return
+	}
+	defer c.mu.Unlock()
+	c.clockSync = true
+	if err := c.setDayTime(time.Now()); err != nil {
+		logger.Warnf("Failed to set the robot's clock: %v", err)
+	}
+}
+
+// syncClockArgs are the parameters of sync_clock.
+type syncClockArgs struct {
+	Timezone string `json:"timezone" doc:"IANA time zone to set the clock in, e.g. America/New_York; defaults to the host's"`
+}
+
+// syncClock serves sync_clock: it sets the robot's clock, which scheduled
+// cleanings and the display run on, to the host's time.
+func (c *roombaConn) syncClock(ctx context.Context, args syncClockArgs) (map[string]any, error) {
+	now := time.Now()
+	if args.Timezone != "" {
+		loc, err := time.LoadLocation(args.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("timezone: %w", err)
+		}
+		now = now.In(loc)
+	}
+	if err := c.mu.LockContext(ctx); err != nil {
+		return nil, err
+	}
+	defer c.mu.Unlock()
+	if err := c.setDayTime(now); err != nil {
+		return nil, fmt.Errorf("failed to set the robot's clock: %w", err)
+	}
+	return map[string]any{
+		"day":      strings.ToLower(now.Weekday().String()),
+		"time":     now.Format("15:04"),
+		"timezone": now.Location().String(),
+	}, nil
+}
@@ -5,10 +5,7 @@ import (
 	"log"
 	viamroomba "viamroomba"
 
-	base "go.viam.com/rdk/components/base"
-	"go.viam.com/rdk/components/sensor"
 	"go.viam.com/rdk/module"
-	"go.viam.com/rdk/resource"
 )
 
 func main() {
@@ -17,8 +14,9 @@ func main() {
 	// Discard the default logger to suppress that noise.
 	log.SetOutput(io.Discard)
 
-	module.ModularMain(
-		resource.APIModel{API: base.API, Model: viamroomba.Base},
-		resource.APIModel{API: sensor.API, Model: viamroomba.Sensor},
-	)
+	// Leave every robot stopped if the module panics or is shut down.
+	defer viamroomba.RecoverToSafeState()
+	viamroomba.StopOnSignal()
+
+	module.ModularMain(viamroomba.Models...)
 }
@@ -0,0 +1,387 @@
+package viamroomba
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// noArgs is the argument struct of commands that take no parameters.
+type noArgs struct{}
+
+// command is one DoCommand: its name, a description for list_commands, the
+// struct its parameters are decoded into, and the handler.
+//
+// Parameters are declared as fields of the argument struct, named by their
+// json tag and described by a doc tag. Fields tagged required:"true" must be
+// present; optional fields that need to tell "unset" from zero are pointers.
+type command struct {
+	name     string
+	doc      string
+	argsType reflect.Type
+	run      func(ctx context.Context, raw map[string]any) (map[string]any, error)
+	// check decodes and validates the parameters without running anything,
+	// so a batch can check every command before the first runs.
+	check func(raw map[string]any) error
+	// solo commands can't run in a batch; see alone.
+	solo bool
+}
+
+// newCommand builds a command whose handler receives its parameters decoded
+// and validated into T.
+func newCommand[T any](name, doc string, handler func(context.Context, T) (map[string]any, error)) command {
+	return command{
+		name:     name,
+		doc:      doc,
+		argsType: reflect.TypeFor[T](),
+		run: func(ctx context.Context, raw map[string]any) (map[string]any, error) {
+			var args T
+			if err := decodeArgs(raw, &args); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			return handler(ctx, args)
+		},
+		check: func(raw map[string]any) error {
+			var args T
+			if err := decodeArgs(raw, &args); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			return nil
+		},
+	}
+}
+
+// alone marks a command that must be sent on its own rather than in a batch:
+// one that hands a motion to the motion executor, or waits on it, would
+// stall on the bus the batch holds.
+func (c command) alone() command {
+	c.solo = true
+	return c
+}
+
+// maxBatchCommands bounds how many commands one batch may run.
+const maxBatchCommands = 32
+
+// commandSet dispatches DoCommand requests. It serves list_commands and
+// batches itself.
+type commandSet []command
+
+func (cs commandSet) dispatch(ctx context.Context, cmd map[string]any) (map[string]any, error) {
+	defer RecoverToSafeState()
+	if _, ok := cmd["command"]; !ok {
+		if _, ok := cmd["commands"]; ok {
+			return cs.batch(ctx, cmd)
+		}
+	}
+	c, err := cs.lookup(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return c.run(ctx, cmd)
+}
+
+// lookup finds the command a request names.
+func (cs commandSet) lookup(cmd map[string]any) (command, error) {
+	name, ok := cmd["command"].(string)
+	if !ok {
+		return command{}, errors.New("command must be a string")
+	}
+	if name == "list_commands" {
+		return newCommand(name, "", func(context.Context, noArgs) (map[string]any, error) {
+			return cs.list(), nil
+		}), nil
+	}
+	for _, c := range cs {
+		if c.name == name {
+			return c, nil
+		}
+	}
+	names := []string{"list_commands"}
+	for _, c := range cs {
+		names = append(names, c.name)
+	}
+	if guess := closest(name, names); guess != "" {
+		return command{}, fmt.Errorf("unknown command: %s (did you mean %s?)", name, guess)
+	}
+	return command{}, fmt.Errorf("unknown command: %s", name)
+}
+
+// batch serves {"commands": [...]}: each entry is a request of its own, and
+// they run in order with the bus held from the first command that uses it
+// until the last has finished, so no other client's traffic or background
+// check lands between dependent commands. Every entry is checked before any
+// runs, so an unknown command or bad parameter fails the whole batch with
+// nothing sent. Once running, the batch stops at the first command that
+// fails; what the robot already did can't be undone, so the error says how
+// many commands ran.
+func (cs commandSet) batch(ctx context.Context, cmd map[string]any) (map[string]any, error) {
+	for k := range cmd {
+		if k != "commands" {
+			return nil, fmt.Errorf("a batch takes only commands, not %q", k)
+		}
+	}
+	list, ok := cmd["commands"].([]any)
+	if !ok {
+		return nil, errors.New("commands must be a list of commands")
+	}
+	if len(list) == 0 || len(list) > maxBatchCommands {
+		return nil, fmt.Errorf("a batch must have between 1 and %d commands, not %d", maxBatchCommands, len(list))
+	}
+
+	requests := make([]map[string]any, len(list))
+	cmds := make([]command, len(list))
+	for i, entry := range list {
+		req, ok := entry.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("commands[%d] must be an object", i)
+		}
+		c, err := cs.lookup(req)
+		if err != nil {
+			return nil, fmt.Errorf("commands[%d]: %w", i, err)
+		}
+		if c.solo {
+			return nil, fmt.Errorf("commands[%d]: %s can't run in a batch; send it on its own", i, c.name)
+		}
+		if err := c.check(req); err != nil {
+			return nil, fmt.Errorf("commands[%d]: %w", i, err)
+		}
+		requests[i], cmds[i] = req, c
+	}
+
+	b := &busBatch{}
+	defer b.release()
+	ctx = context.WithValue(ctx, batchKey{}, b)
+	results := make([]any, 0, len(cmds))
+	for i, c := range cmds {
+		resp, err := c.run(ctx, requests[i])
+		if err != nil {
+			return nil, fmt.Errorf("commands[%d] (%s) failed after %d of %d commands ran: %w", i, c.name, i, len(cmds), err)
+		}
+		if resp == nil {
+			resp = map[string]any{}
+		}
+		results = append(results, resp)
+	}
+	return map[string]any{"results": results}, nil
+}
+
+// inBatch reports whether ctx is that of a command running in a batch, for
+// commands that would hold the bus too long to be batched with some
+// parameters.
+func inBatch(ctx context.Context) bool {
+	return ctx.Value(batchKey{}) != nil
+}
+
+// batchNames lists the commands a batch request names, or nothing if cmd
+// isn't a batch.
+func batchNames(cmd map[string]any) []string {
+	if _, ok := cmd["command"]; ok {
+		return nil
+	}
+	list, _ := cmd["commands"].([]any)
+	var names []string
+	for _, entry := range list {
+		if req, ok := entry.(map[string]any); ok {
+			if name, ok := req["command"].(string); ok {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// list formats every command and its parameters for list_commands.
+func (cs commandSet) list() map[string]any {
+	commands := []any{map[string]any{
+		"command":     "list_commands",
+		"description": "List every supported command and its parameters",
+		"params":      []any{},
+	}}
+	for _, c := range cs {
+		params := []any{}
+		for _, f := range argFields(c.argsType) {
+			params = append(params, map[string]any{
+				"name":        f.name,
+				"type":        f.typ,
+				"required":    f.required,
+				"description": f.doc,
+			})
+		}
+		commands = append(commands, map[string]any{
+			"command":     c.name,
+			"description": c.doc,
+			"params":      params,
+		})
+	}
+	return map[string]any{"commands": commands}
+}
+
+// argField is one parameter of an argument struct.
+type argField struct {
+	name     string
+	typ      string // number, bool, string, list, or object
+	required bool
+	doc      string
+}
+
+// argFields lists the parameters of an argument struct, including those of
+// embedded structs.
+func argFields(t reflect.Type) []argField {
+	var fields []argField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			fields = append(fields, argFields(f.Type)...)
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		fields = append(fields, argField{
+			name:     name,
+			typ:      jsonTypeName(f.Type),
+			required: f.Tag.Get("required") == "true",
+			doc:      f.Tag.Get("doc"),
+		})
+	}
+	return fields
+}
+
+func jsonTypeName(t reflect.Type) string {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "bool"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		return "list"
+	case reflect.Map, reflect.Struct, reflect.Interface:
+		return "object"
+	default:
+		return "number"
+	}
+}
+
+// decodeArgs decodes a DoCommand payload into args, reporting every unknown
+// (e.g. misspelled) and missing required parameter at once.
+func decodeArgs(raw map[string]any, args any) error {
+	fields := argFields(reflect.TypeOf(args).Elem())
+	known := make([]string, 0, len(fields))
+	for _, f := range fields {
+		known = append(known, f.name)
+	}
+
+	var problems []string
+	keys := make([]string, 0, len(raw))
+	for k := range raw {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if k == "command" || contains(known, k) {
+			continue
+		}
+		if guess := closest(k, known); guess != "" {
+			problems = append(problems, fmt.Sprintf("unknown parameter %q (did you mean %q?)", k, guess))
+		} else {
+			problems = append(problems, fmt.Sprintf("unknown parameter %q", k))
+		}
+	}
+	for _, f := range fields {
+		if _, ok := raw[f.name]; f.required && !ok {
+			problems = append(problems, fmt.Sprintf("missing required parameter %q", f.name))
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, args); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return fmt.Errorf("parameter %q must be a %s, got %s", typeErr.Field, jsonTypeName(typeErr.Type), typeErr.Value)
+		}
+		return err
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// closest returns the candidate within two edits of s, for "did you mean"
+// hints, or "" if none is that close.
+func closest(s string, candidates []string) string {
+	best, bestDist := "", 3
+	for _, c := range candidates {
+		if d := editDistance(s, c); d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// connCommands are served by every component, since they describe the
+// serial connection rather than the component.
+func connCommands(conn *roombaConn) []command {
+	return []command{
+		newCommand("get_metrics", "Serial link counters and latency histograms",
+			func(context.Context, noArgs) (map[string]any, error) {
+				return conn.metrics.snapshot(), nil
+			}),
+		newCommand("get_capabilities", "Optional OI features the robot supports",
+			func(context.Context, noArgs) (map[string]any, error) {
+				report := conn.caps.report()
+				report["oi_profile"] = conn.profile.name
+				return report, nil
+			}),
+		newCommand("get_events", "Discrete events after a sequence number", conn.events.getEvents),
+		newCommand("get_readiness", "Whether the serial link is up", conn.readiness),
+		newCommand("get_obstacle_memory", "Remembered bump locations in the odometry frame", conn.obstacles.get),
+		newCommand("clear_obstacle_memory", "Forget every remembered bump location", conn.obstacles.clear),
+		newCommand("get_hazard_map", "Pose-stamped bump, cliff, and other safety events as GeoJSON-style points", conn.hazards.get),
+		newCommand("clear_hazard_map", "Forget every kept hazard event", conn.hazards.clear),
+		newCommand("sync_clock", "Set the robot's clock to the host's time", conn.syncClock),
+		newCommand("start_capture", "Record the raw bytes sent to and read from the robot to a pcap file", conn.startCapture),
+		newCommand("stop_capture", "Stop recording and close the capture file", conn.stopCapture),
+	}
+}
@@ -0,0 +1,88 @@
+package viamroomba
+
+import "testing"
+
+// testArgs is an argument struct with a required, an optional, and an
+// embedded parameter.
+type testArgs struct {
+	testTimeout
+	Speed   float64 `json:"speed_mm_per_sec" required:"true"`
+	Verbose bool    `json:"verbose"`
+}
+
+type testTimeout struct {
+	TimeoutMS float64 `json:"timeout_ms"`
+}
+
+func TestDecodeArgs(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		raw     map[string]any
+		want    testArgs
+		wantErr string
+	}{
+		{
+			name: "all set",
+			raw:  map[string]any{"command": "drive", "speed_mm_per_sec": 200.0, "verbose": true, "timeout_ms": 500.0},
+			want: testArgs{testTimeout: testTimeout{TimeoutMS: 500}, Speed: 200, Verbose: true},
+		},
+		{
+			name: "optional left out",
+			raw:  map[string]any{"speed_mm_per_sec": -50.0},
+			want: testArgs{Speed: -50},
+		},
+		{
+			name:    "missing required",
+			raw:     map[string]any{"verbose": true},
+			wantErr: `missing required parameter "speed_mm_per_sec"`,
+		},
+		{
+			name:    "misspelled",
+			raw:     map[string]any{"speed_mm_per_sec": 1.0, "verbos": true},
+			wantErr: `unknown parameter "verbos" (did you mean "verbose"?)`,
+		},
+		{
+			name:    "every problem at once",
+			raw:     map[string]any{"timout_ms": 1.0, "color": "red"},
+			wantErr: `unknown parameter "color"; unknown parameter "timout_ms" (did you mean "timeout_ms"?); missing required parameter "speed_mm_per_sec"`,
+		},
+		{
+			name:    "wrong type",
+			raw:     map[string]any{"speed_mm_per_sec": "fast"},
+			wantErr: `parameter "speed_mm_per_sec" must be a number, got string`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got testArgs
+			err := decodeArgs(tc.raw, &got)
+			switch {
+			case tc.wantErr != "":
+				if err == nil || err.Error() != tc.wantErr {
+					t.Errorf("decodeArgs(%v) error = %v, want %q", tc.raw, err, tc.wantErr)
+				}
+			case err != nil:
+				t.Errorf("decodeArgs(%v): %v", tc.raw, err)
+			case got != tc.want:
+				t.Errorf("decodeArgs(%v) = %+v, want %+v", tc.raw, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestClosest(t *testing.T) {
+	candidates := []string{"speed_mm_per_sec", "distance_mm", "timeout_ms", "angle_deg"}
+	for _, tc := range []struct {
+		s, want string
+	}{
+		{"distance_mm", "distance_mm"},
+		{"distanse_mm", "distance_mm"},
+		{"timeoutms", "timeout_ms"},
+		{"angle_dg", "angle_deg"},
+		{"angle_rad", ""},
+		{"", ""},
+	} {
+		if got := closest(tc.s, candidates); got != tc.want {
+			t.Errorf("closest(%q) = %q, want %q", tc.s, got, tc.want)
+		}
+	}
+}
@@ -1,54 +1,830 @@
 package viamroomba
 
 import (
+	"context"
+	"encoding/binary"
 	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/parabolala/go-roomba"
+	"github.com/xa4a/go-roomba/constants"
+	"go.viam.com/rdk/logging"
 )
 
+// OI opcodes sent through roombaConn.write.
+const (
+	opStart       = 128
+	opSafe        = 131
+	opFull        = 132
+	opPower       = 133
+	opSpot        = 134
+	opClean       = 135
+	opMax         = 136
+	opDrive       = 137
+	opSeekDock    = 143
+	opDriveDirect = 145
+	opPauseStream = 150
+)
+
+const (
+	// minCommandGap is the OI's internal update period; commands sent faster
+	// than this are queued in the robot's small input buffer and can be dropped.
+	minCommandGap = 15 * time.Millisecond
+	// modeChangeSettle is how long the OI needs after a mode command before it
+	// reliably accepts the next command.
+	modeChangeSettle = 20 * time.Millisecond
+	// driveCommandRate and driveCommandBurst bound how many Drive commands per
+	// second are forwarded, so 50Hz+ teleop can't flood the link.
+	driveCommandRate  = 40.0
+	driveCommandBurst = 5.0
+)
+
+// oiMode is the Open Interface operating mode, as reported by packet 35.
+type oiMode byte
+
+const (
+	oiOff oiMode = iota
+	oiPassive
+	oiSafe
+	oiFull
+)
+
+var oiModes = []string{"off", "passive", "safe", "full"}
+
+func (m oiMode) String() string {
+	if int(m) < len(oiModes) {
+		return oiModes[m]
+	}
+	return "unknown"
+}
+
+// oiTransitions lists the modes each mode can be switched to with one mode
+// command. Off only answers Start, which lands in Passive, and no mode
+// command turns the OI off: only Power does.
+var oiTransitions = map[oiMode][]oiMode{
+	oiOff:     {oiPassive},
+	oiPassive: {oiPassive, oiSafe, oiFull},
+	oiSafe:    {oiPassive, oiSafe, oiFull},
+	oiFull:    {oiPassive, oiSafe, oiFull},
+}
+
+// canSwitch reports whether one mode command takes the OI from one mode to
+// another.
+func canSwitch(from, to oiMode) bool {
+	return slices.Contains(oiTransitions[from], to)
+}
+
+// modeObserver is notified of every OI mode change. Observers run with the
+// connection lock held and must not call back into the connection.
+type modeObserver func(from, to oiMode)
+
+// busLock serializes access to the serial bus. It is a mutex that callers
+// serving an RPC can give up waiting on when the RPC's context is cancelled,
+// so a wedged transaction doesn't pile up requests past client timeouts.
+// How long each holder keeps it is recorded in metrics, to show which
+// callers make the others wait.
+type busLock struct {
+	ch      chan struct{}
+	metrics *linkMetrics
+	// lockedAt is when the lock was taken; only the holder touches it.
+	lockedAt time.Time
+	// batch is the DoCommand batch holding the lock, if one is.
+	batch atomic.Pointer[busBatch]
+}
+
+func newBusLock(metrics *linkMetrics) busLock {
+	return busLock{ch: make(chan struct{}, 1), metrics: metrics}
+}
+
+func (l *busLock) Lock() {
+	l.ch <- struct{}{}
+	l.lockedAt = time.Now()
+}
+
+func (l *busLock) Unlock() {
+	// A batch keeps the lock until its last command has run.
+	if l.batch.Load() != nil {
+		return
+	}
+	held := time.Since(l.lockedAt)
+	<-l.ch
+	l.metrics.recordHold(held)
+}
+
+// LockContext acquires the lock, or returns ctx.Err() if ctx is done first.
+// Within a DoCommand batch the first command to take the lock keeps it for
+// the batch, and the commands after it find it already theirs.
+func (l *busLock) LockContext(ctx context.Context) error {
+	b, _ := ctx.Value(batchKey{}).(*busBatch)
+	if b != nil && l.batch.Load() == b {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case l.ch <- struct{}{}:
+		l.lockedAt = time.Now()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if b != nil {
+		l.batch.Store(b)
+		b.held = append(b.held, l)
+	}
+	return nil
+}
+
+// batchKey is the context key under which a DoCommand batch runs its
+// commands.
+type batchKey struct{}
+
+// busBatch is a DoCommand batch in progress: the bus locks its commands have
+// taken, which it holds until it ends. Only the goroutine running the batch
+// touches it.
+type busBatch struct {
+	held []*busLock
+}
+
+// release gives up every lock the batch took.
+func (b *busBatch) release() {
+	for _, l := range b.held {
+		l.batch.Store(nil)
+		l.Unlock()
+	}
+	b.held = nil
+}
+
 type roombaConn struct {
 	roomba *roomba.Roomba
-	mu     sync.Mutex
+	mu     busLock
 	refs   int
+
+	// serialPort is the path the connection was opened with, for reconnects.
+	serialPort string
+	// startAttempts bounds the Start handshake when the port is moved.
+	startAttempts int
+	// profile is the oi_profile of the component that opened the port.
+	profile oiProfile
+	// clockSync is whether the robot's clock is set again after a reconnect,
+	// for sync_clock_on_connect. Guarded by mu.
+	clockSync bool
+	// lastReentry is when reenterOI last ran. Guarded by mu.
+	lastReentry time.Time
+	// modeReadAt is when packet 35 was last read. Guarded by mu.
+	modeReadAt time.Time
+	// desynced is set when a read left the byte stream out of step with the
+	// robot, so the next read resyncs first. Guarded by mu.
+	desynced bool
+	// port is the raw serial port; roomba.S is wire, which wraps it to
+	// collect metrics and catch link faults.
+	port    io.ReadWriter
+	wire    *countingPort
+	metrics linkMetrics
+	link    linkState
+	capture byteCapture
+	// safeWire is wire, for the safe-state handler to reach the port when
+	// it gives up waiting for mu. Set with mu held, read without it.
+	safeWire atomic.Pointer[countingPort]
+
+	odom odometry
+
+	// caps is probed once when the connection opens.
+	caps capabilities
+
+	events    eventLog
+	activity  activity
+	obstacles obstacleMemory
+	hazards   hazardMap
+
+	// mode is the software-tracked OI mode, guarded by mu. It is updated by
+	// explicit transitions (setMode), by commands that implicitly change it
+	// (noteMode), and reconciled against packet 35 whenever that is read
+	// (observeMode), so every component sharing the port agrees on it.
+	mode           oiMode
+	observers      map[int]modeObserver
+	nextObserverID int
+
+	// driveDirectLast is whether the last drive command was Drive Direct, whose
+	// wheel velocities the robot reports in packets 41-42 instead of 39-40.
+	// Guarded by mu.
+	driveDirectLast bool
+	// driveBuf holds the payload of each Drive and Drive Direct command, so
+	// teleop streaming them doesn't allocate one each time. Guarded by mu.
+	driveBuf [4]byte
+	// groupFields holds the packets of the last group read, by ID, reused
+	// from read to read. Guarded by mu.
+	groupFields map[byte][]byte
+
+	// lastCommand is when the last OI command was written, for the idle
+	// policy. Guarded by mu.
+	lastCommand time.Time
+
+	// outputs is the last bit mask sent with each output opcode (138, 147),
+	// since setting one output rewrites the others. Guarded by mu.
+	outputs map[byte]byte
+
+	// Pacing state for the serial link, guarded by mu. readyAt is the earliest
+	// time the next command may be written; driveTokens is a token bucket for
+	// Drive commands refilled at driveCommandRate.
+	readyAt      time.Time
+	driveTokens  float64
+	tokensFilled time.Time
+
+	// tracers receive a debug log line for every command and response while
+	// any component on this port has debug_serial enabled. Guarded by mu.
+	tracers      map[int]logging.Logger
+	nextTracerID int
 }
 
+// connections holds one roombaConn per physical serial device. All
+// per-robot state (odometry, OI mode, pacing, metrics) lives on the
+// roombaConn, so robots on different ports never share anything but this map.
 var (
 	globalMu    sync.Mutex
 	connections = map[string]*roombaConn{}
 )
 
-func acquireConn(serialPort string) (*roombaConn, error) {
+// openOI opens a serial port for acquireConn. Tests replace it to put
+// simulated robots on the ports.
+var openOI = startOI
+
+// connKey resolves symlinks (e.g. /dev/serial/by-id/...) so that two paths to
+// the same device share one connection instead of opening it twice.
+func connKey(serialPort string) string {
+	if resolved, err := filepath.EvalSymlinks(serialPort); err == nil {
+		return resolved
+	}
+	return serialPort
+}
+
+// windowsPortPattern matches COM ports with or without the \\.\ device prefix.
+var windowsPortPattern = regexp.MustCompile(`^(\\\\\.\\)?COM[0-9]+$`)
+
+// validateSerialPort checks that port looks like something the serial
+// library can open: an absolute device path on Unix or a COM port on Windows.
+func validateSerialPort(port string) error {
+	if port == "" {
+		return fmt.Errorf("serial_port is required")
+	}
+	if strings.HasPrefix(port, "/") || windowsPortPattern.MatchString(strings.ToUpper(port)) {
+		return nil
+	}
+	return fmt.Errorf("serial_port %q is not a device path (e.g. /dev/ttyUSB0 or COM3)", port)
+}
+
+// acquireConn returns the shared connection to serialPort, opening it and
+// starting the OI if nothing uses it yet. startAttempts bounds the Start
+// handshake (see startOI); zero means the default. It and profile only
+// matter to the component that opens the port.
+func acquireConn(serialPort string, startAttempts int, profile oiProfile) (*roombaConn, error) {
 	globalMu.Lock()
 	defer globalMu.Unlock()
-	if conn, ok := connections[serialPort]; ok {
+	key := connKey(serialPort)
+	if conn, ok := connections[key]; ok {
 		conn.refs++
 		return conn, nil
 	}
-	r, err := roomba.MakeRoomba(serialPort)
+	r, err := openOI(serialPort, startAttempts, profile)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open serial connection on %s: %w", serialPort, err)
+		return nil, err
 	}
-	// Send START command (opcode 128) to enable the Open Interface before any queries or commands.
-	if err := r.Passive(); err != nil {
-		return nil, fmt.Errorf("failed to start OI on %s: %w", serialPort, err)
+	conn := &roombaConn{
+		serialPort:    serialPort,
+		startAttempts: startAttempts,
+		profile:       profile,
+		refs:          1,
+		mode:          oiPassive,
+		observers:     map[int]modeObserver{},
+		tracers:       map[int]logging.Logger{},
+		readyAt:       time.Now().Add(modeChangeSettle),
+		driveTokens:   driveCommandBurst,
+		link:          linkState{closed: make(chan struct{})},
 	}
-	conn := &roombaConn{roomba: r, refs: 1}
+	conn.mu = newBusLock(&conn.metrics)
+	conn.events.pose = conn.odom.pose
+	conn.events.addObserver(conn.hazards.observe)
+	conn.install(r)
 	conn.setReadTimeout(2 * time.Second)
-	connections[serialPort] = conn
+	conn.caps = conn.discoverCapabilities()
+	connections[key] = conn
 	return conn, nil
 }
 
-func releaseConn(serialPort string) {
+// releaseConn drops a reference to the connection and closes the serial
+// port once nothing uses it, so the next acquire starts from a clean port.
+func releaseConn(conn *roombaConn) {
 	globalMu.Lock()
 	defer globalMu.Unlock()
-	conn, ok := connections[serialPort]
-	if !ok {
+	key := connKey(conn.serialPort)
+	if connections[key] != conn {
 		return
 	}
 	conn.refs--
 	if conn.refs <= 0 {
-		delete(connections, serialPort)
+		delete(connections, key)
+		conn.mu.Lock()
+		close(conn.link.closed)
+		if !conn.link.down.Load() {
+			closePort(conn.port)
+		}
+		conn.capture.stop()
+		conn.mu.Unlock()
+	}
+}
+
+// moveConn reopens a connection on another serial port in place, e.g. after
+// a USB adapter re-enumerates under a new name. It waits for the exchange in
+// flight, stops the wheels and closes the old port, then restores the OI
+// mode on the new one. Everything else lives on the roombaConn (odometry,
+// events, observers, tracers), so components and their watchers carry on
+// with the same connection. Every component sharing the old port follows it
+// to the new one. It gives up waiting for the exchange in flight when ctx is
+// done.
+func moveConn(ctx context.Context, conn *roombaConn, serialPort string) error {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+	oldKey, newKey := connKey(conn.serialPort), connKey(serialPort)
+	if oldKey == newKey {
+		return nil
+	}
+	if _, ok := connections[newKey]; ok {
+		return fmt.Errorf("%s is already open by another connection", serialPort)
+	}
+
+	if err := conn.mu.LockContext(ctx); err != nil {
+		return err
+	}
+	defer conn.mu.Unlock()
+	if !conn.link.down.Load() {
+		if err := conn.stop(); err != nil {
+			conn.trace("failed to stop before moving to %s: %v", serialPort, err)
+		}
+	}
+
+	r, err := startOI(serialPort, conn.startAttempts, conn.profile)
+	if err != nil {
+		return err
+	}
+
+	if !conn.link.down.Load() {
+		closePort(conn.port)
+	}
+	close(conn.link.closed)
+	conn.link = linkState{closed: make(chan struct{})}
+	conn.install(r)
+	conn.setReadTimeout(2 * time.Second)
+	conn.readyAt = time.Now().Add(modeChangeSettle)
+	conn.serialPort = serialPort
+	delete(connections, oldKey)
+	connections[newKey] = conn
+
+	// The OI starts in Passive; send the robot back to the mode it was in
+	// without reporting a change, since as far as clients can tell there
+	// was none. A link that was down had already dropped to off.
+	switch conn.mode {
+	case oiSafe:
+		err = conn.write(opSafe, nil)
+	case oiFull:
+		err = conn.write(opFull, nil)
+	case oiOff:
+		conn.noteMode(oiPassive)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to restore %s mode on %s: %w", conn.mode, serialPort, err)
+	}
+	return nil
+}
+
+func closePort(port io.ReadWriter) {
+	if c, ok := port.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+// pace blocks until the link is ready for the next command. Budgeted
+// commands also consume a token from the Drive bucket, waiting for a refill
+// if it is empty. Callers must hold c.mu.
+func (c *roombaConn) pace(budgeted bool) {
+	if wait := time.Until(c.readyAt); wait > 0 {
+		time.Sleep(wait)
+	}
+	if !budgeted {
+		return
+	}
+	now := time.Now()
+	if !c.tokensFilled.IsZero() {
+		c.driveTokens = min(driveCommandBurst, c.driveTokens+now.Sub(c.tokensFilled).Seconds()*driveCommandRate)
+	}
+	c.tokensFilled = now
+	if c.driveTokens < 1 {
+		time.Sleep(time.Duration((1 - c.driveTokens) / driveCommandRate * float64(time.Second)))
+		c.driveTokens = 1
+		c.tokensFilled = time.Now()
+	}
+	c.driveTokens--
+}
+
+// write sends a single OI command, spacing it from the previous one. Mode
+// and cleaning commands hold off the next command for modeChangeSettle.
+// Callers must hold c.mu.
+func (c *roombaConn) write(opcode byte, payload []byte) error {
+	if err := c.checkLink(); err != nil {
+		return err
+	}
+	c.pace(false)
+	if len(c.tracers) > 0 {
+		c.trace("serial TX opcode %d (%s): %s", opcode, opcodeName(opcode), hexDump(payload))
+	}
+	start := time.Now()
+	err := c.roomba.Write(opcode, payload)
+	c.metrics.recordCommand("write", time.Since(start))
+	if err != nil {
+		c.trace("serial TX error: %v", err)
+	}
+	gap := minCommandGap
+	switch opcode {
+	case opStart, opSafe, opFull, opSpot, opClean, opMax, opSeekDock, opPower:
+		gap = modeChangeSettle
+	}
+	c.readyAt = time.Now().Add(gap)
+	c.lastCommand = time.Now()
+	return c.noteLinkFault(err)
+}
+
+// drive sends a Drive command. Non-zero velocities are subject to the Drive
+// rate budget; stops never wait on it. Callers must hold c.mu.
+func (c *roombaConn) drive(velocity, radius int16) error {
+	if velocity < -500 || velocity > 500 {
+		return fmt.Errorf("invalid velocity: %d", velocity)
+	}
+	if velocity != 0 {
+		c.pace(true)
+	}
+	payload := binary.BigEndian.AppendUint16(c.driveBuf[:0], uint16(velocity))
+	payload = binary.BigEndian.AppendUint16(payload, uint16(radius))
+	c.driveDirectLast = false
+	return c.write(opDrive, payload)
+}
+
+// driveDirect sends a Drive Direct command setting each wheel's velocity
+// independently. Like drive, non-zero velocities are subject to the Drive
+// rate budget. Callers must hold c.mu.
+func (c *roombaConn) driveDirect(right, left int16) error {
+	for _, v := range []int16{right, left} {
+		if v < -500 || v > 500 {
+			return fmt.Errorf("invalid wheel velocity: %d", v)
+		}
+	}
+	if right != 0 || left != 0 {
+		c.pace(true)
+	}
+	payload := binary.BigEndian.AppendUint16(c.driveBuf[:0], uint16(right))
+	payload = binary.BigEndian.AppendUint16(payload, uint16(left))
+	c.driveDirectLast = true
+	return c.write(opDriveDirect, payload)
+}
+
+// stop is equivalent to Drive(0, 0). Callers must hold c.mu.
+func (c *roombaConn) stop() error {
+	return c.drive(0, 0)
+}
+
+// query reads a list of sensor packets with a single Query List command. A
+// response that fails validation is counted as corrupt and the query retried
+// once after flushing the receive buffer. Callers must hold c.mu.
+func (c *roombaConn) query(packets []byte) ([][]byte, error) {
+	data, bad, err := c.queryPartial(packets)
+	if err != nil {
+		return data, err
+	}
+	if len(bad) > 0 {
+		return nil, fmt.Errorf("corrupt sensor response: %w", validateResponse(packets, data))
+	}
+	return data, nil
+}
+
+// queryPartial is query for callers that can use whatever packets came back
+// intact: if the retry still has packets of the wrong length or with
+// implausible values, the response is returned along with what is wrong
+// with each of them, rather than as an error. The stream is marked out of
+// step all the same, so the next read resyncs first. Callers must hold
+// c.mu.
+func (c *roombaConn) queryPartial(packets []byte) ([][]byte, map[byte]error, error) {
+	return c.queryPartialInto(packets, nil)
+}
+
+// queryPartialInto is queryPartial reading into bufs, for a caller that
+// queries the same packets again and again. The packets returned are bufs,
+// so the caller must be done with them before its next query. Callers must
+// hold c.mu.
+func (c *roombaConn) queryPartialInto(packets []byte, bufs *queryBuffers) ([][]byte, map[byte]error, error) {
+	if err := c.checkSync(); err != nil {
+		return nil, nil, err
+	}
+	data, err := c.queryOnce(packets, bufs)
+	if err != nil && c.reenterOI(err) {
+		data, err = c.queryOnce(packets, bufs)
+	}
+	if err != nil {
+		return data, nil, c.noteReadError(err)
+	}
+	if verr := validateResponse(packets, data); verr != nil {
+		c.noteCorrupt(verr)
+		if err := c.resync(); err != nil {
+			return nil, nil, err
+		}
+		if data, err = c.queryOnce(packets, bufs); err != nil {
+			return data, nil, c.noteReadError(err)
+		}
+		if verr := validateResponse(packets, data); verr != nil {
+			c.noteCorrupt(verr)
+			c.desynced = true
+			if len(data) != len(packets) {
+				return nil, nil, fmt.Errorf("corrupt sensor response: %w", verr)
+			}
+			return data, packetErrors(packets, data), nil
+		}
+	}
+	return data, nil, nil
+}
+
+// queryOnce sends one Query List for packets and reads the response into
+// bufs, or into new buffers if bufs is nil. Callers must hold c.mu.
+func (c *roombaConn) queryOnce(packets []byte, bufs *queryBuffers) ([][]byte, error) {
+	if err := c.checkLink(); err != nil {
+		return nil, err
+	}
+	c.pace(false)
+	if len(c.tracers) > 0 {
+		c.trace("serial TX opcode 149 (Query List): %s", hexDump(packets))
+	}
+	start := time.Now()
+	data, err := c.queryList(packets, bufs)
+	c.metrics.recordCommand("query", time.Since(start))
+	c.traceResponse(packets, data, err)
+	c.readyAt = time.Now().Add(minCommandGap)
+	return data, c.noteLinkFault(err)
+}
+
+// queryBuffers are the receive buffers of a Query List: the command sent,
+// the response, and the response split into packets. A caller that reads
+// the same packets again and again keeps one to read into, rather than
+// allocating them on every query.
+type queryBuffers struct {
+	cmd  []byte
+	raw  []byte
+	data [][]byte
+}
+
+// queryList is go-roomba's QueryList reading into bufs, which it grows to
+// fit; go-roomba allocates a buffer for every packet of every query. As
+// there, a read that fails leaves the packets after it zeroed. Callers must
+// hold c.mu.
+func (c *roombaConn) queryList(packets []byte, bufs *queryBuffers) ([][]byte, error) {
+	if bufs == nil {
+		bufs = &queryBuffers{}
+	}
+	total := 0
+	for _, id := range packets {
+		n, ok := constants.SENSOR_PACKET_LENGTH[id]
+		if !ok {
+			return nil, fmt.Errorf("unknown packet id requested: %d", id)
+		}
+		total += int(n)
+	}
+	if cap(bufs.raw) < total {
+		bufs.raw = make([]byte, total)
+	}
+	if cap(bufs.data) < len(packets) {
+		bufs.data = make([][]byte, len(packets))
+	}
+	raw, data := bufs.raw[:total], bufs.data[:len(packets)]
+	clear(raw)
+	for i, id := range packets {
+		n := int(constants.SENSOR_PACKET_LENGTH[id])
+		data[i], raw = raw[:n:n], raw[n:]
+	}
+
+	bufs.cmd = append(append(bufs.cmd[:0], opQueryList, byte(len(packets))), packets...)
+	if _, err := c.roomba.S.Write(bufs.cmd); err != nil {
+		return data, fmt.Errorf("failed writing command to serial interface: %w", err)
+	}
+	for i, id := range packets {
+		if _, err := io.ReadFull(c.roomba.S, data[i]); err != nil {
+			return data, fmt.Errorf("failed reading sensors data for packet id %d: %w", id, err)
+		}
+	}
+	return data, nil
+}
+
+// noteCorrupt records a response that failed validation.
+func (c *roombaConn) noteCorrupt(err error) {
+	c.trace("serial RX corrupt response: %v", err)
+	c.metrics.mu.Lock()
+	c.metrics.corruptResponses++
+	c.metrics.mu.Unlock()
+}
+
+// sensor reads a single sensor packet, validating and retrying it like
+// query. Callers must hold c.mu.
+func (c *roombaConn) sensor(packet byte) ([]byte, error) {
+	if err := c.checkSync(); err != nil {
+		return nil, err
+	}
+	data, err := c.sensorOnce(packet)
+	if err != nil && c.reenterOI(err) {
+		data, err = c.sensorOnce(packet)
+	}
+	if err != nil {
+		return data, c.noteReadError(err)
+	}
+	if verr := validateResponse([]byte{packet}, [][]byte{data}); verr != nil {
+		c.noteCorrupt(verr)
+		if err := c.resync(); err != nil {
+			return nil, err
+		}
+		if data, err = c.sensorOnce(packet); err != nil {
+			return data, c.noteReadError(err)
+		}
+		if verr := validateResponse([]byte{packet}, [][]byte{data}); verr != nil {
+			c.noteCorrupt(verr)
+			c.desynced = true
+			return nil, fmt.Errorf("corrupt sensor response: %w", verr)
+		}
+	}
+	return data, nil
+}
+
+func (c *roombaConn) sensorOnce(packet byte) ([]byte, error) {
+	if err := c.checkLink(); err != nil {
+		return nil, err
+	}
+	c.pace(false)
+	c.trace("serial TX opcode 142 (Sensors): %02x", packet)
+	start := time.Now()
+	data, err := c.roomba.Sensors(packet)
+	c.metrics.recordCommand("sensor", time.Since(start))
+	c.traceResponse([]byte{packet}, [][]byte{data}, err)
+	c.readyAt = time.Now().Add(minCommandGap)
+	return data, c.noteLinkFault(err)
+}
+
+// seekDock sends the Seek Dock command. go-roomba's SeekDock looks up a
+// misspelled opcode name and sends 0 instead. Callers must hold c.mu.
+func (c *roombaConn) seekDock() error {
+	if err := c.write(opSeekDock, nil); err != nil {
+		return err
+	}
+	c.noteMode(oiPassive)
+	return nil
+}
+
+// addModeObserver registers fn for OI mode changes and returns a function
+// that unregisters it.
+func (c *roombaConn) addModeObserver(fn modeObserver) func() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id := c.nextObserverID
+	c.nextObserverID++
+	c.observers[id] = fn
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.observers, id)
+	}
+}
+
+// addTracer enables serial tracing to logger and returns a function that
+// disables it again.
+func (c *roombaConn) addTracer(logger logging.Logger) func() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id := c.nextTracerID
+	c.nextTracerID++
+	c.tracers[id] = logger
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.tracers, id)
+	}
+}
+
+// trace logs a serial trace line to every tracer. Callers must hold c.mu.
+func (c *roombaConn) trace(format string, args ...any) {
+	for _, logger := range c.tracers {
+		logger.Debugf(format, args...)
+	}
+}
+
+// traceResponse logs each packet of a sensor response. Callers must hold c.mu.
+func (c *roombaConn) traceResponse(packets []byte, data [][]byte, err error) {
+	if len(c.tracers) == 0 {
+		return
+	}
+	for i, id := range packets {
+		if i < len(data) {
+			c.trace("serial RX packet %d (%s): %s", id, packetName(id), hexDump(data[i]))
+		}
+	}
+	if err != nil {
+		c.trace("serial RX error: %v", err)
+	}
+}
+
+// noteMode records a mode change that has already happened on the robot,
+// either as a side effect of a command (Clean, Seek Dock, Power) or because
+// the robot reported it. Callers must hold c.mu.
+func (c *roombaConn) noteMode(to oiMode) {
+	from := c.mode
+	if from == to {
+		return
+	}
+	c.mode = to
+	for _, fn := range c.observers {
+		fn(from, to)
+	}
+}
+
+// observeMode reconciles the tracked mode with a packet 35 value read from
+// the robot. Callers must hold c.mu.
+func (c *roombaConn) observeMode(raw byte) {
+	c.modeReadAt = time.Now()
+	if oiMode(raw) == oiOff && c.mode != oiOff && c.reenterOI(nil) {
+		return
+	}
+	if int(raw) >= len(oiModes) || oiMode(raw) == c.mode {
+		return
+	}
+	// Every change the module makes is noted as it makes it, so the robot
+	// changed mode by itself: a cliff or wheel drop in Safe mode, a button
+	// press, or its own firmware.
+	c.trace("OI mode reads %s, not %s as tracked", oiMode(raw), c.mode)
+	c.events.record("mode_mismatch", map[string]any{"tracked": c.mode.String(), "actual": oiMode(raw).String()})
+	c.noteMode(oiMode(raw))
+}
+
+// syncMode reads packet 35 and reconciles the tracked mode with it.
+// Callers must hold c.mu.
+func (c *roombaConn) syncMode() (oiMode, error) {
+	data, err := c.sensor(35)
+	if err != nil {
+		return c.mode, fmt.Errorf("failed to read OI mode: %w", err)
+	}
+	if len(data) == 0 {
+		return c.mode, fmt.Errorf("failed to read OI mode: empty response")
+	}
+	c.observeMode(data[0])
+	return c.mode, nil
+}
+
+// setMode explicitly switches the OI to the given mode, starting it first if
+// it is Off. Off itself can't be switched to. Callers must hold c.mu.
+func (c *roombaConn) setMode(to oiMode) error {
+	if !canSwitch(c.mode, to) && !(canSwitch(c.mode, oiPassive) && canSwitch(oiPassive, to)) {
+		return fmt.Errorf("cannot switch OI from %s to %s mode", c.mode, to)
+	}
+
+	// Off must be started into Passive before it takes another mode.
+	if !canSwitch(c.mode, to) {
+		if err := c.write(opStart, nil); err != nil {
+			return fmt.Errorf("failed to start OI: %w", err)
+		}
+		c.noteMode(oiPassive)
+	}
+
+	var err error
+	switch to {
+	case oiPassive:
+		err = c.write(opStart, nil)
+	case oiSafe:
+		err = c.write(opSafe, nil)
+	case oiFull:
+		err = c.write(opFull, nil)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to enter %s mode: %w", to, err)
+	}
+	c.noteMode(to)
+	return nil
+}
+
+// requireControl returns an error unless the OI is in Safe or Full mode,
+// the only modes in which the robot accepts actuator commands. In Passive
+// the robot silently ignores them, so fail fast instead. Callers must hold c.mu.
+func (c *roombaConn) requireControl(action string) error {
+	if err := c.checkLink(); err != nil {
+		return err
+	}
+	if c.mode == oiSafe || c.mode == oiFull {
+		return nil
 	}
+	return fmt.Errorf("cannot %s: OI is in %s mode, send enter_safe_mode or enter_full_mode first", action, c.mode)
 }
@@ -0,0 +1,385 @@
+package viamroomba
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/golang/geo/r3"
+)
+
+// TestConnectionsDontCrossTalk opens robots on two ports, one of them also
+// through a symlinked alias, and checks that each port gets its own
+// connection, reference count, and commands, and that closing one leaves
+// the other working.
+func TestConnectionsDontCrossTalk(t *testing.T) {
+	robots := useFakeRobots(t)
+	dir := t.TempDir()
+	portA, portB := filepath.Join(dir, "ttyUSB0"), filepath.Join(dir, "ttyUSB1")
+	for _, port := range []string{portA, portB} {
+		if err := os.WriteFile(port, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	aliasA := filepath.Join(dir, "usb-iRobot_Roomba-if00")
+	if err := os.Symlink(portA, aliasA); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := acquireConn(portA, 0, defaultOIProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aliased, err := acquireConn(aliasA, 0, defaultOIProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := acquireConn(portB, 0, defaultOIProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aliased != a {
+		t.Error("the symlinked alias opened a second connection to the same port")
+	}
+	if b == a {
+		t.Fatal("two ports share one connection")
+	}
+	if len(robots) != 2 {
+		t.Fatalf("opened %d ports, want 2", len(robots))
+	}
+	if a.refs != 2 || b.refs != 1 {
+		t.Errorf("refs are %d and %d, want 2 and 1", a.refs, b.refs)
+	}
+	robotA, robotB := robots[connKey(portA)], robots[connKey(portB)]
+
+	for _, w := range []struct {
+		conn   *roombaConn
+		opcode byte
+	}{{a, opSafe}, {b, opFull}} {
+		w.conn.mu.Lock()
+		err := w.conn.write(w.opcode, nil)
+		w.conn.mu.Unlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ops := robotA.opcodes(); !bytes.Contains(ops, []byte{opSafe}) || bytes.Contains(ops, []byte{opFull}) {
+		t.Errorf("port A was sent % d, want Safe and not Full", ops)
+	}
+	if ops := robotB.opcodes(); !bytes.Contains(ops, []byte{opFull}) || bytes.Contains(ops, []byte{opSafe}) {
+		t.Errorf("port B was sent % d, want Full and not Safe", ops)
+	}
+
+	releaseConn(aliased)
+	if robotA.closed {
+		t.Fatal("port A was closed while the connection still had a reference")
+	}
+	releaseConn(a)
+	if !robotA.closed {
+		t.Error("port A wasn't closed after its last reference was released")
+	}
+	if robotB.closed {
+		t.Fatal("closing port A closed port B")
+	}
+	b.mu.Lock()
+	mode, err := b.syncMode()
+	b.mu.Unlock()
+	if err != nil {
+		t.Fatalf("port B stopped working after port A closed: %v", err)
+	}
+	if mode != oiFull {
+		t.Errorf("port B reads mode %s, want Full", mode)
+	}
+
+	releaseConn(b)
+	if !robotB.closed {
+		t.Error("port B wasn't closed after its last reference was released")
+	}
+	globalMu.Lock()
+	defer globalMu.Unlock()
+	if len(connections) != 0 {
+		t.Errorf("%d connections left open", len(connections))
+	}
+}
+
+// busCommands returns a connection on a fakeRobot and a command set whose
+// commands use it: "send" takes the bus, writes the opcode it's given, and
+// lets go; "fail" fails without touching the bus; and "solo" must run on
+// its own. sends counts how many times send found the bus already held by
+// its batch, and runs how many times each command ran.
+func busCommands(t *testing.T) (conn *roombaConn, robot *fakeRobot, cs commandSet, reused *int, runs map[string]int) {
+	t.Helper()
+	robots := useFakeRobots(t)
+	port := filepath.Join(t.TempDir(), "ttyUSB0")
+	if err := os.WriteFile(port, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := acquireConn(port, 0, defaultOIProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { releaseConn(conn) })
+
+	reused, runs = new(int), map[string]int{}
+	type sendArgs struct {
+		Opcode int `json:"opcode" required:"true"`
+	}
+	cs = commandSet{
+		newCommand("send", "", func(ctx context.Context, args sendArgs) (map[string]any, error) {
+			runs["send"]++
+			if b, _ := ctx.Value(batchKey{}).(*busBatch); b != nil && conn.mu.batch.Load() == b {
+				*reused++
+			}
+			if err := conn.mu.LockContext(ctx); err != nil {
+				return nil, err
+			}
+			defer conn.mu.Unlock()
+			return nil, conn.write(byte(args.Opcode), nil)
+		}),
+		newCommand("fail", "", func(context.Context, noArgs) (map[string]any, error) {
+			runs["fail"]++
+			return nil, errors.New("no")
+		}),
+		newCommand("solo", "", func(context.Context, noArgs) (map[string]any, error) {
+			runs["solo"]++
+			return nil, nil
+		}).alone(),
+	}
+	return conn, robots[connKey(port)], cs, reused, runs
+}
+
+// busFree reports whether the bus can be taken now, and gives it back if so.
+func busFree(conn *roombaConn) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := conn.mu.LockContext(ctx); err != nil {
+		return false
+	}
+	conn.mu.Unlock()
+	return true
+}
+
+func batchOf(cmds ...map[string]any) map[string]any {
+	list := make([]any, len(cmds))
+	for i, c := range cmds {
+		list[i] = c
+	}
+	return map[string]any{"commands": list}
+}
+
+func send(opcode byte) map[string]any {
+	return map[string]any{"command": "send", "opcode": float64(opcode)}
+}
+
+// TestBatchHoldsBusAcrossCommands checks that a batch takes the bus once,
+// for its first command that uses it, that the commands after find it
+// already theirs, that their Unlock leaves it held so nothing else gets
+// between them, and that it is given back when the batch ends.
+func TestBatchHoldsBusAcrossCommands(t *testing.T) {
+	conn, robot, cs, reused, _ := busCommands(t)
+	between := map[string]any{"command": "between"}
+	var heldBetween bool
+	cs = append(cs, newCommand("between", "", func(context.Context, noArgs) (map[string]any, error) {
+		heldBetween = !busFree(conn)
+		return nil, nil
+	}))
+
+	resp, err := cs.dispatch(context.Background(), batchOf(send(opSafe), between, send(opFull), send(opStart)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results, _ := resp["results"].([]any); len(results) != 4 {
+		t.Errorf("got %d results, want 4", len(results))
+	}
+	if *reused != 2 {
+		t.Errorf("%d sends found the bus already the batch's, want 2", *reused)
+	}
+	if !heldBetween {
+		t.Error("the bus was free between the batch's commands")
+	}
+	if ops := robot.opcodes(); !bytes.HasSuffix(ops, []byte{opSafe, opFull, opStart}) {
+		t.Errorf("sent % d, want Safe, Full, Start last", ops)
+	}
+	if conn.mu.batch.Load() != nil {
+		t.Error("the bus still belongs to the batch after it ended")
+	}
+	if !busFree(conn) {
+		t.Error("the bus is still held after the batch ended")
+	}
+}
+
+// TestBusUnlockInBatch checks that Unlock leaves the bus held while a batch
+// has it, and that release gives it back.
+func TestBusUnlockInBatch(t *testing.T) {
+	conn, _, _, _, _ := busCommands(t)
+	b := &busBatch{}
+	ctx := context.WithValue(context.Background(), batchKey{}, b)
+	if err := conn.mu.LockContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	conn.mu.Unlock()
+	if busFree(conn) {
+		t.Fatal("Unlock gave up the bus while a batch held it")
+	}
+	if err := conn.mu.LockContext(ctx); err != nil {
+		t.Fatalf("the batch couldn't take back its own bus: %v", err)
+	}
+	if len(b.held) != 1 {
+		t.Errorf("the batch holds %d locks, want 1", len(b.held))
+	}
+	b.release()
+	if !busFree(conn) {
+		t.Error("release didn't give the bus back")
+	}
+}
+
+// TestBatchReleasesBusAfterFailure checks that a batch stops at the command
+// that fails, says how far it got, and gives the bus back.
+func TestBatchReleasesBusAfterFailure(t *testing.T) {
+	conn, robot, cs, _, runs := busCommands(t)
+	before := len(robot.opcodes())
+
+	_, err := cs.dispatch(context.Background(), batchOf(send(opSafe), map[string]any{"command": "fail"}, send(opFull)))
+	if err == nil || !strings.Contains(err.Error(), "commands[1] (fail) failed after 1 of 3 commands ran") {
+		t.Fatalf("got %v, want commands[1] to fail after 1 of 3 ran", err)
+	}
+	if ops := robot.opcodes()[before:]; !bytes.Equal(ops, []byte{opSafe}) {
+		t.Errorf("sent % d, want only Safe", ops)
+	}
+	if runs["send"] != 1 {
+		t.Errorf("send ran %d times, want 1", runs["send"])
+	}
+	if conn.mu.batch.Load() != nil || !busFree(conn) {
+		t.Error("the bus wasn't given back after the batch failed")
+	}
+}
+
+// TestBatchRejectsSoloCommands checks that a batch naming a command that
+// must run on its own fails before any of its commands run.
+func TestBatchRejectsSoloCommands(t *testing.T) {
+	conn, robot, cs, _, runs := busCommands(t)
+	before := len(robot.opcodes())
+
+	_, err := cs.dispatch(context.Background(), batchOf(send(opSafe), map[string]any{"command": "solo"}))
+	if err == nil || !strings.Contains(err.Error(), "commands[1]: solo can't run in a batch") {
+		t.Fatalf("got %v, want commands[1] rejected as solo", err)
+	}
+	if len(runs) != 0 {
+		t.Errorf("ran %v before rejecting the batch", runs)
+	}
+	if ops := robot.opcodes()[before:]; len(ops) != 0 {
+		t.Errorf("sent % d, want nothing", ops)
+	}
+	if !busFree(conn) {
+		t.Error("the bus is held after a rejected batch")
+	}
+}
+
+// TestSetMode checks the mode commands setMode sends from every mode to
+// every other, and that it refuses to switch the OI off.
+func TestSetMode(t *testing.T) {
+	conn, robot, _, _, _ := busCommands(t)
+	for _, tc := range []struct {
+		from, to oiMode
+		sent     []byte // nil if the switch is refused
+	}{
+		{oiOff, oiPassive, []byte{opStart}},
+		{oiOff, oiSafe, []byte{opStart, opSafe}},
+		{oiOff, oiFull, []byte{opStart, opFull}},
+		{oiPassive, oiPassive, []byte{opStart}},
+		{oiPassive, oiSafe, []byte{opSafe}},
+		{oiPassive, oiFull, []byte{opFull}},
+		{oiSafe, oiPassive, []byte{opStart}},
+		{oiSafe, oiFull, []byte{opFull}},
+		{oiFull, oiSafe, []byte{opSafe}},
+		{oiFull, oiPassive, []byte{opStart}},
+		{oiOff, oiOff, nil},
+		{oiPassive, oiOff, nil},
+		{oiSafe, oiOff, nil},
+		{oiFull, oiOff, nil},
+	} {
+		t.Run(tc.from.String()+"_to_"+tc.to.String(), func(t *testing.T) {
+			conn.mu.Lock()
+			defer conn.mu.Unlock()
+			conn.mode = tc.from
+			before := len(robot.opcodes())
+			err := conn.setMode(tc.to)
+			sent := robot.opcodes()[before:]
+			if tc.sent == nil {
+				if err == nil {
+					t.Fatal("switched, want refused")
+				}
+				if len(sent) != 0 || conn.mode != tc.from {
+					t.Errorf("sent % d and tracks %s, want nothing sent and %s", sent, conn.mode, tc.from)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(sent, tc.sent) {
+				t.Errorf("sent % d, want % d", sent, tc.sent)
+			}
+			if conn.mode != tc.to {
+				t.Errorf("tracks %s, want %s", conn.mode, tc.to)
+			}
+		})
+	}
+}
+
+// BenchmarkBusHoldUnderLoad runs Readings on a sensor while a base on the
+// same port streams SetVelocity, and reports how long each holder kept the
+// bus lock: the mean and worst hold are how long teleop can be kept
+// waiting behind a sensor read, and the other way around.
+func BenchmarkBusHoldUnderLoad(b *testing.B) {
+	useFakeRobots(b)
+	port := filepath.Join(b.TempDir(), "ttyUSB0")
+	s := newTestBase(b, port, clock.New())
+	sensor := newTestSensor(b, port)
+	ctx := context.Background()
+
+	s.conn.metrics.mu.Lock()
+	delete(s.conn.metrics.latency, "bus_hold")
+	s.conn.metrics.mu.Unlock()
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if err := s.SetVelocity(ctx, r3.Vector{Y: float64(200 + i%2*10)}, r3.Vector{}, nil); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	}()
+	b.ResetTimer()
+	for range b.N {
+		if _, err := sensor.Readings(ctx, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	close(done)
+	wg.Wait()
+
+	s.conn.metrics.mu.Lock()
+	defer s.conn.metrics.mu.Unlock()
+	if h := s.conn.metrics.latency["bus_hold"]; h != nil && h.total > 0 {
+		b.ReportMetric(h.sumMS/float64(h.total), "hold-mean-ms")
+		b.ReportMetric(h.maxMS, "hold-max-ms")
+	}
+}
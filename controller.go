@@ -0,0 +1,136 @@
+package viamroomba
+
+import (
+	"context"
+	"fmt"
+
+	"go.viam.com/rdk/components/generic"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+)
+
+// ControllerConfig configures the resource that owns a Roomba's serial port.
+// Other components reference it by name via their "controller" attribute.
+type ControllerConfig struct {
+	SerialPort         string `json:"serial_port"`
+	StartAttempts      int    `json:"start_attempts,omitempty"`
+	OIProfile          string `json:"oi_profile,omitempty"`
+	SyncClockOnConnect bool   `json:"sync_clock_on_connect,omitempty"`
+}
+
+func (cfg *ControllerConfig) Validate(path string) ([]string, []string, error) {
+	if err := validateSerialPort(cfg.SerialPort); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateStartAttempts(cfg.StartAttempts); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateOIProfile(cfg.OIProfile); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return nil, nil, nil
+}
+
+type viamRoombaController struct {
+	name       resource.Name
+	logger     logging.Logger
+	conn       *roombaConn
+	serialPort string
+	commands   commandSet
+}
+
+func newViamRoombaController(ctx context.Context, deps resource.Dependencies, rawConf resource.Config, logger logging.Logger) (resource.Resource, error) {
+	conf, err := resource.NativeConfig[*ControllerConfig](rawConf)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := lookupOIProfile(conf.OIProfile)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := acquireConn(conf.SerialPort, conf.StartAttempts, profile)
+	if err != nil {
+		return nil, err
+	}
+	warnProfile(logger, conn, profile)
+	if conf.SyncClockOnConnect {
+		conn.enableClockSync(ctx, logger)
+	}
+
+	logger.Infof("Roomba controller initialized on %s", conf.SerialPort)
+
+	return &viamRoombaController{
+		name:       rawConf.ResourceName(),
+		logger:     logger,
+		conn:       conn,
+		serialPort: conf.SerialPort,
+		commands: append(connCommands(conn),
+			newCommand("transact", "Run raw serial writes, reads, and waits as one exchange with the robot", conn.transact),
+		),
+	}, nil
+}
+
+func (c *viamRoombaController) Name() resource.Name {
+	return c.name
+}
+
+// Reconfigure moves the controller's connection to a new serial port in
+// place. Components using the controller keep the same connection, so they
+// follow it without being rebuilt.
+func (c *viamRoombaController) Reconfigure(ctx context.Context, deps resource.Dependencies, rawConf resource.Config) error {
+	conf, err := resource.NativeConfig[*ControllerConfig](rawConf)
+	if err != nil {
+		return err
+	}
+	if err := moveConn(ctx, c.conn, conf.SerialPort); err != nil {
+		return err
+	}
+	if conf.SyncClockOnConnect {
+		c.conn.enableClockSync(ctx, c.logger)
+	}
+	if conf.SerialPort != c.serialPort {
+		c.logger.Infof("Roomba controller moved from %s to %s", c.serialPort, conf.SerialPort)
+	}
+	c.serialPort = conf.SerialPort
+	return nil
+}
+
+func (c *viamRoombaController) DoCommand(ctx context.Context, cmd map[string]any) (map[string]any, error) {
+	return c.commands.dispatch(ctx, cmd)
+}
+
+func (c *viamRoombaController) Close(ctx context.Context) error {
+	releaseConn(c.conn)
+	return nil
+}
+
+// validateConnection checks that a component names exactly one of a serial
+// port or a controller, and returns the controller as a required dependency.
+func validateConnection(serialPort, controller string) ([]string, error) {
+	switch {
+	case serialPort != "" && controller != "":
+		return nil, fmt.Errorf("only one of serial_port or controller may be set")
+	case controller != "":
+		return []string{controller}, nil
+	default:
+		return nil, validateSerialPort(serialPort)
+	}
+}
+
+// resolveSerialPort returns the serial port a component should connect to:
+// its own serial_port, or the port owned by the controller it depends on.
+func resolveSerialPort(deps resource.Dependencies, serialPort, controller string) (string, error) {
+	if controller == "" {
+		return serialPort, nil
+	}
+	res, err := generic.FromProvider(deps, controller)
+	if err != nil {
+		return "", err
+	}
+	ctrl, ok := res.(*viamRoombaController)
+	if !ok {
+		return "", fmt.Errorf("controller %q is not a %s", controller, Controller)
+	}
+	return ctrl.serialPort, nil
+}
@@ -0,0 +1,341 @@
+package viamroomba
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+)
+
+const (
+	defaultCoverageCellMM = 100
+	// coverageInterval is how often the coverage service samples the pose.
+	// At top speed the robot covers 10cm in this time, and the path between
+	// samples is filled in, so no cell is skipped.
+	coverageInterval = 200 * time.Millisecond
+)
+
+// CoverageConfig configures the coverage mapping service.
+type CoverageConfig struct {
+	SerialPort string  `json:"serial_port,omitempty"`
+	Controller string  `json:"controller,omitempty"`
+	CellSizeMM int     `json:"cell_size_mm,omitempty"`
+	SwathMM    int     `json:"swath_mm,omitempty"`
+	AreaM2     float64 `json:"area_m2,omitempty"`
+}
+
+func (cfg *CoverageConfig) Validate(path string) ([]string, []string, error) {
+	deps, err := validateConnection(cfg.SerialPort, cfg.Controller)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if cfg.CellSizeMM < 0 {
+		return nil, nil, fmt.Errorf("%s: cell_size_mm must be a positive number", path)
+	}
+	if cfg.SwathMM < 0 {
+		return nil, nil, fmt.Errorf("%s: swath_mm must be a positive number", path)
+	}
+	if cfg.AreaM2 < 0 {
+		return nil, nil, fmt.Errorf("%s: area_m2 must be a positive number", path)
+	}
+	return deps, nil, nil
+}
+
+// cell is a coverage grid cell index; cell (0, 0) spans the odometry origin
+// to one cell size in +X and +Y.
+type cell struct {
+	x, y int
+}
+
+// coverageService marks the grid cells the robot passes over, from the
+// shared odometry pose, so clients can ask how much of a room was covered.
+type coverageService struct {
+	resource.AlwaysRebuild
+
+	name       resource.Name
+	logger     logging.Logger
+	conn       *roombaConn
+	commands   commandSet
+	cellSizeMM float64
+	swathMM    float64
+	areaM2     float64
+
+	mu      sync.Mutex
+	visited map[cell]bool
+	// last is the previous sampled position, or nil after a reset.
+	last   *[2]float64
+	stats  cleaningStats
+	energy energyStats
+
+	cancelFunc func()
+	done       chan struct{}
+}
+
+func newCoverageService(ctx context.Context, deps resource.Dependencies, rawConf resource.Config, logger logging.Logger) (resource.Resource, error) {
+	conf, err := resource.NativeConfig[*CoverageConfig](rawConf)
+	if err != nil {
+		return nil, err
+	}
+	serialPort, err := resolveSerialPort(deps, conf.SerialPort, conf.Controller)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := acquireConn(serialPort, 0, defaultOIProfile)
+	if err != nil {
+		return nil, err
+	}
+
+	cellSizeMM := conf.CellSizeMM
+	if cellSizeMM == 0 {
+		cellSizeMM = defaultCoverageCellMM
+	}
+	stats := cleaningStats{
+		store:  newStateStore("coverage_" + rawConf.ResourceName().Name),
+		cellM2: float64(cellSizeMM*cellSizeMM) / 1e6,
+	}
+	var saved cleaningState
+	if err := stats.store.load(&saved); err != nil {
+		logger.Warnf("Starting with no cleaning history: %v", err)
+	}
+	stats.history = saved.Sessions
+	var energy energyStats
+	energy.restore(saved.Energy)
+	cancelCtx, cancelFunc := context.WithCancel(context.Background())
+	s := &coverageService{
+		name:       rawConf.ResourceName(),
+		logger:     logger,
+		conn:       conn,
+		cellSizeMM: float64(cellSizeMM),
+		swathMM:    float64(conf.SwathMM),
+		areaM2:     conf.AreaM2,
+		visited:    map[cell]bool{},
+		stats:      stats,
+		energy:     energy,
+		cancelFunc: cancelFunc,
+		done:       make(chan struct{}),
+	}
+	s.commands = commandSet{
+		newCommand("get_coverage_map", "Visited cells as a grid, with the covered area and percentage", s.coverageMap),
+		newCommand("reset_map", "Forget every visited cell", s.resetMap),
+		newCommand("get_cleaning_stats", "Runtime, distance, area, dirt, and battery use of each cleaning cycle", s.cleaningStats),
+		newCommand("get_energy_stats", "Energy drawn by each kind of operation and the most recent operations", s.energyStats),
+	}
+	goSafe(func() { s.track(cancelCtx) })
+
+	logger.Infof("Roomba coverage mapping on %s (%dmm cells)", serialPort, cellSizeMM)
+	return s, nil
+}
+
+func (s *coverageService) Name() resource.Name {
+	return s.name
+}
+
+// track samples the pose every coverageInterval. While the robot is doing
+// something it also reads the odometry itself, so the pose moves even if no
+// sensor is polling; while idle it leaves the bus alone. The voltage and
+// current are read with it, for the energy statistics, and while it cleans
+// the dirt and battery packets too, for the cleaning statistics. Once a
+// cleaning cycle has brought the robot back to its dock, it samples
+// idlePollFactor times less often until the robot does something else.
+func (s *coverageService) track(ctx context.Context) {
+	defer close(s.done)
+	ticker := time.NewTicker(coverageInterval)
+	defer ticker.Stop()
+	var throttle pollThrottle
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		kind, id := s.conn.activity.current()
+		if !throttle.due(&s.conn.activity) && kind != "idle" {
+			continue
+		}
+		var energyData, cleaningData [][]byte
+		if kind != "idle" {
+			extra := energyPackets
+			if kind == "clean" {
+				extra = trackedCleaningPackets
+			}
+			if err := s.conn.mu.LockContext(ctx); err != nil {
+				return
+			}
+			_, _, read, err := s.conn.readOdometryWith(extra)
+			s.conn.mu.Unlock()
+			if err != nil {
+				s.logger.Debugf("Coverage mapping failed to read odometry: %v", err)
+			} else {
+				energyData = read[:len(energyPackets)]
+				if kind == "clean" {
+					cleaningData = read[len(energyPackets):]
+					s.conn.activity.noteDocked(cleaningData[2][0]&0x02 != 0)
+				}
+			}
+		}
+		x, y, _ := s.conn.odom.pose()
+		s.visit(x, y)
+		s.sample(kind, id, energyData, cleaningData)
+	}
+}
+
+// trackedCleaningPackets are read while the robot cleans: energyPackets,
+// then cleaningPackets.
+var trackedCleaningPackets = append(append([]byte{}, energyPackets...), cleaningPackets...)
+
+// sample updates the energy and cleaning statistics, saving them when an
+// operation or cleaning session ends.
+func (s *coverageService) sample(kind, id string, energyData, cleaningData [][]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	mwh, opEnded := s.energy.sample(now, kind, id, energyData)
+	s.stats.addEnergy(mwh)
+	sessionEnded := s.stats.sample(now, kind, s.conn.odom.totals(), cleaningData)
+	if !opEnded && !sessionEnded {
+		return
+	}
+	if sessionEnded {
+		session := s.stats.history[len(s.stats.history)-1]
+		s.logger.Infof("Cleaning cycle finished: %.0f min, %.1f m, %.1f m², %d dirt events, %d mAh, %.0f mWh",
+			session.RuntimeSec/60, session.DistanceMM/1000, session.AreaM2, session.DirtEvents, session.BatteryUsedMAh,
+			session.EnergyUsedMWh)
+	}
+	if err := s.stats.store.save(cleaningState{Sessions: s.stats.history, Energy: s.energy.saved()}); err != nil {
+		s.logger.Warnf("Failed to save cleaning history: %v", err)
+	}
+}
+
+// visit marks the cells swept on the way from the previous sample to (x, y).
+func (s *coverageService) visit(x, y float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	from := [2]float64{x, y}
+	if s.last != nil {
+		from = *s.last
+	}
+	s.last = &[2]float64{x, y}
+
+	// Step along the path at half a cell so no cell it crosses is missed.
+	dist := math.Hypot(x-from[0], y-from[1])
+	steps := int(math.Ceil(dist / (s.cellSizeMM / 2)))
+	for i := 0; i <= steps; i++ {
+		t := 1.0
+		if steps > 0 {
+			t = float64(i) / float64(steps)
+		}
+		s.sweep(from[0]+t*(x-from[0]), from[1]+t*(y-from[1]))
+	}
+}
+
+// sweep marks the cell under (x, y) and, with a swath wider than a cell,
+// every cell whose center lies within half the swath of it. Callers must
+// hold s.mu.
+func (s *coverageService) sweep(x, y float64) {
+	s.mark(s.cellAt(x, y))
+	half := s.swathMM / 2
+	if half <= s.cellSizeMM/2 {
+		return
+	}
+	lo, hi := s.cellAt(x-half, y-half), s.cellAt(x+half, y+half)
+	for cx := lo.x; cx <= hi.x; cx++ {
+		for cy := lo.y; cy <= hi.y; cy++ {
+			centerX := (float64(cx) + 0.5) * s.cellSizeMM
+			centerY := (float64(cy) + 0.5) * s.cellSizeMM
+			if math.Hypot(centerX-x, centerY-y) <= half {
+				s.mark(cell{cx, cy})
+			}
+		}
+	}
+}
+
+// mark records a swept cell on the map and toward the running cleaning
+// session's area. Callers must hold s.mu.
+func (s *coverageService) mark(at cell) {
+	s.visited[at] = true
+	s.stats.sweep(at)
+}
+
+func (s *coverageService) cellAt(x, y float64) cell {
+	return cell{int(math.Floor(x / s.cellSizeMM)), int(math.Floor(y / s.cellSizeMM))}
+}
+
+// coverageMap returns the visited cells as rows of 0s and 1s over their
+// bounding box, row 0 being the lowest Y, with the covered area. The
+// percentage is of area_m2 if configured, or of the bounding box otherwise.
+func (s *coverageService) coverageMap(context.Context, noArgs) (map[string]any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cellM2 := s.cellSizeMM * s.cellSizeMM / 1e6
+	result := map[string]any{
+		"cell_size_mm":     s.cellSizeMM,
+		"covered_cells":    len(s.visited),
+		"covered_area_m2":  float64(len(s.visited)) * cellM2,
+		"coverage_percent": 0.0,
+		"grid":             []any{},
+	}
+	if len(s.visited) == 0 {
+		return result, nil
+	}
+
+	first := true
+	var lo, hi cell
+	for c := range s.visited {
+		if first {
+			lo, hi, first = c, c, false
+			continue
+		}
+		lo = cell{min(lo.x, c.x), min(lo.y, c.y)}
+		hi = cell{max(hi.x, c.x), max(hi.y, c.y)}
+	}
+	width, height := hi.x-lo.x+1, hi.y-lo.y+1
+	grid := make([]any, 0, height)
+	for cy := lo.y; cy <= hi.y; cy++ {
+		row := make([]any, 0, width)
+		for cx := lo.x; cx <= hi.x; cx++ {
+			if s.visited[cell{cx, cy}] {
+				row = append(row, 1)
+			} else {
+				row = append(row, 0)
+			}
+		}
+		grid = append(grid, row)
+	}
+
+	area := s.areaM2
+	if area == 0 {
+		area = float64(width*height) * cellM2
+	}
+	result["grid"] = grid
+	result["origin_x_mm"] = float64(lo.x) * s.cellSizeMM
+	result["origin_y_mm"] = float64(lo.y) * s.cellSizeMM
+	result["width_cells"] = width
+	result["height_cells"] = height
+	result["coverage_percent"] = math.Round(math.Min(100, float64(len(s.visited))*cellM2/area*100)*10) / 10
+	return result, nil
+}
+
+func (s *coverageService) resetMap(context.Context, noArgs) (map[string]any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.visited = map[cell]bool{}
+	s.last = nil
+	return map[string]any{"status": "reset"}, nil
+}
+
+func (s *coverageService) DoCommand(ctx context.Context, cmd map[string]any) (map[string]any, error) {
+	return s.commands.dispatch(ctx, cmd)
+}
+
+func (s *coverageService) Close(ctx context.Context) error {
+	s.cancelFunc()
+	<-s.done
+	releaseConn(s.conn)
+	return nil
+}
@@ -0,0 +1,45 @@
+package viamroomba
+
+// dockSignal is a decoded IR character sent by a Roomba charging dock.
+type dockSignal struct {
+	redBuoy    bool
+	greenBuoy  bool
+	forceField bool
+}
+
+// decodeDockIR decodes an IR character (packets 17, 52, 53) into the dock
+// buoy/force-field beams it contains. The second return is false if the
+// character isn't from a dock or carries no beam.
+//
+//	160-175: Roomba 500 Home Base   (red = 0x08, green = 0x04, force field = 0x01)
+//	240-254: Roomba 600 Drive-on Charger (red = 0x08, green = 0x04, force field = 0x02)
+func decodeDockIR(code byte) (dockSignal, bool) {
+	var sig dockSignal
+	switch code & 0xF0 {
+	case 0xA0:
+		sig = dockSignal{redBuoy: code&0x08 != 0, greenBuoy: code&0x04 != 0, forceField: code&0x01 != 0}
+	case 0xF0:
+		sig = dockSignal{redBuoy: code&0x08 != 0, greenBuoy: code&0x04 != 0, forceField: code&0x02 != 0}
+	default:
+		return dockSignal{}, false
+	}
+	return sig, sig.redBuoy || sig.greenBuoy || sig.forceField
+}
+
+// dockBearing estimates which side of the robot the dock is on from the left
+// and right directional IR receivers. "center" means both receivers see the
+// dock, i.e. the robot is facing it.
+func dockBearing(leftCode, rightCode byte) string {
+	_, left := decodeDockIR(leftCode)
+	_, right := decodeDockIR(rightCode)
+	switch {
+	case left && right:
+		return "center"
+	case left:
+		return "left"
+	case right:
+		return "right"
+	default:
+		return "none"
+	}
+}
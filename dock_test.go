@@ -0,0 +1,50 @@
+package viamroomba
+
+import "testing"
+
+func TestDecodeDockIR(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		code byte
+		want dockSignal
+		ok   bool
+	}{
+		{"home base force field", 0xA1, dockSignal{forceField: true}, true},
+		{"home base green buoy", 0xA4, dockSignal{greenBuoy: true}, true},
+		{"home base red buoy", 0xA8, dockSignal{redBuoy: true}, true},
+		{"home base red, green, and force field", 0xAD, dockSignal{redBuoy: true, greenBuoy: true, forceField: true}, true},
+		{"virtual wall, not a home base force field", 0xA2, dockSignal{}, false},
+		{"home base reserved", 0xA0, dockSignal{}, false},
+		{"drive-on charger force field", 0xF2, dockSignal{forceField: true}, true},
+		{"drive-on charger red and green", 0xFC, dockSignal{redBuoy: true, greenBuoy: true}, true},
+		{"drive-on charger bit 0 isn't its force field", 0xF1, dockSignal{}, false},
+		{"drive-on charger reserved", 0xF0, dockSignal{}, false},
+		{"no signal", 0x00, dockSignal{}, false},
+		{"remote left", 0x81, dockSignal{}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := decodeDockIR(tc.code)
+			if got != tc.want || ok != tc.ok {
+				t.Errorf("decodeDockIR(%#x) = %+v, %v, want %+v, %v", tc.code, got, ok, tc.want, tc.ok)
+			}
+		})
+	}
+}
+
+func TestDockBearing(t *testing.T) {
+	for _, tc := range []struct {
+		left, right byte
+		want        string
+	}{
+		{0xA8, 0xA4, "center"},
+		{0xF8, 0xF2, "center"},
+		{0xA8, 0x00, "left"},
+		{0x00, 0xF4, "right"},
+		{0x00, 0x00, "none"},
+		{0xA2, 0xF1, "none"},
+	} {
+		if got := dockBearing(tc.left, tc.right); got != tc.want {
+			t.Errorf("dockBearing(%#x, %#x) = %s, want %s", tc.left, tc.right, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package viamroomba
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// errDryRun refuses the commands that hand driving over to the robot,
+// which the simulation can't follow.
+var errDryRun = errors.New("not available with dry_run: the robot would drive itself")
+
+// With dry_run, motion commands go through the same validation as always
+// (mode, thermal protection, limits) and are logged, but the wheels are
+// driven in s.dryRun, a simulation like base-fake's, instead of on the
+// robot. Closed-loop motion and heading hold read the simulation's
+// odometry, so they run to completion as they would on the floor. Sensor
+// reads still go to the robot.
+
+// simulateDrive drives the dry run simulation the way a Drive command
+// with velocity and radius would drive the robot.
+func (s *viamRoombaBase) simulateDrive(velocity, radius int16) {
+	s.logger.Infof("Dry run: Drive velocity=%d mm/s radius=%d mm", velocity, radius)
+	v := float64(velocity)
+	switch radius {
+	case 32767, -32768:
+		s.dryRun.drive(v, 0)
+	case 1, -1:
+		// velocity is each wheel's speed, turning about the center.
+		s.dryRun.drive(0, float64(radius)*v/(float64(s.widthMM)/2)*180/math.Pi)
+	default:
+		s.dryRun.drive(v, v/float64(radius)*180/math.Pi)
+	}
+}
+
+// simulateDriveDirect drives the dry run simulation the way a Drive Direct
+// command would drive the robot.
+func (s *viamRoombaBase) simulateDriveDirect(right, left int16) {
+	s.logger.Infof("Dry run: Drive Direct right=%d mm/s left=%d mm/s", right, left)
+	r, l := float64(right), float64(left)
+	s.dryRun.drive((r+l)/2, (r-l)/float64(s.widthMM)*180/math.Pi)
+}
+
+// readOdometry reads the distance and angle deltas since the last read,
+// from the robot or, with dry_run, from the simulation. Callers must hold
+// s.conn.mu.
+func (s *viamRoombaBase) readOdometry() (distanceMM, angleDeg float64, err error) {
+	if s.dryRun == nil {
+		return s.conn.readOdometry()
+	}
+	readings := s.dryRun.readings()
+	distance, _ := readings["distance_mm"].(int)
+	angle, _ := readings["angle_deg"].(int)
+	return float64(distance), float64(angle), nil
+}
+
+// simulatedPose serves get_simulated_pose.
+func (s *viamRoombaBase) simulatedPose(context.Context, noArgs) (map[string]any, error) {
+	if s.dryRun == nil {
+		return nil, fmt.Errorf("get_simulated_pose needs dry_run")
+	}
+	pose := s.dryRun.pose()
+	pose["moving"] = s.dryRun.moving()
+	return pose, nil
+}
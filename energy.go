@@ -0,0 +1,167 @@
+package viamroomba
+
+import (
+	"context"
+	"encoding/binary"
+	"sort"
+	"time"
+)
+
+const (
+	// maxEnergyOperations bounds the recent operations get_energy_stats
+	// lists.
+	maxEnergyOperations = 50
+	// maxEnergyGap is the longest gap between samples that is integrated;
+	// across a longer one (a failed read, a busy bus) the power drawn is
+	// unknown, so the gap is left out.
+	maxEnergyGap = time.Second
+)
+
+// energyPackets are read with the odometry whenever the robot is doing
+// something: Voltage (22) and Current (23).
+var energyPackets = []byte{22, 23}
+
+// operationEnergy is the energy one operation drew, or the totals for a
+// kind of operation.
+type operationEnergy struct {
+	Kind       string    `json:"kind,omitempty"`
+	Start      time.Time `json:"start,omitempty"`
+	Operations int       `json:"operations,omitempty"`
+	RuntimeSec float64   `json:"runtime_sec"`
+	EnergyMWh  float64   `json:"energy_mwh"`
+}
+
+// energyStats integrates the power the robot draws (packets 22 and 23) over
+// each operation it runs, as the shared activity reports them, and totals
+// it by kind, such as move_straight, spin, or clean. Only the battery's
+// discharge counts; while charging nothing is drawn. Guarded by the
+// coverage service's mu.
+type energyStats struct {
+	totals map[string]*operationEnergy
+	recent []operationEnergy
+
+	// current is the running operation, and currentID its activity ID.
+	// lastAt is when it was last sampled.
+	current   *operationEnergy
+	currentID string
+	lastAt    time.Time
+}
+
+// sample integrates one sample: kind and id are the running operation, and
+// data, if not nil, energyPackets read with it. It returns the energy drawn
+// since the previous sample, and whether an operation ended, so the totals
+// should be saved.
+func (e *energyStats) sample(now time.Time, kind, id string, data [][]byte) (float64, bool) {
+	ended := false
+	if e.current != nil && id != e.currentID {
+		e.finish()
+		ended = true
+	}
+	if kind == "idle" {
+		return 0, ended
+	}
+	if e.current == nil {
+		e.current = &operationEnergy{Kind: kind, Start: now}
+		e.currentID, e.lastAt = id, now
+	}
+
+	dt := now.Sub(e.lastAt)
+	e.lastAt = now
+	if data == nil || dt > maxEnergyGap {
+		return 0, ended
+	}
+	voltageMV := float64(binary.BigEndian.Uint16(data[0]))
+	currentMA := float64(int16(binary.BigEndian.Uint16(data[1])))
+	// Current is negative while the battery discharges.
+	mwh := voltageMV * max(0, -currentMA) / 1000 * dt.Hours()
+	e.current.RuntimeSec += dt.Seconds()
+	e.current.EnergyMWh += mwh
+	return mwh, ended
+}
+
+// finish ends the running operation, adding it to the totals and the
+// recent operations.
+func (e *energyStats) finish() {
+	op := *e.current
+	e.current, e.currentID = nil, ""
+	if e.totals == nil {
+		e.totals = map[string]*operationEnergy{}
+	}
+	total, ok := e.totals[op.Kind]
+	if !ok {
+		total = &operationEnergy{}
+		e.totals[op.Kind] = total
+	}
+	total.Operations++
+	total.RuntimeSec += op.RuntimeSec
+	total.EnergyMWh += op.EnergyMWh
+	e.recent = append(e.recent, op)
+	if len(e.recent) > maxEnergyOperations {
+		e.recent = e.recent[len(e.recent)-maxEnergyOperations:]
+	}
+}
+
+// saved returns the totals to persist.
+func (e *energyStats) saved() map[string]operationEnergy {
+	out := make(map[string]operationEnergy, len(e.totals))
+	for kind, total := range e.totals {
+		out[kind] = *total
+	}
+	return out
+}
+
+// restore loads persisted totals.
+func (e *energyStats) restore(saved map[string]operationEnergy) {
+	e.totals = make(map[string]*operationEnergy, len(saved))
+	for kind, total := range saved {
+		e.totals[kind] = &total
+	}
+}
+
+// energyStats serves get_energy_stats.
+func (s *coverageService) energyStats(context.Context, noArgs) (map[string]any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := &s.energy
+
+	kinds := make([]string, 0, len(e.totals))
+	for kind := range e.totals {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	byKind := map[string]any{}
+	var totalMWh float64
+	for _, kind := range kinds {
+		total := e.totals[kind]
+		byKind[kind] = map[string]any{
+			"operations":      total.Operations,
+			"runtime_sec":     total.RuntimeSec,
+			"energy_mwh":      total.EnergyMWh,
+			"mean_energy_mwh": total.EnergyMWh / float64(total.Operations),
+		}
+		totalMWh += total.EnergyMWh
+	}
+	recent := make([]any, 0, len(e.recent))
+	for _, op := range e.recent {
+		recent = append(recent, operationMap(op))
+	}
+	out := map[string]any{
+		"by_operation": byKind,
+		"recent":       recent,
+		"energy_mwh":   totalMWh,
+	}
+	if e.current != nil {
+		out["current"] = operationMap(*e.current)
+	}
+	return out, nil
+}
+
+// operationMap converts an operation for DoCommand output.
+func operationMap(op operationEnergy) map[string]any {
+	return map[string]any{
+		"kind":        op.Kind,
+		"start":       op.Start.Format(time.RFC3339),
+		"runtime_sec": op.RuntimeSec,
+		"energy_mwh":  op.EnergyMWh,
+	}
+}
@@ -0,0 +1,193 @@
+package viamroomba
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.viam.com/rdk/components/board"
+	"go.viam.com/rdk/components/input"
+	"go.viam.com/rdk/resource"
+)
+
+// estopInterval is how often the e-stop input is read.
+const estopInterval = 20 * time.Millisecond
+
+// EStopConfig configures an external emergency stop input: a GPIO pin on
+// a board, or a control on an input controller.
+type EStopConfig struct {
+	Board           string `json:"board,omitempty"`
+	Pin             string `json:"pin,omitempty"`
+	ActiveLow       bool   `json:"active_low,omitempty"`
+	InputController string `json:"input_controller,omitempty"`
+	Control         string `json:"control,omitempty"`
+}
+
+// validate checks the estop attribute and returns its dependency.
+func (cfg *EStopConfig) validate() (string, error) {
+	switch {
+	case (cfg.Board == "") == (cfg.InputController == ""):
+		return "", errors.New("estop needs exactly one of board or input_controller")
+	case cfg.Board != "" && cfg.Pin == "":
+		return "", errors.New("estop.board requires estop.pin")
+	case cfg.Board == "" && (cfg.Pin != "" || cfg.ActiveLow):
+		return "", errors.New("estop.pin and estop.active_low require estop.board")
+	case cfg.InputController == "" && cfg.Control != "":
+		return "", errors.New("estop.control requires estop.input_controller")
+	case cfg.Board != "":
+		return cfg.Board, nil
+	default:
+		return cfg.InputController, nil
+	}
+}
+
+// estopInput reads whether the e-stop is asserted.
+type estopInput struct {
+	source string
+	read   func(ctx context.Context) (bool, error)
+}
+
+// resolveEStop finds the estop dependency and returns how to read it.
+func resolveEStop(deps resource.Dependencies, cfg *EStopConfig) (*estopInput, error) {
+	if cfg.Board != "" {
+		b, err := board.FromProvider(deps, cfg.Board)
+		if err != nil {
+			return nil, err
+		}
+		pin, err := b.GPIOPinByName(cfg.Pin)
+		if err != nil {
+			return nil, fmt.Errorf("estop pin %q: %w", cfg.Pin, err)
+		}
+		return &estopInput{
+			source: fmt.Sprintf("pin %s on %s", cfg.Pin, cfg.Board),
+			read: func(ctx context.Context) (bool, error) {
+				high, err := pin.Get(ctx, nil)
+				return high != cfg.ActiveLow, err
+			},
+		}, nil
+	}
+
+	controller, err := input.FromProvider(deps, cfg.InputController)
+	if err != nil {
+		return nil, err
+	}
+	control := input.Control(cfg.Control)
+	if control == "" {
+		control = input.ButtonEStop
+	}
+	return &estopInput{
+		source: fmt.Sprintf("%s on %s", control, cfg.InputController),
+		read: func(ctx context.Context) (bool, error) {
+			events, err := controller.Events(ctx, nil)
+			if err != nil {
+				return false, err
+			}
+			// A control that hasn't been used yet has no event.
+			return events[control].Event == input.ButtonPress, nil
+		},
+	}, nil
+}
+
+// estopState is the base's external e-stop, guarded by conn.mu.
+type estopState struct {
+	input *estopInput // nil when not configured
+
+	asserted bool
+	since    time.Time
+	// readErr is why the input couldn't be read, which asserts the e-stop.
+	readErr error
+}
+
+// errAsserted refuses motion while the e-stop is asserted.
+func (e *estopState) errAsserted() error {
+	if e.readErr != nil {
+		return fmt.Errorf("e-stop %s can't be read (%v); motion is refused until it can", e.input.source, e.readErr)
+	}
+	return fmt.Errorf("e-stop %s is asserted; motion is refused until it is released", e.input.source)
+}
+
+// watchEStop reads the e-stop input every estopInterval until the base is
+// closed. When it is asserted, or can't be read, the robot is halted and
+// motion refused; when it is released, motion is allowed again. The robot
+// stays stopped until the next command.
+func (s *viamRoombaBase) watchEStop() {
+	ticker := s.clk.Ticker(estopInterval)
+	defer ticker.Stop()
+	e := &s.estop
+	for {
+		select {
+		case <-s.cancelCtx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		asserted, err := e.input.read(s.cancelCtx)
+		if s.cancelCtx.Err() != nil {
+			return
+		}
+		if err != nil {
+			asserted = true
+		}
+
+		if err := s.conn.mu.LockContext(s.cancelCtx); err != nil {
+			return
+		}
+		wasAsserted := e.asserted
+		e.asserted, e.readErr = asserted, err
+		switch {
+		case asserted && !wasAsserted:
+			e.since = time.Now()
+			if err != nil {
+				s.logger.Errorf("Failed to read e-stop %s; stopping the robot until it can be read: %v", e.input.source, err)
+			} else {
+				s.logger.Errorf("E-stop %s asserted; stopping the robot", e.input.source)
+			}
+			detail := map[string]any{"source": e.input.source}
+			if err != nil {
+				detail["error"] = err.Error()
+			}
+			s.conn.events.record("estop", detail)
+			s.conn.mu.Unlock()
+			s.halt("E-stop")
+			continue
+		case !asserted && wasAsserted:
+			s.logger.Infof("E-stop %s released; motion allowed again", e.input.source)
+			s.conn.events.record("estop_released", map[string]any{"stopped_sec": time.Since(e.since).Seconds()})
+		}
+		s.conn.mu.Unlock()
+	}
+}
+
+// checkEStop refuses a motion or cleaning command while the e-stop is
+// asserted. Callers must hold s.conn.mu.
+func (s *viamRoombaBase) checkEStop() error {
+	if s.estop.asserted {
+		return s.estop.errAsserted()
+	}
+	return nil
+}
+
+// estopSnapshot serves get_estop.
+func (s *viamRoombaBase) estopSnapshot(ctx context.Context, _ noArgs) (map[string]any, error) {
+	if err := s.conn.mu.LockContext(ctx); err != nil {
+		return nil, err
+	}
+	defer s.conn.mu.Unlock()
+	e := s.estop
+	if e.input == nil {
+		return map[string]any{"enabled": false}, nil
+	}
+	out := map[string]any{
+		"enabled":  true,
+		"source":   e.input.source,
+		"asserted": e.asserted,
+	}
+	if e.asserted {
+		out["since"] = e.since.Format(time.RFC3339)
+	}
+	if e.readErr != nil {
+		out["error"] = e.readErr.Error()
+	}
+	return out, nil
+}
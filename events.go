@@ -0,0 +1,247 @@
+package viamroomba
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// maxEvents is how many events the log keeps; older ones are dropped.
+	maxEvents = 256
+	// lowBatteryPercent is the charge below which a low_battery event fires.
+	lowBatteryPercent = 15.0
+)
+
+// event is a discrete change on the robot, such as a bumper being pressed.
+type event struct {
+	seq    uint64
+	time   time.Time
+	kind   string
+	detail map[string]any
+	// pose is where odometry put the robot, for hazardEvents only.
+	pose *eventPose
+}
+
+// eventLog is a ring buffer of events shared by every component on a port.
+// Sequence numbers start at 1 and never repeat, so a client can ask for
+// everything after the last event it saw.
+type eventLog struct {
+	mu     sync.Mutex
+	events []event
+	next   uint64
+	// wake is closed and replaced whenever an event is recorded, so
+	// long-polling callers can wait for one.
+	wake chan struct{}
+	// observers are called with l.mu held for every event recorded, and
+	// must not call back into the log.
+	observers      map[int]func(event)
+	nextObserverID int
+	// pose returns the odometry pose that hazard events are stamped with.
+	pose func() (float64, float64, float64)
+}
+
+// record appends an event, dropping the oldest once the log is full.
+func (l *eventLog) record(kind string, detail map[string]any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.next++
+	if len(l.events) >= maxEvents {
+		l.events = l.events[1:]
+	}
+	e := event{seq: l.next, time: time.Now(), kind: kind, detail: detail}
+	if hazardEvents[kind] && l.pose != nil {
+		x, y, theta := l.pose()
+		e.pose = &eventPose{xMM: x, yMM: y, thetaDeg: theta}
+	}
+	l.events = append(l.events, e)
+	for _, fn := range l.observers {
+		fn(e)
+	}
+	if l.wake != nil {
+		close(l.wake)
+		l.wake = nil
+	}
+}
+
+// addObserver registers fn for every future event and returns a function
+// that unregisters it.
+func (l *eventLog) addObserver(fn func(event)) func() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.observers == nil {
+		l.observers = map[int]func(event){}
+	}
+	id := l.nextObserverID
+	l.nextObserverID++
+	l.observers[id] = fn
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.observers, id)
+	}
+}
+
+// since returns the events after seq, the sequence number of the latest
+// event, and whether events after seq have already been dropped. If there
+// are none yet, it also returns a channel that is closed on the next record.
+func (l *eventLog) since(seq uint64) ([]event, uint64, bool, <-chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var out []event
+	for _, e := range l.events {
+		if e.seq > seq {
+			out = append(out, e)
+		}
+	}
+	missed := len(l.events) > 0 && l.events[0].seq > seq+1
+	if len(out) > 0 {
+		return out, l.next, missed, nil
+	}
+	if l.wake == nil {
+		l.wake = make(chan struct{})
+	}
+	return nil, l.next, missed, l.wake
+}
+
+// getEventsArgs are the parameters of get_events.
+type getEventsArgs struct {
+	Since      *float64 `json:"since" doc:"Only return events with a higher seq"`
+	TimeoutSec *float64 `json:"timeout_sec" doc:"Wait up to this long for an event if there are none yet"`
+}
+
+// getEvents serves the get_events DoCommand: events after Since (default 0,
+// i.e. everything kept), waiting up to TimeoutSec for one if there are none
+// yet.
+func (l *eventLog) getEvents(ctx context.Context, args getEventsArgs) (map[string]any, error) {
+	var seq uint64
+	if args.Since != nil {
+		if *args.Since < 0 {
+			return nil, fmt.Errorf("since must be a non-negative number")
+		}
+		seq = uint64(*args.Since)
+	}
+	var timeout <-chan time.Time
+	if args.TimeoutSec != nil {
+		if *args.TimeoutSec <= 0 {
+			return nil, fmt.Errorf("timeout_sec must be a positive number")
+		}
+		timer := time.NewTimer(time.Duration(*args.TimeoutSec * float64(time.Second)))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	events, latest, missed, wake := l.since(seq)
+	if len(events) == 0 && timeout != nil {
+		select {
+		case <-wake:
+			events, latest, missed, _ = l.since(seq)
+		case <-timeout:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	list := make([]any, 0, len(events))
+	for _, e := range events {
+		entry := map[string]any{
+			"seq":       e.seq,
+			"timestamp": e.time.UTC().Format(time.RFC3339Nano),
+			"type":      e.kind,
+		}
+		for k, v := range e.detail {
+			entry[k] = v
+		}
+		if e.pose != nil {
+			entry["pose"] = map[string]any{"x_mm": e.pose.xMM, "y_mm": e.pose.yMM, "theta_deg": e.pose.thetaDeg}
+		}
+		list = append(list, entry)
+	}
+	return map[string]any{
+		"events":   list,
+		"last_seq": latest,
+		"missed":   missed,
+	}, nil
+}
+
+// eventDetector turns successive Readings into events by watching for
+// sensors switching on. Guarded by the sensor's conn.mu.
+type eventDetector struct {
+	// prev is each eventSources reading as of the previous call, followed
+	// by whether the dock was in sight; nil before the first call.
+	prev       []bool
+	lowBattery bool
+	slipping   bool
+}
+
+// eventSources maps each boolean reading watched for events to the event
+// type it raises when it turns on.
+var eventSources = []struct {
+	reading string
+	kind    string
+}{
+	{"bump_left", "bump"},
+	{"bump_right", "bump"},
+	{"cliff_left", "cliff"},
+	{"cliff_front_left", "cliff"},
+	{"cliff_front_right", "cliff"},
+	{"cliff_right", "cliff"},
+	{"wheel_drop_left", "wheel_drop"},
+	{"wheel_drop_right", "wheel_drop"},
+	{"button_clean", "button_pressed"},
+	{"button_spot", "button_pressed"},
+	{"button_dock", "button_pressed"},
+	{"button_minute", "button_pressed"},
+	{"button_hour", "button_pressed"},
+	{"button_day", "button_pressed"},
+	{"button_schedule", "button_pressed"},
+	{"button_clock", "button_pressed"},
+	{"charger_homebase", "docked"},
+}
+
+// update records an event in log for every watched reading that turned on
+// since the previous call, and returns those readings. The first call only
+// establishes the baseline.
+func (d *eventDetector) update(log *eventLog, readings map[string]any) []string {
+	first := d.prev == nil
+	if first {
+		d.prev = make([]bool, len(eventSources)+1)
+	}
+	var turnedOn []string
+	for i, src := range eventSources {
+		on, _ := readings[src.reading].(bool)
+		if on && !first && !d.prev[i] {
+			log.record(src.kind, map[string]any{"sensor": src.reading})
+			turnedOn = append(turnedOn, src.reading)
+		}
+		d.prev[i] = on
+	}
+
+	dock := false
+	for _, name := range []string{"dock_red_buoy", "dock_green_buoy", "dock_force_field"} {
+		if on, _ := readings[name].(bool); on {
+			dock = true
+		}
+	}
+	if dock && !first && !d.prev[len(eventSources)] {
+		log.record("dock_detected", nil)
+	}
+	d.prev[len(eventSources)] = dock
+
+	if pct, ok := readings["battery_percent"].(float64); ok {
+		low := pct < lowBatteryPercent
+		if low && !d.lowBattery {
+			log.record("low_battery", map[string]any{"battery_percent": pct})
+		}
+		d.lowBattery = low
+	}
+
+	if slipping, ok := readings["slipping"].(bool); ok {
+		if slipping && !d.slipping {
+			log.record("slip", map[string]any{"slip_ratio": readings["slip_ratio"]})
+		}
+		d.slipping = slipping
+	}
+	return turnedOn
+}
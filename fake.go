@@ -0,0 +1,273 @@
+package viamroomba
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/golang/geo/r3"
+	base "go.viam.com/rdk/components/base"
+	"go.viam.com/rdk/components/sensor"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/operation"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/spatialmath"
+)
+
+// FakeConfig configures base-fake. Every dimension is optional and defaults
+// to the Roomba 600 series.
+type FakeConfig struct {
+	WidthMM              int `json:"width_mm,omitempty"`
+	WheelCircumferenceMM int `json:"wheel_circumference_mm,omitempty"`
+	DiameterMM           int `json:"diameter_mm,omitempty"`
+}
+
+func (cfg *FakeConfig) Validate(path string) ([]string, []string, error) {
+	if cfg.WidthMM < 0 || cfg.WheelCircumferenceMM < 0 || cfg.DiameterMM < 0 {
+		return nil, nil, fmt.Errorf("%s: dimensions must be positive numbers", path)
+	}
+	return nil, nil, nil
+}
+
+// fakeBase is a base that drives a simulated robot instead of a serial
+// port, for testing navigation logic without hardware.
+type fakeBase struct {
+	resource.AlwaysRebuild
+
+	name   resource.Name
+	logger logging.Logger
+
+	widthMM              int
+	wheelCircumferenceMM int
+	diameterMM           int
+
+	sim      *simulation
+	clk      clock.Clock
+	opMgr    *operation.SingleOperationManager
+	commands commandSet
+
+	cancelCtx  context.Context
+	cancelFunc func()
+}
+
+func newFakeBase(ctx context.Context, deps resource.Dependencies, rawConf resource.Config, logger logging.Logger) (base.Base, error) {
+	conf, err := resource.NativeConfig[*FakeConfig](rawConf)
+	if err != nil {
+		return nil, err
+	}
+	conf = &FakeConfig{
+		WidthMM:              cmp.Or(conf.WidthMM, 235),
+		WheelCircumferenceMM: cmp.Or(conf.WheelCircumferenceMM, 220),
+		DiameterMM:           cmp.Or(conf.DiameterMM, 340),
+	}
+
+	clk := clock.New()
+	cancelCtx, cancelFunc := context.WithCancel(context.Background())
+	b := &fakeBase{
+		name:                 rawConf.ResourceName(),
+		logger:               logger,
+		widthMM:              conf.WidthMM,
+		wheelCircumferenceMM: conf.WheelCircumferenceMM,
+		diameterMM:           conf.DiameterMM,
+		sim:                  newSimulation(clk, conf.WidthMM, conf.DiameterMM, conf.WheelCircumferenceMM),
+		clk:                  clk,
+		opMgr:                operation.NewSingleOperationManager(),
+		cancelCtx:            cancelCtx,
+		cancelFunc:           cancelFunc,
+	}
+	b.commands = b.newCommands()
+	return b, nil
+}
+
+func (b *fakeBase) Name() resource.Name {
+	return b.name
+}
+
+// addObstacleArgs are the parameters of add_obstacle.
+type addObstacleArgs struct {
+	Type string  `json:"type" required:"true" doc:"wall or cliff"`
+	X1MM float64 `json:"x1_mm" required:"true" doc:"Start of the segment, in the simulation frame"`
+	Y1MM float64 `json:"y1_mm" required:"true" doc:"Start of the segment, in the simulation frame"`
+	X2MM float64 `json:"x2_mm" required:"true" doc:"End of the segment, in the simulation frame"`
+	Y2MM float64 `json:"y2_mm" required:"true" doc:"End of the segment, in the simulation frame"`
+}
+
+// setPoseArgs are the parameters of set_pose.
+type setPoseArgs struct {
+	XMM      float64 `json:"x_mm" doc:"Position along the starting heading"`
+	YMM      float64 `json:"y_mm" doc:"Position to the left of the starting heading"`
+	ThetaDeg float64 `json:"theta_deg" doc:"Heading, positive to the left"`
+}
+
+// newCommands builds the fake base's DoCommands.
+func (b *fakeBase) newCommands() commandSet {
+	return commandSet{
+		newCommand("add_obstacle", "Add a virtual wall or cliff edge", func(_ context.Context, args addObstacleArgs) (map[string]any, error) {
+			id, err := b.sim.addObstacle(args.Type, args.X1MM, args.Y1MM, args.X2MM, args.Y2MM)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]any{"id": id}, nil
+		}),
+		newCommand("clear_obstacles", "Remove every virtual wall and cliff", func(context.Context, noArgs) (map[string]any, error) {
+			b.sim.clearObstacles()
+			return map[string]any{"status": "cleared"}, nil
+		}),
+		newCommand("get_pose", "The simulated robot's true pose", func(context.Context, noArgs) (map[string]any, error) {
+			return b.sim.pose(), nil
+		}),
+		newCommand("set_pose", "Move the simulated robot without driving", func(_ context.Context, args setPoseArgs) (map[string]any, error) {
+			b.sim.setPose(args.XMM, args.YMM, args.ThetaDeg)
+			return b.sim.pose(), nil
+		}),
+		newCommand("get_readings", "Simulated sensor readings, as the fake sensor reports them", func(context.Context, noArgs) (map[string]any, error) {
+			return b.sim.readings(), nil
+		}),
+	}
+}
+
+func (b *fakeBase) MoveStraight(ctx context.Context, distanceMm int, mmPerSec float64, extra map[string]any) error {
+	if distanceMm == 0 || mmPerSec == 0 {
+		return b.Stop(ctx, extra)
+	}
+	velocity := math.Min(500, math.Abs(mmPerSec))
+	if distanceMm < 0 {
+		velocity = -velocity
+	}
+	return b.timedMotion(ctx, velocity, 0, math.Abs(float64(distanceMm)/velocity))
+}
+
+func (b *fakeBase) Spin(ctx context.Context, angleDeg float64, degsPerSec float64, extra map[string]any) error {
+	if angleDeg == 0 || degsPerSec == 0 {
+		return b.Stop(ctx, extra)
+	}
+	return b.timedMotion(ctx, 0, math.Copysign(math.Abs(degsPerSec), angleDeg), math.Abs(angleDeg/degsPerSec))
+}
+
+// timedMotion drives the simulation for seconds and then stops it, like the
+// real base's timed MoveStraight and Spin.
+func (b *fakeBase) timedMotion(ctx context.Context, velocity, angularDegPerSec, seconds float64) error {
+	ctx, done := b.opMgr.New(ctx)
+	defer done()
+	b.sim.drive(velocity, angularDegPerSec)
+	defer b.sim.drive(0, 0)
+
+	timer := b.clk.Timer(time.Duration(seconds * float64(time.Second)))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-b.cancelCtx.Done():
+		return b.cancelCtx.Err()
+	}
+}
+
+func (b *fakeBase) SetPower(ctx context.Context, linear r3.Vector, angular r3.Vector, extra map[string]any) error {
+	const maxWheelSpeed = 500.0
+	maxAngularDegPerSec := maxWheelSpeed * 180.0 / (math.Pi * float64(b.widthMM) / 2.0)
+	return b.SetVelocity(ctx,
+		r3.Vector{Y: math.Max(-1, math.Min(1, linear.Y)) * maxWheelSpeed},
+		r3.Vector{Z: math.Max(-1, math.Min(1, angular.Z)) * maxAngularDegPerSec},
+		extra)
+}
+
+func (b *fakeBase) SetVelocity(ctx context.Context, linear r3.Vector, angular r3.Vector, extra map[string]any) error {
+	b.opMgr.CancelRunning(ctx)
+	b.sim.drive(linear.Y, angular.Z)
+	return nil
+}
+
+func (b *fakeBase) Stop(ctx context.Context, extra map[string]any) error {
+	b.opMgr.CancelRunning(ctx)
+	b.sim.drive(0, 0)
+	return nil
+}
+
+func (b *fakeBase) IsMoving(ctx context.Context) (bool, error) {
+	return b.sim.moving(), nil
+}
+
+func (b *fakeBase) Properties(ctx context.Context, extra map[string]any) (base.Properties, error) {
+	return base.Properties{
+		WidthMeters:              float64(b.widthMM) / 1000.0,
+		TurningRadiusMeters:      0.0,
+		WheelCircumferenceMeters: float64(b.wheelCircumferenceMM) / 1000.0,
+	}, nil
+}
+
+func (b *fakeBase) Geometries(ctx context.Context, extra map[string]any) ([]spatialmath.Geometry, error) {
+	d := float64(b.diameterMM)
+	geom, err := spatialmath.NewBox(
+		spatialmath.NewPoseFromPoint(r3.Vector{Z: 92.0 / 2}),
+		r3.Vector{X: d, Y: d, Z: 92},
+		b.name.Name,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return []spatialmath.Geometry{geom}, nil
+}
+
+func (b *fakeBase) DoCommand(ctx context.Context, cmd map[string]any) (map[string]any, error) {
+	return b.commands.dispatch(ctx, cmd)
+}
+
+func (b *fakeBase) Close(ctx context.Context) error {
+	b.opMgr.CancelRunning(ctx)
+	b.cancelFunc()
+	return nil
+}
+
+// FakeSensorConfig configures sensor-fake, which reports the simulated
+// robot of a base-fake.
+type FakeSensorConfig struct {
+	Base string `json:"base"`
+}
+
+func (cfg *FakeSensorConfig) Validate(path string) ([]string, []string, error) {
+	if cfg.Base == "" {
+		return nil, nil, fmt.Errorf("%s: base is required", path)
+	}
+	return []string{cfg.Base}, nil, nil
+}
+
+type fakeSensor struct {
+	resource.AlwaysRebuild
+	resource.TriviallyCloseable
+
+	name resource.Name
+	sim  *simulation
+}
+
+func newFakeSensor(ctx context.Context, deps resource.Dependencies, rawConf resource.Config, logger logging.Logger) (sensor.Sensor, error) {
+	conf, err := resource.NativeConfig[*FakeSensorConfig](rawConf)
+	if err != nil {
+		return nil, err
+	}
+	res, err := base.FromProvider(deps, conf.Base)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := res.(*fakeBase)
+	if !ok {
+		return nil, fmt.Errorf("base %q is not a %s", conf.Base, BaseFake)
+	}
+	return &fakeSensor{name: rawConf.ResourceName(), sim: b.sim}, nil
+}
+
+func (s *fakeSensor) Name() resource.Name {
+	return s.name
+}
+
+func (s *fakeSensor) Readings(ctx context.Context, extra map[string]any) (map[string]any, error) {
+	return s.sim.readings(), nil
+}
+
+func (s *fakeSensor) DoCommand(ctx context.Context, cmd map[string]any) (map[string]any, error) {
+	return nil, errUnimplemented
+}
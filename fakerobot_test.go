@@ -0,0 +1,252 @@
+package viamroomba
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/benbjohnson/clock"
+	"github.com/parabolala/go-roomba"
+	"github.com/xa4a/go-roomba/constants"
+	"go.viam.com/rdk/components/base"
+	"go.viam.com/rdk/components/sensor"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+)
+
+// fakeRobot is an in-memory serial transport that answers like a Roomba's
+// OI: it follows the mode through Start, Safe, Full, and the cleaning
+// commands, answers Sensors and Query List with the packets in values (zero
+// if unset), and keeps every command it is sent. A read with nothing to
+// return fails with io.EOF, as a serial read that timed out does.
+type fakeRobot struct {
+	mu sync.Mutex
+	// pending is written bytes that don't yet make a whole command, and out
+	// the response bytes not yet read.
+	pending []byte
+	out     []byte
+	mode    byte
+	values  map[byte][]byte
+	sent    [][]byte
+	closed  bool
+}
+
+func newFakeRobot() *fakeRobot {
+	return &fakeRobot{
+		mode: byte(oiPassive),
+		values: map[byte][]byte{
+			22: {0x3a, 0x98}, // 15000 mV
+			25: {0x07, 0xd0}, // 2000 mAh
+			26: {0x0a, 0x8c}, // 2700 mAh
+			24: {25},         // 25 °C
+		},
+	}
+}
+
+// fakeCommandArgs is how many bytes follow each fixed-length opcode.
+var fakeCommandArgs = map[byte]int{
+	129: 1, 137: 4, 138: 1, 139: 3, 141: 1, 142: 1, 144: 3, 145: 4, 146: 4,
+	147: 1, 150: 1, 162: 1, 163: 4, 164: 4, 165: 1, 167: 15, 168: 3,
+}
+
+// fakeCommandLength returns the length of the command at the start of buf,
+// opcode included, or 0 if buf doesn't yet hold enough to tell.
+func fakeCommandLength(buf []byte) int {
+	if len(buf) == 0 {
+		return 0
+	}
+	switch buf[0] {
+	case 148, 149: // Stream and Query List: a count, then that many IDs.
+		if len(buf) < 2 {
+			return 0
+		}
+		return 2 + int(buf[1])
+	case opSong: // Song: a number, a length, then note and duration pairs.
+		if len(buf) < 3 {
+			return 0
+		}
+		return 3 + 2*int(buf[2])
+	}
+	return 1 + fakeCommandArgs[buf[0]]
+}
+
+func (r *fakeRobot) Write(b []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return 0, os.ErrClosed
+	}
+	r.pending = append(r.pending, b...)
+	for {
+		n := fakeCommandLength(r.pending)
+		if n == 0 || n > len(r.pending) {
+			break
+		}
+		r.handle(append([]byte(nil), r.pending[:n]...))
+		r.pending = r.pending[n:]
+	}
+	return len(b), nil
+}
+
+func (r *fakeRobot) Read(b []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return 0, os.ErrClosed
+	}
+	if len(r.out) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(b, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+func (r *fakeRobot) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	return nil
+}
+
+// handle carries out one whole command. Callers must hold r.mu.
+func (r *fakeRobot) handle(cmd []byte) {
+	r.sent = append(r.sent, cmd)
+	switch cmd[0] {
+	case opStart, opSpot, opClean, opMax, opSeekDock:
+		r.mode = byte(oiPassive)
+	case opSafe:
+		r.mode = byte(oiSafe)
+	case opFull:
+		r.mode = byte(oiFull)
+	case opPower:
+		r.mode = byte(oiOff)
+	case 142:
+		r.out = append(r.out, r.packet(cmd[1])...)
+	case 149:
+		for _, id := range cmd[2:] {
+			r.out = append(r.out, r.packet(id)...)
+		}
+	}
+}
+
+// packet is the robot's answer for one packet ID. Callers must hold r.mu.
+func (r *fakeRobot) packet(id byte) []byte {
+	if span, ok := groupRanges[id]; ok {
+		var buf []byte
+		for member := int(span[0]); member <= int(span[1]); member++ {
+			buf = append(buf, r.packet(byte(member))...)
+		}
+		return buf
+	}
+	if id == 35 {
+		return []byte{r.mode}
+	}
+	if v, ok := r.values[id]; ok {
+		return append([]byte(nil), v...)
+	}
+	return make([]byte, constants.SENSOR_PACKET_LENGTH[id])
+}
+
+// opcodes returns the opcode of every command sent so far, in order.
+func (r *fakeRobot) opcodes() []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ops := make([]byte, len(r.sent))
+	for i, cmd := range r.sent {
+		ops[i] = cmd[0]
+	}
+	return ops
+}
+
+// lastDrive returns the velocity and radius of the last Drive command sent,
+// or false if none was.
+func (r *fakeRobot) lastDrive() ([2]int16, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := len(r.sent) - 1; i >= 0; i-- {
+		if cmd := r.sent[i]; cmd[0] == opDrive {
+			return [2]int16{int16(binary.BigEndian.Uint16(cmd[1:])), int16(binary.BigEndian.Uint16(cmd[3:]))}, true
+		}
+	}
+	return [2]int16{}, false
+}
+
+// useFakeRobots makes acquireConn open a fakeRobot in place of each serial
+// port, until the test ends, and returns them by the port's connection key.
+func useFakeRobots(tb testing.TB) map[string]*fakeRobot {
+	tb.Helper()
+	var mu sync.Mutex
+	robots := map[string]*fakeRobot{}
+	orig := openOI
+	openOI = func(serialPort string, _ int, _ oiProfile) (*roomba.Roomba, error) {
+		r := newFakeRobot()
+		mu.Lock()
+		robots[connKey(serialPort)] = r
+		mu.Unlock()
+		return &roomba.Roomba{PortName: serialPort, S: r, StreamPaused: make(chan bool, 1)}, nil
+	}
+	// go-roomba logs every command it writes.
+	logOut := log.Writer()
+	log.SetOutput(io.Discard)
+	tb.Cleanup(func() {
+		openOI = orig
+		log.SetOutput(logOut)
+	})
+	return robots
+}
+
+// newTestBase builds a base with the default config on port, running its
+// timers on clk, puts the robot in Safe mode so it can drive, and closes
+// the base when the test ends. The port must have a fakeRobot on it; see
+// useFakeRobots.
+func newTestBase(tb testing.TB, port string, clk clock.Clock) *viamRoombaBase {
+	tb.Helper()
+	orig := baseClock
+	baseClock = func() clock.Clock { return clk }
+	defer func() { baseClock = orig }()
+
+	b, err := NewBase(context.Background(), nil, base.Named("base"), &Config{SerialPort: port}, logging.NewTestLogger(tb))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { b.Close(context.Background()) })
+	if _, err := b.DoCommand(context.Background(), map[string]any{"command": "enter_safe_mode"}); err != nil {
+		tb.Fatal(err)
+	}
+	return b.(*viamRoombaBase)
+}
+
+// newTestSensor builds a sensor with the default config on port, and closes
+// it when the test ends. The port must have a fakeRobot on it.
+func newTestSensor(tb testing.TB, port string) *viamRoombaSensor {
+	tb.Helper()
+	return newTestSensorWith(tb, &SensorConfig{SerialPort: port})
+}
+
+// newTestSensorWith is newTestSensor with the config cfg.
+func newTestSensorWith(tb testing.TB, cfg *SensorConfig) *viamRoombaSensor {
+	tb.Helper()
+	conf := resource.Config{Name: "sensor", API: sensor.API, Model: Sensor, ConvertedAttributes: cfg}
+	s, err := newViamRoombaSensor(context.Background(), nil, conf, logging.NewTestLogger(tb))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { s.Close(context.Background()) })
+	return s.(*viamRoombaSensor)
+}
+
+// baseOnFakeRobot builds a base as newTestBase does, on a port of its own,
+// and returns it with the fakeRobot it drives.
+func baseOnFakeRobot(tb testing.TB, clk clock.Clock) (*viamRoombaBase, *fakeRobot) {
+	tb.Helper()
+	robots := useFakeRobots(tb)
+	port := filepath.Join(tb.TempDir(), "ttyUSB0")
+	s := newTestBase(tb, port, clk)
+	return s, robots[connKey(port)]
+}
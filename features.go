@@ -0,0 +1,56 @@
+package viamroomba
+
+import "context"
+
+// featureMatrix serves get_features: what this base, as configured and on
+// the attached robot, provides, so generic client code can adapt to it
+// without parsing the config. base.Properties only carries dimensions, so
+// the matrix is a DoCommand rather than part of Properties.
+func (s *viamRoombaBase) featureMatrix(context.Context, noArgs) (map[string]any, error) {
+	robot := s.conn.caps.features()
+	model := s.model
+	if model == "" {
+		model = Base.String()
+	}
+	return map[string]any{
+		"model":      model,
+		"oi_profile": s.conn.profile.name,
+		"closed_loop": map[string]any{
+			// Distance and angle are basic packets, so every robot can end
+			// a motion on odometry; closed_loop_motion makes MoveStraight
+			// and Spin do so.
+			"available":       true,
+			"enabled":         s.closedLoopMotion,
+			"heading_fusion":  s.gyro != nil,
+			"measured_motion": robot["encoders"],
+		},
+		"drive_direct": map[string]any{
+			"available": robot["drive_direct"],
+			// Heading hold steers with it when the robot has it.
+			"used": robot["drive_direct"] && s.headingHold,
+		},
+		// The module polls with Query List or group packets; it never
+		// starts the OI's Stream mode.
+		"stream_mode": map[string]any{"available": true, "enabled": false},
+		"safety_monitor": map[string]any{
+			"cliff_reflex":       s.cliffReflex,
+			"bump_reflex":        s.bumpReflex,
+			"thermal_protection": s.thermal.limitC > 0,
+			"estop":              s.estop.input != nil,
+			"geofence":           s.geofence.radiusMM > 0,
+			"speed_zones":        len(s.speedZones.zones) > 0,
+			"mode_reassert":      s.modeMismatches != nil,
+			"full_mode_allowed":  s.allowFullMode,
+		},
+		"motion": map[string]any{
+			"heading_hold":   s.headingHold,
+			"adaptive_speed": s.cfg.AdaptiveSpeed,
+			"quiet_hours":    s.quietHours != nil,
+			"non_blocking":   s.nonBlockingMotion,
+			"strict_limits":  s.strictLimits,
+			"dry_run":        s.dryRun != nil,
+			"max_speed_mm_s": s.maxVelocity,
+		},
+		"robot": s.conn.caps.report()["features"],
+	}, nil
+}
@@ -0,0 +1,104 @@
+package viamroomba
+
+import (
+	"fmt"
+	"maps"
+	"sort"
+)
+
+// readingUnits are the units of the readings that measure something, as
+// include_units reports them. Counts, levels, and signal strengths the OI
+// gives no unit for are left out.
+var readingUnits = map[string]string{
+	"serial_latency_ms":            "ms",
+	"distance_mm":                  "mm",
+	"angle_deg":                    "deg",
+	"total_distance_mm":            "mm",
+	"total_rotation_deg":           "deg",
+	"voltage_mv":                   "mV",
+	"current_ma":                   "mA",
+	"charging_current_ma":          "mA",
+	"temperature_c":                "°C",
+	"battery_charge_mah":           "mAh",
+	"battery_capacity_mah":         "mAh",
+	"battery_percent":              "%",
+	"time_to_full_min":             "min",
+	"time_to_empty_min":            "min",
+	"requested_velocity_mms":       "mm/s",
+	"requested_radius_mm":          "mm",
+	"commanded_left_velocity_mms":  "mm/s",
+	"commanded_right_velocity_mms": "mm/s",
+	"measured_left_velocity_mms":   "mm/s",
+	"measured_right_velocity_mms":  "mm/s",
+	"left_encoder_counts":          "counts",
+	"right_encoder_counts":         "counts",
+	"main_brush_current_ma":        "mA",
+}
+
+// validateFieldAliases checks the field_aliases attribute: every reading is
+// renamed to a distinct, non-empty name that isn't itself renamed.
+func validateFieldAliases(aliases map[string]string) error {
+	from := make([]string, 0, len(aliases))
+	for k := range aliases {
+		from = append(from, k)
+	}
+	sort.Strings(from)
+	to := map[string]string{}
+	for _, k := range from {
+		v := aliases[k]
+		switch {
+		case k == "" || v == "":
+			return fmt.Errorf("field_aliases: names must not be empty")
+		case to[v] != "":
+			return fmt.Errorf("field_aliases: %s and %s are both renamed to %s", to[v], k, v)
+		}
+		if _, renamed := aliases[v]; renamed && v != k {
+			return fmt.Errorf("field_aliases: %s is renamed to %s, which is itself renamed", k, v)
+		}
+		if v == "units" {
+			return fmt.Errorf("field_aliases: %s can't be renamed to units, which include_units uses", k)
+		}
+		to[v] = k
+	}
+	return nil
+}
+
+// presentFields renames, in place, the readings that aliases names. With
+// withUnits, it adds a units map giving the unit of each reading in
+// readingUnits, under its new name.
+func presentFields(readings map[string]any, aliases map[string]string, withUnits bool) {
+	var units map[string]any
+	if withUnits {
+		units = make(map[string]any, len(readingUnits))
+		for k, unit := range readingUnits {
+			if _, ok := readings[k]; !ok {
+				continue
+			}
+			if alias, ok := aliases[k]; ok {
+				k = alias
+			}
+			units[k] = unit
+		}
+	}
+	for k, alias := range aliases {
+		if v, ok := readings[k]; ok {
+			delete(readings, k)
+			readings[alias] = v
+		}
+	}
+	if withUnits {
+		readings["units"] = units
+	}
+}
+
+// cloneReadings copies readings for another caller, along with the maps
+// nested in it (units and errors), which a caller might modify.
+func cloneReadings(readings map[string]any) map[string]any {
+	out := maps.Clone(readings)
+	for k, v := range out {
+		if m, ok := v.(map[string]any); ok {
+			out[k] = maps.Clone(m)
+		}
+	}
+	return out
+}
@@ -0,0 +1,26 @@
+package viamroomba
+
+const (
+	defaultCarpetSignalThreshold = 1200
+	defaultEdgeSignalThreshold   = 200
+)
+
+// classifyFloor estimates the floor type from the four cliff signal strengths
+// (packets 28-31). The cliff sensors are downward-facing IR reflectance
+// sensors: smooth hard floors reflect strongly, carpet pile scatters the beam,
+// and a drop-off returns almost nothing. Any single sensor below
+// edgeThreshold reports "edge"; otherwise the mean decides between "carpet"
+// and "hard_floor".
+func classifyFloor(signals [4]int, carpetThreshold, edgeThreshold int) string {
+	sum := 0
+	for _, sig := range signals {
+		if sig < edgeThreshold {
+			return "edge"
+		}
+		sum += sig
+	}
+	if sum/len(signals) < carpetThreshold {
+		return "carpet"
+	}
+	return "hard_floor"
+}
@@ -0,0 +1,25 @@
+package viamroomba
+
+import "testing"
+
+func TestClassifyFloor(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		signals [4]int
+		want    string
+	}{
+		{"tile", [4]int{2400, 2500, 2450, 2300}, "hard_floor"},
+		{"mean exactly at the carpet threshold", [4]int{1100, 1300, 1200, 1200}, "hard_floor"},
+		{"mean just under the carpet threshold", [4]int{1100, 1300, 1199, 1200}, "carpet"},
+		{"thick carpet", [4]int{600, 700, 650, 620}, "carpet"},
+		{"one sensor over a drop-off", [4]int{2400, 2500, 150, 2300}, "edge"},
+		{"signal exactly at the edge threshold", [4]int{200, 2500, 2400, 2300}, "hard_floor"},
+		{"lifted", [4]int{0, 0, 0, 0}, "edge"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := classifyFloor(tc.signals, defaultCarpetSignalThreshold, defaultEdgeSignalThreshold); got != tc.want {
+				t.Errorf("classifyFloor(%v) = %s, want %s", tc.signals, got, tc.want)
+			}
+		})
+	}
+}
@@ -3,7 +3,11 @@
 package viamroomba
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"strings"
 	"syscall"
 	"time"
 	"unsafe"
@@ -12,7 +16,12 @@ import (
 // flushRx discards any unread bytes from the serial receive buffer.
 // This prevents stale bytes from corrupting subsequent sensor query responses.
 func (c *roombaConn) flushRx() {
-	f, ok := c.roomba.S.(*os.File)
+	flushPort(c.port)
+}
+
+// flushPort discards any unread bytes from port's receive buffer.
+func flushPort(port io.ReadWriter) {
+	f, ok := port.(*os.File)
 	if !ok {
 		return
 	}
@@ -23,13 +32,50 @@ func (c *roombaConn) flushRx() {
 	syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(tcflsh), uintptr(tciflush))
 }
 
+// setModemLine asserts or clears the RTS or DTR line of the serial port.
+// Adapters that wire one of them to the robot's BRC pin drive BRC low while
+// the line is asserted.
+func (c *roombaConn) setModemLine(line string, assert bool) error {
+	f, ok := c.port.(*os.File)
+	if !ok {
+		return errors.New("serial port has no modem control lines")
+	}
+	const (
+		tiocmbis = 0x5416
+		tiocmbic = 0x5417
+		tiocmDTR = 0x002
+		tiocmRTS = 0x004
+	)
+	bits := uint32(tiocmRTS)
+	if line == "dtr" {
+		bits = tiocmDTR
+	}
+	req := uintptr(tiocmbic)
+	if assert {
+		req = tiocmbis
+	}
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), req, uintptr(unsafe.Pointer(&bits))); errno != 0 {
+		return fmt.Errorf("failed to set %s: %w", strings.ToUpper(line), errno)
+	}
+	return nil
+}
+
+// canTimeoutReads reports that setReadTimeout bounds serial reads.
+const canTimeoutReads = true
+
 // setReadTimeout configures the serial port so that read() returns after at
 // most d (rounded to the nearest 100ms decisecond) instead of blocking forever.
 // With VMIN=0, VTIME=N the kernel waits up to N*100ms for the first byte and
 // returns 0 bytes (EOF in Go) if nothing arrives, releasing any mutex held by
 // the caller.
 func (c *roombaConn) setReadTimeout(d time.Duration) {
-	f, ok := c.roomba.S.(*os.File)
+	setPortReadTimeout(c.port, d)
+}
+
+// setPortReadTimeout is setReadTimeout for a port not yet installed on a
+// connection.
+func setPortReadTimeout(port io.ReadWriter, d time.Duration) {
+	f, ok := port.(*os.File)
 	if !ok {
 		return
 	}
@@ -2,8 +2,24 @@
 
 package viamroomba
 
-import "time"
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// canTimeoutReads is false because setReadTimeout is a no-op here: a read
+// that gets no reply blocks until the robot sends something.
+const canTimeoutReads = false
 
 func (c *roombaConn) flushRx() {}
 
+func flushPort(io.ReadWriter) {}
+
 func (c *roombaConn) setReadTimeout(_ time.Duration) {}
+
+func setPortReadTimeout(io.ReadWriter, time.Duration) {}
+
+func (c *roombaConn) setModemLine(string, bool) error {
+	return errors.New("modem control lines are only supported on Linux")
+}
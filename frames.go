@@ -0,0 +1,54 @@
+package viamroomba
+
+import (
+	"fmt"
+	"math"
+)
+
+// SensorOffset is the mounting position of a sensor relative to the base
+// origin (center of the wheel axis, on the floor) in the Viam base frame:
+// +X right, +Y forward, +Z up.
+type SensorOffset struct {
+	XMM float64 `json:"x_mm"`
+	YMM float64 `json:"y_mm"`
+	ZMM float64 `json:"z_mm"`
+}
+
+// defaultSensorOffsets are measured from a Roomba 650.
+var defaultSensorOffsets = map[string]SensorOffset{
+	"bump_left":         {XMM: -120, YMM: 120, ZMM: 40},
+	"bump_right":        {XMM: 120, YMM: 120, ZMM: 40},
+	"cliff_left":        {XMM: -150, YMM: 70, ZMM: 0},
+	"cliff_front_left":  {XMM: -55, YMM: 150, ZMM: 0},
+	"cliff_front_right": {XMM: 55, YMM: 150, ZMM: 0},
+	"cliff_right":       {XMM: 150, YMM: 70, ZMM: 0},
+	"wall":              {XMM: 140, YMM: 80, ZMM: 30},
+	"dock_ir":           {XMM: 0, YMM: 130, ZMM: 90},
+	"dirt_detect":       {XMM: 0, YMM: 50, ZMM: 0},
+}
+
+// resolveSensorOffsets overlays configured offsets onto the defaults,
+// rejecting names that don't correspond to a known sensor.
+func resolveSensorOffsets(configured map[string]SensorOffset) (map[string]SensorOffset, error) {
+	offsets := make(map[string]SensorOffset, len(defaultSensorOffsets))
+	for name, off := range defaultSensorOffsets {
+		offsets[name] = off
+	}
+	for name, off := range configured {
+		if _, ok := defaultSensorOffsets[name]; !ok {
+			return nil, fmt.Errorf("unknown sensor %q in sensor_offsets", name)
+		}
+		offsets[name] = off
+	}
+	return offsets, nil
+}
+
+// toOdometryFrame projects a base-frame offset into the odometry frame given
+// the robot's odometry pose. The odometry frame has +X along the heading the
+// robot had when the connection was opened and +Y to its left.
+func (o SensorOffset) toOdometryFrame(xMM, yMM, headingDeg float64) (float64, float64) {
+	th := headingDeg * math.Pi / 180.0
+	forward, left := o.YMM, -o.XMM
+	return xMM + forward*math.Cos(th) - left*math.Sin(th),
+		yMM + forward*math.Sin(th) + left*math.Cos(th)
+}
@@ -0,0 +1,31 @@
+package viamroomba
+
+import (
+	"math"
+	"testing"
+)
+
+func TestToOdometryFrame(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		off           SensorOffset
+		x, y, heading float64
+		wantX, wantY  float64
+	}{
+		{"forward at the origin", SensorOffset{YMM: 100}, 0, 0, 0, 100, 0},
+		{"right at the origin", SensorOffset{XMM: 100}, 0, 0, 0, 0, -100},
+		{"forward turned left", SensorOffset{YMM: 100}, 0, 0, 90, 0, 100},
+		{"forward turned around", SensorOffset{YMM: 100}, 0, 0, 180, -100, 0},
+		{"right turned left", SensorOffset{XMM: 100}, 0, 0, 90, 100, 0},
+		{"moved away", SensorOffset{XMM: -50, YMM: 100}, 10, 20, 0, 110, 70},
+		{"height is ignored", SensorOffset{ZMM: 90}, 10, 20, 45, 10, 20},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			x, y := tc.off.toOdometryFrame(tc.x, tc.y, tc.heading)
+			if math.Abs(x-tc.wantX) > 1e-9 || math.Abs(y-tc.wantY) > 1e-9 {
+				t.Errorf("%+v.toOdometryFrame(%v, %v, %v) = (%v, %v), want (%v, %v)",
+					tc.off, tc.x, tc.y, tc.heading, x, y, tc.wantX, tc.wantY)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package viamroomba
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// fullModeWatchInterval is how often the Full mode watchdog reads the cliff
+// sensors. The robot can cover 5cm at top speed in this time.
+const fullModeWatchInterval = 100 * time.Millisecond
+
+// enterFullModeArgs are the parameters of enter_full_mode.
+type enterFullModeArgs struct {
+	Confirm string `json:"confirm" doc:"Must match full_mode_token, if one is configured"`
+}
+
+// enterFullMode switches to Full mode, which disables the robot's own cliff
+// and wheel drop protection, so it is refused unless allow_full_mode is set
+// (and the confirmation token matches, if configured). A watchdog then
+// reverts to Safe mode after full_mode_timeout_sec, or as soon as a cliff is
+// seen.
+func (s *viamRoombaBase) enterFullMode(ctx context.Context, args enterFullModeArgs) (map[string]any, error) {
+	if !s.allowFullMode {
+		return nil, errors.New("full mode is disabled; set allow_full_mode in the base config to enable it")
+	}
+	if s.fullModeToken != "" && args.Confirm != s.fullModeToken {
+		return nil, errors.New("full mode requires confirm to match the configured full_mode_token")
+	}
+
+	if err := s.conn.mu.LockContext(ctx); err != nil {
+		return nil, err
+	}
+	defer s.conn.mu.Unlock()
+	if err := s.conn.setMode(oiFull); err != nil {
+		return nil, err
+	}
+	s.conn.activity.set("idle")
+	s.logger.Info("Entered Full mode (safety features disabled)")
+
+	s.stopFullModeWatch()
+	watchCtx, cancel := context.WithCancel(s.cancelCtx)
+	s.stopFullModeWatch = cancel
+	goSafe(func() { s.watchFullMode(watchCtx) })
+
+	return map[string]any{"status": "full_mode_enabled"}, nil
+}
+
+// watchFullMode polls the cliff sensors while the OI is in Full mode and
+// drops back to Safe mode if any of them trips or the configured time
+// limit passes. It returns once the OI leaves Full mode by any route.
+func (s *viamRoombaBase) watchFullMode(ctx context.Context) {
+	var timeout <-chan time.Time
+	if s.fullModeTimeout > 0 {
+		timer := s.clk.Timer(s.fullModeTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	ticker := s.clk.Ticker(fullModeWatchInterval)
+	defer ticker.Stop()
+
+	for {
+		reason := ""
+		select {
+		case <-ctx.Done():
+			return
+		case <-timeout:
+			reason = "time limit reached"
+		case <-ticker.C:
+		}
+
+		if err := s.conn.mu.LockContext(ctx); err != nil {
+			return
+		}
+		if s.conn.mode != oiFull {
+			s.conn.mu.Unlock()
+			return
+		}
+		if reason == "" {
+			reason = s.fullModeDanger()
+		}
+		if reason != "" {
+			s.revertFullMode(reason)
+			s.conn.mu.Unlock()
+			return
+		}
+		s.conn.mu.Unlock()
+	}
+}
+
+// fullModeDanger reads the cliff sensors (packets 9-12) and their signal
+// strengths (packets 28-31) and describes any cliff seen, or returns "".
+// An unreadable sensor counts as a cliff. Callers must hold s.conn.mu.
+func (s *viamRoombaBase) fullModeDanger() string {
+	data, err := s.conn.query([]byte{9, 10, 11, 12, 28, 29, 30, 31})
+	if err != nil {
+		return "cliff sensors unreadable: " + err.Error()
+	}
+	for i := 0; i < 4; i++ {
+		if data[i][0]&0x01 != 0 {
+			return "cliff detected by " + packetName(byte(9+i))
+		}
+		if signal := int(binary.BigEndian.Uint16(data[4+i])); signal < s.fullModeCliffThreshold {
+			return "low signal on " + packetName(byte(28+i))
+		}
+	}
+	return ""
+}
+
+// revertFullMode stops the wheels and returns to Safe mode. Callers must
+// hold s.conn.mu.
+func (s *viamRoombaBase) revertFullMode(reason string) {
+	s.logger.Warnf("Leaving Full mode: %s", reason)
+	if err := s.conn.stop(); err != nil {
+		s.logger.Warnf("Failed to stop while leaving Full mode: %v", err)
+	}
+	if err := s.conn.setMode(oiSafe); err != nil {
+		s.logger.Errorf("Failed to return to Safe mode from Full mode: %v", err)
+		return
+	}
+	s.conn.activity.set("idle")
+	s.conn.events.record("full_mode_reverted", map[string]any{"reason": reason})
+}
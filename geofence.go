@@ -0,0 +1,216 @@
+package viamroomba
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// geofenceInterval is how often the geofence checks how far the robot
+	// is from its center. Odometry is only read for it when nothing else
+	// (a path, heading hold, the sensor) has read it for this long, so it
+	// doesn't take distance and angle deltas from a closed-loop motion.
+	geofenceInterval = 250 * time.Millisecond
+	// geofenceOutwardMM is how much farther out the robot must get, once
+	// stopped outside the fence, to be stopped again, so odometry noise
+	// doesn't stop a robot driving back in.
+	geofenceOutwardMM = 20.0
+)
+
+// geofenceState is the base's soft geofence: a circle of radiusMM around
+// the pose the base started at, or where the robot last docked. Once the
+// robot is found outside it, it is stopped and only motion back toward the
+// center is allowed, until it is back inside or the fence is overridden.
+// It has its own lock so the event observer can move the center without
+// the bus; with both held, conn.mu is taken first.
+type geofenceState struct {
+	radiusMM float64 // zero when disabled
+
+	mu               sync.Mutex
+	centerX, centerY float64
+	breached         bool
+	overridden       bool
+	// stoppedAtMM is the distance from the center the robot was last
+	// stopped at.
+	stoppedAtMM float64
+}
+
+// planarPose returns the position in mm and heading in degrees the
+// geofence works with: the odometry pose, or with dry_run the simulated
+// robot's.
+func (s *viamRoombaBase) planarPose() (x, y, headingDeg float64) {
+	if s.dryRun == nil {
+		return s.conn.odom.pose()
+	}
+	pose := s.dryRun.pose()
+	x, _ = pose["x_mm"].(float64)
+	y, _ = pose["y_mm"].(float64)
+	headingDeg, _ = pose["theta_deg"].(float64)
+	return x, y, headingDeg
+}
+
+// recenter moves the geofence to the robot's current pose and lifts any
+// breach or override.
+func (s *viamRoombaBase) recenter() {
+	x, y, _ := s.planarPose()
+	g := &s.geofence
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.centerX, g.centerY = x, y
+	g.breached, g.overridden = false, false
+}
+
+// watchGeofence checks the robot's distance from the geofence center every
+// geofenceInterval while the base is driving it, until the base is closed.
+// Cleaning cycles and dock searches, which the robot drives by itself, are
+// left alone.
+func (s *viamRoombaBase) watchGeofence() {
+	ticker := s.clk.Ticker(geofenceInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.cancelCtx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		switch kind, _ := s.conn.activity.current(); kind {
+		case "idle", "clean", "docking":
+			continue
+		}
+		if err := s.conn.mu.LockContext(s.cancelCtx); err != nil {
+			return
+		}
+		if s.dryRun == nil && s.conn.odom.age() >= geofenceInterval {
+			if _, _, err := s.conn.readOdometry(); err != nil {
+				s.conn.mu.Unlock()
+				s.logger.Debugf("Geofence failed to read odometry: %v", err)
+				continue
+			}
+		}
+		halt := s.checkGeofenceDistance()
+		s.conn.mu.Unlock()
+		if halt {
+			s.haltForGeofence()
+		}
+	}
+}
+
+// checkGeofenceDistance updates the breach from the robot's distance from
+// the center and reports whether the robot must be stopped: when it first
+// leaves the fence, and when it gets farther out again after that.
+func (s *viamRoombaBase) checkGeofenceDistance() bool {
+	x, y, _ := s.planarPose()
+	g := &s.geofence
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	distance := math.Hypot(x-g.centerX, y-g.centerY)
+	switch {
+	case distance <= g.radiusMM:
+		if g.breached || g.overridden {
+			s.logger.Infof("Robot is back inside the %.0fmm geofence; motion is unrestricted again", g.radiusMM)
+		}
+		g.breached, g.overridden = false, false
+		return false
+	case g.overridden:
+		return false
+	case !g.breached:
+		g.breached, g.stoppedAtMM = true, distance
+		s.logger.Errorf("Robot is %.0fmm from the geofence center, outside its %.0fmm radius; stopping it", distance, g.radiusMM)
+		s.conn.events.record("geofence", map[string]any{"distance_mm": distance, "radius_mm": g.radiusMM})
+		return true
+	case distance > g.stoppedAtMM+geofenceOutwardMM:
+		g.stoppedAtMM = distance
+		s.logger.Warnf("Robot is heading farther outside the geofence (%.0fmm from the center); stopping it", distance)
+		return true
+	default:
+		g.stoppedAtMM = min(g.stoppedAtMM, distance)
+		return false
+	}
+}
+
+// haltForGeofence cancels the running motion and stops the wheels.
+func (s *viamRoombaBase) haltForGeofence() {
+	s.opMgr.CancelRunning(s.cancelCtx)
+	if err := s.conn.mu.LockContext(s.cancelCtx); err != nil {
+		return
+	}
+	defer s.conn.mu.Unlock()
+	if err := s.stopVerified(); err != nil {
+		s.logger.Errorf("Geofence failed to stop the robot: %v", err)
+	}
+	s.conn.activity.set("idle")
+}
+
+// checkGeofence refuses a Drive command with velocity and radius that
+// would take the robot farther outside the geofence, judged by its
+// direction of travel (for an arc, the direction it starts in). Stopping
+// and spinning in place are always allowed. Callers must hold s.conn.mu.
+func (s *viamRoombaBase) checkGeofence(velocity, radius int16) error {
+	if s.geofence.radiusMM == 0 || velocity == 0 || radius == 1 || radius == -1 {
+		return nil
+	}
+	x, y, headingDeg := s.planarPose()
+	g := &s.geofence
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.breached {
+		return nil
+	}
+	heading := headingDeg * math.Pi / 180
+	dx, dy := math.Cos(heading), math.Sin(heading)
+	if velocity < 0 {
+		dx, dy = -dx, -dy
+	}
+	if dx*(x-g.centerX)+dy*(y-g.centerY) <= 0 {
+		return nil
+	}
+	return fmt.Errorf("the robot is %.0fmm from the geofence center, outside its %.0fmm radius; only motion back "+
+		"toward the center is allowed until it returns or override_geofence is sent",
+		math.Hypot(x-g.centerX, y-g.centerY), g.radiusMM)
+}
+
+// geofenceSnapshot serves get_geofence.
+func (s *viamRoombaBase) geofenceSnapshot(context.Context, noArgs) (map[string]any, error) {
+	g := &s.geofence
+	if g.radiusMM == 0 {
+		return map[string]any{"enabled": false}, nil
+	}
+	x, y, _ := s.planarPose()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return map[string]any{
+		"enabled":     true,
+		"radius_mm":   g.radiusMM,
+		"center":      map[string]any{"x_mm": g.centerX, "y_mm": g.centerY},
+		"distance_mm": math.Hypot(x-g.centerX, y-g.centerY),
+		"breached":    g.breached,
+		"overridden":  g.overridden,
+	}, nil
+}
+
+// overrideGeofence serves override_geofence: the fence stops restricting
+// motion until the robot is back inside it.
+func (s *viamRoombaBase) overrideGeofence(context.Context, noArgs) (map[string]any, error) {
+	g := &s.geofence
+	if g.radiusMM == 0 {
+		return nil, fmt.Errorf("override_geofence needs geofence_radius_mm")
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.breached, g.overridden = false, true
+	s.logger.Warn("Geofence overridden until the robot is back inside it")
+	return map[string]any{"overridden": true}, nil
+}
+
+// resetGeofence serves reset_geofence.
+func (s *viamRoombaBase) resetGeofence(ctx context.Context, args noArgs) (map[string]any, error) {
+	if s.geofence.radiusMM == 0 {
+		return nil, fmt.Errorf("reset_geofence needs geofence_radius_mm")
+	}
+	s.recenter()
+	return s.geofenceSnapshot(ctx, args)
+}
@@ -0,0 +1,144 @@
+package viamroomba
+
+import (
+	"fmt"
+
+	"github.com/xa4a/go-roomba/constants"
+)
+
+// groupRanges are the OI group packets that read a contiguous run of
+// packets in one transaction: group 6 (packets 7-42) is supported by every
+// OI version, group 100 (7-58) and 101 (43-58) by the 600 series and later.
+var groupRanges = map[byte][2]byte{
+	6:   {7, 42},
+	100: {7, 58},
+	101: {43, 58},
+}
+
+// groupFor returns the smallest group packet that contains every packet in
+// packets, or 0 if none does.
+func groupFor(packets []byte) byte {
+	best := byte(0)
+	for group, r := range groupRanges {
+		covers := true
+		for _, id := range packets {
+			if id < r[0] || id > r[1] {
+				covers = false
+				break
+			}
+		}
+		if covers && (best == 0 || constants.SENSOR_PACKET_LENGTH[group] < constants.SENSOR_PACKET_LENGTH[best]) {
+			best = group
+		}
+	}
+	return best
+}
+
+// splitGroup slices a group packet's buffer into its individual packets,
+// in order.
+func splitGroup(group byte, buf []byte) ([]byte, [][]byte, error) {
+	r, ok := groupRanges[group]
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported group packet %d", group)
+	}
+	count := int(r[1]) - int(r[0]) + 1
+	ids := make([]byte, 0, count)
+	fields := make([][]byte, 0, count)
+	off := 0
+	for id := int(r[0]); id <= int(r[1]); id++ {
+		n := int(constants.SENSOR_PACKET_LENGTH[byte(id)])
+		if off+n > len(buf) {
+			return nil, nil, fmt.Errorf("group packet %d is %d bytes, too short for packet %d", group, len(buf), id)
+		}
+		ids = append(ids, byte(id))
+		fields = append(fields, buf[off:off+n])
+		off += n
+	}
+	if off != len(buf) {
+		return nil, nil, fmt.Errorf("group packet %d is %d bytes, want %d", group, len(buf), off)
+	}
+	return ids, fields, nil
+}
+
+// readGroup reads a group packet and returns its individual packets by id.
+// Like query, a response that fails validation is retried once, after a
+// resync. The map is
+// reused by the next read, so callers must be done with it before releasing
+// c.mu. Callers must hold c.mu.
+func (c *roombaConn) readGroup(group byte) (map[byte][]byte, error) {
+	fields, bad, err := c.readGroupPartial(group)
+	if err != nil {
+		return nil, err
+	}
+	if len(bad) > 0 {
+		return nil, fmt.Errorf("corrupt sensor response: %w", firstPacketError(bad))
+	}
+	return fields, nil
+}
+
+// readGroupPartial is readGroup for callers that can use whatever packets
+// came back intact, as queryPartial is query's. A group whose length is
+// wrong can't be split into packets at all, so that is still an error.
+// Callers must hold c.mu.
+func (c *roombaConn) readGroupPartial(group byte) (map[byte][]byte, map[byte]error, error) {
+	if err := c.checkSync(); err != nil {
+		return nil, nil, err
+	}
+	var lastErr error
+	var ids []byte
+	var fields [][]byte
+	var bad map[byte]error
+	for attempt := 0; attempt < 2; attempt++ {
+		if attempt > 0 {
+			if err := c.resync(); err != nil {
+				return nil, nil, err
+			}
+		}
+		buf, err := c.sensorOnce(group)
+		if err != nil && attempt == 0 && c.reenterOI(err) {
+			buf, err = c.sensorOnce(group)
+		}
+		if err != nil {
+			return nil, nil, c.noteReadError(err)
+		}
+		bad = nil
+		ids, fields, err = splitGroup(group, buf)
+		if err == nil {
+			if bad = packetErrors(ids, fields); len(bad) > 0 {
+				err = firstPacketError(bad)
+			}
+		}
+		if err != nil {
+			c.noteCorrupt(err)
+			lastErr = err
+			continue
+		}
+		lastErr = nil
+		break
+	}
+	if lastErr != nil {
+		c.desynced = true
+		if bad == nil {
+			return nil, nil, fmt.Errorf("corrupt sensor response: %w", lastErr)
+		}
+	}
+	if c.groupFields == nil {
+		c.groupFields = make(map[byte][]byte, len(ids))
+	}
+	clear(c.groupFields)
+	for i, id := range ids {
+		c.groupFields[id] = fields[i]
+	}
+	return c.groupFields, bad, nil
+}
+
+// firstPacketError returns the error of the lowest-numbered packet in bad.
+func firstPacketError(bad map[byte]error) error {
+	first := -1
+	for id := range bad {
+		if first < 0 || int(id) < first {
+			first = int(id)
+		}
+	}
+	return bad[byte(first)]
+}
@@ -0,0 +1,167 @@
+package viamroomba
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/parabolala/go-roomba"
+)
+
+const (
+	defaultStartAttempts = 5
+	maxStartAttempts     = 20
+	// The first retry waits startBackoff; each later one waits twice as
+	// long as the one before, up to maxStartBackoff. A robot just switched
+	// on can take a couple of seconds to answer.
+	startBackoff    = 250 * time.Millisecond
+	maxStartBackoff = 2 * time.Second
+	// handshakeReadTimeout bounds the wait for the OI Mode reply.
+	handshakeReadTimeout = 500 * time.Millisecond
+	// opSensors is the Sensors opcode, sent by hand during the handshake.
+	opSensors = 142
+	// opQueryList is the Query List opcode, sent by hand by queryList.
+	opQueryList = 149
+)
+
+// startOI opens serialPort and starts the Open Interface, confirming that
+// the robot answers by reading its OI mode (packet 35). Start is sent
+// again, after a growing delay, up to attempts times. On failure the error
+// says what went wrong: the port could not be opened, nothing answered, or
+// something answered with data that isn't an OI mode, which usually means
+// the wrong baud rate. Where serial reads can't time out, the robot can't
+// be asked without risking a hang, so Start is sent once, unverified. A
+// profile with cleanWake has each Start preceded by the wake sequence.
+func startOI(serialPort string, attempts int, profile oiProfile) (*roomba.Roomba, error) {
+	if attempts <= 0 {
+		attempts = defaultStartAttempts
+	}
+	r, err := roomba.MakeRoomba(serialPort)
+	if err != nil {
+		return nil, diagnoseOpen(serialPort, err)
+	}
+	// Claim the port before sending anything, so another program using it
+	// isn't sent a Start in the middle of its own exchange.
+	if err := lockPort(r.S, serialPort); err != nil {
+		closePort(r.S)
+		return nil, err
+	}
+	if profile.cleanWake {
+		if err := writeCleanWake(r.S); err != nil {
+			closePort(r.S)
+			return nil, fmt.Errorf("failed to wake the robot on %s: writing to the port failed: %w", serialPort, err)
+		}
+	}
+	if !canTimeoutReads {
+		if err := r.Passive(); err != nil {
+			closePort(r.S)
+			return nil, fmt.Errorf("failed to start OI on %s: %w", serialPort, err)
+		}
+		return r, nil
+	}
+
+	setPortReadTimeout(r.S, handshakeReadTimeout)
+	defer setPortReadTimeout(r.S, 2*time.Second)
+	var garbage []byte
+	backoff := startBackoff
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(backoff)
+			backoff = min(2*backoff, maxStartBackoff)
+			if profile.cleanWake {
+				if err := writeCleanWake(r.S); err != nil {
+					closePort(r.S)
+					return nil, fmt.Errorf("failed to wake the robot on %s: writing to the port failed: %w", serialPort, err)
+				}
+			}
+		}
+		if err := r.Passive(); err != nil {
+			closePort(r.S)
+			return nil, fmt.Errorf("failed to start OI on %s: writing to the port failed: %w", serialPort, err)
+		}
+		time.Sleep(modeChangeSettle)
+		flushPort(r.S)
+		if _, err := r.S.Write([]byte{opSensors, 35}); err != nil {
+			closePort(r.S)
+			return nil, fmt.Errorf("failed to start OI on %s: writing to the port failed: %w", serialPort, err)
+		}
+		buf := make([]byte, 16)
+		n, _ := r.S.Read(buf)
+		if n == 1 && buf[0] >= byte(oiPassive) && buf[0] <= byte(oiFull) {
+			return r, nil
+		}
+		if n > 0 {
+			garbage = buf[:n]
+		}
+	}
+	closePort(r.S)
+	if garbage != nil {
+		return nil, fmt.Errorf("failed to start OI on %s: the device answered with % x instead of an OI mode; "+
+			"the baud rate is likely wrong (the OI talks at 115200 baud unless the robot was switched to 19200, "+
+			"which a power cycle undoes) or another device is on this port", serialPort, garbage)
+	}
+	hint := ""
+	if !profile.cleanWake {
+		hint = "; a Wi-Fi Roomba (900, i, or s series) needs oi_profile set to wake it"
+	}
+	return nil, fmt.Errorf("failed to start OI on %s: no response after %d attempts; check that the robot is "+
+		"switched on and awake (press Clean), that the cable is plugged into its mini-DIN port, and that "+
+		"this is the right port%s", serialPort, attempts, hint)
+}
+
+// validateStartAttempts checks the start_attempts attribute.
+func validateStartAttempts(attempts int) error {
+	if attempts < 0 || attempts > maxStartAttempts {
+		return fmt.Errorf("start_attempts must be in [0, %d]", maxStartAttempts)
+	}
+	return nil
+}
+
+// diagnoseOpen explains why serialPort couldn't be opened.
+func diagnoseOpen(serialPort string, err error) error {
+	_, statErr := os.Stat(serialPort)
+	switch {
+	case errors.Is(err, os.ErrNotExist) || errors.Is(statErr, os.ErrNotExist):
+		return fmt.Errorf("failed to open serial connection on %s: the device doesn't exist; "+
+			"check that the adapter is plugged in and serial_port is right: %w", serialPort, err)
+	case errors.Is(err, syscall.EBUSY):
+		// Another instance of the module has it open and exclusive.
+		return &portInUseError{serialPort: serialPort}
+	case errors.Is(err, os.ErrPermission):
+		return fmt.Errorf("failed to open serial connection on %s: permission denied; "+
+			"add the user running viam-server to the dialout group: %w", serialPort, err)
+	default:
+		return fmt.Errorf("failed to open serial connection on %s: %w", serialPort, err)
+	}
+}
+
+// portInUseError reports that another process has the serial port open.
+// Two programs talking to the robot at once interleave their bytes, so
+// each reads the other's replies as garbage.
+type portInUseError struct {
+	serialPort string
+	// holders names the processes that have the port open, as
+	// "pid (command)", where they could be found.
+	holders []string
+	// uucp is set when the port was found by a terminal program's lock
+	// file rather than an open file.
+	uucp bool
+}
+
+func (e *portInUseError) Error() string {
+	who := "another process"
+	if len(e.holders) > 0 {
+		who = strings.Join(e.holders, ", ")
+	}
+	msg := fmt.Sprintf("serial port %s is in use by %s; two programs talking to the robot at once garble each "+
+		"other's data. Stop the other program (a second viam-server, another instance of this module, or a "+
+		"terminal program such as minicom or screen), or, if it is this machine's own config, give every "+
+		"component the same serial_port or controller so they share one connection", e.serialPort, who)
+	if e.uucp {
+		msg += "; if that process is not using the port, delete its stale lock file in /var/lock"
+	}
+	return msg
+}
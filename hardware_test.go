@@ -0,0 +1,246 @@
+//go:build hardware
+
+package viamroomba
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"testing"
+	"time"
+)
+
+const (
+	// hwDriveSpeed and hwDriveTime make each hardware check move short:
+	// about 100 mm, or 50° in place.
+	hwDriveSpeed = 100 // mm/s
+	hwDriveTime  = time.Second
+	// hwDockTimeout is how long the dock check waits for the robot to
+	// reach the dock.
+	hwDockTimeout = 3 * time.Minute
+)
+
+// hardwareCheck is one step of TestHardware.
+type hardwareCheck struct {
+	name string
+	run  func(ctx context.Context, conn *roombaConn) (string, error)
+}
+
+// TestHardware exercises the real OI on the robot at $ROOMBA_PORT, so a
+// contributor or user can check the module against their model before
+// deploying it: it opens the port, reads the mode and sensors, drives a
+// short way forward and back, spins about 50° each way, and, with
+// ROOMBA_DOCK=1, seeks the dock. The robot needs about half a meter of
+// clear floor. It stops at the first failing step, leaving the robot
+// stopped in Passive mode, and is skipped unless ROOMBA_PORT is set.
+func TestHardware(t *testing.T) {
+	serialPort := os.Getenv("ROOMBA_PORT")
+	if serialPort == "" {
+		t.Skip("set ROOMBA_PORT to the robot's serial port, e.g. /dev/ttyUSB0")
+	}
+	// go-roomba logs every serial write.
+	logOut := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(logOut) })
+
+	conn, err := acquireConn(serialPort, 0, defaultOIProfile)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer releaseConn(conn)
+
+	checks := []hardwareCheck{
+		{"mode", hwCheckMode},
+		{"sensors", hwCheckSensors},
+		{"drive", hwCheckDrive},
+		{"spin", hwCheckSpin},
+	}
+	if os.Getenv("ROOMBA_DOCK") == "1" {
+		checks = append(checks, hardwareCheck{"dock", hwCheckDock})
+	}
+
+	defer func() {
+		conn.mu.Lock()
+		defer conn.mu.Unlock()
+		if err := conn.stop(); err != nil {
+			t.Errorf("failed to stop the robot: %v", err)
+		}
+		if err := conn.setMode(oiPassive); err != nil {
+			t.Errorf("failed to return the robot to Passive mode: %v", err)
+		}
+	}()
+	for _, check := range checks {
+		passed := t.Run(check.name, func(t *testing.T) {
+			detail, err := check.run(t.Context(), conn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Log(detail)
+		})
+		if !passed {
+			return
+		}
+	}
+}
+
+// hwCheckMode reads back the OI mode (packet 35) and the capabilities
+// discovered when the port was opened.
+func hwCheckMode(ctx context.Context, conn *roombaConn) (string, error) {
+	if err := conn.mu.LockContext(ctx); err != nil {
+		return "", err
+	}
+	defer conn.mu.Unlock()
+	mode, err := conn.syncMode()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("OI mode %s, capabilities %v", mode, conn.caps.features()), nil
+}
+
+// hwCheckSensors reads the bumpers and wheel drops, battery, and charging
+// state, and checks that they are plausible and that the robot is free to
+// drive.
+func hwCheckSensors(ctx context.Context, conn *roombaConn) (string, error) {
+	if err := conn.mu.LockContext(ctx); err != nil {
+		return "", err
+	}
+	defer conn.mu.Unlock()
+	data, err := conn.query([]byte{7, 21, 22, 24, 25, 26})
+	if err != nil {
+		return "", err
+	}
+	u16 := func(b []byte) int { return int(binary.BigEndian.Uint16(b)) }
+	bumps, voltage, tempC := data[0][0], u16(data[2]), int(int8(data[3][0]))
+	charge, capacity := u16(data[4]), u16(data[5])
+	switch {
+	case voltage < 10000 || voltage > 20000:
+		return "", fmt.Errorf("battery voltage %d mV is implausible; is this the right baud rate?", voltage)
+	case capacity == 0:
+		return "", errors.New("battery capacity reads 0 mAh")
+	case bumps&0x0c != 0:
+		return "", errors.New("a wheel is dropped; put the robot on the floor")
+	case bumps&0x03 != 0:
+		return "", errors.New("a bumper is pressed; clear the robot's path")
+	}
+	return fmt.Sprintf("battery %d mV, %d/%d mAh, %d°C, charging state %d", voltage, charge, capacity, tempC, data[1][0]), nil
+}
+
+// hwCheckDrive drives forward and back again for hwDriveTime each, and
+// checks that odometry saw roughly the distance commanded.
+func hwCheckDrive(ctx context.Context, conn *roombaConn) (string, error) {
+	want := hwDriveSpeed * hwDriveTime.Seconds()
+	forward, _, err := hwDrive(ctx, conn, hwDriveSpeed, 32767)
+	if err != nil {
+		return "", err
+	}
+	back, _, err := hwDrive(ctx, conn, -hwDriveSpeed, 32767)
+	if err != nil {
+		return "", err
+	}
+	for _, got := range []float64{forward, -back} {
+		if got < want*0.6 || got > want*1.4 {
+			return "", fmt.Errorf("commanded about %.0f mm but odometry read %.0f mm; check the wheels and encoders", want, got)
+		}
+	}
+	return fmt.Sprintf("forward %.0f mm, back %.0f mm", forward, -back), nil
+}
+
+// hwCheckSpin spins in place each way for hwDriveTime, and checks that
+// odometry saw roughly the angle commanded for the default wheel base.
+func hwCheckSpin(ctx context.Context, conn *roombaConn) (string, error) {
+	want := hwDriveSpeed * hwDriveTime.Seconds() / (235.0 / 2) * 180 / math.Pi
+	_, ccw, err := hwDrive(ctx, conn, hwDriveSpeed, 1)
+	if err != nil {
+		return "", err
+	}
+	_, cw, err := hwDrive(ctx, conn, hwDriveSpeed, -1)
+	if err != nil {
+		return "", err
+	}
+	for _, got := range []float64{ccw, -cw} {
+		if got < want*0.6 || got > want*1.4 {
+			return "", fmt.Errorf("commanded about %.0f° but odometry read %.0f°; check the wheels and encoders", want, got)
+		}
+	}
+	return fmt.Sprintf("counterclockwise %.0f°, clockwise %.0f°", ccw, -cw), nil
+}
+
+// hwDrive drives in Safe mode for hwDriveTime, stops, and returns the
+// distance and angle odometry read over the move.
+func hwDrive(ctx context.Context, conn *roombaConn, velocity, radius int16) (float64, float64, error) {
+	if err := conn.mu.LockContext(ctx); err != nil {
+		return 0, 0, err
+	}
+	err := conn.setMode(oiSafe)
+	if err == nil {
+		// Start from zero.
+		_, _, err = conn.readOdometry()
+	}
+	if err == nil {
+		err = conn.drive(velocity, radius)
+	}
+	conn.mu.Unlock()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	select {
+	case <-time.After(hwDriveTime):
+	case <-ctx.Done():
+	}
+
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if err := conn.stop(); err != nil {
+		return 0, 0, err
+	}
+	if ctx.Err() != nil {
+		return 0, 0, ctx.Err()
+	}
+	// Let the robot come to rest before reading how far it went.
+	time.Sleep(250 * time.Millisecond)
+	return conn.readOdometry()
+}
+
+// hwCheckDock sends Seek Dock and waits until the robot reports the home
+// base as a charging source (packet 34).
+func hwCheckDock(ctx context.Context, conn *roombaConn) (string, error) {
+	start := time.Now()
+	if err := conn.mu.LockContext(ctx); err != nil {
+		return "", err
+	}
+	err := conn.seekDock()
+	conn.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	deadline := time.After(hwDockTimeout)
+	for {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-deadline:
+			return "", fmt.Errorf("not docked after %v; is the dock powered and in sight?", hwDockTimeout)
+		case <-ticker.C:
+		}
+		if err := conn.mu.LockContext(ctx); err != nil {
+			return "", err
+		}
+		data, err := conn.sensor(34)
+		conn.mu.Unlock()
+		if err != nil {
+			return "", err
+		}
+		if data[0]&0x02 != 0 {
+			return fmt.Sprintf("docked after %.0f s", time.Since(start).Seconds()), nil
+		}
+	}
+}
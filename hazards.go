@@ -0,0 +1,124 @@
+package viamroomba
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+// maxHazards is how many hazard events the hazard map keeps; the oldest are
+// dropped first.
+const maxHazards = 1000
+
+// hazardEvents are the event types stamped with the odometry pose and kept
+// in the hazard map.
+var hazardEvents = map[string]bool{
+	"bump":         true,
+	"cliff":        true,
+	"wheel_drop":   true,
+	"bump_reflex":  true,
+	"cliff_reflex": true,
+	"stuck":        true,
+	"slip":         true,
+	"geofence":     true,
+}
+
+// eventPose is the odometry pose when an event was recorded.
+type eventPose struct {
+	xMM, yMM, thetaDeg float64
+}
+
+// hazardMap keeps the pose-stamped hazard events of a connection, longer
+// than the event log keeps them, for overlaying on a map. Like the obstacle
+// memory it is shared by every component on the port and lost when the
+// port is closed.
+type hazardMap struct {
+	mu      sync.Mutex
+	hazards []event
+}
+
+// observe is the event log observer that collects hazard events.
+func (m *hazardMap) observe(e event) {
+	if e.pose == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.hazards) >= maxHazards {
+		m.hazards = m.hazards[1:]
+	}
+	m.hazards = append(m.hazards, e)
+}
+
+// getHazardMapArgs are the parameters of get_hazard_map.
+type getHazardMapArgs struct {
+	Since *float64 `json:"since" doc:"Only return hazards with a higher seq"`
+	Types []string `json:"types" doc:"Only return these event types"`
+}
+
+// get serves get_hazard_map: the kept hazard events as a GeoJSON-style
+// FeatureCollection of points in the odometry frame, oldest first. A
+// hazard seen by one of the robot's sensors is placed where that sensor
+// sits on a Roomba 650 rather than at the robot's center.
+func (m *hazardMap) get(_ context.Context, args getHazardMapArgs) (map[string]any, error) {
+	var seq uint64
+	if args.Since != nil {
+		if *args.Since < 0 {
+			return nil, errors.New("since must be a non-negative number")
+		}
+		seq = uint64(*args.Since)
+	}
+	for _, kind := range args.Types {
+		if !hazardEvents[kind] {
+			return nil, errors.New("types may only name bump, cliff, wheel_drop, bump_reflex, cliff_reflex, stuck, slip, and geofence")
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	features := []any{}
+	for _, e := range m.hazards {
+		if e.seq <= seq || len(args.Types) > 0 && !slices.Contains(args.Types, e.kind) {
+			continue
+		}
+		x, y := e.pose.xMM, e.pose.yMM
+		if sensor, ok := e.detail["sensor"].(string); ok {
+			if off, ok := defaultSensorOffsets[sensor]; ok {
+				x, y = off.toOdometryFrame(x, y, e.pose.thetaDeg)
+			}
+		}
+		properties := map[string]any{
+			"seq":       e.seq,
+			"type":      e.kind,
+			"timestamp": e.time.UTC().Format(time.RFC3339Nano),
+			"robot_pose": map[string]any{
+				"x_mm":      e.pose.xMM,
+				"y_mm":      e.pose.yMM,
+				"theta_deg": e.pose.thetaDeg,
+			},
+		}
+		for k, v := range e.detail {
+			properties[k] = v
+		}
+		features = append(features, map[string]any{
+			"type":       "Feature",
+			"geometry":   map[string]any{"type": "Point", "coordinates": []any{x, y}},
+			"properties": properties,
+		})
+	}
+	return map[string]any{
+		"type":     "FeatureCollection",
+		"frame":    "odometry_mm",
+		"features": features,
+	}, nil
+}
+
+func (m *hazardMap) clear(context.Context, noArgs) (map[string]any, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := len(m.hazards)
+	m.hazards = nil
+	return map[string]any{"cleared": n}, nil
+}
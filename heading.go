@@ -0,0 +1,155 @@
+package viamroomba
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	defaultHeadingHoldKp = 3.0
+	defaultHeadingHoldKi = 0.5
+	defaultHeadingHoldKd = 0.0
+	// maxHeadingCorrection bounds the turn rate (deg/s) the controller may
+	// add, so a bad angle reading can't swing the robot around.
+	maxHeadingCorrection = 30.0
+	// headingHoldInterval is how often the angle packet is polled.
+	headingHoldInterval = 50 * time.Millisecond
+)
+
+// headingPID turns a heading error into a corrective turn rate.
+type headingPID struct {
+	kp, ki, kd float64
+	integral   float64
+	prevErr    float64
+	started    bool
+}
+
+// update returns the correction in deg/s (positive turns left) for a
+// heading error in degrees observed dt seconds after the previous one.
+func (p *headingPID) update(errDeg, dt float64) float64 {
+	var derivative float64
+	if p.started && dt > 0 {
+		derivative = (errDeg - p.prevErr) / dt
+	}
+	p.started = true
+	p.prevErr = errDeg
+	p.integral += errDeg * dt
+	// Keep the integral term alone from demanding more than the cap (windup).
+	if p.ki > 0 {
+		limit := maxHeadingCorrection / p.ki
+		p.integral = math.Max(-limit, math.Min(limit, p.integral))
+	}
+	out := p.kp*errDeg + p.ki*p.integral + p.kd*derivative
+	return math.Max(-maxHeadingCorrection, math.Min(maxHeadingCorrection, out))
+}
+
+// holdHeading keeps a straight drive at velocity on the heading it had when
+// called, correcting drift from the angle packet (20) until d elapses, or
+// until ctx is cancelled or the base closed if d is zero. The caller must
+// already have started the drive.
+func (s *viamRoombaBase) holdHeading(ctx context.Context, velocity int16, d time.Duration) error {
+	pid := headingPID{kp: s.headingHoldKp, ki: s.headingHoldKi, kd: s.headingHoldKd}
+	directDrive := s.conn.caps.hasPacket(41)
+
+	if err := s.conn.mu.LockContext(ctx); err != nil {
+		return err
+	}
+	// Discard the deltas accumulated before the drive; they still reach the pose.
+	_, _, err := s.readOdometry()
+	s.conn.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to read odometry: %w", err)
+	}
+
+	var timeout <-chan time.Time
+	if d > 0 {
+		timer := s.clk.Timer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	ticker := s.clk.Ticker(headingHoldInterval)
+	defer ticker.Stop()
+
+	var heading float64 // degrees turned since the drive started, positive left
+	last := s.clk.Now()
+	for {
+		select {
+		case <-ticker.C:
+		case <-timeout:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.cancelCtx.Done():
+			return s.cancelCtx.Err()
+		}
+
+		if err := s.conn.mu.LockContext(ctx); err != nil {
+			return err
+		}
+		_, angle, err := s.readOdometry()
+		if err != nil {
+			s.conn.mu.Unlock()
+			return fmt.Errorf("failed to read odometry: %w", err)
+		}
+		now := s.clk.Now()
+		heading += angle
+		correction := pid.update(-heading, now.Sub(last).Seconds())
+		last = now
+		if directDrive {
+			err = s.driveWheels(velocity, correction)
+		} else {
+			err = s.drive(velocity, correctionRadius(velocity, correction))
+		}
+		s.conn.mu.Unlock()
+		if err != nil {
+			return fmt.Errorf("failed to correct heading: %w", err)
+		}
+	}
+}
+
+// driveWheels drives at velocity while turning at correction deg/s, using
+// Drive Direct so that small corrections aren't lost to the Drive command's
+// 2m maximum radius. Callers must hold s.conn.mu.
+func (s *viamRoombaBase) driveWheels(velocity int16, correction float64) error {
+	if err := s.checkThermal(); err != nil {
+		return err
+	}
+	if err := s.checkEStop(); err != nil {
+		return err
+	}
+	if err := s.checkGeofence(velocity, 32767); err != nil {
+		return err
+	}
+	if err := s.wake(); err != nil {
+		return err
+	}
+	if err := s.conn.requireControl("drive"); err != nil {
+		return err
+	}
+	delta := correction * math.Pi / 180.0 * float64(s.widthMM) / 2.0
+	s.noteDrive(0, 0)
+	limit := float64(s.zoneClamp(s.quietClamp(s.speedLimit.limit())))
+	right := int16(math.Max(-limit, math.Min(limit, float64(velocity)+delta)))
+	left := int16(math.Max(-limit, math.Min(limit, float64(velocity)-delta)))
+	if s.dryRun != nil {
+		s.simulateDriveDirect(right, left)
+		return nil
+	}
+	return s.conn.driveDirect(right, left)
+}
+
+// correctionRadius converts a corrective turn rate into a Drive radius for
+// robots without Drive Direct. Corrections gentler than the largest radius
+// Drive accepts (2000mm) are driven straight.
+func correctionRadius(velocity int16, correction float64) int16 {
+	if correction == 0 {
+		return 32767
+	}
+	radius := float64(velocity) * 180.0 / (correction * math.Pi)
+	if math.Abs(radius) > 2000 {
+		return 32767
+	}
+	return int16(radius)
+}
@@ -0,0 +1,95 @@
+package viamroomba
+
+import (
+	"fmt"
+	"time"
+)
+
+// maxIdleCheckInterval bounds how often the idle policy checks the robot; a
+// short idle_timeout_min is checked more often.
+const maxIdleCheckInterval = 30 * time.Second
+
+// watchIdle puts the robot to sleep once no command has been sent for
+// idleTimeout while it sits in Safe or Full mode doing nothing and isn't
+// charging. In Safe mode the robot stays awake, drains its battery, and
+// won't charge on the dock. Sleep is Passive mode, or powering the robot
+// off with idle_action "power_off". The next drive command wakes it. It
+// returns when the base is closed.
+func (s *viamRoombaBase) watchIdle() {
+	ticker := s.clk.Ticker(min(maxIdleCheckInterval, s.idleTimeout/4))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.cancelCtx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := s.conn.mu.LockContext(s.cancelCtx); err != nil {
+			return
+		}
+		if err := s.sleepIfIdle(); err != nil {
+			s.logger.Warnf("Idle policy failed to put the robot to sleep: %v", err)
+		}
+		s.conn.mu.Unlock()
+	}
+}
+
+// sleepIfIdle applies the idle policy once. Callers must hold s.conn.mu.
+func (s *viamRoombaBase) sleepIfIdle() error {
+	if s.conn.mode != oiSafe && s.conn.mode != oiFull {
+		return nil
+	}
+	if kind, _ := s.conn.activity.current(); kind != "idle" {
+		return nil
+	}
+	idleFor := time.Since(s.conn.lastCommand)
+	if idleFor > time.Since(s.idleSince) {
+		idleFor = time.Since(s.idleSince)
+	}
+	if idleFor < s.idleTimeout {
+		return nil
+	}
+	// Packet 21 is the charging state; 0 is not charging.
+	data, err := s.conn.sensor(21)
+	if err != nil {
+		return err
+	}
+	if len(data) > 0 && data[0] != 0 {
+		return nil
+	}
+
+	if err := s.conn.stop(); err != nil {
+		return err
+	}
+	if s.idleAction == "power_off" {
+		if err := s.conn.write(opPower, nil); err != nil {
+			return err
+		}
+		s.conn.noteMode(oiOff)
+	} else if err := s.conn.setMode(oiPassive); err != nil {
+		return err
+	}
+	s.asleep = true
+	s.logger.Infof("No commands for %s; idle policy put the robot to sleep (%s)", idleFor.Round(time.Second), s.idleAction)
+	s.conn.events.record("idle_sleep", map[string]any{"action": s.idleAction, "idle_sec": idleFor.Seconds()})
+	return nil
+}
+
+// wake puts the robot back in Safe mode, never Full, if the idle policy put
+// it to sleep and it is still asleep. Callers must hold s.conn.mu.
+func (s *viamRoombaBase) wake() error {
+	if !s.asleep {
+		return nil
+	}
+	s.asleep = false
+	if s.conn.mode == oiSafe || s.conn.mode == oiFull {
+		return nil
+	}
+	if err := s.conn.setMode(oiSafe); err != nil {
+		return fmt.Errorf("failed to wake the robot from idle sleep: %w", err)
+	}
+	s.logger.Info("Woke the robot from idle sleep")
+	s.conn.events.record("idle_wake", nil)
+	return nil
+}
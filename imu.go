@@ -0,0 +1,151 @@
+package viamroomba
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"go.viam.com/rdk/components/movementsensor"
+	"go.viam.com/rdk/resource"
+)
+
+const (
+	// gyroInterval is how often the movement sensor's yaw is read, as
+	// often as the closed-loop motions poll odometry.
+	gyroInterval = 50 * time.Millisecond
+	// gyroStaleAfter is how old the last yaw may be before odometry falls
+	// back to the angle packet alone.
+	gyroStaleAfter = 500 * time.Millisecond
+	// defaultGyroWeight is how much of each heading change is taken from
+	// the movement sensor rather than the wheel encoders.
+	defaultGyroWeight = 0.98
+)
+
+// gyroHeading is the yaw of the base's movement sensor (an IMU), in degrees
+// counterclockwise. It is read in the background, so odometry updates,
+// which hold the bus, never wait on the sensor. The yaw comes from the
+// sensor's orientation if it reports one, and otherwise by integrating its
+// angular velocity.
+type gyroHeading struct {
+	weight float64
+	source string // "orientation" or "angular_velocity"
+
+	mu      sync.Mutex
+	yawDeg  float64
+	at      time.Time
+	lastErr error
+}
+
+// resolveGyro finds the movement_sensor dependency and checks that it can
+// report a heading.
+func resolveGyro(ctx context.Context, deps resource.Dependencies, conf *Config) (movementsensor.MovementSensor, *gyroHeading, error) {
+	ms, err := movementsensor.FromProvider(deps, conf.MovementSensor)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, ok := ms.(*poseSensor); ok {
+		return nil, nil, fmt.Errorf("movement_sensor %q is this module's odometry sensor, which reports the "+
+			"wheel encoders' heading; use an IMU", conf.MovementSensor)
+	}
+	props, err := ms.Properties(ctx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read movement_sensor %q's properties: %w", conf.MovementSensor, err)
+	}
+	g := &gyroHeading{weight: conf.MovementSensorWeight}
+	if g.weight == 0 {
+		g.weight = defaultGyroWeight
+	}
+	switch {
+	case props.OrientationSupported:
+		g.source = "orientation"
+	case props.AngularVelocitySupported:
+		g.source = "angular_velocity"
+	default:
+		return nil, nil, fmt.Errorf("movement_sensor %q reports neither orientation nor angular velocity", conf.MovementSensor)
+	}
+	return ms, g, nil
+}
+
+// latest returns the last yaw read, unless it is older than gyroStaleAfter.
+func (g *gyroHeading) latest() (float64, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.at.IsZero() || time.Since(g.at) > gyroStaleAfter {
+		return 0, false
+	}
+	return g.yawDeg, true
+}
+
+// watchGyro reads the movement sensor's yaw every gyroInterval until the
+// base is closed.
+func (s *viamRoombaBase) watchGyro(ms movementsensor.MovementSensor) {
+	ticker := s.clk.Ticker(gyroInterval)
+	defer ticker.Stop()
+	g := s.gyro
+	var yawDeg float64
+	var last time.Time
+	for {
+		select {
+		case <-s.cancelCtx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		var err error
+		if g.source == "orientation" {
+			orientation, oErr := ms.Orientation(s.cancelCtx, nil)
+			if err = oErr; err == nil {
+				yawDeg = orientation.EulerAngles().Yaw * 180 / math.Pi
+			}
+		} else {
+			av, avErr := ms.AngularVelocity(s.cancelCtx, nil)
+			if err = avErr; err == nil && !last.IsZero() {
+				yawDeg += av.Z * now.Sub(last).Seconds()
+			}
+		}
+		if errors.Is(err, context.Canceled) {
+			return
+		}
+
+		g.mu.Lock()
+		if err != nil {
+			if g.lastErr == nil {
+				s.logger.Warnf("Failed to read movement_sensor %s; using wheel odometry alone until it recovers: %v", g.source, err)
+			}
+			g.lastErr = err
+		} else {
+			if g.lastErr != nil {
+				s.logger.Info("movement_sensor is reading again; fusing its heading with odometry")
+			}
+			g.yawDeg, g.at, g.lastErr = yawDeg, now, nil
+			last = now
+		}
+		g.mu.Unlock()
+	}
+}
+
+// gyroSnapshot serves get_heading_fusion.
+func (s *viamRoombaBase) gyroSnapshot(context.Context, noArgs) (map[string]any, error) {
+	g := s.gyro
+	if g == nil {
+		return map[string]any{"enabled": false}, nil
+	}
+	_, fresh := g.latest()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	status := map[string]any{
+		"enabled": true,
+		"source":  g.source,
+		"weight":  g.weight,
+		"healthy": fresh,
+		"yaw_deg": g.yawDeg,
+	}
+	if g.lastErr != nil {
+		status["error"] = g.lastErr.Error()
+	}
+	return status, nil
+}
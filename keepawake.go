@@ -0,0 +1,68 @@
+package viamroomba
+
+import (
+	"time"
+)
+
+const (
+	// defaultKeepAwakeInterval is comfortably inside the five minutes after
+	// which a robot in Passive mode goes to sleep off the dock.
+	defaultKeepAwakeInterval = 60 * time.Second
+	// brcPulse is how long BRC is held low; the OI spec asks for one second.
+	brcPulse = time.Second
+)
+
+// keepAwake stops the robot from going to sleep while the OI sits in
+// Passive mode, so that a long idle teleop session can pick up where it
+// left off. Every interval it either pulses the BRC pin low through the
+// adapter's RTS or DTR line (keep_awake "brc"), or sends Start, which
+// changes nothing in Passive mode (keep_awake "opcode"). Safe and Full mode
+// keep the robot awake by themselves. It returns when the base is closed.
+func (s *viamRoombaBase) keepAwake(interval time.Duration) {
+	ticker := s.clk.Ticker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.cancelCtx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := s.conn.mu.LockContext(s.cancelCtx); err != nil {
+			return
+		}
+		if s.conn.mode != oiPassive {
+			s.conn.mu.Unlock()
+			continue
+		}
+		var err error
+		if s.keepAwakeMethod == "opcode" {
+			err = s.conn.write(opStart, nil)
+		} else {
+			err = s.conn.setModemLine(s.brcLine, true)
+		}
+		s.conn.mu.Unlock()
+		if err != nil {
+			s.warnings.Warnf("keep_awake", "Keep-awake pulse failed: %v", err)
+			continue
+		}
+		if s.keepAwakeMethod == "opcode" {
+			continue
+		}
+
+		// Hold BRC low without holding the bus, then release it.
+		timer := s.clk.Timer(brcPulse)
+		select {
+		case <-timer.C:
+		case <-s.cancelCtx.Done():
+			timer.Stop()
+		}
+		if err := s.conn.mu.LockContext(s.cancelCtx); err != nil {
+			return
+		}
+		if err := s.conn.setModemLine(s.brcLine, false); err != nil {
+			s.logger.Warnf("Failed to release BRC after the keep-awake pulse: %v", err)
+		}
+		s.conn.mu.Unlock()
+	}
+}
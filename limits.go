@@ -0,0 +1,50 @@
+package viamroomba
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	// maxWheelVelocity is the fastest the Drive commands accept, in mm/s.
+	// With payload_kg, the base allows less; see maxVelocity.
+	maxWheelVelocity = 500.0
+	// maxDriveRadius is the gentlest curve the Drive command can drive, in mm.
+	maxDriveRadius = 2000.0
+)
+
+// limit checks a commanded value against [lo, hi], the range the robot can
+// carry out. Outside it, the value is clamped with a warning (dampened, as
+// teleop can exceed a limit on every call), or with strict_limits an error
+// is returned so that a planner learns its command was infeasible instead
+// of having it quietly changed.
+func (s *viamRoombaBase) limit(name string, value, lo, hi float64) (float64, error) {
+	if value >= lo && value <= hi {
+		return value, nil
+	}
+	if s.strictLimits {
+		return 0, fmt.Errorf("%s %.1f is outside the supported range [%.1f, %.1f]", name, value, lo, hi)
+	}
+	clamped := max(lo, min(hi, value))
+	s.warnings.Warnf("clamp "+name, "Clamping %s from %.1f to %.1f", name, value, clamped)
+	return clamped, nil
+}
+
+// maxSegmentSpeed is the fastest a straight or spin path segment can be
+// driven, in its own units.
+func (s *viamRoombaBase) maxSegmentSpeed(seg pathSegment) float64 {
+	switch {
+	case seg.SpinDeg != 0:
+		return s.maxSpinDegsPerSec()
+	case seg.StraightMM < 0:
+		return float64(s.maxReverseVelocity)
+	default:
+		return s.maxVelocity
+	}
+}
+
+// maxSpinDegsPerSec is the fastest the robot can spin in place, with both
+// wheels at full speed.
+func (s *viamRoombaBase) maxSpinDegsPerSec() float64 {
+	return s.maxVelocity * 180.0 / (math.Pi * float64(s.widthMM) / 2.0)
+}
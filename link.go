@@ -0,0 +1,159 @@
+package viamroomba
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/parabolala/go-roomba"
+)
+
+// ErrNotConnected is returned by every component API while the serial link
+// to the robot is down, so clients can tell a lost cable from a hardware
+// fault. The connection keeps trying to reopen the port in the background.
+var ErrNotConnected = errors.New("roomba serial link is down")
+
+// reconnectInterval is how often a down link tries to reopen the port.
+const reconnectInterval = 2 * time.Second
+
+// linkState tracks whether the serial link is usable, guarded by the
+// connection's mu. down is also atomic, since the safe-state handler reads
+// it when it gives up waiting for mu.
+type linkState struct {
+	down    atomic.Bool
+	since   time.Time
+	lastErr error
+	// closed stops the reconnect loop once the connection is released.
+	closed chan struct{}
+}
+
+// checkLink returns ErrNotConnected while the link is down. Callers must
+// hold c.mu.
+func (c *roombaConn) checkLink() error {
+	if c.link.down.Load() {
+		return ErrNotConnected
+	}
+	return nil
+}
+
+// noteLinkFault marks the link down if the last exchange failed in the port
+// itself (e.g. the USB adapter was unplugged), as opposed to the robot not
+// answering before the read timeout. It returns the error callers should
+// report. Callers must hold c.mu.
+func (c *roombaConn) noteLinkFault(err error) error {
+	fault := c.wire.fault
+	if fault == nil {
+		return err
+	}
+	c.link.down.Store(true)
+	c.link.since = time.Now()
+	c.link.lastErr = fault
+	closePort(c.port)
+	c.trace("serial link down: %v", fault)
+	c.events.record("disconnected", map[string]any{"error": fault.Error()})
+	c.activity.set("idle")
+	c.noteMode(oiOff)
+	serialPort, closed := c.serialPort, c.link.closed
+	goSafe(func() { c.reconnect(serialPort, closed) })
+	return fmt.Errorf("%w: %v", ErrNotConnected, fault)
+}
+
+// reconnect reopens the serial port every reconnectInterval until it
+// succeeds or the connection is released. The robot comes back in Passive
+// mode, as after a fresh acquireConn.
+func (c *roombaConn) reconnect(serialPort string, closed <-chan struct{}) {
+	ticker := time.NewTicker(reconnectInterval)
+	defer ticker.Stop()
+	// Waiting for the bus ends with the connection.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	goSafe(func() {
+		select {
+		case <-closed:
+			cancel()
+		case <-ctx.Done():
+		}
+	})
+	for {
+		select {
+		case <-closed:
+			return
+		case <-ticker.C:
+		}
+
+		// Each tick is an attempt of its own, so try the handshake once.
+		r, err := startOI(serialPort, 1, c.profile)
+
+		if lockErr := c.mu.LockContext(ctx); lockErr != nil {
+			if err == nil {
+				closePort(r.S)
+			}
+			return
+		}
+		select {
+		case <-closed:
+			c.mu.Unlock()
+			if err == nil {
+				closePort(r.S)
+			}
+			return
+		default:
+		}
+		if err != nil {
+			c.link.lastErr = err
+			c.mu.Unlock()
+			continue
+		}
+		c.install(r)
+		c.setReadTimeout(2 * time.Second)
+		c.link.down.Store(false)
+		c.link.lastErr = nil
+		c.readyAt = time.Now().Add(modeChangeSettle)
+		c.noteMode(oiPassive)
+		if c.clockSync {
+			if err := c.setDayTime(time.Now()); err != nil {
+				c.trace("failed to set the robot's clock after reconnecting: %v", err)
+			}
+		}
+		c.metrics.mu.Lock()
+		c.metrics.reconnects++
+		c.metrics.mu.Unlock()
+		c.events.record("reconnected", map[string]any{"down_sec": time.Since(c.link.since).Seconds()})
+		c.mu.Unlock()
+		return
+	}
+}
+
+// install makes r the connection's robot, wrapping its port to collect
+// metrics and catch link faults. Callers must hold c.mu, unless c is not
+// yet shared.
+func (c *roombaConn) install(r *roomba.Roomba) {
+	c.roomba = r
+	c.port = r.S
+	c.desynced = false
+	c.wire = &countingPort{rw: c.port, metrics: &c.metrics, capture: &c.capture}
+	r.S = c.wire
+	c.safeWire.Store(c.wire)
+}
+
+// readiness reports whether the link is up, and if not since when and why.
+func (c *roombaConn) readiness(ctx context.Context, _ noArgs) (map[string]any, error) {
+	if err := c.mu.LockContext(ctx); err != nil {
+		return nil, err
+	}
+	defer c.mu.Unlock()
+	status := map[string]any{
+		"ready":       !c.link.down.Load(),
+		"serial_port": c.serialPort,
+	}
+	if c.link.down.Load() {
+		status["down_since"] = c.link.since.Format(time.RFC3339)
+		status["down_sec"] = time.Since(c.link.since).Seconds()
+		if c.link.lastErr != nil {
+			status["last_error"] = c.link.lastErr.Error()
+		}
+	}
+	return status, nil
+}
@@ -0,0 +1,100 @@
+//go:build linux
+
+package viamroomba
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// lockPort claims port, opened from serialPort, for this process. It takes
+// an exclusive advisory lock (flock) on the device, which another
+// viam-server or module instance opening it through this module would
+// also take, and fails with a portInUseError if one already has it or a
+// terminal program holds a UUCP lock file (/var/lock/LCK..ttyUSB0) for
+// it. It then marks the terminal exclusive (TIOCEXCL), so programs that
+// don't check locks can't open it while the module has it.
+func lockPort(port io.ReadWriter, serialPort string) error {
+	f, ok := port.(*os.File)
+	if !ok {
+		return nil
+	}
+	if pid := uucpLockHolder(serialPort); pid != 0 {
+		return &portInUseError{serialPort: serialPort, holders: []string{describeProcess(pid)}, uucp: true}
+	}
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return &portInUseError{serialPort: serialPort, holders: portHolders(serialPort)}
+	}
+	// Some device filesystems don't support flock; carry on without it.
+	if err == nil {
+		const tiocexcl = 0x540C
+		syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(tiocexcl), 0)
+	}
+	return nil
+}
+
+// uucpLockHolder returns the process holding a UUCP lock file for
+// serialPort, as minicom, screen, and other terminal programs create, or
+// 0 if there is none or its process has exited.
+func uucpLockHolder(serialPort string) int {
+	device := filepath.Base(connKey(serialPort))
+	for _, dir := range []string{"/var/lock", "/run/lock"} {
+		data, err := os.ReadFile(filepath.Join(dir, "LCK.."+device))
+		if err != nil {
+			continue
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+		if _, err := os.Stat(fmt.Sprintf("/proc/%d", pid)); err == nil {
+			return pid
+		}
+	}
+	return 0
+}
+
+// portHolders lists the other processes that have serialPort open, as
+// "pid (command)", by looking through /proc. Processes of other users
+// can't be seen without root.
+func portHolders(serialPort string) []string {
+	device := connKey(serialPort)
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+	var holders []string
+	for _, p := range procs {
+		pid, err := strconv.Atoi(p.Name())
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+		fds, err := os.ReadDir(fmt.Sprintf("/proc/%d/fd", pid))
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			if target, err := os.Readlink(fmt.Sprintf("/proc/%d/fd/%s", pid, fd.Name())); err == nil && target == device {
+				holders = append(holders, describeProcess(pid))
+				break
+			}
+		}
+	}
+	return holders
+}
+
+// describeProcess names a process as "pid (command)".
+func describeProcess(pid int) string {
+	comm, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+	if err != nil {
+		return strconv.Itoa(pid)
+	}
+	return fmt.Sprintf("%d (%s)", pid, strings.TrimSpace(string(comm)))
+}
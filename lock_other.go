@@ -0,0 +1,11 @@
+//go:build !linux
+
+package viamroomba
+
+import "io"
+
+// lockPort does nothing here: serial ports are opened exclusively on
+// Windows, and advisory locks aren't checked elsewhere.
+func lockPort(io.ReadWriter, string) error {
+	return nil
+}
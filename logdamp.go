@@ -0,0 +1,62 @@
+package viamroomba
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"go.viam.com/rdk/logging"
+)
+
+// warnDampInterval is the least time between two logs of the same dampened
+// warning.
+const warnDampInterval = 10 * time.Second
+
+// logDamper keeps warnings that can repeat many times a second, such as
+// SetVelocity clamping during 50 Hz teleop, from flooding the log. The first
+// warning for a key is logged as is; repeats within warnDampInterval are
+// only counted, and the first one after it is logged with how many were left
+// out. Repeats that stop within the interval are never summarized, but the
+// first of the run already said what was wrong.
+type logDamper struct {
+	logger logging.Logger
+
+	mu   sync.Mutex
+	keys map[string]*dampedWarning
+}
+
+type dampedWarning struct {
+	loggedAt   time.Time
+	suppressed int
+}
+
+func newLogDamper(logger logging.Logger) *logDamper {
+	return &logDamper{logger: logger, keys: map[string]*dampedWarning{}}
+}
+
+// Warnf logs a warning, unless one with the same key was logged within
+// warnDampInterval. key names the kind of warning, so that, e.g., clamping
+// the angular velocity doesn't hide clamping the linear one.
+func (d *logDamper) Warnf(key, format string, args ...any) {
+	now := time.Now()
+	d.mu.Lock()
+	w, ok := d.keys[key]
+	if !ok {
+		w = &dampedWarning{}
+		d.keys[key] = w
+	}
+	if ok && now.Sub(w.loggedAt) < warnDampInterval {
+		w.suppressed++
+		d.mu.Unlock()
+		return
+	}
+	suppressed, since := w.suppressed, now.Sub(w.loggedAt)
+	w.loggedAt, w.suppressed = now, 0
+	d.mu.Unlock()
+
+	msg := fmt.Sprintf(format, args...)
+	if suppressed > 0 {
+		msg = fmt.Sprintf("%s (%d more like this in the last %v)", msg, suppressed, since.Round(time.Second))
+	}
+	d.logger.Warn(msg)
+}
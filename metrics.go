@@ -0,0 +1,168 @@
+package viamroomba
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// latencyBucketsMS are the upper bounds of the latency histogram buckets.
+// Anything slower lands in a final overflow bucket.
+var latencyBucketsMS = []float64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000}
+
+type latencyHistogram struct {
+	counts []uint64
+	sumMS  float64
+	maxMS  float64
+	total  uint64
+}
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	ms := float64(d) / float64(time.Millisecond)
+	if h.counts == nil {
+		h.counts = make([]uint64, len(latencyBucketsMS)+1)
+	}
+	i := 0
+	for i < len(latencyBucketsMS) && ms > latencyBucketsMS[i] {
+		i++
+	}
+	h.counts[i]++
+	h.sumMS += ms
+	h.total++
+	if ms > h.maxMS {
+		h.maxMS = ms
+	}
+}
+
+func (h *latencyHistogram) snapshot() map[string]any {
+	buckets := map[string]any{}
+	for i, c := range h.counts {
+		label := "inf"
+		if i < len(latencyBucketsMS) {
+			label = fmt.Sprintf("le_%gms", latencyBucketsMS[i])
+		}
+		buckets[label] = c
+	}
+	mean := 0.0
+	if h.total > 0 {
+		mean = h.sumMS / float64(h.total)
+	}
+	return map[string]any{
+		"count":   h.total,
+		"mean_ms": mean,
+		"max_ms":  h.maxMS,
+		"buckets": buckets,
+	}
+}
+
+// linkMetrics counts serial traffic for one connection. Everything is
+// guarded by its own lock so snapshots never wait on the serial bus.
+type linkMetrics struct {
+	mu             sync.Mutex
+	bytesWritten   uint64
+	bytesRead      uint64
+	commands       uint64
+	checksumErrors uint64
+	// corruptResponses counts sensor responses that failed validation.
+	corruptResponses uint64
+	timeouts         uint64
+	reconnects       uint64
+	// resyncs counts resynchronizations after a corrupt or unanswered
+	// response, and resyncFailures those that didn't recover.
+	resyncs        uint64
+	resyncFailures uint64
+	latency        map[string]*latencyHistogram
+}
+
+// recordCommand counts a command of the given kind ("write", "query",
+// "sensor") and its round-trip time.
+func (m *linkMetrics) recordCommand(kind string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.commands++
+	if m.latency == nil {
+		m.latency = map[string]*latencyHistogram{}
+	}
+	h, ok := m.latency[kind]
+	if !ok {
+		h = &latencyHistogram{}
+		m.latency[kind] = h
+	}
+	h.observe(d)
+}
+
+// recordHold records how long the bus lock was held, under "bus_hold"
+// alongside the command latencies.
+func (m *linkMetrics) recordHold(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.latency == nil {
+		m.latency = map[string]*latencyHistogram{}
+	}
+	h, ok := m.latency["bus_hold"]
+	if !ok {
+		h = &latencyHistogram{}
+		m.latency["bus_hold"] = h
+	}
+	h.observe(d)
+}
+
+func (m *linkMetrics) snapshot() map[string]any {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	latency := map[string]any{}
+	for kind, h := range m.latency {
+		latency[kind] = h.snapshot()
+	}
+	return map[string]any{
+		"bytes_written":     m.bytesWritten,
+		"bytes_read":        m.bytesRead,
+		"commands":          m.commands,
+		"checksum_errors":   m.checksumErrors,
+		"corrupt_responses": m.corruptResponses,
+		"timeouts":          m.timeouts,
+		"reconnects":        m.reconnects,
+		"resyncs":           m.resyncs,
+		"resync_failures":   m.resyncFailures,
+		"latency":           latency,
+	}
+}
+
+// countingPort wraps the serial port to count bytes in each direction. A
+// read that returns nothing with io.EOF is the termios VTIME timeout firing
+// (see setReadTimeout), so it is counted as a timeout; any other error is
+// kept in fault, since it means the port itself has failed.
+type countingPort struct {
+	rw      io.ReadWriter
+	metrics *linkMetrics
+	capture *byteCapture
+	fault   error
+}
+
+func (p *countingPort) Read(b []byte) (int, error) {
+	n, err := p.rw.Read(b)
+	p.capture.record(captureRX, b[:n])
+	p.metrics.mu.Lock()
+	p.metrics.bytesRead += uint64(n)
+	if n == 0 && err == io.EOF {
+		p.metrics.timeouts++
+	}
+	p.metrics.mu.Unlock()
+	if err != nil && err != io.EOF && p.fault == nil {
+		p.fault = err
+	}
+	return n, err
+}
+
+func (p *countingPort) Write(b []byte) (int, error) {
+	n, err := p.rw.Write(b)
+	p.capture.record(captureTX, b[:n])
+	p.metrics.mu.Lock()
+	p.metrics.bytesWritten += uint64(n)
+	p.metrics.mu.Unlock()
+	if err != nil && p.fault == nil {
+		p.fault = err
+	}
+	return n, err
+}
@@ -0,0 +1,112 @@
+package viamroomba
+
+import (
+	"fmt"
+	"time"
+)
+
+// defaultModeCheckInterval is how often the base checks the OI mode against
+// the tracked one unless mode_check_interval_sec is set.
+const defaultModeCheckInterval = 5 * time.Second
+
+// watchMode checks every interval that the robot is in the OI mode the
+// module thinks it is, reading packet 35 itself only if nothing else (the
+// sensor, a mode change) has in that time, so a mismatch is caught even
+// while nothing polls the robot. observeMode corrects the tracked mode and
+// records a mode_mismatch event; with reassert_mode, the base then puts
+// the robot back in Safe mode. While the robot rests it checks
+// idlePollFactor times less often. It runs until the base is closed.
+func (s *viamRoombaBase) watchMode(interval time.Duration) {
+	ticker := s.clk.Ticker(interval)
+	defer ticker.Stop()
+	var throttle pollThrottle
+	for {
+		var tracked oiMode
+		select {
+		case <-s.cancelCtx.Done():
+			return
+		case <-ticker.C:
+			if throttle.due(&s.conn.activity) {
+				s.checkMode(interval)
+			}
+			continue
+		case tracked = <-s.modeMismatches:
+		}
+		if err := s.reassertMode(tracked); err != nil {
+			s.logger.Warnf("Failed to put the robot back in Safe mode: %v", err)
+		}
+	}
+}
+
+// checkMode reads packet 35 if it hasn't been read within interval. A robot
+// the idle policy put to sleep is left alone, since reading would keep it
+// awake.
+func (s *viamRoombaBase) checkMode(interval time.Duration) {
+	if err := s.conn.mu.LockContext(s.cancelCtx); err != nil {
+		return
+	}
+	defer s.conn.mu.Unlock()
+	if s.asleep || s.conn.link.down.Load() || time.Since(s.conn.modeReadAt) < interval {
+		return
+	}
+	if _, err := s.conn.syncMode(); err != nil {
+		s.logger.Debugf("Failed to check the OI mode: %v", err)
+	}
+}
+
+// noteModeMismatch logs a mode_mismatch event and, with reassert_mode,
+// hands it to watchMode. It is called from the event observer, possibly
+// with the bus held, so it doesn't touch the robot itself.
+func (s *viamRoombaBase) noteModeMismatch(e event) {
+	tracked, _ := e.detail["tracked"].(string)
+	s.logger.Warnf("The robot is in %v mode, not %s as tracked; it changed mode by itself "+
+		"(a cliff, wheel drop, or button press in Safe mode does this)", e.detail["actual"], tracked)
+	if s.modeMismatches == nil {
+		return
+	}
+	var mode oiMode
+	switch tracked {
+	case oiSafe.String():
+		mode = oiSafe
+	case oiFull.String():
+		mode = oiFull
+	default:
+		return
+	}
+	select {
+	case s.modeMismatches <- mode:
+	default:
+	}
+}
+
+// reassertMode puts the robot back in Safe mode after it dropped out of
+// tracked (Safe or Full) by itself. Full mode is never re-entered without
+// enter_full_mode's confirmation. It does nothing if the robot has since
+// been sent somewhere else, is running a cleaning cycle or dock search, or
+// has a wheel dropped, in which case Safe mode would only drop out again.
+func (s *viamRoombaBase) reassertMode(tracked oiMode) error {
+	if err := s.conn.mu.LockContext(s.cancelCtx); err != nil {
+		return err
+	}
+	defer s.conn.mu.Unlock()
+	if s.conn.mode != oiPassive && s.conn.mode != oiOff {
+		return nil
+	}
+	if kind, _ := s.conn.activity.current(); kind == "clean" || kind == "docking" {
+		return nil
+	}
+	data, err := s.conn.sensor(7)
+	if err != nil {
+		return fmt.Errorf("failed to read the wheel drops: %w", err)
+	}
+	if data[0]&0x0c != 0 {
+		s.logger.Info("Not returning to Safe mode while a wheel is dropped")
+		return nil
+	}
+	if err := s.conn.setMode(oiSafe); err != nil {
+		return err
+	}
+	s.logger.Infof("Put the robot back in Safe mode after it left %s mode by itself", tracked)
+	s.conn.events.record("mode_reasserted", map[string]any{"mode": oiSafe.String(), "was": tracked.String()})
+	return nil
+}
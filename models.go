@@ -0,0 +1,156 @@
+package viamroomba
+
+import (
+	"context"
+
+	base "go.viam.com/rdk/components/base"
+	"go.viam.com/rdk/components/button"
+	"go.viam.com/rdk/components/generic"
+	"go.viam.com/rdk/components/movementsensor"
+	"go.viam.com/rdk/components/sensor"
+	toggleswitch "go.viam.com/rdk/components/switch"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	genericservice "go.viam.com/rdk/services/generic"
+)
+
+// Namespace is the namespace of every model in the module. Forks can publish
+// under their own namespace without editing code:
+//
+//	go build -ldflags "-X viamroomba.Namespace=myorg" ./cmd/module
+var Namespace = "jalen"
+
+const moduleName = "viam-roomba"
+
+func newModel(name string) resource.Model {
+	return resource.NewModel(Namespace, moduleName, name)
+}
+
+var (
+	Base        = newModel("base")
+	Base550     = newModel("base-550")
+	BaseCreate2 = newModel("base-create2")
+	BaseFake    = newModel("base-fake")
+	Sensor      = newModel("sensor")
+	SensorFake  = newModel("sensor-fake")
+	Controller  = newModel("controller")
+	Coverage    = newModel("coverage")
+	Odometry    = newModel("odometry")
+	PowerOutput = newModel("power-output")
+	CleanButton = newModel("clean-button")
+)
+
+// baseVariant is a base model and the physical defaults it applies to any
+// dimensions left unset in its config.
+type baseVariant struct {
+	model                resource.Model
+	widthMM              int
+	wheelCircumferenceMM int
+	diameterMM           int
+	heightMM             int
+}
+
+// baseVariants lists every serial base model. Adding a robot with different
+// dimensions only needs a row here.
+var baseVariants = []baseVariant{
+	{model: Base, widthMM: 235, wheelCircumferenceMM: 220, diameterMM: 340, heightMM: 92},
+	{model: Base550, widthMM: 235, wheelCircumferenceMM: 226, diameterMM: 340, heightMM: 92},
+	{model: BaseCreate2, widthMM: 235, wheelCircumferenceMM: 226, diameterMM: 342, heightMM: 92},
+}
+
+// Models lists every model the module serves, for module.ModularMain.
+var Models = []resource.APIModel{
+	{API: sensor.API, Model: Sensor},
+	{API: generic.API, Model: Controller},
+	{API: base.API, Model: BaseFake},
+	{API: sensor.API, Model: SensorFake},
+	{API: genericservice.API, Model: Coverage},
+	{API: movementsensor.API, Model: Odometry},
+	{API: toggleswitch.API, Model: PowerOutput},
+	{API: button.API, Model: CleanButton},
+}
+
+func init() {
+	resource.RegisterComponent(sensor.API, Sensor,
+		resource.Registration[sensor.Sensor, *SensorConfig]{
+			Constructor: newViamRoombaSensor,
+		},
+	)
+	resource.RegisterComponent(generic.API, Controller,
+		resource.Registration[resource.Resource, *ControllerConfig]{
+			Constructor: newViamRoombaController,
+		},
+	)
+	// base-fake and sensor-fake need no robot; they drive and report a
+	// simulated one, for trying out configs, client code, and navigation.
+	resource.RegisterComponent(base.API, BaseFake,
+		resource.Registration[base.Base, *FakeConfig]{
+			Constructor: newFakeBase,
+		},
+	)
+	resource.RegisterComponent(sensor.API, SensorFake,
+		resource.Registration[sensor.Sensor, *FakeSensorConfig]{
+			Constructor: newFakeSensor,
+		},
+	)
+	resource.RegisterComponent(movementsensor.API, Odometry,
+		resource.Registration[movementsensor.MovementSensor, *PoseConfig]{
+			Constructor: newPoseSensor,
+		},
+	)
+	resource.RegisterComponent(toggleswitch.API, PowerOutput,
+		resource.Registration[toggleswitch.Switch, *PowerOutputConfig]{
+			Constructor: newPowerOutput,
+		},
+	)
+	resource.RegisterComponent(button.API, CleanButton,
+		resource.Registration[button.Button, *ButtonConfig]{
+			Constructor: newCleanButton,
+		},
+	)
+	resource.RegisterService(genericservice.API, Coverage,
+		resource.Registration[resource.Resource, *CoverageConfig]{
+			Constructor: newCoverageService,
+		},
+	)
+	for _, v := range baseVariants {
+		resource.RegisterComponent(base.API, v.model,
+			resource.Registration[base.Base, *Config]{
+				Constructor: v.newBase,
+			},
+		)
+		Models = append(Models, resource.APIModel{API: base.API, Model: v.model})
+	}
+}
+
+func (v baseVariant) newBase(ctx context.Context, deps resource.Dependencies, rawConf resource.Config, logger logging.Logger) (base.Base, error) {
+	conf, err := resource.NativeConfig[*Config](rawConf)
+	if err != nil {
+		return nil, err
+	}
+	b, err := NewBase(ctx, deps, rawConf.ResourceName(), v.withDefaults(conf), logger)
+	if err != nil {
+		return nil, err
+	}
+	b.(*viamRoombaBase).withDefaults = v.withDefaults
+	b.(*viamRoombaBase).model = v.model.String()
+	return b, nil
+}
+
+// withDefaults returns a copy of conf with unset dimensions filled in.
+func (v baseVariant) withDefaults(conf *Config) *Config {
+	c := *conf
+	if c.WidthMM == 0 {
+		c.WidthMM = v.widthMM
+	}
+	if c.WheelCircumferenceMM == 0 {
+		c.WheelCircumferenceMM = v.wheelCircumferenceMM
+	}
+	if c.DiameterMM == 0 {
+		c.DiameterMM = v.diameterMM
+	}
+	if c.HeightMM == 0 {
+		c.HeightMM = v.heightMM
+	}
+	return &c
+}
@@ -0,0 +1,51 @@
+package viamroomba
+
+import (
+	"testing"
+
+	"go.viam.com/rdk/resource"
+)
+
+// TestModelsRegisteredOnce checks that every model the module serves is
+// listed in Models exactly once and registered, that every base variant is
+// among them, and that nothing in the module's namespace is registered
+// without being listed, which module.ModularMain would then never serve.
+func TestModelsRegisteredOnce(t *testing.T) {
+	listed := map[resource.APIModel]int{}
+	models := map[resource.Model]int{}
+	for _, m := range Models {
+		listed[m]++
+		models[m.Model]++
+		if _, ok := resource.LookupRegistration(m.API, m.Model); !ok {
+			t.Errorf("%s %s is listed in Models but not registered", m.API, m.Model)
+		}
+	}
+	for m, n := range models {
+		if n != 1 {
+			t.Errorf("model %s is listed in Models %d times", m, n)
+		}
+	}
+
+	variants := map[resource.Model]int{}
+	for _, v := range baseVariants {
+		variants[v.model]++
+	}
+	for m, n := range variants {
+		if n != 1 {
+			t.Errorf("model %s is in baseVariants %d times", m, n)
+		}
+		if models[m] != 1 {
+			t.Errorf("base variant %s is listed in Models %d times, want 1", m, models[m])
+		}
+	}
+
+	for apiModel := range resource.RegisteredResources() {
+		family := apiModel.Model.Family
+		if string(family.Namespace) != Namespace || family.Name != moduleName {
+			continue
+		}
+		if listed[apiModel] != 1 {
+			t.Errorf("%s %s is registered but listed in Models %d times", apiModel.API, apiModel.Model, listed[apiModel])
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package viamroomba
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// motionState tracks the most recent non-blocking MoveStraight, Spin, or
+// execute_path so clients can poll or wait for it via DoCommand.
+type motionState struct {
+	mu   sync.Mutex
+	done chan struct{} // closed when the motion finishes; nil if none has started
+	err  error
+}
+
+// start records a new motion and returns the function that marks it finished.
+func (m *motionState) start() func(error) {
+	done := make(chan struct{})
+	m.mu.Lock()
+	m.done = done
+	m.err = nil
+	m.mu.Unlock()
+	return func(err error) {
+		m.mu.Lock()
+		m.err = err
+		m.mu.Unlock()
+		close(done)
+	}
+}
+
+// current returns the completion channel of the latest motion, or nil.
+func (m *motionState) current() chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.done
+}
+
+func (m *motionState) result() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.err
+}
+
+// nonBlocking reports whether a timed motion should return as soon as the
+// drive command is sent. extra["non_blocking"] overrides the config default.
+func (s *viamRoombaBase) nonBlocking(extra map[string]any) bool {
+	if v, ok := extra["non_blocking"].(bool); ok {
+		return v
+	}
+	return s.nonBlockingMotion
+}
+
+// motionGoal is a timed or closed-loop motion queued for the base's motion
+// executor.
+type motionGoal struct {
+	ctx         context.Context
+	done        func() // releases the operation slot
+	nonBlocking bool
+	kind        string
+	// start, if set, sends the commands that begin the motion, with the
+	// bus held. run then watches the motion until it is finished.
+	start func() error
+	run   func(context.Context) error
+
+	// started receives start's result, and finished run's.
+	started  chan error
+	finished chan error
+}
+
+// runMotion hands a motion to the motion executor and waits until it has
+// started, so that a refused start is returned even to a non-blocking
+// caller, and then, unless the motion is non-blocking, until it finishes.
+// kind is the operation reported in sensor readings while the motion runs.
+// Non-blocking motions are detached from the caller's context so they
+// outlive the request that started them.
+func (s *viamRoombaBase) runMotion(
+	ctx context.Context, extra map[string]any, kind string, start func() error, run func(context.Context) error,
+) error {
+	timeout, err := parseTimeoutMS(extra["timeout_ms"])
+	if err != nil {
+		return fmt.Errorf("extra %w", err)
+	}
+	if timeout > 0 {
+		run = s.withTimeout(kind, timeout, run)
+	}
+	nonBlocking := s.nonBlocking(extra)
+	if nonBlocking {
+		ctx = context.WithoutCancel(ctx)
+	}
+	// Claiming the operation slot cancels whatever the executor is running,
+	// so it is free to take this motion next.
+	ctx, done := s.opMgr.New(ctx)
+	g := &motionGoal{
+		ctx:         ctx,
+		done:        done,
+		nonBlocking: nonBlocking,
+		kind:        kind,
+		start:       start,
+		run:         run,
+		started:     make(chan error, 1),
+		finished:    make(chan error, 1),
+	}
+	select {
+	case s.motions <- g:
+	case <-ctx.Done():
+		done()
+		return ctx.Err()
+	case <-s.cancelCtx.Done():
+		done()
+		return s.cancelCtx.Err()
+	}
+	if err := <-g.started; err != nil || nonBlocking {
+		return err
+	}
+	return <-g.finished
+}
+
+// runMotions is the base's motion executor: it runs the motions handed to
+// it by runMotion one at a time until the base is closed. Every motion's
+// drive commands, completion monitoring, and watchdog timer run here, so a
+// newer motion or a Stop preempts the current one simply by cancelling its
+// operation.
+func (s *viamRoombaBase) runMotions() {
+	for {
+		select {
+		case <-s.cancelCtx.Done():
+			return
+		case g := <-s.motions:
+			s.execute(g)
+		}
+	}
+}
+
+// execute starts a motion and runs it to the end. With a reflex enabled,
+// forward driving is guarded by it.
+func (s *viamRoombaBase) execute(g *motionGoal) {
+	if g.start != nil {
+		err := s.conn.mu.LockContext(g.ctx)
+		if err == nil {
+			err = g.start()
+			s.conn.mu.Unlock()
+		}
+		if err != nil {
+			g.done()
+			g.started <- err
+			return
+		}
+	}
+	finish := func(error) {}
+	if g.nonBlocking {
+		finish = s.motion.start()
+	}
+	g.started <- nil
+
+	run := g.run
+	if s.reflexes() {
+		run = s.withReflexes(run)
+	}
+	endActivity := s.conn.activity.begin(g.kind)
+	err := run(g.ctx)
+	endActivity()
+	g.done()
+	finish(err)
+	g.finished <- err
+}
+
+// parseTimeoutMS reads a timeout_ms parameter, or returns zero if v is nil.
+func parseTimeoutMS(v any) (time.Duration, error) {
+	if v == nil {
+		return 0, nil
+	}
+	ms, ok := v.(float64)
+	if !ok || ms <= 0 {
+		return 0, errors.New("timeout_ms must be a positive number")
+	}
+	return time.Duration(ms * float64(time.Millisecond)), nil
+}
+
+// withTimeout bounds a motion's run to d, whatever deadline the client set:
+// once d elapses its context is done, so it stops the base as it would for
+// a newer command, and the motion fails with a timeout error.
+func (s *viamRoombaBase) withTimeout(kind string, d time.Duration, run func(context.Context) error) func(context.Context) error {
+	return func(ctx context.Context) error {
+		timeoutCtx, cancel := s.clk.WithTimeout(ctx, d)
+		defer cancel()
+		err := run(timeoutCtx)
+		if err != nil && ctx.Err() == nil && errors.Is(timeoutCtx.Err(), context.DeadlineExceeded) {
+			s.logger.Warnf("%s didn't finish within %v; stopped it", kind, d)
+			return fmt.Errorf("%s timed out after %v: %w", kind, d, context.DeadlineExceeded)
+		}
+		return err
+	}
+}
+
+// waitThenStop is the watchdog of a timed motion: it lets the motion run
+// for d and then stops the base. The motion is cut short if ctx is
+// cancelled (e.g. by a newer operation) or the base is closed.
+func (s *viamRoombaBase) waitThenStop(ctx context.Context, d time.Duration, extra map[string]any) error {
+	timer := s.clk.Timer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		s.stop(ctx, extra)
+		return ctx.Err()
+	case <-s.cancelCtx.Done():
+		s.stop(ctx, extra)
+		return s.cancelCtx.Err()
+	}
+
+	return s.stop(ctx, extra)
+}
+
+// motionStatus reports whether the latest non-blocking motion has finished,
+// and how it ended. A base that never started one reports complete.
+func (s *viamRoombaBase) motionStatus() map[string]any {
+	status := map[string]any{"complete": true}
+	if done := s.motion.current(); done != nil {
+		select {
+		case <-done:
+		default:
+			status["complete"] = false
+			return status
+		}
+	}
+	if err := s.motion.result(); err != nil {
+		status["error"] = err.Error()
+	}
+	return status
+}
+
+// motionArgs are the parameters shared by DoCommands that start a motion.
+type motionArgs struct {
+	NonBlocking *bool    `json:"non_blocking" doc:"Return immediately instead of when the motion finishes"`
+	TimeoutMS   *float64 `json:"timeout_ms" doc:"Stop the motion and fail if it hasn't finished after this long"`
+}
+
+// extra returns the arguments in the form MoveStraight and Spin take them.
+func (a motionArgs) extra() map[string]any {
+	extra := map[string]any{}
+	if a.NonBlocking != nil {
+		extra["non_blocking"] = *a.NonBlocking
+	}
+	if a.TimeoutMS != nil {
+		extra["timeout_ms"] = *a.TimeoutMS
+	}
+	return extra
+}
+
+// waitForMotionArgs are the parameters of wait_for_motion.
+type waitForMotionArgs struct {
+	TimeoutSec *float64 `json:"timeout_sec" doc:"Give up waiting after this long"`
+}
+
+// waitForMotion blocks until the latest non-blocking motion finishes, the
+// optional timeout elapses, or ctx is cancelled.
+func (s *viamRoombaBase) waitForMotion(ctx context.Context, args waitForMotionArgs) (map[string]any, error) {
+	done := s.motion.current()
+	if done == nil {
+		return s.motionStatus(), nil
+	}
+
+	var timeout <-chan time.Time
+	if args.TimeoutSec != nil {
+		sec := *args.TimeoutSec
+		if sec <= 0 {
+			return nil, fmt.Errorf("timeout_sec must be a positive number")
+		}
+		timer := s.clk.Timer(time.Duration(sec * float64(time.Second)))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-done:
+	case <-timeout:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return s.motionStatus(), nil
+}
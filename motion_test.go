@@ -0,0 +1,161 @@
+package viamroomba
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+// timerClock is a mock clock that reports the duration of each timer it
+// arms, so a test knows a motion is waiting on it before moving the clock.
+type timerClock struct {
+	*clock.Mock
+	armed chan time.Duration
+}
+
+func newTimerClock() *timerClock {
+	return &timerClock{Mock: clock.NewMock(), armed: make(chan time.Duration, 8)}
+}
+
+func (c *timerClock) Timer(d time.Duration) *clock.Timer {
+	t := c.Mock.Timer(d)
+	c.armed <- d
+	return t
+}
+
+// waitArmed returns the duration of the next timer armed on clk.
+func waitArmed(t *testing.T, clk *timerClock) time.Duration {
+	t.Helper()
+	select {
+	case d := <-clk.armed:
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatal("the motion never started its timer")
+		return 0
+	}
+}
+
+// waitResult returns what a motion running in the background returned.
+func waitResult(t *testing.T, errc <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-errc:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("the motion never returned")
+		return nil
+	}
+}
+
+// timedMotions are the open-loop motions, each two seconds long.
+var timedMotions = []struct {
+	name  string
+	run   func(ctx context.Context, s *viamRoombaBase, extra map[string]any) error
+	drive [2]int16
+}{
+	{
+		name: "move_straight",
+		run: func(ctx context.Context, s *viamRoombaBase, extra map[string]any) error {
+			return s.MoveStraight(ctx, 300, 150, extra)
+		},
+		drive: [2]int16{150, 32767},
+	},
+	{
+		name: "spin",
+		run: func(ctx context.Context, s *viamRoombaBase, extra map[string]any) error {
+			return s.Spin(ctx, -90, 45, extra)
+		},
+		drive: [2]int16{100, -1},
+	},
+}
+
+// startMotion runs a motion in the background, checks that it armed a
+// two-second timer and is driving, and returns the channel its result
+// arrives on.
+func startMotion(
+	ctx context.Context, t *testing.T, s *viamRoombaBase, robot *fakeRobot, clk *timerClock,
+	run func(context.Context, *viamRoombaBase, map[string]any) error, drive [2]int16, extra map[string]any,
+) <-chan error {
+	t.Helper()
+	errc := make(chan error, 1)
+	go func() { errc <- run(ctx, s, extra) }()
+	if d := waitArmed(t, clk); d != 2*time.Second {
+		t.Fatalf("motion timer is %v, want 2s", d)
+	}
+	if got, _ := robot.lastDrive(); got != drive {
+		t.Fatalf("drove %v, want %v", got, drive)
+	}
+	return errc
+}
+
+// checkStopped fails the test unless the last Drive command was a stop.
+func checkStopped(t *testing.T, robot *fakeRobot) {
+	t.Helper()
+	if got, _ := robot.lastDrive(); got != [2]int16{} {
+		t.Errorf("last drive was %v, want a stop", got)
+	}
+}
+
+func TestTimedMotionStopsAfterDuration(t *testing.T) {
+	for _, m := range timedMotions {
+		t.Run(m.name, func(t *testing.T) {
+			clk := newTimerClock()
+			s, robot := baseOnFakeRobot(t, clk)
+			errc := startMotion(context.Background(), t, s, robot, clk, m.run, m.drive, nil)
+
+			clk.Add(2*time.Second - time.Millisecond)
+			select {
+			case err := <-errc:
+				t.Fatalf("returned before its duration: %v", err)
+			default:
+			}
+			if got, _ := robot.lastDrive(); got != m.drive {
+				t.Fatalf("drove %v before its duration, want %v", got, m.drive)
+			}
+
+			clk.Add(time.Millisecond)
+			if err := waitResult(t, errc); err != nil {
+				t.Fatal(err)
+			}
+			checkStopped(t, robot)
+		})
+	}
+}
+
+func TestTimedMotionCancelled(t *testing.T) {
+	for _, m := range timedMotions {
+		t.Run(m.name, func(t *testing.T) {
+			clk := newTimerClock()
+			s, robot := baseOnFakeRobot(t, clk)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			errc := startMotion(ctx, t, s, robot, clk, m.run, m.drive, nil)
+
+			clk.Add(time.Second)
+			cancel()
+			if err := waitResult(t, errc); !errors.Is(err, context.Canceled) {
+				t.Fatalf("got %v, want %v", err, context.Canceled)
+			}
+			checkStopped(t, robot)
+		})
+	}
+}
+
+func TestTimedMotionTimeout(t *testing.T) {
+	for _, m := range timedMotions {
+		t.Run(m.name, func(t *testing.T) {
+			clk := newTimerClock()
+			s, robot := baseOnFakeRobot(t, clk)
+			errc := startMotion(context.Background(), t, s, robot, clk, m.run, m.drive, map[string]any{"timeout_ms": 500.0})
+
+			clk.Add(500 * time.Millisecond)
+			if err := waitResult(t, errc); !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+			}
+			checkStopped(t, robot)
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package viamroomba
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// maxObstacles is how many obstacles the memory keeps; the least
+	// recently hit are dropped first.
+	maxObstacles = 500
+	// obstacleMergeMM is how close a bump must be to a remembered obstacle
+	// to count as hitting it again.
+	obstacleMergeMM = 100.0
+	// obstacleRepeatWindow is how soon after a hit another report of the
+	// same obstacle is taken to be the same contact (e.g. seen by both the
+	// base's bump reflex and the sensor) rather than a new hit.
+	obstacleRepeatWindow = 2 * time.Second
+	// defaultObstacleRadiusMM is the search radius of get_obstacle_memory
+	// when only a point is given.
+	defaultObstacleRadiusMM = 500.0
+)
+
+// obstacle is a remembered bump location in the odometry frame.
+type obstacle struct {
+	xMM, yMM  float64
+	sensor    string
+	hits      int
+	firstSeen time.Time
+	lastSeen  time.Time
+}
+
+// obstacleMemory remembers where the robot has bumped into things, so that
+// coverage scripts can steer around them. Like the odometry pose it lives on
+// the connection, and so is shared by every component on the port and lost
+// when the port is closed.
+type obstacleMemory struct {
+	mu        sync.Mutex
+	obstacles []obstacle
+}
+
+// record adds a bump at (x, y), or counts another hit on the remembered
+// obstacle closest to it within obstacleMergeMM.
+func (m *obstacleMemory) record(sensor string, x, y float64, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	best, bestDist := -1, obstacleMergeMM
+	for i, o := range m.obstacles {
+		if d := math.Hypot(o.xMM-x, o.yMM-y); d <= bestDist {
+			best, bestDist = i, d
+		}
+	}
+	if best >= 0 {
+		o := m.obstacles[best]
+		if now.Sub(o.lastSeen) >= obstacleRepeatWindow {
+			o.hits++
+		}
+		o.lastSeen = now
+		// Move the remembered point to the latest hit, weighted by the hits
+		// so far, so odometry drift doesn't split one obstacle into several.
+		o.xMM += (x - o.xMM) / float64(o.hits)
+		o.yMM += (y - o.yMM) / float64(o.hits)
+		copy(m.obstacles[best:], m.obstacles[best+1:])
+		m.obstacles[len(m.obstacles)-1] = o
+		return
+	}
+	if len(m.obstacles) >= maxObstacles {
+		m.obstacles = m.obstacles[1:]
+	}
+	m.obstacles = append(m.obstacles, obstacle{
+		xMM:       x,
+		yMM:       y,
+		sensor:    sensor,
+		hits:      1,
+		firstSeen: now,
+		lastSeen:  now,
+	})
+}
+
+// getObstacleMemoryArgs are the parameters of get_obstacle_memory.
+type getObstacleMemoryArgs struct {
+	NearXMM  *float64 `json:"near_x_mm" doc:"Only return obstacles near this point (odometry frame)"`
+	NearYMM  *float64 `json:"near_y_mm" doc:"Only return obstacles near this point (odometry frame)"`
+	RadiusMM *float64 `json:"radius_mm" doc:"Search radius around the point; defaults to 500"`
+}
+
+// get lists the remembered obstacles, optionally only those within a radius
+// of a point, least recently hit first.
+func (m *obstacleMemory) get(_ context.Context, args getObstacleMemoryArgs) (map[string]any, error) {
+	if (args.NearXMM == nil) != (args.NearYMM == nil) {
+		return nil, errors.New("near_x_mm and near_y_mm must be given together")
+	}
+	radius := defaultObstacleRadiusMM
+	if args.RadiusMM != nil {
+		if *args.RadiusMM <= 0 {
+			return nil, errors.New("radius_mm must be a positive number")
+		}
+		radius = *args.RadiusMM
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := []any{}
+	for _, o := range m.obstacles {
+		if args.NearXMM != nil && math.Hypot(o.xMM-*args.NearXMM, o.yMM-*args.NearYMM) > radius {
+			continue
+		}
+		list = append(list, map[string]any{
+			"x_mm":       o.xMM,
+			"y_mm":       o.yMM,
+			"sensor":     o.sensor,
+			"hits":       o.hits,
+			"first_seen": o.firstSeen.Format(time.RFC3339Nano),
+			"last_seen":  o.lastSeen.Format(time.RFC3339Nano),
+		})
+	}
+	return map[string]any{"obstacles": list}, nil
+}
+
+func (m *obstacleMemory) clear(context.Context, noArgs) (map[string]any, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := len(m.obstacles)
+	m.obstacles = nil
+	return map[string]any{"cleared": n}, nil
+}
@@ -0,0 +1,170 @@
+package viamroomba
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// odometry integrates the Roomba's distance (packet 19) and angle (packet 20)
+// deltas into a pose relative to where the connection was opened. Both packets
+// are reset by the robot every time they are read, so every reader of those
+// packets must feed the deltas here or the pose will drift.
+type odometry struct {
+	mu       sync.Mutex
+	xMM      float64
+	yMM      float64
+	thetaRad float64
+
+	// Totals since the connection was opened, regardless of direction.
+	totalDistanceMM  float64
+	totalRotationDeg float64
+
+	// distanceScale and angleScale correct the distance and angle packets
+	// of firmware that mis-scales them; zero means 1. rawDistanceMM and
+	// rawAngleDeg sum the packets as the robot reported them, signed, for
+	// calibrating the scales.
+	distanceScale, angleScale  float64
+	rawDistanceMM, rawAngleDeg float64
+
+	// updated is when a delta was last applied.
+	updated time.Time
+
+	// gyro, when set, supplies a heading that is fused with the angle
+	// packet. gyroYawDeg is its yaw at the last update, if haveYaw.
+	gyro       *gyroHeading
+	gyroYawDeg float64
+	haveYaw    bool
+}
+
+// odometryTotals are lifetime distance and rotation, persisted by the sensor.
+type odometryTotals struct {
+	DistanceMM  float64 `json:"distance_mm"`
+	RotationDeg float64 `json:"rotation_deg"`
+}
+
+// update applies a distance/angle delta as the robot reported it and
+// returns the distance and change in heading it applied, in mm and degrees:
+// the packets corrected by the scales, and with a gyro, for the heading,
+// the weighted mean of the gyro's change in yaw since the last update and
+// the corrected angle (without one, or while the gyro is stale, just the
+// corrected angle). The position is advanced along the mean heading over
+// the interval, which is a good approximation for the short polling
+// intervals the sensor is used at.
+func (o *odometry) update(distanceMM, angleDeg int) (float64, float64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.rawDistanceMM += float64(distanceMM)
+	o.rawAngleDeg += float64(angleDeg)
+	distance := float64(distanceMM) * scaleOrOne(o.distanceScale)
+	angle := float64(angleDeg) * scaleOrOne(o.angleScale)
+	if o.gyro != nil {
+		yaw, ok := o.gyro.latest()
+		if ok && o.haveYaw {
+			angle = o.gyro.weight*math.Remainder(yaw-o.gyroYawDeg, 360) + (1-o.gyro.weight)*angle
+		}
+		o.gyroYawDeg, o.haveYaw = yaw, ok
+	}
+
+	dTheta := angle * math.Pi / 180.0
+	heading := o.thetaRad + dTheta/2.0
+	o.xMM += distance * math.Cos(heading)
+	o.yMM += distance * math.Sin(heading)
+	o.thetaRad = math.Remainder(o.thetaRad+dTheta, 2*math.Pi)
+	o.totalDistanceMM += math.Abs(distance)
+	o.totalRotationDeg += math.Abs(angle)
+	o.updated = time.Now()
+	return distance, angle
+}
+
+// scaleOrOne returns scale, or 1 if it is unset.
+func scaleOrOne(scale float64) float64 {
+	if scale == 0 {
+		return 1
+	}
+	return scale
+}
+
+// setScales sets the corrections applied to later updates.
+func (o *odometry) setScales(distanceScale, angleScale float64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.distanceScale, o.angleScale = distanceScale, angleScale
+}
+
+// scales returns the corrections in effect, 1 where unset.
+func (o *odometry) scales() (float64, float64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return scaleOrOne(o.distanceScale), scaleOrOne(o.angleScale)
+}
+
+// raw returns the distance and angle packets summed as the robot reported
+// them.
+func (o *odometry) raw() (float64, float64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.rawDistanceMM, o.rawAngleDeg
+}
+
+// setGyro starts fusing g's heading into updates.
+func (o *odometry) setGyro(g *gyroHeading) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.gyro, o.haveYaw = g, false
+}
+
+// clearGyro stops fusing g's heading, unless another has replaced it.
+func (o *odometry) clearGyro(g *gyroHeading) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.gyro == g {
+		o.gyro, o.haveYaw = nil, false
+	}
+}
+
+// age returns how long ago a delta was last applied.
+func (o *odometry) age() time.Duration {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return time.Since(o.updated)
+}
+
+// totals returns the distance and rotation covered since the connection was opened.
+func (o *odometry) totals() odometryTotals {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return odometryTotals{DistanceMM: o.totalDistanceMM, RotationDeg: o.totalRotationDeg}
+}
+
+// pose returns the current x/y position in mm and heading in degrees.
+func (o *odometry) pose() (float64, float64, float64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.xMM, o.yMM, o.thetaRad * 180.0 / math.Pi
+}
+
+// readOdometry reads the distance and angle deltas since the last read and
+// feeds them into the shared pose, returning the distance and the heading
+// change the pose was given. Callers must hold c.mu.
+func (c *roombaConn) readOdometry() (distanceMM, angleDeg float64, err error) {
+	distanceMM, angleDeg, _, err = c.readOdometryWith(nil)
+	return distanceMM, angleDeg, err
+}
+
+// readOdometryWith is readOdometry, also reading the extra packets in the
+// same Query List and returning them in order. Callers must hold c.mu.
+func (c *roombaConn) readOdometryWith(extra []byte) (distanceMM, angleDeg float64, extraData [][]byte, err error) {
+	data, err := c.query(append([]byte{19, 20}, extra...))
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if len(data) < 2+len(extra) || len(data[0]) < 2 || len(data[1]) < 2 {
+		return 0, 0, nil, fmt.Errorf("invalid odometry data length")
+	}
+	distanceMM, angleDeg = c.odom.update(int(int16(binary.BigEndian.Uint16(data[0]))), int(int16(binary.BigEndian.Uint16(data[1]))))
+	return distanceMM, angleDeg, data[2:], nil
+}
@@ -0,0 +1,76 @@
+package viamroomba
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestOdometryUpdate(t *testing.T) {
+	const r = 100 / math.Sqrt2
+	for _, tc := range []struct {
+		name                  string
+		setup                 func(o *odometry)
+		distanceMM, angleDeg  int
+		wantDist, wantAngle   float64
+		wantX, wantY, wantDeg float64
+	}{
+		{name: "straight", distanceMM: 100, wantDist: 100, wantX: 100},
+		{name: "backwards", distanceMM: -100, wantDist: -100, wantX: -100},
+		{name: "spin", angleDeg: 90, wantAngle: 90, wantDeg: 90},
+		{name: "arc follows the mean heading", distanceMM: 100, angleDeg: 90, wantDist: 100, wantAngle: 90, wantX: r, wantY: r, wantDeg: 90},
+		{
+			name:       "from a heading",
+			setup:      func(o *odometry) { o.thetaRad = math.Pi / 2 },
+			distanceMM: 100, wantDist: 100, wantY: 100, wantDeg: 90,
+		},
+		{
+			name:     "heading wraps",
+			setup:    func(o *odometry) { o.thetaRad = math.Pi },
+			angleDeg: 90, wantAngle: 90, wantDeg: -90,
+		},
+		{
+			name:       "scaled",
+			setup:      func(o *odometry) { o.distanceScale, o.angleScale = 2, 0.5 },
+			distanceMM: 50, angleDeg: 180, wantDist: 100, wantAngle: 90, wantX: r, wantY: r, wantDeg: 90,
+		},
+		{
+			name: "fused with the gyro",
+			setup: func(o *odometry) {
+				o.gyro = &gyroHeading{weight: 0.5, yawDeg: 100, at: time.Now()}
+				o.gyroYawDeg, o.haveYaw = 0, true
+			},
+			angleDeg: 80, wantAngle: 90, wantDeg: 90,
+		},
+		{
+			name: "stale gyro",
+			setup: func(o *odometry) {
+				o.gyro = &gyroHeading{weight: 0.5, yawDeg: 100, at: time.Now().Add(-time.Minute)}
+				o.gyroYawDeg, o.haveYaw = 0, true
+			},
+			angleDeg: 80, wantAngle: 80, wantDeg: 80,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var o odometry
+			if tc.setup != nil {
+				tc.setup(&o)
+			}
+			dist, angle := o.update(tc.distanceMM, tc.angleDeg)
+			if math.Abs(dist-tc.wantDist) > 1e-9 || math.Abs(angle-tc.wantAngle) > 1e-9 {
+				t.Errorf("update(%d, %d) = (%v, %v), want (%v, %v)",
+					tc.distanceMM, tc.angleDeg, dist, angle, tc.wantDist, tc.wantAngle)
+			}
+			deg := o.thetaRad * 180 / math.Pi
+			if math.Abs(o.xMM-tc.wantX) > 1e-9 || math.Abs(o.yMM-tc.wantY) > 1e-9 || math.Abs(deg-tc.wantDeg) > 1e-9 {
+				t.Errorf("pose is (%v, %v, %v°), want (%v, %v, %v°)", o.xMM, o.yMM, deg, tc.wantX, tc.wantY, tc.wantDeg)
+			}
+			if want := math.Abs(tc.wantDist); o.totalDistanceMM != want {
+				t.Errorf("total distance is %v, want %v", o.totalDistanceMM, want)
+			}
+			if o.rawDistanceMM != float64(tc.distanceMM) || o.rawAngleDeg != float64(tc.angleDeg) {
+				t.Errorf("raw is (%v, %v), want (%d, %d)", o.rawDistanceMM, o.rawAngleDeg, tc.distanceMM, tc.angleDeg)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package viamroomba
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	toggleswitch "go.viam.com/rdk/components/switch"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+)
+
+// OI output opcodes. Each sets every output it drives at once from a bit
+// mask, so the connection remembers the last mask sent for each.
+const (
+	// opLowSideDrivers drives low side drivers 0-2 on the Create's cargo bay
+	// connector. On a Roomba and the Create 2 the same opcode runs the brush
+	// and vacuum motors instead, which people also use to power accessories.
+	opLowSideDrivers = 138
+	// opDigitalOutputs drives the cargo bay digital outputs 0-2.
+	opDigitalOutputs = 147
+)
+
+// powerOutputs maps each output name to its opcode and bit.
+var powerOutputs = map[string]struct {
+	opcode byte
+	bit    byte
+}{
+	"digital_output_0":  {opDigitalOutputs, 0x01},
+	"digital_output_1":  {opDigitalOutputs, 0x02},
+	"digital_output_2":  {opDigitalOutputs, 0x04},
+	"low_side_driver_0": {opLowSideDrivers, 0x01},
+	"low_side_driver_1": {opLowSideDrivers, 0x02},
+	"low_side_driver_2": {opLowSideDrivers, 0x04},
+}
+
+// PowerOutputConfig configures a switch for one cargo bay output.
+type PowerOutputConfig struct {
+	SerialPort string `json:"serial_port,omitempty"`
+	Controller string `json:"controller,omitempty"`
+	Output     string `json:"output"`
+}
+
+func (cfg *PowerOutputConfig) Validate(path string) ([]string, []string, error) {
+	deps, err := validateConnection(cfg.SerialPort, cfg.Controller)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if _, ok := powerOutputs[cfg.Output]; !ok {
+		names := make([]string, 0, len(powerOutputs))
+		for name := range powerOutputs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, nil, fmt.Errorf("%s: output must be one of %s", path, strings.Join(names, ", "))
+	}
+	return deps, nil, nil
+}
+
+// setOutput switches one output bit on or off, leaving the others that share
+// its opcode as they were. The OI must be in Safe or Full mode. Callers must
+// hold c.mu.
+func (c *roombaConn) setOutput(opcode, bit byte, on bool) error {
+	if err := c.requireControl("switch outputs"); err != nil {
+		return err
+	}
+	if c.outputs == nil {
+		c.outputs = map[byte]byte{}
+	}
+	mask := c.outputs[opcode] &^ bit
+	if on {
+		mask |= bit
+	}
+	if err := c.write(opcode, []byte{mask}); err != nil {
+		return fmt.Errorf("failed to set outputs: %w", err)
+	}
+	c.outputs[opcode] = mask
+	return nil
+}
+
+// powerOutput is a two-position switch (0 off, 1 on) for one cargo bay output,
+// such as the one powering a lidar, so it can be turned off while docked.
+type powerOutput struct {
+	resource.AlwaysRebuild
+
+	name   resource.Name
+	logger logging.Logger
+	conn   *roombaConn
+	output string
+	opcode byte
+	bit    byte
+}
+
+func newPowerOutput(ctx context.Context, deps resource.Dependencies, rawConf resource.Config, logger logging.Logger) (toggleswitch.Switch, error) {
+	conf, err := resource.NativeConfig[*PowerOutputConfig](rawConf)
+	if err != nil {
+		return nil, err
+	}
+	serialPort, err := resolveSerialPort(deps, conf.SerialPort, conf.Controller)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := acquireConn(serialPort, 0, defaultOIProfile)
+	if err != nil {
+		return nil, err
+	}
+	out := powerOutputs[conf.Output]
+	logger.Infof("Roomba %s switch on %s", conf.Output, serialPort)
+	return &powerOutput{
+		name:   rawConf.ResourceName(),
+		logger: logger,
+		conn:   conn,
+		output: conf.Output,
+		opcode: out.opcode,
+		bit:    out.bit,
+	}, nil
+}
+
+func (s *powerOutput) Name() resource.Name {
+	return s.name
+}
+
+func (s *powerOutput) SetPosition(ctx context.Context, position uint32, extra map[string]any) error {
+	defer RecoverToSafeState()
+	if position > 1 {
+		return fmt.Errorf("invalid position %d: %s has positions 0 (off) and 1 (on)", position, s.output)
+	}
+	if err := s.conn.mu.LockContext(ctx); err != nil {
+		return err
+	}
+	defer s.conn.mu.Unlock()
+	return s.conn.setOutput(s.opcode, s.bit, position == 1)
+}
+
+// GetPosition returns the position last set through the module. The OI has
+// no packet reporting the outputs, so a change made by another client isn't
+// seen.
+func (s *powerOutput) GetPosition(ctx context.Context, extra map[string]any) (uint32, error) {
+	if err := s.conn.mu.LockContext(ctx); err != nil {
+		return 0, err
+	}
+	defer s.conn.mu.Unlock()
+	if s.conn.outputs[s.opcode]&s.bit != 0 {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (s *powerOutput) GetNumberOfPositions(ctx context.Context, extra map[string]any) (uint32, []string, error) {
+	return 2, []string{"off", "on"}, nil
+}
+
+func (s *powerOutput) DoCommand(ctx context.Context, cmd map[string]any) (map[string]any, error) {
+	return nil, errUnimplemented
+}
+
+func (s *powerOutput) Close(ctx context.Context) error {
+	releaseConn(s.conn)
+	return nil
+}
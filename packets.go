@@ -0,0 +1,180 @@
+package viamroomba
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/xa4a/go-roomba/constants"
+)
+
+// extraPacketLengths are OI 600-series packets missing from go-roomba's
+// length table, which it needs to read any packet. Most are 2-byte values.
+var extraPacketLengths = map[byte]byte{
+	41: 2, 42: 2, 43: 2, 44: 2, 45: 1, 46: 2, 47: 2, 48: 2, 49: 2, 50: 2, 51: 2,
+	54: 2, 55: 2, 56: 2, 57: 2, 58: 1,
+}
+
+// correctedPacketLengths fix entries go-roomba has wrong: the unused packets
+// inside group 6 and the size of group 100 (packets 7-58).
+var correctedPacketLengths = map[byte]byte{
+	16: 1, 32: 1, 33: 2, 100: 80,
+}
+
+func init() {
+	for id, n := range extraPacketLengths {
+		if _, ok := constants.SENSOR_PACKET_LENGTH[id]; !ok {
+			constants.SENSOR_PACKET_LENGTH[id] = n
+		}
+	}
+	for id, n := range correctedPacketLengths {
+		constants.SENSOR_PACKET_LENGTH[id] = n
+	}
+}
+
+// opcodeNames names the OI opcodes the module sends, for tracing.
+var opcodeNames = map[byte]string{
+	128: "Start",
+	131: "Safe",
+	132: "Full",
+	133: "Power",
+	134: "Spot",
+	135: "Clean",
+	136: "Max",
+	137: "Drive",
+	138: "Motors/Low Side Drivers",
+	139: "LEDs",
+	140: "Song",
+	141: "Play",
+	142: "Sensors",
+	143: "Seek Dock",
+	145: "Drive Direct",
+	147: "Digital Outputs",
+	148: "Stream",
+	149: "Query List",
+	150: "Pause/Resume Stream",
+	167: "Schedule",
+	168: "Set Day/Time",
+}
+
+// packetNames names the OI sensor packets.
+var packetNames = map[byte]string{
+	7:  "Bumps and Wheel Drops",
+	8:  "Wall",
+	9:  "Cliff Left",
+	10: "Cliff Front Left",
+	11: "Cliff Front Right",
+	12: "Cliff Right",
+	13: "Virtual Wall",
+	14: "Overcurrents",
+	15: "Dirt Detect",
+	17: "IR Opcode",
+	18: "Buttons",
+	19: "Distance",
+	20: "Angle",
+	21: "Charging State",
+	22: "Voltage",
+	23: "Current",
+	24: "Temperature",
+	25: "Battery Charge",
+	26: "Battery Capacity",
+	27: "Wall Signal",
+	28: "Cliff Left Signal",
+	29: "Cliff Front Left Signal",
+	30: "Cliff Front Right Signal",
+	31: "Cliff Right Signal",
+	34: "Charging Sources Available",
+	35: "OI Mode",
+	36: "Song Number",
+	37: "Song Playing",
+	38: "Number of Stream Packets",
+	39: "Requested Velocity",
+	40: "Requested Radius",
+	41: "Requested Right Velocity",
+	42: "Requested Left Velocity",
+	43: "Left Encoder Counts",
+	44: "Right Encoder Counts",
+	45: "Light Bumper",
+	46: "Light Bump Left Signal",
+	47: "Light Bump Front Left Signal",
+	48: "Light Bump Center Left Signal",
+	49: "Light Bump Center Right Signal",
+	50: "Light Bump Front Right Signal",
+	51: "Light Bump Right Signal",
+	52: "IR Opcode Left",
+	53: "IR Opcode Right",
+	54: "Left Motor Current",
+	55: "Right Motor Current",
+	56: "Main Brush Motor Current",
+	57: "Side Brush Motor Current",
+	58: "Stasis",
+}
+
+// packetUnits are the units of the OI sensor packets that measure
+// something; "bitmask" packets pack several flags into one value.
+var packetUnits = map[byte]string{
+	7:  "bitmask",
+	14: "bitmask",
+	18: "bitmask",
+	19: "mm",
+	20: "deg",
+	22: "mV",
+	23: "mA",
+	24: "°C",
+	25: "mAh",
+	26: "mAh",
+	34: "bitmask",
+	39: "mm/s",
+	40: "mm",
+	41: "mm/s",
+	42: "mm/s",
+	43: "counts",
+	44: "counts",
+	45: "bitmask",
+	54: "mA",
+	55: "mA",
+	56: "mA",
+	57: "mA",
+	58: "bitmask",
+}
+
+// decodePacket returns a packet's value: signed or unsigned by the OI spec,
+// big-endian if it is 2 bytes.
+func decodePacket(id byte, data []byte) int {
+	switch {
+	case len(data) == 1 && signedPackets[id]:
+		return int(int8(data[0]))
+	case len(data) == 1:
+		return int(data[0])
+	case signedPackets[id]:
+		return int(int16(binary.BigEndian.Uint16(data)))
+	default:
+		return int(binary.BigEndian.Uint16(data))
+	}
+}
+
+func opcodeName(op byte) string {
+	if name, ok := opcodeNames[op]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+func packetName(id byte) string {
+	if name, ok := packetNames[id]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// hexDump formats bytes as space-separated hex, e.g. "00 64 7f ff".
+func hexDump(b []byte) string {
+	var sb strings.Builder
+	for i, v := range b {
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+		fmt.Fprintf(&sb, "%02x", v)
+	}
+	return sb.String()
+}
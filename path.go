@@ -0,0 +1,396 @@
+package viamroomba
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// maxPathSegments bounds the size of a single execute_path request.
+const maxPathSegments = 100
+
+// pathSegment is one step of an execute_path request: a straight move of
+// StraightMM at Speed mm/s, an in-place spin of SpinDeg at Speed deg/s, or an
+// arc of ArcDeg around a center RadiusMM to the side at Speed mm/s.
+type pathSegment struct {
+	StraightMM float64
+	SpinDeg    float64
+	ArcDeg     float64
+	RadiusMM   float64
+	Speed      float64
+}
+
+// parsePath decodes the "segments" argument of execute_path.
+func parsePath(list []any) ([]pathSegment, error) {
+	if len(list) == 0 {
+		return nil, errors.New("segments must be a non-empty list")
+	}
+	if len(list) > maxPathSegments {
+		return nil, fmt.Errorf("segments may contain at most %d entries, got %d", maxPathSegments, len(list))
+	}
+	segments := make([]pathSegment, 0, len(list))
+	for i, item := range list {
+		m, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("segment %d must be an object", i)
+		}
+		speed, ok := m["speed"].(float64)
+		if !ok || speed <= 0 {
+			return nil, fmt.Errorf("segment %d: speed must be a positive number", i)
+		}
+		seg, err := parseSegment(m)
+		if err != nil {
+			return nil, fmt.Errorf("segment %d: %w", i, err)
+		}
+		segments = append(segments, seg)
+	}
+	return segments, nil
+}
+
+// parseSegment decodes a single segment object; move_arc uses it directly.
+func parseSegment(m map[string]any) (pathSegment, error) {
+	speed, ok := m["speed"].(float64)
+	if !ok || speed <= 0 {
+		return pathSegment{}, errors.New("speed must be a positive number")
+	}
+	straight, hasStraight := m["straight_mm"].(float64)
+	spin, hasSpin := m["spin_deg"].(float64)
+	arc, hasArc := m["arc_deg"].(float64)
+	kinds := 0
+	for _, has := range []bool{hasStraight, hasSpin, hasArc} {
+		if has {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return pathSegment{}, errors.New("must have exactly one of straight_mm, spin_deg, or arc_deg")
+	}
+	seg := pathSegment{StraightMM: straight, SpinDeg: spin, ArcDeg: arc, Speed: speed}
+	if hasArc {
+		radius, ok := m["radius_mm"].(float64)
+		// The Drive command's radius is limited to 2000mm; larger arcs are driven straight.
+		if !ok || radius < 1 || radius > 2000 {
+			return pathSegment{}, errors.New("radius_mm must be between 1 and 2000")
+		}
+		if speed > 500 {
+			return pathSegment{}, errors.New("speed must be at most 500 mm/s for an arc")
+		}
+		seg.RadiusMM = radius
+	}
+	return seg, nil
+}
+
+// pathProgress reports how far the most recent execute_path has got.
+type pathProgress struct {
+	mu       sync.Mutex
+	state    string // idle, running, complete, cancelled, or failed
+	segment  int
+	segments int
+	fraction float64 // progress through the current segment, 0 to 1
+	err      error
+}
+
+func (p *pathProgress) begin(segments int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.state, p.segment, p.segments, p.fraction, p.err = "running", 0, segments, 0, nil
+}
+
+func (p *pathProgress) advance(segment int, fraction float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.segment, p.fraction = segment, math.Min(1, fraction)
+}
+
+func (p *pathProgress) finish(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+	switch {
+	case err == nil:
+		p.state, p.segment, p.fraction = "complete", p.segments, 0
+	case errors.Is(err, context.Canceled):
+		p.state = "cancelled"
+	default:
+		p.state = "failed"
+	}
+}
+
+func (p *pathProgress) snapshot() map[string]any {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	state := p.state
+	if state == "" {
+		state = "idle"
+	}
+	status := map[string]any{
+		"state":            state,
+		"segment":          p.segment,
+		"segments":         p.segments,
+		"segment_progress": p.fraction,
+	}
+	if p.err != nil {
+		status["error"] = p.err.Error()
+	}
+	return status
+}
+
+// executePathArgs are the parameters of execute_path.
+type executePathArgs struct {
+	Segments []any `json:"segments" required:"true" doc:"Objects with speed and one of straight_mm, spin_deg, or arc_deg (with radius_mm)"`
+	motionArgs
+}
+
+// executePath runs an execute_path request. Like MoveStraight and Spin it
+// blocks unless non_blocking (or non_blocking_motion) is set, and it is
+// cancelled by Stop or by any newer motion.
+func (s *viamRoombaBase) executePath(ctx context.Context, args executePathArgs) (map[string]any, error) {
+	segments, err := parsePath(args.Segments)
+	if err != nil {
+		return nil, err
+	}
+	if s.strictLimits {
+		// Refuse an infeasible path before any of it is driven.
+		for i, seg := range segments {
+			if _, err := s.limit("speed", seg.Speed, 0, s.maxSegmentSpeed(seg)); err != nil {
+				return nil, fmt.Errorf("segment %d: %w", i, err)
+			}
+		}
+	}
+
+	begin := func() error {
+		s.path.begin(len(segments))
+		return nil
+	}
+	err = s.runMotion(ctx, args.extra(), "execute_path", begin, func(ctx context.Context) error {
+		err := s.runPath(ctx, segments)
+		s.path.finish(err)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.path.snapshot(), nil
+}
+
+// runPath drives each segment in turn and stops the base at the end, or as
+// soon as a segment fails or the path is cancelled.
+func (s *viamRoombaBase) runPath(ctx context.Context, segments []pathSegment) error {
+	for i, seg := range segments {
+		s.path.advance(i, 0)
+		if err := s.runSegment(ctx, seg, nil, func(fraction float64) { s.path.advance(i, fraction) }); err != nil {
+			s.stop(ctx, nil)
+			return fmt.Errorf("segment %d: %w", i, err)
+		}
+	}
+	return s.stop(ctx, nil)
+}
+
+// runSegment drives a single segment closed-loop: it polls odometry until
+// the robot has covered the requested distance or angle, reporting the
+// fraction covered to progress. A segment that takes more than twice its
+// nominal time (e.g. because the robot is stuck) fails rather than driving
+// forever. With a profile, a straight move or spin follows it instead of
+// driving at seg.Speed from start to finish.
+func (s *viamRoombaBase) runSegment(ctx context.Context, seg pathSegment, profile *trapezoid, progress func(float64)) error {
+	const pollInterval = 50 * time.Millisecond
+
+	var velocity, radius int16
+	var target, nominalSec float64
+	// toVelocity converts a profile speed to a Drive velocity for straight
+	// moves and spins.
+	var toVelocity func(speed float64) int16
+	// turn is the direction of rotation for segments measured by angle:
+	// 1 for counterclockwise (left), -1 for clockwise, 0 for straight moves.
+	var turn float64
+	switch {
+	case seg.ArcDeg != 0:
+		speed, err := s.limit("speed", seg.Speed, 0, s.maxVelocity)
+		if err != nil {
+			return err
+		}
+		// A positive Drive radius curves left when driving forward.
+		velocity = int16(math.Max(1, speed))
+		turn = math.Copysign(1, seg.ArcDeg)
+		radius = int16(turn * seg.RadiusMM)
+		target = math.Abs(seg.ArcDeg)
+		nominalSec = target * math.Pi / 180.0 * seg.RadiusMM / float64(velocity)
+	case seg.SpinDeg != 0:
+		speed, err := s.limit("speed", seg.Speed, 0, s.maxSegmentSpeed(seg))
+		if err != nil {
+			return err
+		}
+		toVelocity = func(speed float64) int16 {
+			// Wheel speed for the turn rate about the center of the axle.
+			wheelSpeed := speed * math.Pi / 180.0 * float64(s.widthMM) / 2.0
+			return int16(math.Max(1, math.Min(s.maxVelocity, wheelSpeed)))
+		}
+		velocity = toVelocity(speed)
+		turn = math.Copysign(1, seg.SpinDeg)
+		radius = int16(turn)
+		target = math.Abs(seg.SpinDeg)
+		nominalSec = target / speed
+	default:
+		if _, err := s.limit("speed", seg.Speed, 0, s.maxSegmentSpeed(seg)); err != nil {
+			return err
+		}
+		toVelocity = func(speed float64) int16 {
+			v := int16(math.Max(1, math.Min(s.maxVelocity, speed)))
+			if seg.StraightMM < 0 {
+				v = -min(v, s.maxReverseVelocity)
+			}
+			return v
+		}
+		velocity = toVelocity(seg.Speed)
+		radius = 32767
+		target = math.Abs(seg.StraightMM)
+		nominalSec = target / math.Abs(float64(velocity))
+	}
+	if target == 0 {
+		return nil
+	}
+	if profile != nil {
+		nominalSec += profile.extraSec()
+		velocity = toVelocity(profile.floor)
+	}
+	start := s.clk.Now()
+	deadline := s.clk.Now().Add(time.Duration((s.stuckFactor*nominalSec + 1) * float64(time.Second)))
+
+	if err := s.conn.mu.LockContext(ctx); err != nil {
+		return err
+	}
+	// Discard the deltas accumulated before this segment; they still reach the pose.
+	_, _, err := s.readOdometry()
+	if err == nil {
+		err = s.drive(velocity, radius)
+	}
+	s.conn.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	ticker := s.clk.Ticker(pollInterval)
+	defer ticker.Stop()
+
+	var covered float64
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.cancelCtx.Done():
+			return s.cancelCtx.Err()
+		}
+
+		if err := s.conn.mu.LockContext(ctx); err != nil {
+			return err
+		}
+		distance, angle, err := s.readOdometry()
+		s.conn.mu.Unlock()
+		if err != nil {
+			return fmt.Errorf("failed to read odometry: %w", err)
+		}
+		if turn != 0 {
+			covered += angle * turn
+		} else {
+			covered += distance * math.Copysign(1, float64(velocity))
+		}
+		progress(covered / target)
+		if covered >= target {
+			return nil
+		}
+		if profile != nil {
+			next := toVelocity(profile.speed(s.clk.Since(start).Seconds(), covered, target))
+			if next != velocity {
+				if err := s.conn.mu.LockContext(ctx); err != nil {
+					return err
+				}
+				err := s.drive(next, radius)
+				s.conn.mu.Unlock()
+				if err != nil {
+					return err
+				}
+				velocity = next
+			}
+		}
+		if s.clk.Now().After(deadline) {
+			s.conn.events.record("stuck", map[string]any{"covered": covered, "target": target})
+			return fmt.Errorf("timed out after covering %.0f of %.0f", covered, target)
+		}
+	}
+}
+
+// spinArc runs a Spin given extra["radius_mm"]: the robot turns angleDeg
+// around a center radiusMM to the side instead of in place, at degsPerSec
+// about that center, and stops once odometry says it has turned that far,
+// like a move_arc.
+func (s *viamRoombaBase) spinArc(ctx context.Context, angleDeg, degsPerSec float64, radius any, extra map[string]any) error {
+	radiusMM, ok := radius.(float64)
+	if !ok || radiusMM < 1 || radiusMM > 2000 {
+		return errors.New("extra radius_mm must be between 1 and 2000")
+	}
+	// The robot's center travels the arc at the turn rate times the radius.
+	mmPerDeg := math.Pi / 180.0 * radiusMM
+	rate, err := s.limit("degs_per_sec", math.Abs(degsPerSec), 0, s.maxVelocity/mmPerDeg)
+	if err != nil {
+		return err
+	}
+	seg, err := parseSegment(map[string]any{
+		"arc_deg":   angleDeg,
+		"radius_mm": radiusMM,
+		"speed":     rate * mmPerDeg,
+	})
+	if err != nil {
+		return err
+	}
+	s.logger.Debugf("Spin: arc of %.2f deg around a %.0fmm radius at %.2f deg/sec", angleDeg, radiusMM, rate)
+	return s.runMotion(ctx, extra, "spin", nil, func(ctx context.Context) error {
+		if err := s.runSegment(ctx, seg, nil, func(float64) {}); err != nil {
+			s.stop(ctx, extra)
+			return err
+		}
+		return s.stop(ctx, extra)
+	})
+}
+
+// moveArcArgs are the parameters of move_arc.
+type moveArcArgs struct {
+	AngleDeg float64 `json:"angle_deg" required:"true" doc:"Angle to turn; positive curves left"`
+	RadiusMM float64 `json:"radius_mm" required:"true" doc:"Arc radius, 1 to 2000"`
+	Speed    float64 `json:"speed" required:"true" doc:"Speed in mm/s, up to 500"`
+	motionArgs
+}
+
+// moveArc drives a single arc segment. It blocks, runs in the background, and
+// is cancelled exactly like MoveStraight and Spin.
+func (s *viamRoombaBase) moveArc(ctx context.Context, args moveArcArgs) (map[string]any, error) {
+	if args.AngleDeg == 0 {
+		return nil, errors.New("angle_deg must be a non-zero number")
+	}
+	seg, err := parseSegment(map[string]any{
+		"arc_deg":   args.AngleDeg,
+		"radius_mm": args.RadiusMM,
+		"speed":     args.Speed,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.runMotion(ctx, args.extra(), "move_arc", nil, func(ctx context.Context) error {
+		if err := s.runSegment(ctx, seg, nil, func(float64) {}); err != nil {
+			s.stop(ctx, nil)
+			return err
+		}
+		return s.stop(ctx, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if s.nonBlocking(args.extra()) {
+		return map[string]any{"status": "moving"}, nil
+	}
+	return map[string]any{"status": "complete"}, nil
+}
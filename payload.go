@@ -0,0 +1,30 @@
+package viamroomba
+
+const (
+	// maxPayloadKg is the most the Create 2 is rated to carry.
+	maxPayloadKg = 9.0
+	// fullPayloadDerate is the fraction of its top speed and default
+	// accelerations the robot keeps at maxPayloadKg. A tall payload tips
+	// when the robot stops short from full speed, and a heavy one stalls
+	// the motors accelerating.
+	fullPayloadDerate = 0.5
+	// payloadCurrentMAPerKg is how much the wheel current limit for carpet
+	// detection is raised per kg carried: a loaded robot draws more
+	// current on a hard floor.
+	payloadCurrentMAPerKg = 30
+)
+
+// payloadDerate returns the fraction of the robot's top speed and default
+// accelerations used with payloadKg aboard, falling linearly to
+// fullPayloadDerate at maxPayloadKg.
+func payloadDerate(payloadKg float64) float64 {
+	return 1 - (1-fullPayloadDerate)*payloadKg/maxPayloadKg
+}
+
+// payloadStuckFactor returns how many times its nominal time a closed-loop
+// segment may take before it is stuck: twice unloaded, rising to three
+// times at maxPayloadKg, since a loaded robot is slower up to speed and
+// slips more.
+func payloadStuckFactor(payloadKg float64) float64 {
+	return 2 + payloadKg/maxPayloadKg
+}
@@ -0,0 +1,63 @@
+package viamroomba
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// stateStore persists a component's long-lived statistics as a JSON file in
+// the module data directory ($VIAM_MODULE_DATA), so they survive viam-server
+// restarts and module upgrades. Without a data directory it does nothing.
+type stateStore struct {
+	path string
+}
+
+func newStateStore(name string) *stateStore {
+	dir := os.Getenv("VIAM_MODULE_DATA")
+	if dir == "" {
+		return &stateStore{}
+	}
+	return &stateStore{path: filepath.Join(dir, unsafeFileChars.ReplaceAllString(name, "_")+".json")}
+}
+
+// load decodes the saved state into v, leaving v untouched if nothing has
+// been saved yet.
+func (s *stateStore) load(v any) error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read saved state: %w", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse saved state %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// save writes v atomically, so a crash mid-write never leaves a torn file.
+func (s *stateStore) save(v any) error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
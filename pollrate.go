@@ -0,0 +1,25 @@
+package viamroomba
+
+// idlePollFactor is how many times less often background checks read the
+// robot while it rests (idle, or on its dock) than while it is doing
+// something, so a robot left charging overnight isn't queried every few
+// seconds for nothing.
+const idlePollFactor = 6
+
+// pollThrottle slows down a background check that ticks at the rate it
+// needs while the robot moves: while the robot rests, only every
+// idlePollFactor-th tick is due. The first tick after the robot starts doing
+// something is always due, so the check is back at its full rate at once.
+type pollThrottle struct {
+	skipped int
+}
+
+// due reports whether the check should read the robot on this tick.
+func (p *pollThrottle) due(a *activity) bool {
+	if !a.resting() || p.skipped >= idlePollFactor-1 {
+		p.skipped = 0
+		return true
+	}
+	p.skipped++
+	return false
+}
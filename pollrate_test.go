@@ -0,0 +1,52 @@
+package viamroomba
+
+import "testing"
+
+// TestPollThrottle checks which ticks a background check reads the robot
+// on as the robot rests, moves, and comes back to its dock.
+func TestPollThrottle(t *testing.T) {
+	var a activity
+	var p pollThrottle
+	ticks := func(n int) (due int) {
+		for range n {
+			if p.due(&a) {
+				due++
+			}
+		}
+		return due
+	}
+
+	if got := ticks(2 * idlePollFactor); got != 2 {
+		t.Errorf("idle: %d of %d ticks due, want 2", got, 2*idlePollFactor)
+	}
+
+	done := a.begin("move_straight")
+	if !p.due(&a) {
+		t.Error("the first tick after the robot started moving wasn't due")
+	}
+	if got := ticks(5); got != 5 {
+		t.Errorf("moving: %d of 5 ticks due, want 5", got)
+	}
+	done()
+	if got := ticks(idlePollFactor); got != 1 {
+		t.Errorf("idle again: %d of %d ticks due, want 1", got, idlePollFactor)
+	}
+
+	a.set("clean")
+	if got := ticks(3); got != 3 {
+		t.Errorf("cleaning: %d of 3 ticks due, want 3", got)
+	}
+	a.noteDocked(true)
+	if got := ticks(idlePollFactor); got != 1 {
+		t.Errorf("docked after cleaning: %d of %d ticks due, want 1", got, idlePollFactor)
+	}
+	a.noteDocked(false)
+	if !p.due(&a) {
+		t.Error("the first tick after the robot left its dock wasn't due")
+	}
+	a.noteDocked(true)
+	a.set("clean")
+	if a.resting() {
+		t.Error("a new cleaning cycle started from the dock counts as resting")
+	}
+}
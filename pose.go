@@ -0,0 +1,296 @@
+package viamroomba
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/golang/geo/r3"
+	geo "github.com/kellydunn/golang-geo"
+	"go.viam.com/rdk/components/base"
+	"go.viam.com/rdk/components/movementsensor"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/spatialmath"
+)
+
+const (
+	// poseRefreshInterval is how stale the pose may be before a call reads
+	// the odometry again. SLAM asks for the position and orientation back to
+	// back; this keeps that to one exchange with the robot.
+	poseRefreshInterval = 20 * time.Millisecond
+	// poseVelocityInterval is the shortest time between the samples that
+	// velocities are computed from, so they aren't dominated by the 1mm and
+	// 1° resolution of the odometry packets.
+	poseVelocityInterval = 100 * time.Millisecond
+	// defaultVelocityWindow is how far back velocities measured from the
+	// encoders look unless velocity_window_ms is set.
+	defaultVelocityWindow = 250 * time.Millisecond
+
+	// Wheel odometry error grows with travel. These are typical for a Roomba
+	// on hard floor and are reported as covariance hints in Accuracy.
+	positionDriftFraction = 0.02 // of distance travelled
+	headingDriftFraction  = 0.02 // of rotation
+	headingDriftPerMeter  = 1.0  // degrees per meter travelled
+)
+
+// PoseConfig configures the odometry movement sensor.
+type PoseConfig struct {
+	SerialPort       string `json:"serial_port,omitempty"`
+	Controller       string `json:"controller,omitempty"`
+	Base             string `json:"base,omitempty"`
+	VelocityWindowMS int    `json:"velocity_window_ms,omitempty"`
+}
+
+func (cfg *PoseConfig) Validate(path string) ([]string, []string, error) {
+	deps, err := validateConnection(cfg.SerialPort, cfg.Controller)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if cfg.VelocityWindowMS < 0 || cfg.VelocityWindowMS > 2000 {
+		return nil, nil, fmt.Errorf("%s: velocity_window_ms must be in [0, 2000]", path)
+	}
+	if cfg.Base != "" {
+		deps = append(deps, cfg.Base)
+	}
+	return deps, nil, nil
+}
+
+// poseSensor publishes the shared odometry pose as a movement sensor, in the
+// form SLAM services such as viam-cartographer take an odometer: a position
+// and an orientation relative to where the connection was opened.
+//
+// The odometry frame has +X along the robot's heading when the connection
+// was opened and +Y to its left. As a movement sensor that heading is north:
+// the position is a geo point offset from (0, 0) by the odometry x/y, the
+// orientation is a yaw about +Z (counterclockwise), and the compass heading
+// is clockwise from the starting heading.
+type poseSensor struct {
+	resource.AlwaysRebuild
+
+	name   resource.Name
+	logger logging.Logger
+	conn   *roombaConn
+
+	mu        sync.Mutex
+	refreshed time.Time
+	// The previous velocity sample and the velocities derived from it.
+	prevAt        time.Time
+	prevX, prevY  float64
+	prevThetaDeg  float64
+	linearMMs     float64
+	angularDegSec float64
+	// encoders measures the velocities from the wheel encoders instead,
+	// or is nil if the robot doesn't report them.
+	encoders *encoderVelocity
+}
+
+func newPoseSensor(ctx context.Context, deps resource.Dependencies, rawConf resource.Config, logger logging.Logger) (movementsensor.MovementSensor, error) {
+	conf, err := resource.NativeConfig[*PoseConfig](rawConf)
+	if err != nil {
+		return nil, err
+	}
+	serialPort, err := resolveSerialPort(deps, conf.SerialPort, conf.Controller)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := acquireConn(serialPort, 0, defaultOIProfile)
+	if err != nil {
+		return nil, err
+	}
+	logger.Infof("Roomba odometry movement sensor on %s", serialPort)
+	s := &poseSensor{
+		name:   rawConf.ResourceName(),
+		logger: logger,
+		conn:   conn,
+	}
+
+	if !conn.caps.hasPacket(43) {
+		logger.Infof("Robot does not report encoder counts (packets 43-44); velocities come from the change in pose")
+		return s, nil
+	}
+	// Like the sensor's wheel velocities, these use the base's dimensions
+	// if it has any, or the Roomba 650's.
+	widthMM, wheelCircumferenceMM := 235, 220
+	if conf.Base != "" {
+		b, err := base.FromProvider(deps, conf.Base)
+		if err != nil {
+			releaseConn(conn)
+			return nil, err
+		}
+		if rb, ok := b.(*viamRoombaBase); ok {
+			widthMM, wheelCircumferenceMM = rb.widthMM, rb.wheelCircumferenceMM
+		}
+	}
+	window := time.Duration(conf.VelocityWindowMS) * time.Millisecond
+	if window == 0 {
+		window = defaultVelocityWindow
+	}
+	s.encoders = newEncoderVelocity(widthMM, wheelCircumferenceMM, window)
+	return s, nil
+}
+
+func (s *poseSensor) Name() resource.Name {
+	return s.name
+}
+
+// pose brings the shared odometry up to date, unless it was read within
+// poseRefreshInterval, and returns it along with the velocities: measured
+// by the encoders, read in the same exchange, or if the robot has none,
+// from the change in pose. A failed read returns the error rather than a
+// stale pose.
+func (s *poseSensor) pose(ctx context.Context) (x, y, thetaDeg, linearMMs, angularDegSec float64, err error) {
+	defer RecoverToSafeState()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.refreshed) >= poseRefreshInterval {
+		if err := s.conn.mu.LockContext(ctx); err != nil {
+			return 0, 0, 0, 0, 0, err
+		}
+		var extra []byte
+		if s.encoders != nil {
+			extra = []byte{43, 44}
+		}
+		_, _, data, err := s.conn.readOdometryWith(extra)
+		s.conn.mu.Unlock()
+		if err != nil {
+			return 0, 0, 0, 0, 0, err
+		}
+		s.refreshed = now
+		if s.encoders != nil {
+			left := binary.BigEndian.Uint16(data[0])
+			right := binary.BigEndian.Uint16(data[1])
+			if linear, angular, ok := s.encoders.update(now, left, right); ok {
+				s.linearMMs, s.angularDegSec = linear, angular
+			}
+		}
+	}
+
+	x, y, thetaDeg = s.conn.odom.pose()
+	if s.encoders != nil {
+		return x, y, thetaDeg, s.linearMMs, s.angularDegSec, nil
+	}
+	// Velocities come from the change in the shared pose rather than the
+	// packet deltas, which other components on the port also consume.
+	if s.prevAt.IsZero() {
+		s.prevAt, s.prevX, s.prevY, s.prevThetaDeg = now, x, y, thetaDeg
+	} else if dt := now.Sub(s.prevAt).Seconds(); dt >= poseVelocityInterval.Seconds() {
+		dx, dy := x-s.prevX, y-s.prevY
+		// Forward travel is positive, reverse negative.
+		heading := s.prevThetaDeg * math.Pi / 180.0
+		s.linearMMs = (dx*math.Cos(heading) + dy*math.Sin(heading)) / dt
+		s.angularDegSec = math.Remainder(thetaDeg-s.prevThetaDeg, 360) / dt
+		s.prevAt, s.prevX, s.prevY, s.prevThetaDeg = now, x, y, thetaDeg
+	}
+	return x, y, thetaDeg, s.linearMMs, s.angularDegSec, nil
+}
+
+// Position returns the odometry position as a geo point north (odometry +X)
+// and west (odometry +Y) of (0, 0), at altitude 0.
+func (s *poseSensor) Position(ctx context.Context, extra map[string]any) (*geo.Point, float64, error) {
+	x, y, _, _, _, err := s.pose(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	// geo takes kilometers and a bearing clockwise from north.
+	distanceKM := math.Hypot(x, y) / 1e6
+	bearing := math.Atan2(-y, x) * 180.0 / math.Pi
+	return geo.NewPoint(0, 0).PointAtDistanceAndBearing(distanceKM, bearing), 0, nil
+}
+
+// Orientation returns the odometry heading as a counterclockwise yaw.
+func (s *poseSensor) Orientation(ctx context.Context, extra map[string]any) (spatialmath.Orientation, error) {
+	_, _, thetaDeg, _, _, err := s.pose(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &spatialmath.EulerAngles{Yaw: thetaDeg * math.Pi / 180.0}, nil
+}
+
+// CompassHeading returns the heading clockwise from the starting heading, in
+// [0, 360).
+func (s *poseSensor) CompassHeading(ctx context.Context, extra map[string]any) (float64, error) {
+	_, _, thetaDeg, _, _, err := s.pose(ctx)
+	if err != nil {
+		return 0, err
+	}
+	heading := math.Mod(-thetaDeg, 360)
+	if heading < 0 {
+		heading += 360
+	}
+	return heading, nil
+}
+
+// LinearVelocity returns the forward speed in m/s along the robot's +Y, as
+// Viam movement sensors report it.
+func (s *poseSensor) LinearVelocity(ctx context.Context, extra map[string]any) (r3.Vector, error) {
+	_, _, _, linearMMs, _, err := s.pose(ctx)
+	if err != nil {
+		return r3.Vector{}, err
+	}
+	return r3.Vector{Y: linearMMs / 1000.0}, nil
+}
+
+// AngularVelocity returns the turn rate in degrees per second about +Z,
+// counterclockwise positive.
+func (s *poseSensor) AngularVelocity(ctx context.Context, extra map[string]any) (spatialmath.AngularVelocity, error) {
+	_, _, _, _, angularDegSec, err := s.pose(ctx)
+	if err != nil {
+		return spatialmath.AngularVelocity{}, err
+	}
+	return spatialmath.AngularVelocity{Z: angularDegSec}, nil
+}
+
+func (s *poseSensor) LinearAcceleration(ctx context.Context, extra map[string]any) (r3.Vector, error) {
+	return r3.Vector{}, movementsensor.ErrMethodUnimplementedLinearAcceleration
+}
+
+func (s *poseSensor) Properties(ctx context.Context, extra map[string]any) (*movementsensor.Properties, error) {
+	return &movementsensor.Properties{
+		PositionSupported:        true,
+		OrientationSupported:     true,
+		CompassHeadingSupported:  true,
+		LinearVelocitySupported:  true,
+		AngularVelocitySupported: true,
+	}, nil
+}
+
+// Accuracy reports how far the odometry may have drifted since the
+// connection was opened, as standard deviations that grow with the distance
+// and rotation covered. SLAM can weigh the odometry against the lidar by
+// them. There is no GPS fix, so the GPS fields are unset.
+func (s *poseSensor) Accuracy(ctx context.Context, extra map[string]any) (*movementsensor.Accuracy, error) {
+	totals := s.conn.odom.totals()
+	positionStdMM := positionDriftFraction * totals.DistanceMM
+	headingStdDeg := headingDriftFraction*totals.RotationDeg + headingDriftPerMeter*totals.DistanceMM/1000.0
+	return &movementsensor.Accuracy{
+		AccuracyMap: map[string]float32{
+			"position_std_dev_mm":   float32(positionStdMM),
+			"heading_std_dev_deg":   float32(headingStdDeg),
+			"position_variance_m2":  float32(positionStdMM * positionStdMM / 1e6),
+			"heading_variance_rad2": float32(math.Pow(headingStdDeg*math.Pi/180.0, 2)),
+		},
+		Hdop:               float32(math.NaN()),
+		Vdop:               float32(math.NaN()),
+		NmeaFix:            -1,
+		CompassDegreeError: float32(headingStdDeg),
+	}, nil
+}
+
+func (s *poseSensor) Readings(ctx context.Context, extra map[string]any) (map[string]any, error) {
+	return movementsensor.DefaultAPIReadings(ctx, s, extra)
+}
+
+func (s *poseSensor) DoCommand(ctx context.Context, cmd map[string]any) (map[string]any, error) {
+	return nil, errUnimplemented
+}
+
+func (s *poseSensor) Close(ctx context.Context) error {
+	releaseConn(s.conn)
+	return nil
+}
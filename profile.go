@@ -0,0 +1,64 @@
+package viamroomba
+
+import (
+	"context"
+	"math"
+)
+
+const (
+	defaultLinearAccel  = 500.0 // mm/s²
+	defaultAngularAccel = 360.0 // deg/s²
+	// The profile never commands less than these, so the robot doesn't
+	// stall a few millimeters short of the target.
+	minProfileSpeedMMs  = 20.0
+	minProfileSpeedDegs = 10.0
+)
+
+// trapezoid is a trapezoidal speed profile: speed ramps up at accel from a
+// standstill, holds at cruise, and ramps down at accel so that it reaches
+// zero at the target, never dropping below floor. Units are mm or degrees.
+type trapezoid struct {
+	cruise float64
+	accel  float64
+	floor  float64
+}
+
+// speed returns the speed to command elapsedSec into the move with covered
+// of target behind it.
+func (p trapezoid) speed(elapsedSec, covered, target float64) float64 {
+	v := min(p.cruise, p.accel*elapsedSec, math.Sqrt(2*p.accel*max(0, target-covered)))
+	return min(p.cruise, max(v, p.floor))
+}
+
+// extraSec is how much longer the profile takes than moving at cruise the
+// whole way, for the stuck deadline.
+func (p trapezoid) extraSec() float64 {
+	return p.cruise / p.accel
+}
+
+// moveClosedLoop runs MoveStraight or Spin with closed_loop_motion: the
+// segment ends when odometry says it has been covered, rather than after
+// the time it should take, and speed follows a trapezoidal profile so the
+// robot doesn't overshoot by stopping from full speed.
+func (s *viamRoombaBase) moveClosedLoop(ctx context.Context, seg pathSegment, kind string, extra map[string]any) error {
+	s.logger.Debugf("%s: closed-loop segment %+v", kind, seg)
+	return s.runMotion(ctx, extra, kind, nil, func(ctx context.Context) error {
+		if err := s.runSegment(ctx, seg, s.profileFor(seg), func(float64) {}); err != nil {
+			s.stop(ctx, extra)
+			return err
+		}
+		return s.stop(ctx, extra)
+	})
+}
+
+// profileFor returns the profile MoveStraight or Spin drives a segment
+// with, or nil unless closed_loop_motion is enabled.
+func (s *viamRoombaBase) profileFor(seg pathSegment) *trapezoid {
+	if !s.closedLoopMotion {
+		return nil
+	}
+	if seg.SpinDeg != 0 {
+		return &trapezoid{cruise: seg.Speed, accel: s.angularAccel, floor: minProfileSpeedDegs}
+	}
+	return &trapezoid{cruise: seg.Speed, accel: s.linearAccel, floor: minProfileSpeedMMs}
+}
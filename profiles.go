@@ -0,0 +1,169 @@
+package viamroomba
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"go.viam.com/rdk/logging"
+)
+
+const (
+	// cleanWakeRun is how long the wake sequence lets the cleaning cycle it
+	// starts run before stopping it again: long enough for the robot to
+	// wake, too short for it to leave the dock.
+	cleanWakeRun = 500 * time.Millisecond
+	// reentryInterval is how soon after re-entering the OI the module will
+	// try again, so a robot that is really gone isn't woken in a loop.
+	reentryInterval = 10 * time.Second
+)
+
+// oiProfile is how a family of robots departs from the OI as the 500 and
+// 600 series and the Create 2 implement it.
+type oiProfile struct {
+	name string
+	// cleanWake sends the Clean button sequence before Start when opening
+	// the port: Wi-Fi Roombas ignore the OI while asleep, and their firmware
+	// only hands it over for a while after a cleaning command.
+	cleanWake bool
+	// reenter wakes the robot and starts the OI again when the robot's
+	// firmware takes it back (packet 35 reads Off) or the robot stops
+	// answering.
+	reenter bool
+}
+
+// defaultOIProfile is for the 500 and 600 series and the Create 2, and for
+// components that never open the port themselves.
+var defaultOIProfile = oiProfile{name: "default"}
+
+// oiProfiles lists the oi_profile values. Adding a family of robots with
+// the same quirks only needs a row here.
+var oiProfiles = map[string]oiProfile{
+	"":         defaultOIProfile,
+	"default":  defaultOIProfile,
+	"980":      {name: "980", cleanWake: true},
+	"i-series": {name: "i-series", cleanWake: true, reenter: true},
+}
+
+// lookupOIProfile returns the profile named by the oi_profile attribute.
+func lookupOIProfile(name string) (oiProfile, error) {
+	profile, ok := oiProfiles[name]
+	if !ok {
+		return oiProfile{}, fmt.Errorf("oi_profile must be one of default, 980, i-series, not %q", name)
+	}
+	return profile, nil
+}
+
+// validateOIProfile checks the oi_profile attribute.
+func validateOIProfile(name string) error {
+	_, err := lookupOIProfile(name)
+	return err
+}
+
+// writeCleanWake sends the wake sequence to w: Start, then Clean, as the
+// Clean button would, then Safe, which stops the cycle, once it has run
+// for cleanWakeRun. The robot is left in Safe mode for Start to put in
+// Passive.
+func writeCleanWake(w io.Writer) error {
+	for _, op := range []byte{opStart, opClean} {
+		if _, err := w.Write([]byte{op}); err != nil {
+			return err
+		}
+		time.Sleep(modeChangeSettle)
+	}
+	time.Sleep(cleanWakeRun)
+	if _, err := w.Write([]byte{opSafe}); err != nil {
+		return err
+	}
+	time.Sleep(modeChangeSettle)
+	return nil
+}
+
+// reenterOI wakes the robot and starts the OI again after its firmware took
+// the OI back or it stopped answering (cause, if not nil, says how), putting
+// it back in the mode it was in, and reports whether it did. It does
+// nothing unless the profile asks for it, the link is up, and it hasn't
+// just tried. Callers must hold c.mu.
+func (c *roombaConn) reenterOI(cause error) bool {
+	if !c.profile.reenter || errors.Is(cause, ErrNotConnected) || time.Since(c.lastReentry) < reentryInterval {
+		return false
+	}
+	c.lastReentry = time.Now()
+	reason := "the robot turned the OI off"
+	if cause != nil {
+		reason = fmt.Sprintf("the robot stopped answering (%v)", cause)
+	}
+	c.trace("re-entering the OI: %s", reason)
+
+	mode := c.mode
+	err := c.noteLinkFault(writeCleanWake(c.wire))
+	if err == nil {
+		err = c.rawWrite([]byte{opStart})
+	}
+	c.flushRx()
+	if err != nil {
+		c.trace("failed to re-enter the OI: %v", err)
+		return false
+	}
+	// Restore the mode without reporting a change, as after moving the
+	// port; the robot was only away for a moment.
+	c.mode = oiPassive
+	switch mode {
+	case oiSafe:
+		err = c.rawWrite([]byte{opSafe})
+	case oiFull:
+		err = c.rawWrite([]byte{opFull})
+	}
+	if err == nil && mode != oiOff {
+		c.mode = mode
+	}
+	c.events.record("oi_reentered", map[string]any{"reason": reason, "mode": c.mode.String()})
+	return err == nil
+}
+
+// profileWarnings describes the optional packets the robot doesn't answer,
+// so a user trying the module on a newer robot sees what is missing rather
+// than readings that silently aren't there.
+func (c *roombaConn) profileWarnings() []string {
+	if !c.caps.probed {
+		return nil
+	}
+	var missing []string
+	for name, ok := range c.caps.features() {
+		if !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	var packets []string
+	for _, id := range capabilityProbes {
+		if !c.caps.packets[id] {
+			packets = append(packets, fmt.Sprint(id))
+		}
+	}
+	warnings := []string{fmt.Sprintf("the robot (oi_profile %s) doesn't answer packets %s, so %s are unavailable; "+
+		"the sensor leaves out their readings", c.profile.name, strings.Join(packets, ", "), strings.Join(missing, ", "))}
+	if slices.Contains(missing, "drive_direct") {
+		warnings = append(warnings, "without Drive Direct, heading hold steers with Drive radii instead of wheel speeds")
+	}
+	return warnings
+}
+
+// warnProfile logs profileWarnings for a component configured with an
+// oi_profile other than the default, whose users are the ones likely to
+// find packets missing.
+func warnProfile(logger logging.Logger, conn *roombaConn, profile oiProfile) {
+	if profile.name == defaultOIProfile.name {
+		return
+	}
+	for _, w := range conn.profileWarnings() {
+		logger.Warn(w)
+	}
+}
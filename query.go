@@ -0,0 +1,90 @@
+package viamroomba
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// maxQueryPackets bounds how many packets one query_packets reads.
+const maxQueryPackets = 52
+
+// queryPacketsArgs are the parameters of query_packets.
+type queryPacketsArgs struct {
+	Packets []int `json:"packets" required:"true" doc:"Sensor packet IDs (7-58) to read, in order"`
+}
+
+// queryPackets serves query_packets: it reads any list of sensor packets
+// with one Query List and decodes each by the OI spec, so packets outside
+// Readings can be read without a new release. Distance and angle read this
+// way are fed to the shared odometry, so the pose doesn't lose them.
+func (s *viamRoombaSensor) queryPackets(ctx context.Context, args queryPacketsArgs) (map[string]any, error) {
+	if len(args.Packets) == 0 || len(args.Packets) > maxQueryPackets {
+		return nil, fmt.Errorf("packets must have 1 to %d entries", maxQueryPackets)
+	}
+	ids := make([]byte, len(args.Packets))
+	for i, id := range args.Packets {
+		switch {
+		case id >= 0 && id <= 6 || id >= 100 && id <= 107:
+			return nil, fmt.Errorf("packet %d is a group packet; list the packets it contains instead", id)
+		case id < 7 || id > 58:
+			return nil, fmt.Errorf("packet %d is not an OI sensor packet; they are 7 to 58", id)
+		case !s.conn.caps.hasPacket(byte(id)):
+			return nil, fmt.Errorf("this robot doesn't report packet %d (%s)", id, packetName(byte(id)))
+		}
+		ids[i] = byte(id)
+	}
+
+	if err := s.conn.mu.LockContext(ctx); err != nil {
+		return nil, err
+	}
+	data, err := s.conn.query(ids)
+	if err == nil && len(data) != len(ids) {
+		err = errors.New("short sensor response")
+	}
+	if err != nil {
+		s.conn.mu.Unlock()
+		return nil, fmt.Errorf("failed to query packets: %w", err)
+	}
+	distance, angle := 0, 0
+	for i, id := range ids {
+		switch id {
+		case 19:
+			distance = decodePacket(id, data[i])
+		case 20:
+			angle = decodePacket(id, data[i])
+		case 35:
+			s.conn.observeMode(data[i][0])
+		}
+	}
+	if distance != 0 || angle != 0 {
+		s.conn.odom.update(distance, angle)
+	}
+	s.conn.mu.Unlock()
+
+	packets := make([]any, 0, len(ids))
+	for i, id := range ids {
+		raw := make([]any, len(data[i]))
+		for j, b := range data[i] {
+			raw[j] = int(b)
+		}
+		packet := map[string]any{"id": int(id), "raw": raw}
+		if name, ok := packetNames[id]; ok {
+			packet["name"] = name
+			packet["value"] = decodePacket(id, data[i])
+		}
+		if unit, ok := packetUnits[id]; ok {
+			packet["unit"] = unit
+		}
+		switch id {
+		case 21:
+			if v := int(data[i][0]); v < len(chargingStates) {
+				packet["state"] = chargingStates[v]
+			}
+		case 35:
+			packet["state"] = oiMode(data[i][0]).String()
+		}
+		packets = append(packets, packet)
+	}
+	return map[string]any{"packets": packets}, nil
+}
@@ -0,0 +1,290 @@
+package viamroomba
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// quietHoursInterval is how often deferred cleaning checks whether quiet
+// hours have ended.
+const quietHoursInterval = 30 * time.Second
+
+// quietDays are the names quiet_hours ranges take in days, indexed by
+// time.Weekday.
+var quietDays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// QuietHoursConfig configures times of day when the base keeps quiet: event
+// songs and the reverse beep are silenced, cleaning is deferred until they
+// end (or refused), and motion can be capped to a low speed.
+type QuietHoursConfig struct {
+	Ranges      []QuietRange `json:"ranges"`
+	Timezone    string       `json:"timezone,omitempty"`
+	MaxSpeedMMs float64      `json:"max_speed_mm_s,omitempty"`
+	Cleaning    string       `json:"cleaning,omitempty"`
+}
+
+// QuietRange is one quiet period, from start to end ("HH:MM", 24-hour), on
+// the given days of the week (the day it starts), or every day if none. A
+// range that ends before it starts runs overnight.
+type QuietRange struct {
+	Start string   `json:"start"`
+	End   string   `json:"end"`
+	Days  []string `json:"days,omitempty"`
+}
+
+// validate checks the quiet_hours attribute.
+func (cfg *QuietHoursConfig) validate() error {
+	_, err := cfg.build()
+	return err
+}
+
+// build parses the quiet_hours attribute.
+func (cfg *QuietHoursConfig) build() (*quietHours, error) {
+	if len(cfg.Ranges) == 0 {
+		return nil, errors.New("quiet_hours.ranges needs at least one range")
+	}
+	q := &quietHours{loc: time.Local, deferCleaning: true}
+	if cfg.Timezone != "" {
+		loc, err := time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("quiet_hours.timezone: %w", err)
+		}
+		q.loc = loc
+	}
+	if cfg.MaxSpeedMMs < 0 || cfg.MaxSpeedMMs > 500 {
+		return nil, errors.New("quiet_hours.max_speed_mm_s must be in [0, 500]")
+	}
+	q.maxSpeed = int16(cfg.MaxSpeedMMs)
+	switch cfg.Cleaning {
+	case "", "defer":
+	case "refuse":
+		q.deferCleaning = false
+	default:
+		return nil, fmt.Errorf("quiet_hours.cleaning must be \"defer\" or \"refuse\", not %q", cfg.Cleaning)
+	}
+
+	for i, r := range cfg.Ranges {
+		var qr quietRange
+		var err error
+		if qr.start, err = parseClock(r.Start); err != nil {
+			return nil, fmt.Errorf("quiet_hours.ranges[%d].start: %w", i, err)
+		}
+		if qr.end, err = parseClock(r.End); err != nil {
+			return nil, fmt.Errorf("quiet_hours.ranges[%d].end: %w", i, err)
+		}
+		if qr.start == qr.end {
+			return nil, fmt.Errorf("quiet_hours.ranges[%d] starts and ends at the same time", i)
+		}
+		if len(r.Days) == 0 {
+			for d := range qr.days {
+				qr.days[d] = true
+			}
+		}
+		for _, day := range r.Days {
+			d := -1
+			for j, name := range quietDays {
+				if strings.EqualFold(day, name) {
+					d = j
+				}
+			}
+			if d < 0 {
+				return nil, fmt.Errorf("quiet_hours.ranges[%d].days: %q is not one of %s", i, day, strings.Join(quietDays, ", "))
+			}
+			qr.days[d] = true
+		}
+		q.ranges = append(q.ranges, qr)
+	}
+	return q, nil
+}
+
+// parseClock parses "HH:MM" into minutes after midnight.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a time of day like \"22:30\"", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// quietRange is a parsed QuietRange, in minutes after midnight.
+type quietRange struct {
+	start, end int
+	days       [7]bool
+}
+
+// endAfter returns when the range ends if t falls in it.
+func (r quietRange) endAfter(t time.Time) (time.Time, bool) {
+	minute := t.Hour()*60 + t.Minute()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	switch {
+	case r.start < r.end:
+		if r.days[t.Weekday()] && minute >= r.start && minute < r.end {
+			return day.Add(time.Duration(r.end) * time.Minute), true
+		}
+	case minute >= r.start:
+		if r.days[t.Weekday()] {
+			return day.AddDate(0, 0, 1).Add(time.Duration(r.end) * time.Minute), true
+		}
+	case minute < r.end:
+		if r.days[(t.Weekday()+6)%7] {
+			return day.Add(time.Duration(r.end) * time.Minute), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// quietHours is the base's parsed quiet_hours.
+type quietHours struct {
+	loc           *time.Location
+	ranges        []quietRange
+	maxSpeed      int16 // 0 for no cap
+	deferCleaning bool
+
+	mu sync.Mutex
+	// deferred is the cleaning command waiting for quiet hours to end, or
+	// nil.
+	deferred *deferredCleaning
+}
+
+// deferredCleaning is a clean, spot_clean, or max_clean held until quiet
+// hours end.
+type deferredCleaning struct {
+	opcode      byte
+	msg, status string
+	requested   time.Time
+}
+
+// until reports whether t is in quiet hours and, if so, when they end,
+// following ranges that run into each other.
+func (q *quietHours) until(t time.Time) (time.Time, bool) {
+	t = t.In(q.loc)
+	end, quiet := t, false
+	// Each pass moves past one range; a week's worth covers any chain.
+	for pass := 0; pass < 7*len(q.ranges)+1; pass++ {
+		next, ok := end, false
+		for _, r := range q.ranges {
+			if e, in := r.endAfter(end); in && e.After(next) {
+				next, ok = e, true
+			}
+		}
+		if !ok {
+			break
+		}
+		end, quiet = next, true
+	}
+	return end, quiet
+}
+
+// quiet reports whether quiet hours are in effect now. A base without
+// quiet_hours is never quiet.
+func (s *viamRoombaBase) quiet() bool {
+	if s.quietHours == nil {
+		return false
+	}
+	_, quiet := s.quietHours.until(time.Now())
+	return quiet
+}
+
+// quietClamp caps velocity to quiet_hours.max_speed_mm_s during quiet
+// hours, keeping its sign.
+func (s *viamRoombaBase) quietClamp(velocity int16) int16 {
+	if s.quietHours == nil || s.quietHours.maxSpeed == 0 || !s.quiet() {
+		return velocity
+	}
+	limit := s.quietHours.maxSpeed
+	return max(-limit, min(limit, velocity))
+}
+
+// checkQuietCleaning holds back a cleaning command during quiet hours: it
+// returns the response to send instead, deferring the command until quiet
+// hours end, or refuses it. It returns nil outside quiet hours.
+func (s *viamRoombaBase) checkQuietCleaning(opcode byte, msg, status string) (map[string]any, error) {
+	q := s.quietHours
+	if q == nil {
+		return nil, nil
+	}
+	end, quiet := q.until(time.Now())
+	if !quiet {
+		return nil, nil
+	}
+	if !q.deferCleaning {
+		return nil, fmt.Errorf("quiet hours until %s; cleaning is refused until then", end.Format("15:04"))
+	}
+	q.mu.Lock()
+	q.deferred = &deferredCleaning{opcode: opcode, msg: msg, status: status, requested: time.Now()}
+	q.mu.Unlock()
+	s.logger.Infof("Quiet hours until %s; %s deferred until then", end.Format("15:04"), opcodeName(opcode))
+	s.conn.events.record("cleaning_deferred", map[string]any{"command": status, "starts_at": end.Format(time.RFC3339)})
+	return map[string]any{"status": "deferred", "starts_at": end.Format(time.RFC3339)}, nil
+}
+
+// cancelDeferredCleaning drops a deferred cleaning command, as Stop does.
+func (s *viamRoombaBase) cancelDeferredCleaning() {
+	if s.quietHours == nil {
+		return
+	}
+	s.quietHours.mu.Lock()
+	defer s.quietHours.mu.Unlock()
+	if s.quietHours.deferred != nil {
+		s.logger.Infof("Deferred %s cancelled", opcodeName(s.quietHours.deferred.opcode))
+		s.quietHours.deferred = nil
+	}
+}
+
+// watchQuietHours starts a deferred cleaning command once quiet hours end,
+// until the base is closed.
+func (s *viamRoombaBase) watchQuietHours() {
+	ticker := s.clk.Ticker(quietHoursInterval)
+	defer ticker.Stop()
+	q := s.quietHours
+	for {
+		select {
+		case <-s.cancelCtx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		q.mu.Lock()
+		d := q.deferred
+		if d == nil || s.quiet() {
+			q.mu.Unlock()
+			continue
+		}
+		q.deferred = nil
+		q.mu.Unlock()
+
+		s.logger.Infof("Quiet hours over; starting the %s deferred at %s", opcodeName(d.opcode), d.requested.Format("15:04"))
+		if _, err := s.startCleaning(s.cancelCtx, d.opcode, d.msg, d.status); err != nil {
+			s.logger.Warnf("Failed to start deferred %s: %v", opcodeName(d.opcode), err)
+		}
+	}
+}
+
+// quietHoursSnapshot serves get_quiet_hours.
+func (s *viamRoombaBase) quietHoursSnapshot(context.Context, noArgs) (map[string]any, error) {
+	q := s.quietHours
+	if q == nil {
+		return map[string]any{"enabled": false}, nil
+	}
+	end, quiet := q.until(time.Now())
+	out := map[string]any{
+		"enabled": true,
+		"quiet":   quiet,
+	}
+	if quiet {
+		out["until"] = end.Format(time.RFC3339)
+	}
+	if q.maxSpeed > 0 {
+		out["max_speed_mm_s"] = q.maxSpeed
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if d := q.deferred; d != nil {
+		out["deferred_cleaning"] = d.status
+	}
+	return out, nil
+}
@@ -0,0 +1,175 @@
+package viamroomba
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	// maxTransactSteps, maxTransactBytes, and maxTransactSleep bound one
+	// transaction, so no caller holds the bus for long.
+	maxTransactSteps = 32
+	maxTransactBytes = 256
+	maxTransactSleep = 2 * time.Second
+)
+
+// transactStep is one step of a raw serial transaction: exactly one of
+// write, read, and sleep_ms.
+type transactStep struct {
+	Write   []int `json:"write,omitempty"`
+	Read    int   `json:"read,omitempty"`
+	SleepMS int   `json:"sleep_ms,omitempty"`
+}
+
+// transactArgs are the parameters of transact.
+type transactArgs struct {
+	Steps []transactStep `json:"steps" required:"true" doc:"Steps to run in order, each {\"write\": [bytes]}, {\"read\": <count>}, or {\"sleep_ms\": <ms>}"`
+}
+
+// transact serves transact: it runs a raw exchange with the robot while
+// holding the bus, so that nothing else on the port interleaves with it,
+// and returns what each read step received. Other modules use it to talk
+// to the robot through the shared connection instead of opening the port
+// a second time, which would corrupt both streams.
+func (c *roombaConn) transact(ctx context.Context, args transactArgs) (map[string]any, error) {
+	if len(args.Steps) == 0 || len(args.Steps) > maxTransactSteps {
+		return nil, fmt.Errorf("steps must have 1 to %d entries", maxTransactSteps)
+	}
+	var sleep time.Duration
+	for i, step := range args.Steps {
+		set := 0
+		for _, ok := range []bool{len(step.Write) > 0, step.Read > 0, step.SleepMS > 0} {
+			if ok {
+				set++
+			}
+		}
+		if set != 1 {
+			return nil, fmt.Errorf("step %d: exactly one of write, read, or sleep_ms must be set", i)
+		}
+		if len(step.Write) > maxTransactBytes || step.Read > maxTransactBytes {
+			return nil, fmt.Errorf("step %d: at most %d bytes may be written or read at once", i, maxTransactBytes)
+		}
+		for _, b := range step.Write {
+			if b < 0 || b > 255 {
+				return nil, fmt.Errorf("step %d: byte %d is out of range [0, 255]", i, b)
+			}
+		}
+		if len(step.Write) > 0 && step.Write[0] == opFull {
+			return nil, fmt.Errorf("step %d: Full mode turns off the robot's cliff and wheel drop safety; "+
+				"use the base's enter_full_mode", i)
+		}
+		if step.Read > 0 && !canTimeoutReads {
+			return nil, errors.New("read steps need serial reads that can time out, which is only supported on Linux")
+		}
+		sleep += time.Duration(step.SleepMS) * time.Millisecond
+	}
+	if sleep > maxTransactSleep {
+		return nil, fmt.Errorf("sleep_ms may total at most %d", maxTransactSleep.Milliseconds())
+	}
+
+	if err := c.mu.LockContext(ctx); err != nil {
+		return nil, err
+	}
+	defer c.mu.Unlock()
+	if err := c.checkLink(); err != nil {
+		return nil, err
+	}
+	// Drop anything left over from before, so reads see only the replies
+	// to this transaction.
+	c.flushRx()
+
+	reads := []any{}
+	modeChanged := false
+	for i, step := range args.Steps {
+		switch {
+		case len(step.Write) > 0:
+			data := make([]byte, len(step.Write))
+			for j, b := range step.Write {
+				data[j] = byte(b)
+			}
+			if err := c.rawWrite(data); err != nil {
+				return nil, fmt.Errorf("step %d: %w", i, err)
+			}
+			switch data[0] {
+			case opStart, opSafe, opPower, opSpot, opClean, opMax, opSeekDock:
+				modeChanged = true
+			}
+		case step.Read > 0:
+			data, err := c.rawRead(step.Read)
+			if err != nil {
+				c.flushRx()
+				return nil, fmt.Errorf("step %d: %w", i, err)
+			}
+			values := make([]any, len(data))
+			for j, b := range data {
+				values[j] = int(b)
+			}
+			reads = append(reads, values)
+		default:
+			select {
+			case <-time.After(time.Duration(step.SleepMS) * time.Millisecond):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	// A mode or cleaning command changes the OI mode behind the module's
+	// back; read it so every component on the port agrees on it again. The
+	// caller asked for the change, so it is adopted rather than reported
+	// as a mismatch.
+	if modeChanged {
+		data, err := c.sensor(35)
+		switch {
+		case err != nil:
+			c.trace("failed to read the OI mode after a raw transaction: %v", err)
+		case int(data[0]) < len(oiModes):
+			c.modeReadAt = time.Now()
+			c.noteMode(oiMode(data[0]))
+		}
+	}
+	return map[string]any{"reads": reads, "mode": c.mode.String()}, nil
+}
+
+// rawWrite sends bytes as they are, spacing them from the previous command
+// like write. Callers must hold c.mu.
+func (c *roombaConn) rawWrite(data []byte) error {
+	c.pace(false)
+	if len(c.tracers) > 0 {
+		c.trace("serial TX raw: %s", hexDump(data))
+	}
+	start := time.Now()
+	_, err := c.wire.Write(data)
+	c.metrics.recordCommand("write", time.Since(start))
+	if err != nil {
+		c.trace("serial TX error: %v", err)
+	}
+	gap := minCommandGap
+	switch data[0] {
+	case opStart, opSafe, opSpot, opClean, opMax, opSeekDock, opPower:
+		gap = modeChangeSettle
+	}
+	c.readyAt = time.Now().Add(gap)
+	c.lastCommand = time.Now()
+	return c.noteLinkFault(err)
+}
+
+// rawRead reads exactly n bytes, failing if they don't all arrive before
+// the port's read timeout. Callers must hold c.mu.
+func (c *roombaConn) rawRead(n int) ([]byte, error) {
+	buf := make([]byte, n)
+	got, err := io.ReadFull(c.wire, buf)
+	if len(c.tracers) > 0 {
+		c.trace("serial RX raw: %s", hexDump(buf[:got]))
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, fmt.Errorf("timed out after reading %d of %d bytes", got, n)
+	}
+	if err != nil {
+		return nil, c.noteLinkFault(err)
+	}
+	return buf, nil
+}
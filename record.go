@@ -0,0 +1,244 @@
+package viamroomba
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/geo/r3"
+)
+
+const (
+	// maxRouteSteps and maxRouteDuration bound one recording, which is
+	// ended automatically when it reaches either.
+	maxRouteSteps    = 10000
+	maxRouteDuration = 30 * time.Minute
+	// replayInterval is how often a replay checks the robot's bumpers,
+	// wheel drops, and cliff sensors, and sends the commands that are due.
+	replayInterval = 50 * time.Millisecond
+)
+
+// routeStep is one recorded velocity command, offsetSec after the
+// recording started.
+type routeStep struct {
+	OffsetSec  float64 `json:"offset_sec"`
+	LinearMMs  float64 `json:"linear_mm_s"`
+	AngularDeg float64 `json:"angular_deg_s"`
+}
+
+// routeState is what the base persists: its recorded routes by name.
+type routeState struct {
+	Routes map[string][]routeStep `json:"routes"`
+}
+
+// routeRecorder captures the timed SetVelocity and SetPower commands of a
+// teleop session, and Stop, so the route can be driven again by replay.
+// Recordings are kept in the module data directory.
+type routeRecorder struct {
+	store *stateStore
+
+	mu        sync.Mutex
+	name      string // the recording in progress, or "" if none
+	started   time.Time
+	steps     []routeStep
+	routes    map[string][]routeStep
+	overflown bool
+}
+
+func newRouteRecorder(store *stateStore) (*routeRecorder, error) {
+	var saved routeState
+	if err := store.load(&saved); err != nil {
+		return nil, err
+	}
+	if saved.Routes == nil {
+		saved.Routes = map[string][]routeStep{}
+	}
+	return &routeRecorder{store: store, routes: saved.Routes}, nil
+}
+
+// record adds a velocity command to the recording in progress, if any.
+func (r *routeRecorder) record(now time.Time, linear, angular float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.name == "" || r.overflown {
+		return
+	}
+	offset := now.Sub(r.started)
+	if len(r.steps) >= maxRouteSteps || offset > maxRouteDuration {
+		// Keep what fits; stop_recording ends the route with a stop there.
+		r.overflown = true
+		return
+	}
+	r.steps = append(r.steps, routeStep{OffsetSec: offset.Seconds(), LinearMMs: linear, AngularDeg: angular})
+}
+
+// startRecordingArgs are the parameters of start_recording.
+type startRecordingArgs struct {
+	Name string `json:"name" required:"true" doc:"Name to save the route under; an existing route of that name is replaced"`
+}
+
+func (r *routeRecorder) start(_ context.Context, args startRecordingArgs) (map[string]any, error) {
+	if args.Name == "" {
+		return nil, errors.New("name must be a non-empty string")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.name != "" {
+		return nil, fmt.Errorf("already recording %q; send stop_recording first", r.name)
+	}
+	r.name, r.started, r.steps, r.overflown = args.Name, time.Now(), nil, false
+	return map[string]any{"status": "recording", "name": args.Name}, nil
+}
+
+// stop ends the recording in progress and saves it. The route ends with a
+// stop at the time stop_recording was sent (or the limit was reached), so
+// replaying it lasts as long as the session did.
+func (r *routeRecorder) stop(context.Context, noArgs) (map[string]any, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.name == "" {
+		return nil, errors.New("not recording")
+	}
+	end := min(time.Since(r.started), maxRouteDuration).Seconds()
+	if r.overflown && len(r.steps) > 0 {
+		end = r.steps[len(r.steps)-1].OffsetSec
+	}
+	steps := append(r.steps, routeStep{OffsetSec: end})
+	name := r.name
+	r.name, r.steps = "", nil
+	r.routes[name] = steps
+	if err := r.store.save(routeState{Routes: r.routes}); err != nil {
+		return nil, fmt.Errorf("recorded %q but failed to save it: %w", name, err)
+	}
+	return map[string]any{
+		"name":         name,
+		"commands":     len(steps) - 1,
+		"duration_sec": end,
+		"truncated":    r.overflown,
+	}, nil
+}
+
+// list serves list_recordings.
+func (r *routeRecorder) list(context.Context, noArgs) (map[string]any, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.routes))
+	for name := range r.routes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	routes := make([]any, 0, len(names))
+	for _, name := range names {
+		steps := r.routes[name]
+		routes = append(routes, map[string]any{
+			"name":         name,
+			"commands":     len(steps) - 1,
+			"duration_sec": steps[len(steps)-1].OffsetSec,
+		})
+	}
+	status := map[string]any{"routes": routes}
+	if r.name != "" {
+		status["recording"] = r.name
+	}
+	return status, nil
+}
+
+// route returns a saved route.
+func (r *routeRecorder) route(name string) ([]routeStep, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	steps, ok := r.routes[name]
+	return steps, ok
+}
+
+// replayArgs are the parameters of replay.
+type replayArgs struct {
+	Name string `json:"name" required:"true" doc:"Route to drive, as saved by stop_recording"`
+	motionArgs
+}
+
+// replay drives a recorded route again, sending each velocity command at
+// the time it was recorded. It blocks, runs in the background, and is
+// cancelled like MoveStraight. Throughout, it watches the bumpers, wheel
+// drops, and cliff sensors, and stops with an error on any contact, since
+// the world may have changed since the route was recorded.
+func (s *viamRoombaBase) replay(ctx context.Context, args replayArgs) (map[string]any, error) {
+	steps, ok := s.routes.route(args.Name)
+	if !ok {
+		return nil, fmt.Errorf("no recorded route named %q", args.Name)
+	}
+	err := s.runMotion(ctx, args.extra(), "replay", nil, func(ctx context.Context) error {
+		err := s.runReplay(ctx, steps)
+		s.stop(ctx, nil)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if s.nonBlocking(args.extra()) {
+		return map[string]any{"status": "replaying"}, nil
+	}
+	return map[string]any{"status": "complete"}, nil
+}
+
+func (s *viamRoombaBase) runReplay(ctx context.Context, steps []routeStep) error {
+	ticker := s.clk.Ticker(replayInterval)
+	defer ticker.Stop()
+	start := s.clk.Now()
+	next := 0
+	for next < len(steps) {
+		if err := s.conn.mu.LockContext(ctx); err != nil {
+			return err
+		}
+		if err := s.replayContact(); err != nil {
+			s.conn.mu.Unlock()
+			return err
+		}
+		for ; next < len(steps) && s.clk.Since(start).Seconds() >= steps[next].OffsetSec; next++ {
+			step := steps[next]
+			if _, _, err := s.setVelocity(r3.Vector{Y: step.LinearMMs}, r3.Vector{Z: step.AngularDeg}); err != nil {
+				s.conn.mu.Unlock()
+				return fmt.Errorf("replay stopped at %.1fs: %w", step.OffsetSec, err)
+			}
+		}
+		s.conn.mu.Unlock()
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.cancelCtx.Done():
+			return s.cancelCtx.Err()
+		}
+	}
+	return nil
+}
+
+// replayContact reads the bumpers and wheel drops (packet 7) and the cliff
+// sensors (packets 9-12) and returns an error naming the first one
+// triggered. A failed read is skipped, as for the reflexes. Callers must
+// hold s.conn.mu.
+func (s *viamRoombaBase) replayContact() error {
+	data, err := s.conn.query([]byte{7, 9, 10, 11, 12})
+	if err != nil {
+		s.logger.Debugf("Replay failed to read the bumpers and cliff sensors: %v", err)
+		return nil
+	}
+	for i, name := range cliffReadings {
+		if data[1+i][0]&0x01 != 0 {
+			return fmt.Errorf("replay stopped: %s detected a cliff", name)
+		}
+	}
+	for _, c := range []struct {
+		bit  byte
+		name string
+	}{{0x01, "bump_right"}, {0x02, "bump_left"}, {0x04, "wheel_drop_right"}, {0x08, "wheel_drop_left"}} {
+		if data[0][0]&c.bit != 0 {
+			return fmt.Errorf("replay stopped: %s triggered", c.name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package viamroomba
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	// reflexInterval is how often the reflexes read the cliff sensors and
+	// bumpers during forward motion.
+	reflexInterval = 50 * time.Millisecond
+	// reflexSpeed is the wheel speed (mm/s) of the back-off and the turn.
+	reflexSpeed = 100
+)
+
+// reflexManeuvers are how far each reflex reverses and then turns away from
+// the side the contact was on. A bump only needs to clear the bumper; a
+// cliff needs the front caster well clear of the edge.
+var reflexManeuvers = map[string]struct {
+	backOffMM float64
+	turnDeg   float64
+}{
+	"cliff": {backOffMM: 50, turnDeg: 45},
+	"bump":  {backOffMM: 30, turnDeg: 20},
+}
+
+// cliffReadings names the cliff sensors in packet order (9-12).
+var cliffReadings = []string{"cliff_left", "cliff_front_left", "cliff_front_right", "cliff_right"}
+
+// reflexError ends a motion that a reflex cut short.
+type reflexError struct {
+	kind   string // cliff or bump
+	sensor string
+}
+
+func (e *reflexError) Error() string {
+	return fmt.Sprintf("%s detected by %s during forward motion", e.kind, e.sensor)
+}
+
+// reflexes reports whether any reflex is enabled.
+func (s *viamRoombaBase) reflexes() bool {
+	return s.cliffReflex || s.bumpReflex
+}
+
+// withReflexes wraps a motion so that the cliff sensors and bumpers are
+// watched while it drives forward. If one triggers, the motion is
+// cancelled, the robot backs off and turns away, and the contact is
+// returned as the motion's error.
+func (s *viamRoombaBase) withReflexes(run func(context.Context) error) func(context.Context) error {
+	return func(ctx context.Context) error {
+		motionCtx, trip := context.WithCancelCause(ctx)
+		defer trip(nil)
+		goSafe(func() { s.watchReflexes(motionCtx, trip) })
+
+		err := run(motionCtx)
+		var reflex *reflexError
+		if !errors.As(context.Cause(motionCtx), &reflex) {
+			return err
+		}
+		s.logger.Warnf("Reflex: %v; backing off", reflex)
+		s.conn.events.record(reflex.kind+"_reflex", map[string]any{"sensor": reflex.sensor})
+		if err := s.backOff(ctx, reflex); err != nil {
+			return fmt.Errorf("%w; backing off failed: %v", reflex, err)
+		}
+		return reflex
+	}
+}
+
+// watchReflexes polls the enabled reflexes' sensors while the base is
+// driving forward and trips the motion on the first contact. It returns
+// when ctx is done.
+func (s *viamRoombaBase) watchReflexes(ctx context.Context, trip context.CancelCauseFunc) {
+	ticker := s.clk.Ticker(reflexInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		if err := s.conn.mu.LockContext(ctx); err != nil {
+			return
+		}
+		var reflex *reflexError
+		if s.forward {
+			reflex = s.contact()
+		}
+		s.conn.mu.Unlock()
+		if reflex != nil {
+			trip(reflex)
+			return
+		}
+	}
+}
+
+// contact reads the bumpers (packet 7) and cliff sensors (packets 9-12) of
+// the enabled reflexes and returns the first contact, or nil. Cliffs win
+// over bumps. A failed read is skipped rather than treated as a contact,
+// since the robot's own protection still applies in Safe mode. A bump is
+// added to the obstacle memory. Callers must hold s.conn.mu.
+func (s *viamRoombaBase) contact() *reflexError {
+	data, err := s.conn.query([]byte{7, 9, 10, 11, 12})
+	if err != nil {
+		s.logger.Debugf("Reflexes failed to read the cliff sensors and bumpers: %v", err)
+		return nil
+	}
+	if s.cliffReflex {
+		for i, name := range cliffReadings {
+			if data[1+i][0]&0x01 != 0 {
+				return &reflexError{kind: "cliff", sensor: name}
+			}
+		}
+	}
+	if !s.bumpReflex {
+		return nil
+	}
+	sensor := ""
+	switch bumps := data[0][0]; {
+	case bumps&0x02 != 0:
+		sensor = "bump_left"
+	case bumps&0x01 != 0:
+		sensor = "bump_right"
+	default:
+		return nil
+	}
+	// Bring the pose up to date so the bump is remembered where it happened.
+	if _, _, err := s.conn.readOdometry(); err != nil {
+		s.logger.Debugf("Failed to read odometry for the obstacle memory: %v", err)
+	}
+	x, y, heading := s.conn.odom.pose()
+	x, y = defaultSensorOffsets[sensor].toOdometryFrame(x, y, heading)
+	s.conn.obstacles.record(sensor, x, y, time.Now())
+	return &reflexError{kind: "bump", sensor: sensor}
+}
+
+// backOff reverses and turns away from the side of the contact, as set by
+// reflexManeuvers, then stops. In Safe mode the robot stops by itself at a
+// cliff and drops to Passive, so it is put back in Safe first. A new
+// command cancelling ctx cuts the maneuver short.
+func (s *viamRoombaBase) backOff(ctx context.Context, reflex *reflexError) error {
+	if err := s.conn.mu.LockContext(ctx); err != nil {
+		return err
+	}
+	mode, err := s.conn.syncMode()
+	if err == nil && mode == oiPassive {
+		err = s.conn.setMode(oiSafe)
+	}
+	s.conn.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// Turn clockwise away from a contact on the left, and vice versa.
+	turn := int16(-1)
+	if reflex.sensor == "cliff_front_right" || reflex.sensor == "cliff_right" || reflex.sensor == "bump_right" {
+		turn = 1
+	}
+	maneuver := reflexManeuvers[reflex.kind]
+	reverse := min(reflexSpeed, s.maxReverseVelocity)
+	turnSec := maneuver.turnDeg * math.Pi / 180.0 * float64(s.widthMM) / 2.0 / reflexSpeed
+	steps := []struct {
+		velocity, radius int16
+		d                time.Duration
+	}{
+		{-reverse, 32767, time.Duration(maneuver.backOffMM / float64(reverse) * float64(time.Second))},
+		{reflexSpeed, turn, time.Duration(turnSec * float64(time.Second))},
+	}
+
+	for _, step := range steps {
+		if err := s.conn.mu.LockContext(ctx); err != nil {
+			return err
+		}
+		err := s.drive(step.velocity, step.radius)
+		s.conn.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		timer := s.clk.Timer(step.d)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+
+	if err := s.conn.mu.LockContext(ctx); err != nil {
+		return err
+	}
+	defer s.conn.mu.Unlock()
+	return s.conn.stop()
+}
@@ -0,0 +1,103 @@
+package viamroomba
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// resyncQuiet is how long resync waits for bytes still in flight to
+	// arrive before flushing them.
+	resyncQuiet = 50 * time.Millisecond
+	// resyncAttempts bounds how many times resync tries to read back the
+	// known value before giving up.
+	resyncAttempts = 3
+)
+
+// syncProbe is what resync reads back: the OI mode twice, by Query List.
+// A response still out of step is vanishingly unlikely to be two equal
+// bytes that are both valid modes.
+var syncProbe = []byte{35, 35}
+
+// resync brings the byte stream back in step with the robot after a
+// corrupt or unanswered response, which leaves stray bytes that would
+// shift every later answer, as happens after a cable is pulled and pushed
+// back in. It pauses any stream the robot is sending (a program that had
+// the port before, or the robot itself after a glitch, may have left one
+// running; Pause Stream is harmless when none is), waits for bytes in
+// flight and flushes them, and reads back the OI mode until it is what a
+// synced response looks like. Until it succeeds, every read resyncs first
+// instead of returning data that can't be trusted. Callers must hold c.mu.
+func (c *roombaConn) resync() error {
+	if err := c.checkLink(); err != nil {
+		return err
+	}
+	c.metrics.mu.Lock()
+	c.metrics.resyncs++
+	c.metrics.mu.Unlock()
+
+	// The probe is short, so a robot that doesn't answer at all costs a
+	// fraction of a second per attempt rather than the normal read timeout.
+	c.setReadTimeout(probeReadTimeout)
+	defer c.setReadTimeout(2 * time.Second)
+	var lastErr error
+	for attempt := 0; attempt < resyncAttempts; attempt++ {
+		if err := c.rawWrite([]byte{opPauseStream, 0}); err != nil {
+			return err
+		}
+		time.Sleep(resyncQuiet)
+		c.flushRx()
+		data, err := c.queryOnce(syncProbe, nil)
+		if errors.Is(err, ErrNotConnected) {
+			return err
+		}
+		if err == nil {
+			err = checkSyncProbe(data)
+		}
+		if err != nil {
+			c.trace("serial resync attempt %d failed: %v", attempt+1, err)
+			lastErr = err
+			continue
+		}
+		c.desynced = false
+		c.trace("serial stream resynchronized")
+		c.observeMode(data[0][0])
+		return nil
+	}
+	c.desynced = true
+	c.metrics.mu.Lock()
+	c.metrics.resyncFailures++
+	c.metrics.mu.Unlock()
+	return fmt.Errorf("lost sync with the robot and couldn't recover it after %d attempts: %w", resyncAttempts, lastErr)
+}
+
+// checkSyncProbe checks the response to syncProbe.
+func checkSyncProbe(data [][]byte) error {
+	if err := validateResponse(syncProbe, data); err != nil {
+		return err
+	}
+	if data[0][0] != data[1][0] {
+		return fmt.Errorf("OI mode read back as %d and %d", data[0][0], data[1][0])
+	}
+	return nil
+}
+
+// checkSync resyncs before a read if an earlier one left the stream out of
+// step. Callers must hold c.mu.
+func (c *roombaConn) checkSync() error {
+	if !c.desynced {
+		return nil
+	}
+	return c.resync()
+}
+
+// noteReadError marks the stream out of step after a read that failed
+// other than by the link going down: a reply that timed out part way may
+// still arrive and be taken for the next one. Callers must hold c.mu.
+func (c *roombaConn) noteReadError(err error) error {
+	if err != nil && !errors.Is(err, ErrNotConnected) {
+		c.desynced = true
+	}
+	return err
+}
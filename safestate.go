@@ -0,0 +1,109 @@
+package viamroomba
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// safeStateWait is how long the safe-state handler waits for the exchange
+// in flight on a port, or for the connection list, before giving up on the
+// lock: the goroutine that panicked may be holding it.
+const safeStateWait = 100 * time.Millisecond
+
+// stopBytes is a Drive command with zero velocity.
+var stopBytes = []byte{opDrive, 0, 0, 0, 0}
+
+// RecoverToSafeState, deferred at the top of a goroutine or of an RPC that
+// talks to the robot, stops every robot the module has open and puts it in
+// Passive mode if it panics, then lets the panic carry on. A panic in an
+// RPC may be recovered by the gRPC server and leave the module running, so
+// the robots must be made safe before it gets there. Without it a panic
+// mid-MoveStraight leaves the robot driving into a wall, since the OI keeps
+// executing the last Drive command until told otherwise. Only the outermost
+// call defers it; what that call runs uses unexported variants (stop rather
+// than Stop), so a panic stops the robots once.
+func RecoverToSafeState() {
+	if r := recover(); r != nil {
+		enterSafeState(true)
+		panic(r)
+	}
+}
+
+// StopOnSignal stops every robot the module has open as soon as the module
+// is told to shut down (SIGINT or SIGTERM), before the orderly teardown
+// that runs each component's on_close, so a teardown that hangs or is cut
+// short by SIGKILL doesn't leave a robot driving.
+func StopOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		enterSafeState(false)
+	}()
+}
+
+// goSafe runs fn in a new goroutine that puts the robots in a safe state if
+// it panics.
+func goSafe(fn func()) {
+	go func() {
+		defer RecoverToSafeState()
+		fn()
+	}()
+}
+
+// enterSafeState stops the wheels of every robot with an open connection
+// and, if passive, puts it in Passive mode.
+func enterSafeState(passive bool) {
+	for _, c := range openConns() {
+		c.writeSafeState(passive)
+	}
+}
+
+// openConns returns the open connections, or none if the list stays
+// locked for safeStateWait.
+func openConns() []*roombaConn {
+	deadline := time.Now().Add(safeStateWait)
+	for !globalMu.TryLock() {
+		if time.Now().After(deadline) {
+			return nil
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	defer globalMu.Unlock()
+	conns := make([]*roombaConn, 0, len(connections))
+	for _, c := range connections {
+		conns = append(conns, c)
+	}
+	return conns
+}
+
+// writeSafeState writes Stop and, if passive, Start (which leaves the OI
+// in Passive mode) straight to the port. It waits up to safeStateWait for
+// the exchange in flight, then writes anyway: a command interleaved with
+// a half-written one is a smaller risk than a robot left driving. Without
+// mu it reads only what is safe to read without it (link.down and
+// safeWire), and writes to the raw port rather than through wire, whose
+// counters and fault belong to the exchange in flight.
+func (c *roombaConn) writeSafeState(passive bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), safeStateWait)
+	defer cancel()
+	var w io.Writer
+	if err := c.mu.LockContext(ctx); err == nil {
+		defer c.mu.Unlock()
+		w = c.wire
+	} else if wire := c.safeWire.Load(); wire != nil {
+		w = wire.rw
+	}
+	if w == nil || c.link.down.Load() {
+		return
+	}
+	w.Write(stopBytes)
+	if passive {
+		time.Sleep(minCommandGap)
+		w.Write([]byte{opStart})
+	}
+}
@@ -0,0 +1,50 @@
+package viamroomba
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/benbjohnson/clock"
+	"github.com/golang/geo/r3"
+)
+
+// TestWriteSafeState checks that the safe-state handler stops a driving
+// robot and puts it in Passive mode, even when the bus stays held, and
+// leaves a robot whose link is down alone.
+func TestWriteSafeState(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		held     bool
+		linkDown bool
+		want     []byte
+	}{
+		{name: "bus free", want: []byte{opDrive, opStart}},
+		{name: "bus held", held: true, want: []byte{opDrive, opStart}},
+		{name: "link down", linkDown: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, robot := baseOnFakeRobot(t, clock.New())
+			if err := s.SetVelocity(context.Background(), r3.Vector{Y: 200}, r3.Vector{}, nil); err != nil {
+				t.Fatal(err)
+			}
+			before := len(robot.opcodes())
+			if tc.held {
+				s.conn.mu.Lock()
+				defer s.conn.mu.Unlock()
+			}
+			if tc.linkDown {
+				s.conn.link.down.Store(true)
+				defer s.conn.link.down.Store(false)
+			}
+
+			s.conn.writeSafeState(true)
+			if got := robot.opcodes()[before:]; !bytes.Equal(got, tc.want) {
+				t.Errorf("wrote opcodes %v, want %v", got, tc.want)
+			}
+			if tc.want != nil {
+				checkStopped(t, robot)
+			}
+		})
+	}
+}
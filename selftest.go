@@ -0,0 +1,265 @@
+package viamroomba
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultSelfTestBatteryPercent is the charge below which self_test
+	// fails the battery unless min_battery_percent is given.
+	defaultSelfTestBatteryPercent = 20
+	// selfTestPulseSpeed and selfTestPulseTime make each wheel pulse about
+	// 25 mm, and selfTestPulseMinMM is the least odometry must see of it.
+	selfTestPulseSpeed = 100 // mm/s
+	selfTestPulseTime  = 250 * time.Millisecond
+	selfTestPulseMinMM = 5
+)
+
+// selfTestPackets are read for the battery and fault checks: bumps and
+// wheel drops (7), cliffs (9-12), overcurrents (14), charging state (21),
+// voltage (22), and charge and capacity (25-26).
+var selfTestPackets = []byte{7, 9, 10, 11, 12, 14, 21, 22, 25, 26}
+
+// selfTestArgs are the parameters of self_test.
+type selfTestArgs struct {
+	MinBatteryPercent *float64 `json:"min_battery_percent" doc:"Fail the battery check below this charge; defaults to 20"`
+	PulseWheels       bool     `json:"pulse_wheels" doc:"Also drive about 25 mm forward and back to check the wheels respond"`
+}
+
+// selfTestReport collects the results of self_test's checks.
+type selfTestReport struct {
+	checks []any
+	pass   bool
+}
+
+func (r *selfTestReport) add(name, status, detail string) {
+	r.checks = append(r.checks, map[string]any{"name": name, "status": status, "detail": detail})
+	if status == "fail" {
+		r.pass = false
+	}
+}
+
+// selfTest serves self_test: an end-to-end check for provisioning
+// pipelines that the robot answers (reading back the OI mode), its battery
+// is charged enough, nothing is faulted, and, with pulse_wheels, that the
+// wheels move when driven. Every check runs and is reported as pass, fail,
+// or skip; the wheel pulse is skipped if anything before it failed, since
+// driving a faulted robot proves nothing and may do harm.
+func (s *viamRoombaBase) selfTest(ctx context.Context, args selfTestArgs) (map[string]any, error) {
+	minPercent := float64(defaultSelfTestBatteryPercent)
+	if args.MinBatteryPercent != nil {
+		minPercent = *args.MinBatteryPercent
+		if minPercent < 0 || minPercent > 100 {
+			return nil, errors.New("min_battery_percent must be between 0 and 100")
+		}
+	}
+	if args.PulseWheels && inBatch(ctx) {
+		return nil, errors.New("self_test with pulse_wheels can't run in a batch; send it on its own")
+	}
+
+	report := &selfTestReport{pass: true}
+	if err := s.selfTestChecks(ctx, report, minPercent); err != nil {
+		return nil, err
+	}
+	if args.PulseWheels {
+		switch {
+		case !report.pass:
+			report.add("wheels", "skip", "not driven, since an earlier check failed")
+		case s.dryRun != nil:
+			report.add("wheels", "skip", "not driven with dry_run")
+		default:
+			detail, err := s.pulseWheels(ctx)
+			if err != nil {
+				report.add("wheels", "fail", err.Error())
+			} else {
+				report.add("wheels", "pass", detail)
+			}
+		}
+	}
+	return map[string]any{"pass": report.pass, "checks": report.checks}, nil
+}
+
+// selfTestChecks runs the serial, battery, and fault checks. It only
+// returns an error if ctx ends first.
+func (s *viamRoombaBase) selfTestChecks(ctx context.Context, report *selfTestReport, minPercent float64) error {
+	if err := s.conn.mu.LockContext(ctx); err != nil {
+		return err
+	}
+	defer s.conn.mu.Unlock()
+
+	start := time.Now()
+	mode, err := s.conn.syncMode()
+	if err != nil {
+		report.add("serial", "fail", err.Error())
+		report.add("battery", "skip", "the robot didn't answer")
+		report.add("faults", "skip", "the robot didn't answer")
+		return nil
+	}
+	report.add("serial", "pass", fmt.Sprintf("OI mode %s read back in %d ms", mode, time.Since(start).Milliseconds()))
+
+	data, err := s.conn.query(selfTestPackets)
+	if err != nil {
+		report.add("battery", "fail", fmt.Sprintf("failed to read the battery: %v", err))
+		report.add("faults", "fail", fmt.Sprintf("failed to read the sensors: %v", err))
+		return nil
+	}
+	u16 := func(b []byte) int { return int(binary.BigEndian.Uint16(b)) }
+
+	voltage, charge, capacity := u16(data[7]), u16(data[8]), u16(data[9])
+	if capacity == 0 {
+		report.add("battery", "fail", "battery capacity reads 0 mAh")
+	} else {
+		percent := float64(charge) / float64(capacity) * 100
+		detail := fmt.Sprintf("%.0f%% (%d/%d mAh, %d mV)", percent, charge, capacity, voltage)
+		if percent < minPercent {
+			report.add("battery", "fail", fmt.Sprintf("%s, below %.0f%%", detail, minPercent))
+		} else {
+			report.add("battery", "pass", detail)
+		}
+	}
+
+	var faults []string
+	bumps := data[0][0]
+	if bumps&0x0c != 0 {
+		faults = append(faults, "a wheel is dropped")
+	}
+	if bumps&0x03 != 0 {
+		faults = append(faults, "a bumper is pressed")
+	}
+	for i, name := range []string{"left", "front left", "front right", "right"} {
+		if data[1+i][0]&0x01 != 0 {
+			faults = append(faults, fmt.Sprintf("the %s cliff sensor is triggered", name))
+		}
+	}
+	if data[5][0] != 0 {
+		faults = append(faults, fmt.Sprintf("overcurrent on %s", overcurrentMotors(data[5][0])))
+	}
+	if data[6][0] == 5 {
+		faults = append(faults, "the robot reports a charging fault")
+	}
+	for _, err := range []error{s.checkEStop(), s.checkThermal()} {
+		if err != nil {
+			faults = append(faults, err.Error())
+		}
+	}
+	if len(faults) > 0 {
+		report.add("faults", "fail", strings.Join(faults, "; "))
+	} else {
+		report.add("faults", "pass", "no bumper, wheel drop, cliff, overcurrent, charging fault, e-stop, or overheating")
+	}
+	return nil
+}
+
+// overcurrentMotors names the motors packet 14 reports an overcurrent on.
+func overcurrentMotors(bits byte) string {
+	var motors []string
+	for _, m := range []struct {
+		bit  byte
+		name string
+	}{{0x01, "the side brush"}, {0x04, "the main brush"}, {0x08, "the right wheel"}, {0x10, "the left wheel"}} {
+		if bits&m.bit != 0 {
+			motors = append(motors, m.name)
+		}
+	}
+	if len(motors) == 0 {
+		return "an unknown motor"
+	}
+	return strings.Join(motors, ", ")
+}
+
+// pulseWheels drives forward and back for selfTestPulseTime each, checking
+// that odometry sees each move, and leaves the robot stopped in the mode it
+// was in. It cancels any running motion first.
+func (s *viamRoombaBase) pulseWheels(ctx context.Context) (string, error) {
+	ctx, done := s.opMgr.New(ctx)
+	defer done()
+	defer s.conn.activity.begin("self_test")()
+
+	if err := s.conn.mu.LockContext(ctx); err != nil {
+		return "", err
+	}
+	mode := s.conn.mode
+	var err error
+	if mode != oiSafe && mode != oiFull {
+		err = s.conn.setMode(oiSafe)
+	}
+	s.conn.mu.Unlock()
+	if err != nil {
+		return "", fmt.Errorf("failed to enter Safe mode to drive: %w", err)
+	}
+	defer func() {
+		if mode == oiSafe || mode == oiFull {
+			return
+		}
+		if err := s.lockToWindDown(ctx); err != nil {
+			s.logger.Warnf("self_test failed to return the robot to %s mode: %v", mode, err)
+			return
+		}
+		defer s.conn.mu.Unlock()
+		if err := s.conn.setMode(mode); err != nil {
+			s.logger.Warnf("self_test failed to return the robot to %s mode: %v", mode, err)
+		}
+	}()
+
+	var moved [2]float64
+	for i, velocity := range []int16{selfTestPulseSpeed, -selfTestPulseSpeed} {
+		distance, err := s.pulse(ctx, velocity)
+		if err != nil {
+			return "", err
+		}
+		if math.Abs(distance) < selfTestPulseMinMM {
+			return "", fmt.Errorf("drove at %d mm/s for %v but odometry read %.0f mm; check the wheels", velocity, selfTestPulseTime, distance)
+		}
+		moved[i] = distance
+	}
+	return fmt.Sprintf("forward %.0f mm, back %.0f mm", moved[0], -moved[1]), nil
+}
+
+// pulse drives straight at velocity for selfTestPulseTime, stops, and
+// returns the distance odometry read over the move.
+func (s *viamRoombaBase) pulse(ctx context.Context, velocity int16) (float64, error) {
+	if err := s.conn.mu.LockContext(ctx); err != nil {
+		return 0, err
+	}
+	// Start from zero; what was driven before goes to the pose as usual.
+	_, _, err := s.conn.readOdometry()
+	if err == nil {
+		// Through s.drive, so the e-stop, geofence, thermal derate, and the
+		// rest refuse the pulse as they would any other motion.
+		if err = s.drive(velocity, 32767); err != nil {
+			err = fmt.Errorf("refused to drive: %w", err)
+		}
+	}
+	s.conn.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	timer := s.clk.Timer(selfTestPulseTime)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	if err := s.lockToWindDown(ctx); err != nil {
+		return 0, err
+	}
+	defer s.conn.mu.Unlock()
+	if err := s.stopVerified(); err != nil {
+		return 0, err
+	}
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+	// Let the robot come to rest before reading how far it went.
+	time.Sleep(100 * time.Millisecond)
+	distance, _, err := s.conn.readOdometry()
+	return distance, err
+}
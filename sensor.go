@@ -3,41 +3,268 @@ package viamroomba
 import (
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
 
+	base "go.viam.com/rdk/components/base"
 	"go.viam.com/rdk/components/sensor"
 	"go.viam.com/rdk/logging"
 	"go.viam.com/rdk/resource"
 )
 
-var Sensor = resource.NewModel("jalen", "viam-roomba", "sensor")
+type SensorConfig struct {
+	SerialPort            string `json:"serial_port,omitempty"`
+	Controller            string `json:"controller,omitempty"`
+	StartAttempts         int    `json:"start_attempts,omitempty"`
+	OIProfile             string `json:"oi_profile,omitempty"`
+	SyncClockOnConnect    bool   `json:"sync_clock_on_connect,omitempty"`
+	Base                  string `json:"base,omitempty"`
+	ClassifyFloor         bool   `json:"classify_floor,omitempty"`
+	CarpetSignalThreshold int    `json:"carpet_signal_threshold,omitempty"`
+	EdgeSignalThreshold   int    `json:"edge_signal_threshold,omitempty"`
 
-func init() {
-	resource.RegisterComponent(sensor.API, Sensor,
-		resource.Registration[sensor.Sensor, *SensorConfig]{
-			Constructor: newViamRoombaSensor,
-		},
-	)
-}
+	SensorOffsets map[string]SensorOffset `json:"sensor_offsets,omitempty"`
 
-type SensorConfig struct {
-	SerialPort string `json:"serial_port"`
+	BinFullDetection          bool `json:"bin_full_detection,omitempty"`
+	BinFullCurrentThresholdMA int  `json:"bin_full_current_threshold_ma,omitempty"`
+	BinFullWindowSec          int  `json:"bin_full_window_sec,omitempty"`
+
+	SlipThreshold float64 `json:"slip_threshold,omitempty"`
+	SlipWindowSec int     `json:"slip_window_sec,omitempty"`
+
+	BatteryTempLimitC        int `json:"battery_temp_limit_c,omitempty"`
+	BatteryDesignCapacityMAh int `json:"battery_design_capacity_mah,omitempty"`
+
+	AlertBatteryPercent         float64 `json:"alert_battery_percent,omitempty"`
+	AlertBatteryCriticalPercent float64 `json:"alert_battery_critical_percent,omitempty"`
+	AlertTemperatureC           int     `json:"alert_temperature_c,omitempty"`
+	AlertTemperatureCriticalC   int     `json:"alert_temperature_critical_c,omitempty"`
+
+	DebugSerial bool `json:"debug_serial,omitempty"`
+
+	QueryDeadlineMS int    `json:"query_deadline_ms,omitempty"`
+	ReadMode        string `json:"read_mode,omitempty"`
+
+	FieldAliases map[string]string `json:"field_aliases,omitempty"`
+	IncludeUnits bool              `json:"include_units,omitempty"`
 }
 
 func (cfg *SensorConfig) Validate(path string) ([]string, []string, error) {
-	if cfg.SerialPort == "" {
-		return nil, nil, fmt.Errorf("%s: serial_port is required", path)
+	deps, err := validateConnection(cfg.SerialPort, cfg.Controller)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateStartAttempts(cfg.StartAttempts); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateOIProfile(cfg.OIProfile); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if cfg.CarpetSignalThreshold < 0 {
+		return nil, nil, fmt.Errorf("%s: carpet_signal_threshold must be a positive number", path)
+	}
+	if cfg.EdgeSignalThreshold < 0 {
+		return nil, nil, fmt.Errorf("%s: edge_signal_threshold must be a positive number", path)
+	}
+	if cfg.BinFullCurrentThresholdMA < 0 {
+		return nil, nil, fmt.Errorf("%s: bin_full_current_threshold_ma must be a positive number", path)
+	}
+	if cfg.BinFullWindowSec < 0 {
+		return nil, nil, fmt.Errorf("%s: bin_full_window_sec must be a positive number", path)
+	}
+	if cfg.SlipThreshold < 0 || cfg.SlipThreshold > 1 {
+		return nil, nil, fmt.Errorf("%s: slip_threshold must be between 0 and 1", path)
+	}
+	if cfg.SlipWindowSec < 0 {
+		return nil, nil, fmt.Errorf("%s: slip_window_sec must be a positive number", path)
+	}
+	if cfg.BatteryTempLimitC < 0 {
+		return nil, nil, fmt.Errorf("%s: battery_temp_limit_c must be a positive number", path)
+	}
+	if cfg.BatteryDesignCapacityMAh < 0 {
+		return nil, nil, fmt.Errorf("%s: battery_design_capacity_mah must be a positive number", path)
+	}
+	if cfg.AlertBatteryPercent < 0 || cfg.AlertBatteryPercent > 100 {
+		return nil, nil, fmt.Errorf("%s: alert_battery_percent must be between 0 and 100", path)
+	}
+	if cfg.AlertBatteryCriticalPercent < 0 || cfg.AlertBatteryCriticalPercent > 100 {
+		return nil, nil, fmt.Errorf("%s: alert_battery_critical_percent must be between 0 and 100", path)
+	}
+	if cfg.AlertTemperatureC < 0 {
+		return nil, nil, fmt.Errorf("%s: alert_temperature_c must be a positive number", path)
 	}
-	return nil, nil, nil
+	if cfg.AlertTemperatureCriticalC < 0 {
+		return nil, nil, fmt.Errorf("%s: alert_temperature_critical_c must be a positive number", path)
+	}
+	if cfg.QueryDeadlineMS < 0 {
+		return nil, nil, fmt.Errorf("%s: query_deadline_ms must be a positive number", path)
+	}
+	switch cfg.ReadMode {
+	case "", "auto", "group", "query_list":
+	default:
+		return nil, nil, fmt.Errorf("%s: read_mode must be one of auto, group, query_list", path)
+	}
+	if _, err := resolveSensorOffsets(cfg.SensorOffsets); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateFieldAliases(cfg.FieldAliases); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	// Depending on the base that shares the port makes viam-server build the
+	// base first and close it last, so the shared connection is never torn
+	// down underneath the sensor during a reconfigure.
+	if cfg.Base != "" {
+		deps = append(deps, cfg.Base)
+	}
+	return deps, nil, nil
 }
 
 type viamRoombaSensor struct {
-	resource.AlwaysRebuild
-
 	name       resource.Name
 	logger     logging.Logger
+	cfg        *SensorConfig
 	conn       *roombaConn
 	serialPort string
+
+	classifyFloor         bool
+	carpetSignalThreshold int
+	edgeSignalThreshold   int
+
+	offsets map[string]SensorOffset
+	// fieldAliases renames readings for the caller, after every other use,
+	// and includeUnits adds the units of those that measure something.
+	fieldAliases map[string]string
+	includeUnits bool
+
+	queryDeadline time.Duration
+
+	// packets is sensorPackets plus any packets needed by optional features.
+	// If group is non-zero they are read with that group packet instead of a
+	// Query List.
+	packets []byte
+	group   byte
+	// packetData holds each read's packets in s.packets order, reused
+	// from read to read. Guarded by conn.mu.
+	packetData [][]byte
+	// rx holds what each Query List of s.packets reads, reused from read
+	// to read. Guarded by conn.mu.
+	rx queryBuffers
+	// widthMM converts requested velocity and radius to wheel velocities.
+	// wheels and slip are nil unless the robot reports encoder counts, and
+	// are guarded by conn.mu.
+	widthMM float64
+	wheels  *wheelTracker
+	slip    *slipDetector
+	// binFull is nil unless bin_full_detection is enabled. Guarded by conn.mu.
+	binFull *binFullDetector
+
+	battery *batteryTracker
+	events  eventDetector
+	alerts  *alertTracker
+
+	// store persists battery history, odometry totals, and dirt events.
+	// odomBaseline is the saved odometry total minus what the connection had
+	// already covered when the sensor started. Both are guarded by conn.mu.
+	store        *stateStore
+	odomBaseline odometryTotals
+	lastSave     time.Time
+
+	removeTracer func()
+
+	commands commandSet
+
+	dirtMu     sync.Mutex
+	dirtEvents []dirtEvent
+
+	virtualWalls virtualWallMap
+
+	// inflight is the Readings call currently talking to the robot, if any.
+	// Concurrent callers wait for its result instead of queueing their own
+	// serial transactions.
+	flightMu sync.Mutex
+	inflight *readingsCall
+}
+
+// readingsCall is a Readings serial query shared by every caller that
+// arrives while it is in flight.
+type readingsCall struct {
+	done     chan struct{}
+	readings map[string]any
+	err      error
+	// users is how many callers are waiting on the query or running it.
+	// Guarded by the sensor's flightMu.
+	users int
+	// shared is whether more than one caller was still waiting when the
+	// query finished, so none may be handed the readings themselves.
+	shared bool
+}
+
+// result returns the query's readings. A caller that had the query to
+// itself gets the map readAll built; callers sharing it each get a copy, so
+// one can't modify another's result.
+func (c *readingsCall) result() (map[string]any, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	if !c.shared {
+		return c.readings, nil
+	}
+	return cloneReadings(c.readings), nil
+}
+
+// release marks one caller as no longer waiting on call.
+func (s *viamRoombaSensor) release(call *readingsCall) {
+	s.flightMu.Lock()
+	defer s.flightMu.Unlock()
+	call.users--
+}
+
+// maxDirtEvents bounds the dirt event history so a long-running sensor with
+// data capture enabled doesn't grow without limit.
+const maxDirtEvents = 1000
+
+// stateSaveInterval throttles how often Readings writes the sensor's state.
+const stateSaveInterval = time.Minute
+
+// defaultQueryDeadline is how long the sensor query may take before its
+// data is treated as stale. A healthy query takes well under 100ms.
+const defaultQueryDeadline = 500 * time.Millisecond
+
+// StaleDataError is returned by Readings when the serial query took longer
+// than the configured deadline. The robot's replies may have been delayed
+// or interleaved with stale bytes, so the values are discarded rather than
+// returned.
+type StaleDataError struct {
+	Latency  time.Duration
+	Deadline time.Duration
+}
+
+func (e *StaleDataError) Error() string {
+	return fmt.Sprintf("stale sensor data: serial query took %v, deadline is %v", e.Latency, e.Deadline)
+}
+
+// dirtEvent is a single non-zero dirt detect reading tagged with the odometry
+// pose at the time it was read.
+type dirtEvent struct {
+	XMM       float64   `json:"x"`
+	YMM       float64   `json:"y"`
+	Intensity int       `json:"intensity"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// sensorState is everything the sensor keeps across restarts.
+type sensorState struct {
+	Battery    batteryHistory `json:"battery"`
+	Odometry   odometryTotals `json:"odometry"`
+	DirtEvents []dirtEvent    `json:"dirt_events"`
+
+	VirtualWalls []virtualWall `json:"virtual_walls"`
 }
 
 func newViamRoombaSensor(ctx context.Context, deps resource.Dependencies, rawConf resource.Config, logger logging.Logger) (sensor.Sensor, error) {
@@ -46,25 +273,232 @@ func newViamRoombaSensor(ctx context.Context, deps resource.Dependencies, rawCon
 		return nil, err
 	}
 
-	conn, err := acquireConn(conf.SerialPort)
+	offsets, err := resolveSensorOffsets(conf.SensorOffsets)
 	if err != nil {
 		return nil, err
 	}
 
-	logger.Infof("Roomba sensor initialized on %s", conf.SerialPort)
+	serialPort, err := resolveSerialPort(deps, conf.SerialPort, conf.Controller)
+	if err != nil {
+		return nil, err
+	}
+
+	// Wheel velocities use the base's dimensions if it has any, or the
+	// Roomba 650's.
+	widthMM, wheelCircumferenceMM := 235, 220
+	if conf.Base != "" {
+		b, err := base.FromProvider(deps, conf.Base)
+		if err != nil {
+			return nil, err
+		}
+		if rb, ok := b.(*viamRoombaBase); ok {
+			if rb.serialPort != serialPort {
+				logger.Warnf("Base %q uses serial port %s but this sensor uses %s; they will not share a connection",
+					conf.Base, rb.serialPort, serialPort)
+			}
+			widthMM, wheelCircumferenceMM = rb.widthMM, rb.wheelCircumferenceMM
+		}
+	}
+
+	store := newStateStore("sensor_" + rawConf.ResourceName().Name)
+	var saved sensorState
+	if err := store.load(&saved); err != nil {
+		return nil, err
+	}
+
+	tempLimit := conf.BatteryTempLimitC
+	if tempLimit == 0 {
+		tempLimit = defaultBatteryTempLimitC
+	}
+	battery := newBatteryTracker(saved.Battery, tempLimit, conf.BatteryDesignCapacityMAh)
+
+	alertBattery := conf.AlertBatteryPercent
+	if alertBattery == 0 {
+		alertBattery = defaultAlertBatteryPercent
+	}
+	alertBatteryCritical := conf.AlertBatteryCriticalPercent
+	if alertBatteryCritical == 0 {
+		alertBatteryCritical = defaultAlertBatteryCriticalPercent
+	}
+	alertTemp := conf.AlertTemperatureC
+	if alertTemp == 0 {
+		alertTemp = tempLimit
+	}
+	alertTempCritical := conf.AlertTemperatureCriticalC
+	if alertTempCritical == 0 {
+		alertTempCritical = alertTemp + alertTemperatureCriticalMarginC
+	}
+	alerts := newAlertTracker(logger, alertBattery, alertBatteryCritical, alertTemp, alertTempCritical)
+
+	profile, err := lookupOIProfile(conf.OIProfile)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := acquireConn(serialPort, conf.StartAttempts, profile)
+	if err != nil {
+		return nil, err
+	}
+	warnProfile(logger, conn, profile)
+	if conf.SyncClockOnConnect {
+		conn.enableClockSync(ctx, logger)
+	}
+	covered := conn.odom.totals()
+	odomBaseline := odometryTotals{
+		DistanceMM:  saved.Odometry.DistanceMM - covered.DistanceMM,
+		RotationDeg: saved.Odometry.RotationDeg - covered.RotationDeg,
+	}
+	if len(saved.DirtEvents) > maxDirtEvents {
+		saved.DirtEvents = saved.DirtEvents[len(saved.DirtEvents)-maxDirtEvents:]
+	}
+
+	carpetSignalThreshold := conf.CarpetSignalThreshold
+	if carpetSignalThreshold == 0 {
+		carpetSignalThreshold = defaultCarpetSignalThreshold
+	}
+	edgeSignalThreshold := conf.EdgeSignalThreshold
+	if edgeSignalThreshold == 0 {
+		edgeSignalThreshold = defaultEdgeSignalThreshold
+	}
+
+	queryDeadline := time.Duration(conf.QueryDeadlineMS) * time.Millisecond
+	if queryDeadline == 0 {
+		queryDeadline = defaultQueryDeadline
+	}
+
+	// Optional packets are only queried if the robot supports them, since an
+	// older OI version fails the whole query on an unknown packet.
+	packets := sensorPackets
+	if conn.caps.hasPacket(52) {
+		packets = append(packets[:len(packets):len(packets)], 52, 53)
+	} else {
+		logger.Infof("Robot does not report directional IR (packets 52-53); dock_bearing is unavailable")
+	}
+	if conn.caps.hasPacket(41) {
+		packets = append(packets[:len(packets):len(packets)], 41, 42)
+	}
+	var wheels *wheelTracker
+	var slip *slipDetector
+	if conn.caps.hasPacket(43) {
+		packets = append(packets[:len(packets):len(packets)], 43, 44)
+		wheels = newWheelTracker(wheelCircumferenceMM)
+		slip = &slipDetector{
+			threshold: conf.SlipThreshold,
+			window:    time.Duration(conf.SlipWindowSec) * time.Second,
+		}
+		if slip.threshold == 0 {
+			slip.threshold = defaultSlipThreshold
+		}
+		if slip.window == 0 {
+			slip.window = defaultSlipWindow
+		}
+	} else {
+		logger.Infof("Robot does not report encoder counts (packets 43-44); measured wheel velocities are unavailable")
+	}
+	var binFull *binFullDetector
+	if conf.BinFullDetection && !conn.caps.hasPacket(56) {
+		logger.Warnf("Robot does not report motor currents (packet 56); bin_full_detection is disabled")
+	} else if conf.BinFullDetection {
+		binFull = &binFullDetector{
+			currentThresholdMA: conf.BinFullCurrentThresholdMA,
+			window:             time.Duration(conf.BinFullWindowSec) * time.Second,
+		}
+		if binFull.currentThresholdMA == 0 {
+			binFull.currentThresholdMA = defaultBinFullCurrentThresholdMA
+		}
+		if binFull.window == 0 {
+			binFull.window = defaultBinFullWindow
+		}
+		packets = append(packets[:len(packets):len(packets)], 56)
+	}
+
+	removeTracer := func() {}
+	if conf.DebugSerial {
+		removeTracer = conn.addTracer(logger)
+	}
+
+	group := byte(0)
+	switch conf.ReadMode {
+	case "group":
+		if group = groupFor(packets); group == 0 {
+			logger.Warnf("No group packet covers the configured sensors; using Query List")
+		}
+	case "", "auto":
+		if group = groupFor(packets); !conn.caps.hasPacket(group) {
+			group = 0
+		}
+	}
 
-	return &viamRoombaSensor{
-		name:       rawConf.ResourceName(),
-		logger:     logger,
-		conn:       conn,
-		serialPort: conf.SerialPort,
-	}, nil
+	logger.Infof("Roomba sensor initialized on %s", serialPort)
+
+	s := &viamRoombaSensor{
+		name:                  rawConf.ResourceName(),
+		logger:                logger,
+		cfg:                   conf,
+		conn:                  conn,
+		serialPort:            serialPort,
+		classifyFloor:         conf.ClassifyFloor,
+		carpetSignalThreshold: carpetSignalThreshold,
+		edgeSignalThreshold:   edgeSignalThreshold,
+		offsets:               offsets,
+		fieldAliases:          conf.FieldAliases,
+		includeUnits:          conf.IncludeUnits,
+		queryDeadline:         queryDeadline,
+		packets:               packets,
+		group:                 group,
+		widthMM:               float64(widthMM),
+		wheels:                wheels,
+		slip:                  slip,
+		binFull:               binFull,
+		battery:               battery,
+		alerts:                alerts,
+		store:                 store,
+		odomBaseline:          odomBaseline,
+		lastSave:              time.Now(),
+		removeTracer:          removeTracer,
+		dirtEvents:            saved.DirtEvents,
+	}
+	s.virtualWalls.restore(saved.VirtualWalls)
+	s.commands = s.newCommands()
+	return s, nil
 }
 
 func (s *viamRoombaSensor) Name() resource.Name {
 	return s.name
 }
 
+// Reconfigure moves the sensor to a new serial port in place when that is
+// the only change, so data capture keeps running. Any other change rebuilds
+// the sensor.
+func (s *viamRoombaSensor) Reconfigure(ctx context.Context, deps resource.Dependencies, rawConf resource.Config) error {
+	conf, err := resource.NativeConfig[*SensorConfig](rawConf)
+	if err != nil {
+		return err
+	}
+	unchanged := *conf
+	unchanged.SerialPort = s.cfg.SerialPort
+	if !reflect.DeepEqual(&unchanged, s.cfg) {
+		return resource.NewMustRebuildError(rawConf.ResourceName())
+	}
+
+	serialPort, err := resolveSerialPort(deps, conf.SerialPort, conf.Controller)
+	if err != nil {
+		return err
+	}
+	if connKey(serialPort) != connKey(s.serialPort) {
+		if err := moveConn(ctx, s.conn, serialPort); err != nil {
+			return err
+		}
+		s.logger.Infof("Roomba sensor moved from %s to %s", s.serialPort, serialPort)
+	}
+	s.cfg = conf
+	s.serialPort = serialPort
+	return nil
+}
+
+// contactSensors are the readings that place an obstacle point at their
+// sensor's offset when they trigger.
+var contactSensors = []string{"bump_left", "bump_right", "wall", "cliff_left", "cliff_front_left", "cliff_front_right", "cliff_right"}
+
 // sensorPackets lists all queried packet IDs in order. Index in this slice
 // corresponds to the index in the data slice returned by QueryList.
 var sensorPackets = []byte{
@@ -98,125 +532,481 @@ var sensorPackets = []byte{
 	40, // Requested Radius (mm, signed)
 }
 
+// readingsSizeHint is about how many readings readAll returns, so their
+// map is sized once rather than grown as they are decoded.
+const readingsSizeHint = 80
+
 var chargingStates = []string{"not_charging", "reconditioning", "full_charging", "trickle_charging", "waiting", "charging_fault"}
-var oiModes = []string{"off", "passive", "safe", "full"}
 
+// Readings returns the latest sensor values. Calls that arrive while another
+// caller's query is in flight share its result.
 func (s *viamRoombaSensor) Readings(ctx context.Context, extra map[string]any) (map[string]any, error) {
-	s.conn.mu.Lock()
+	defer RecoverToSafeState()
+	for {
+		s.flightMu.Lock()
+		call := s.inflight
+		if call == nil {
+			break
+		}
+		call.users++
+		s.flightMu.Unlock()
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			s.release(call)
+			return nil, ctx.Err()
+		}
+		// If the caller that ran the query gave up, run our own.
+		if !errors.Is(call.err, context.Canceled) && !errors.Is(call.err, context.DeadlineExceeded) {
+			defer s.release(call)
+			return call.result()
+		}
+		s.release(call)
+	}
+	call := &readingsCall{done: make(chan struct{}), users: 1}
+	s.inflight = call
+	s.flightMu.Unlock()
+	defer s.release(call)
+
+	call.readings, call.err = s.readAll(ctx)
+
+	s.flightMu.Lock()
+	s.inflight = nil
+	call.shared = call.users > 1
+	s.flightMu.Unlock()
+	close(call.done)
+
+	return call.result()
+}
+
+// readAll queries the robot and decodes every reading. A packet that
+// arrives the wrong length or with an implausible value even after the
+// retry only takes out the readings decoded from it: the rest are returned
+// along with an errors map of what was wrong with each bad packet.
+func (s *viamRoombaSensor) readAll(ctx context.Context) (map[string]any, error) {
+	if err := s.conn.mu.LockContext(ctx); err != nil {
+		return nil, err
+	}
 	defer s.conn.mu.Unlock()
 
 	s.conn.flushRx()
-	data, err := s.conn.roomba.QueryList(sensorPackets)
+	start := time.Now()
+	data, bad, err := s.readPackets()
+	latency := time.Since(start)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query sensors: %w", err)
 	}
-	if len(data) != len(sensorPackets) {
-		return nil, fmt.Errorf("unexpected sensor data count: got %d, want %d", len(data), len(sensorPackets))
+	if latency > s.queryDeadline {
+		return nil, &StaleDataError{Latency: latency, Deadline: s.queryDeadline}
+	}
+	if len(data) != len(s.packets) {
+		return nil, fmt.Errorf("unexpected sensor data count: got %d, want %d", len(data), len(s.packets))
 	}
 
 	b := func(idx int) byte { return data[idx][0] }
 	i16 := func(idx int) int16 { return int16(binary.BigEndian.Uint16(data[idx])) }
 	u16 := func(idx int) uint16 { return binary.BigEndian.Uint16(data[idx]) }
+	// intact reports whether the packets came back whole and plausible.
+	intact := func(ids ...byte) bool {
+		for _, id := range ids {
+			if bad[id] != nil {
+				return false
+			}
+		}
+		return true
+	}
+	for i, id := range s.packets {
+		if bad[id] != nil {
+			data[i] = blankPacket(id)
+		}
+	}
 
-	readings := map[string]any{}
+	operation, operationID := s.conn.activity.current()
+	readings := make(map[string]any, readingsSizeHint)
+	readings["reading_timestamp"] = start.UTC().Format(time.RFC3339Nano)
+	readings["serial_latency_ms"] = float64(latency.Microseconds()) / 1000.0
+	readings["operation"] = operation
+	readings["operation_id"] = operationID
 
 	// Packet 7: Bumps and Wheel Drops
-	bumps := b(0)
-	readings["bump_right"] = bumps&0x01 != 0
-	readings["bump_left"] = bumps&0x02 != 0
-	readings["wheel_drop_right"] = bumps&0x04 != 0
-	readings["wheel_drop_left"] = bumps&0x08 != 0
+	if intact(7) {
+		bumps := b(0)
+		readings["bump_right"] = bumps&0x01 != 0
+		readings["bump_left"] = bumps&0x02 != 0
+		readings["wheel_drop_right"] = bumps&0x04 != 0
+		readings["wheel_drop_left"] = bumps&0x08 != 0
+	}
 
 	// Packets 8-12: Proximity sensors
-	readings["wall"] = b(1)&0x01 != 0
-	readings["cliff_left"] = b(2)&0x01 != 0
-	readings["cliff_front_left"] = b(3)&0x01 != 0
-	readings["cliff_front_right"] = b(4)&0x01 != 0
-	readings["cliff_right"] = b(5)&0x01 != 0
+	for i, name := range []string{"wall", "cliff_left", "cliff_front_left", "cliff_front_right", "cliff_right"} {
+		if intact(sensorPackets[1+i]) {
+			readings[name] = b(1+i)&0x01 != 0
+		}
+	}
+
+	// Base-frame positions of every active contact/proximity sensor.
+	obstaclePoints := []any{}
+	for _, name := range contactSensors {
+		if on, _ := readings[name].(bool); on {
+			off := s.offsets[name]
+			obstaclePoints = append(obstaclePoints, map[string]any{
+				"sensor": name,
+				"x_mm":   off.XMM,
+				"y_mm":   off.YMM,
+				"z_mm":   off.ZMM,
+			})
+		}
+	}
+	readings["obstacle_points"] = obstaclePoints
 
 	// Packet 13: Virtual Wall
-	readings["virtual_wall"] = b(6)&0x01 != 0
+	if intact(13) {
+		readings["virtual_wall"] = b(6)&0x01 != 0
+	}
 
 	// Packet 14: Overcurrents (bitmask: side brush, main brush, right wheel, left wheel)
-	overcurrents := b(7)
-	readings["overcurrent_side_brush"] = overcurrents&0x01 != 0
-	readings["overcurrent_main_brush"] = overcurrents&0x04 != 0
-	readings["overcurrent_right_wheel"] = overcurrents&0x08 != 0
-	readings["overcurrent_left_wheel"] = overcurrents&0x10 != 0
+	if intact(14) {
+		overcurrents := b(7)
+		readings["overcurrent_side_brush"] = overcurrents&0x01 != 0
+		readings["overcurrent_main_brush"] = overcurrents&0x04 != 0
+		readings["overcurrent_right_wheel"] = overcurrents&0x08 != 0
+		readings["overcurrent_left_wheel"] = overcurrents&0x10 != 0
+	}
 
 	// Packet 15: Dirt Detect
-	readings["dirt_detect"] = int(b(8))
+	if intact(15) {
+		readings["dirt_detect"] = int(b(8))
+	}
 
 	// Packet 17: IR Opcode
-	readings["ir_opcode"] = int(b(9))
+	if intact(17) {
+		readings["ir_opcode"] = int(b(9))
+		omni, _ := decodeDockIR(b(9))
+		readings["dock_red_buoy"] = omni.redBuoy
+		readings["dock_green_buoy"] = omni.greenBuoy
+		readings["dock_force_field"] = omni.forceField
+	}
 
 	// Packet 18: Buttons
-	buttons := b(10)
-	readings["button_clean"] = buttons&0x01 != 0
-	readings["button_spot"] = buttons&0x02 != 0
-	readings["button_dock"] = buttons&0x04 != 0
-	readings["button_minute"] = buttons&0x08 != 0
-	readings["button_hour"] = buttons&0x10 != 0
-	readings["button_day"] = buttons&0x20 != 0
-	readings["button_schedule"] = buttons&0x40 != 0
-	readings["button_clock"] = buttons&0x80 != 0
-
-	// Packets 19-20: Odometry (cumulative since last read)
-	readings["distance_mm"] = int(i16(11))
-	readings["angle_deg"] = int(i16(12))
+	if intact(18) {
+		buttons := b(10)
+		readings["button_clean"] = buttons&0x01 != 0
+		readings["button_spot"] = buttons&0x02 != 0
+		readings["button_dock"] = buttons&0x04 != 0
+		readings["button_minute"] = buttons&0x08 != 0
+		readings["button_hour"] = buttons&0x10 != 0
+		readings["button_day"] = buttons&0x20 != 0
+		readings["button_schedule"] = buttons&0x40 != 0
+		readings["button_clock"] = buttons&0x80 != 0
+	}
+
+	// Packets 19-20: Odometry (cumulative since last read). Motion lost to
+	// a bad packet is lost to the pose as well.
+	if intact(19, 20) {
+		distance, angle := s.conn.odom.update(int(i16(11)), int(i16(12)))
+		readings["distance_mm"] = distance
+		readings["angle_deg"] = angle
+	}
+	totals := s.odometryTotals()
+	readings["total_distance_mm"] = totals.DistanceMM
+	readings["total_rotation_deg"] = totals.RotationDeg
+	if dirt := int(b(8)); intact(15) && dirt > 0 {
+		s.recordDirtEvent(dirt)
+	}
 
 	// Packet 21: Charging State
 	chargingIdx := int(b(13))
-	if chargingIdx < len(chargingStates) {
-		readings["charging_state"] = chargingStates[chargingIdx]
-	} else {
-		readings["charging_state"] = "unknown"
+	charging := chargingIdx >= 1 && chargingIdx <= 3
+	if intact(21) {
+		if chargingIdx < len(chargingStates) {
+			readings["charging_state"] = chargingStates[chargingIdx]
+		} else {
+			readings["charging_state"] = "unknown"
+		}
 	}
 
 	// Packets 22-26: Battery
-	readings["voltage_mv"] = int(u16(14))
-	readings["current_ma"] = int(i16(15))
-	readings["temperature_c"] = int(int8(b(16)))
+	if intact(22) {
+		readings["voltage_mv"] = int(u16(14))
+	}
+	if intact(23) {
+		readings["current_ma"] = int(i16(15))
+	}
+	if intact(24) {
+		readings["temperature_c"] = int(int8(b(16)))
+	}
 	charge := int(u16(17))
 	capacity := int(u16(18))
-	readings["battery_charge_mah"] = charge
-	readings["battery_capacity_mah"] = capacity
-	if capacity > 0 {
-		readings["battery_percent"] = float64(charge) / float64(capacity) * 100.0
+	if intact(25, 26) {
+		readings["battery_charge_mah"] = charge
+		readings["battery_capacity_mah"] = capacity
+		if capacity > 0 {
+			readings["battery_percent"] = float64(charge) / float64(capacity) * 100.0
+		}
+	}
+	now := time.Now()
+	if intact(21, 24, 25, 26) {
+		s.battery.update(now, b(13), charge, capacity, int(int8(b(16))))
+	}
+	if intact(21, 23) && charging {
+		readings["charging_current_ma"] = max(0, int(i16(15)))
+	}
+	if intact(21, 23, 25, 26) {
+		if minutes, ok := s.battery.eta(now, charge, capacity, int(i16(15))); ok {
+			if charging {
+				readings["time_to_full_min"] = minutes
+			} else {
+				readings["time_to_empty_min"] = minutes
+			}
+		}
 	}
 
 	// Packets 27-31: Signal strengths
-	readings["wall_signal"] = int(u16(19))
-	readings["cliff_left_signal"] = int(u16(20))
-	readings["cliff_front_left_signal"] = int(u16(21))
-	readings["cliff_front_right_signal"] = int(u16(22))
-	readings["cliff_right_signal"] = int(u16(23))
+	for i, name := range []string{"wall_signal", "cliff_left_signal", "cliff_front_left_signal", "cliff_front_right_signal", "cliff_right_signal"} {
+		if intact(sensorPackets[19+i]) {
+			readings[name] = int(u16(19 + i))
+		}
+	}
+	if s.classifyFloor && intact(28, 29, 30, 31) {
+		signals := [4]int{int(u16(20)), int(u16(21)), int(u16(22)), int(u16(23))}
+		readings["floor_type"] = classifyFloor(signals, s.carpetSignalThreshold, s.edgeSignalThreshold)
+	}
 
 	// Packet 33: Charging Sources Available
-	charger := b(24)
-	readings["charger_internal"] = charger&0x01 != 0
-	readings["charger_homebase"] = charger&0x02 != 0
+	if intact(34) {
+		charger := b(24)
+		readings["charger_internal"] = charger&0x01 != 0
+		readings["charger_homebase"] = charger&0x02 != 0
+		s.conn.activity.noteDocked(charger&0x02 != 0)
+	}
 
 	// Packet 34: OI Mode
-	modeIdx := int(b(25))
-	if modeIdx < len(oiModes) {
-		readings["oi_mode"] = oiModes[modeIdx]
-	} else {
-		readings["oi_mode"] = "unknown"
+	if intact(35) {
+		readings["oi_mode"] = oiMode(b(25)).String()
+		s.conn.observeMode(b(25))
 	}
 
 	// Packets 39-40: Requested motion
-	readings["requested_velocity_mms"] = int(i16(26))
-	readings["requested_radius_mm"] = int(i16(27))
+	if intact(39) {
+		readings["requested_velocity_mms"] = int(i16(26))
+	}
+	if intact(40) {
+		readings["requested_radius_mm"] = int(i16(27))
+	}
+
+	// Optional packets follow the fixed ones; see newViamRoombaSensor. Bad
+	// ones are left out.
+	optional := make(map[byte][]byte, len(s.packets)-len(sensorPackets))
+	for i := len(sensorPackets); i < len(s.packets); i++ {
+		if intact(s.packets[i]) {
+			optional[s.packets[i]] = data[i]
+		}
+	}
+
+	// Packets 52-53: Directional IR receivers
+	left, okLeft := optional[52]
+	right, okRight := optional[53]
+	if okLeft && okRight {
+		readings["ir_opcode_left"] = int(left[0])
+		readings["ir_opcode_right"] = int(right[0])
+		readings["dock_bearing"] = dockBearing(left[0], right[0])
+	}
+
+	// Packets 41-42 hold the wheel velocities of the last Drive Direct
+	// command; after a Drive command they are derived from 39-40 instead.
+	var commandedLeft, commandedRight float64
+	commanded := intact(39, 40)
+	if commanded {
+		commandedLeft, commandedRight = commandedWheelVelocities(i16(26), i16(27), s.widthMM)
+	}
+	if s.conn.driveDirectLast {
+		right, okRight := optional[41]
+		left, okLeft := optional[42]
+		if okRight && okLeft {
+			commandedRight = float64(int16(binary.BigEndian.Uint16(right)))
+			commandedLeft = float64(int16(binary.BigEndian.Uint16(left)))
+			commanded = true
+		}
+	}
+	if commanded {
+		readings["commanded_left_velocity_mms"] = math.Round(commandedLeft)
+		readings["commanded_right_velocity_mms"] = math.Round(commandedRight)
+	}
+
+	// Packets 43-44: Encoder counts
+	left, okLeft = optional[43]
+	right, okRight = optional[44]
+	if okLeft && okRight {
+		leftCounts := binary.BigEndian.Uint16(left)
+		rightCounts := binary.BigEndian.Uint16(right)
+		readings["left_encoder_counts"] = int(leftCounts)
+		readings["right_encoder_counts"] = int(rightCounts)
+		if l, r, ok := s.wheels.update(start, leftCounts, rightCounts); ok {
+			readings["measured_left_velocity_mms"] = l
+			readings["measured_right_velocity_mms"] = r
+			if commanded {
+				ratio := s.slip.update(start, [2]float64{commandedLeft, commandedRight}, [2]float64{l, r})
+				readings["slip_ratio"] = ratio
+				readings["slipping"] = ratio >= s.slip.threshold
+			}
+		}
+	}
+
+	// Packet 56: Main Brush Motor Current, only queried for bin-full detection
+	if brush, ok := optional[56]; ok && s.binFull != nil && intact(15) {
+		current := int(int16(binary.BigEndian.Uint16(brush)))
+		readings["main_brush_current_ma"] = current
+		readings["bin_full_suspected"] = s.binFull.update(time.Now(), current, int(b(8)))
+	}
+
+	// Events and alerts compare each reading with the last, so a reading
+	// with packets missing would look like sensors turning off and on
+	// again; they wait for the next whole one.
+	if len(bad) == 0 {
+		for _, name := range s.events.update(&s.conn.events, readings) {
+			if name == "bump_left" || name == "bump_right" {
+				x, y, heading := s.conn.odom.pose()
+				x, y = s.offsets[name].toOdometryFrame(x, y, heading)
+				s.conn.obstacles.record(name, x, y, start)
+			}
+		}
+		s.alerts.update(start, readings)
+	}
+	if sensors := virtualWallSensors(readings); len(sensors) > 0 {
+		x, y, heading := s.conn.odom.pose()
+		x, y = s.offsets["dock_ir"].toOdometryFrame(x, y, heading)
+		s.virtualWalls.record(sensors, x, y, start)
+	}
+	readings["alerts"] = s.alerts.list()
+
+	if len(bad) > 0 {
+		errs := make(map[string]any, len(bad))
+		for id, err := range bad {
+			errs[strconv.Itoa(int(id))] = err.Error()
+		}
+		readings["errors"] = errs
+		s.logger.Debugf("Readings left out %d bad packets: %v", len(bad), errs)
+	}
+	presentFields(readings, s.fieldAliases, s.includeUnits)
+
+	if time.Since(s.lastSave) >= stateSaveInterval {
+		if err := s.saveState(); err != nil {
+			s.logger.Warnf("Failed to save sensor state: %v", err)
+		}
+	}
 
 	return readings, nil
 }
 
+// readPackets reads s.packets, with one group packet if the robot supports
+// it or a Query List otherwise, returning what is wrong with any packet that
+// came back bad. Callers must hold s.conn.mu.
+func (s *viamRoombaSensor) readPackets() ([][]byte, map[byte]error, error) {
+	if s.group == 0 {
+		return s.conn.queryPartialInto(s.packets, &s.rx)
+	}
+	fields, bad, err := s.conn.readGroupPartial(s.group)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(s.packetData) != len(s.packets) {
+		s.packetData = make([][]byte, len(s.packets))
+	}
+	for i, id := range s.packets {
+		s.packetData[i] = fields[id]
+	}
+	return s.packetData, bad, nil
+}
+
+// odometryTotals returns the lifetime distance and rotation, including what
+// was saved before the last restart.
+func (s *viamRoombaSensor) odometryTotals() odometryTotals {
+	covered := s.conn.odom.totals()
+	return odometryTotals{
+		DistanceMM:  s.odomBaseline.DistanceMM + covered.DistanceMM,
+		RotationDeg: s.odomBaseline.RotationDeg + covered.RotationDeg,
+	}
+}
+
+// saveState persists the sensor's long-lived statistics. Callers must hold
+// s.conn.mu.
+func (s *viamRoombaSensor) saveState() error {
+	s.lastSave = time.Now()
+	s.dirtMu.Lock()
+	events := append([]dirtEvent(nil), s.dirtEvents...)
+	s.dirtMu.Unlock()
+	return s.store.save(sensorState{
+		Battery:    s.battery.snapshotHistory(),
+		Odometry:   s.odometryTotals(),
+		DirtEvents: events,
+
+		VirtualWalls: s.virtualWalls.snapshot(),
+	})
+}
+
+func (s *viamRoombaSensor) recordDirtEvent(intensity int) {
+	x, y, heading := s.conn.odom.pose()
+	x, y = s.offsets["dirt_detect"].toOdometryFrame(x, y, heading)
+
+	s.dirtMu.Lock()
+	defer s.dirtMu.Unlock()
+	if len(s.dirtEvents) >= maxDirtEvents {
+		s.dirtEvents = s.dirtEvents[1:]
+	}
+	s.dirtEvents = append(s.dirtEvents, dirtEvent{XMM: x, YMM: y, Intensity: intensity, Timestamp: time.Now()})
+}
+
 func (s *viamRoombaSensor) DoCommand(ctx context.Context, cmd map[string]any) (map[string]any, error) {
-	return nil, nil
+	return s.commands.dispatch(ctx, cmd)
+}
+
+// batteryHealthArgs are the parameters of battery_health.
+type batteryHealthArgs struct {
+	History bool `json:"history" doc:"Include capacity and temperature history"`
+}
+
+// newCommands builds the sensor's DoCommands.
+func (s *viamRoombaSensor) newCommands() commandSet {
+	cmds := connCommands(s.conn)
+	return append(cmds,
+		newCommand("battery_health", "Battery grade, cycles, and temperature excursions", func(_ context.Context, args batteryHealthArgs) (map[string]any, error) {
+			return s.battery.snapshot(args.History), nil
+		}),
+		newCommand("get_virtual_walls", "Mapped virtual wall beams in the odometry frame", s.virtualWalls.get),
+		newCommand("clear_virtual_walls", "Forget every mapped virtual wall", s.virtualWalls.clear),
+		newCommand("acknowledge_alerts", "Clear raised alerts from Readings", s.alerts.acknowledge),
+		newCommand("get_dirt_events", "Dirt detections with their odometry positions", func(context.Context, noArgs) (map[string]any, error) {
+			return s.dirtEventsSnapshot(), nil
+		}),
+		newCommand("query_packets", "Read any list of sensor packets, decoded with names and units", s.queryPackets),
+	)
+}
+
+func (s *viamRoombaSensor) dirtEventsSnapshot() map[string]any {
+	s.dirtMu.Lock()
+	defer s.dirtMu.Unlock()
+	events := make([]any, 0, len(s.dirtEvents))
+	for _, e := range s.dirtEvents {
+		events = append(events, map[string]any{
+			"x":         e.XMM,
+			"y":         e.YMM,
+			"intensity": e.Intensity,
+			"timestamp": e.Timestamp.Format(time.RFC3339Nano),
+		})
+	}
+	return map[string]any{"events": events}
 }
 
 func (s *viamRoombaSensor) Close(ctx context.Context) error {
-	releaseConn(s.serialPort)
+	if err := s.conn.mu.LockContext(ctx); err != nil {
+		s.logger.Warnf("Failed to save sensor state: %v", err)
+	} else {
+		if err := s.saveState(); err != nil {
+			s.logger.Warnf("Failed to save sensor state: %v", err)
+		}
+		s.conn.mu.Unlock()
+	}
+	s.removeTracer()
+	releaseConn(s.conn)
 	return nil
 }
@@ -0,0 +1,171 @@
+package viamroomba
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// BenchmarkReadings times a full Readings on a fakeRobot, read with a group
+// packet and with a Query List: the query, with its pacing, and decoding it
+// into the readings map.
+func BenchmarkReadings(b *testing.B) {
+	for _, mode := range []string{"group", "query_list"} {
+		b.Run(mode, func(b *testing.B) {
+			useFakeRobots(b)
+			s := newTestSensorWith(b, &SensorConfig{SerialPort: filepath.Join(b.TempDir(), "ttyUSB0"), ReadMode: mode})
+			ctx := context.Background()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				if _, err := s.Readings(ctx, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// holdBus takes s's bus and returns the function that gives it back, which
+// also runs when the test ends if the test didn't.
+func holdBus(t *testing.T, s *viamRoombaSensor) func() {
+	s.conn.mu.Lock()
+	release := sync.OnceFunc(s.conn.mu.Unlock)
+	t.Cleanup(release)
+	return release
+}
+
+// waitSharing waits until n Readings callers share the query in flight on
+// s, and returns it. The test holds the bus meanwhile, so the query can't
+// finish.
+func waitSharing(t *testing.T, s *viamRoombaSensor, n int) *readingsCall {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.flightMu.Lock()
+		call := s.inflight
+		users := 0
+		if call != nil {
+			users = call.users
+		}
+		s.flightMu.Unlock()
+		if users == n {
+			return call
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d callers share the query, want %d", users, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// queries counts the sensor queries robot has been sent.
+func queries(robot *fakeRobot) int {
+	n := 0
+	for _, op := range robot.opcodes() {
+		if op == opSensors || op == opQueryList {
+			n++
+		}
+	}
+	return n
+}
+
+// TestReadingsShareQuery checks that Readings calls arriving while another's
+// query is in flight wait for it rather than queueing their own: the robot
+// is queried once, every caller gets the same readings in a map of its own,
+// and the query is left with no users.
+func TestReadingsShareQuery(t *testing.T) {
+	robots := useFakeRobots(t)
+	port := filepath.Join(t.TempDir(), "ttyUSB0")
+	s := newTestSensor(t, port)
+	robot := robots[connKey(port)]
+	before := queries(robot)
+
+	const callers = 4
+	results := make([]map[string]any, callers)
+	errs := make([]error, callers)
+	var wg sync.WaitGroup
+	release := holdBus(t, s)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = s.Readings(context.Background(), nil)
+		}()
+	}
+	call := waitSharing(t, s, callers)
+	release()
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("caller %d: %v", i, err)
+		}
+	}
+	if n := queries(robot) - before; n != 1 {
+		t.Errorf("the robot was queried %d times, want once", n)
+	}
+	for i := 1; i < callers; i++ {
+		if !reflect.DeepEqual(results[i], results[0]) {
+			t.Errorf("caller %d got different readings from caller 0", i)
+		}
+	}
+	results[0]["bump_left"] = "changed"
+	for i := 1; i < callers; i++ {
+		if results[i]["bump_left"] == "changed" {
+			t.Errorf("changing caller 0's readings changed caller %d's", i)
+		}
+	}
+	s.flightMu.Lock()
+	defer s.flightMu.Unlock()
+	if !call.shared || call.users != 0 || s.inflight != nil {
+		t.Errorf("the query is left shared=%v with %d users, in flight: %v", call.shared, call.users, s.inflight != nil)
+	}
+}
+
+// TestReadingsRetryAfterCancelledQuery checks that a caller waiting on
+// another's query runs its own when the other gives up, rather than
+// returning its cancellation.
+func TestReadingsRetryAfterCancelledQuery(t *testing.T) {
+	robots := useFakeRobots(t)
+	port := filepath.Join(t.TempDir(), "ttyUSB0")
+	s := newTestSensor(t, port)
+	robot := robots[connKey(port)]
+	before := queries(robot)
+
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	defer cancelLeader()
+	leaderErr, waiter := make(chan error, 1), make(chan error, 1)
+	var readings map[string]any
+	release := holdBus(t, s)
+	go func() {
+		_, err := s.Readings(leaderCtx, nil)
+		leaderErr <- err
+	}()
+	waitSharing(t, s, 1)
+	go func() {
+		var err error
+		readings, err = s.Readings(context.Background(), nil)
+		waiter <- err
+	}()
+	waitSharing(t, s, 2)
+
+	cancelLeader()
+	if err := waitResult(t, leaderErr); !errors.Is(err, context.Canceled) {
+		t.Fatalf("the cancelled caller got %v, want %v", err, context.Canceled)
+	}
+	release()
+	if err := waitResult(t, waiter); err != nil {
+		t.Fatalf("the waiting caller got %v, want its own readings", err)
+	}
+	if len(readings) == 0 {
+		t.Error("the waiting caller got no readings")
+	}
+	if n := queries(robot) - before; n != 1 {
+		t.Errorf("the robot was queried %d times, want once, for the waiting caller", n)
+	}
+}
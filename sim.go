@@ -0,0 +1,273 @@
+package viamroomba
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+const (
+	// simStep is the longest interval integrated in one go, so that a fast
+	// robot can't step through a thin wall.
+	simStep = 10 * time.Millisecond
+	// simCliffRangeMM is how close a cliff sensor must be to a virtual cliff
+	// edge to see it.
+	simCliffRangeMM = 15.0
+	// simWallRangeMM is how far the wall sensor sees a virtual wall.
+	simWallRangeMM = 50.0
+)
+
+// simObstacle is a virtual wall or cliff edge: a line segment in the
+// simulation frame.
+type simObstacle struct {
+	id             int
+	kind           string // wall or cliff
+	x1, y1, x2, y2 float64
+}
+
+// simulation integrates commanded velocities into a pose for the fake base,
+// the way the real robot's odometry would see it. The frame has +X along the
+// robot's starting heading and +Y to its left, like the odometry pose. Like
+// the real robot in Safe mode, it won't drive through a virtual wall (the
+// bumper reports the contact) and stops at a virtual cliff.
+type simulation struct {
+	mu  sync.Mutex
+	clk clock.Clock
+
+	widthMM              float64
+	radiusMM             float64
+	wheelCircumferenceMM float64
+
+	last              time.Time
+	xMM, yMM          float64
+	thetaRad          float64
+	velocity          float64 // mm/s
+	omega             float64 // rad/s, positive turns left
+	leftCounts        float64
+	rightCounts       float64
+	distanceMM        float64 // since the last odometry read
+	angleDeg          float64 // since the last odometry read
+	bumpLeft          bool
+	bumpRight         bool
+	cliffs            map[string]bool
+	obstacles         []simObstacle
+	nextObstacleID    int
+	requestedRadius   int16
+	requestedVelocity int16
+}
+
+func newSimulation(clk clock.Clock, widthMM, diameterMM, wheelCircumferenceMM int) *simulation {
+	return &simulation{
+		clk:                  clk,
+		widthMM:              float64(widthMM),
+		radiusMM:             float64(diameterMM) / 2,
+		wheelCircumferenceMM: float64(wheelCircumferenceMM),
+		last:                 clk.Now(),
+		cliffs:               map[string]bool{},
+		requestedRadius:      32767,
+	}
+}
+
+// drive sets the commanded linear (mm/s) and angular (deg/s) velocity.
+func (s *simulation) drive(velocity, angularDegPerSec float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance()
+	s.velocity = math.Max(-500, math.Min(500, velocity))
+	s.omega = angularDegPerSec * math.Pi / 180.0
+	// Report what a Drive command for this motion would have asked for.
+	s.requestedVelocity = int16(s.velocity)
+	switch {
+	case s.omega == 0:
+		s.requestedRadius = 32767
+	case s.velocity == 0:
+		s.requestedVelocity = int16(math.Abs(s.omega) * s.widthMM / 2)
+		s.requestedRadius = int16(math.Copysign(1, s.omega))
+	default:
+		s.requestedRadius = int16(math.Max(-2000, math.Min(2000, s.velocity/s.omega)))
+	}
+}
+
+func (s *simulation) moving() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance()
+	return s.velocity != 0 || s.omega != 0
+}
+
+// advance integrates the motion since the last call. Callers must hold s.mu.
+func (s *simulation) advance() {
+	now := s.clk.Now()
+	for s.last.Before(now) {
+		h := min(simStep, now.Sub(s.last))
+		s.last = s.last.Add(h)
+		s.step(h.Seconds())
+	}
+}
+
+// step integrates one interval of dt seconds. Callers must hold s.mu.
+func (s *simulation) step(dt float64) {
+	ds := s.velocity * dt
+	dTheta := s.omega * dt
+	heading := s.thetaRad + dTheta/2
+	x := s.xMM + ds*math.Cos(heading)
+	y := s.yMM + ds*math.Sin(heading)
+	theta := math.Remainder(s.thetaRad+dTheta, 2*math.Pi)
+
+	// The body is round, so a wall only blocks translation toward it.
+	s.bumpLeft, s.bumpRight = false, false
+	for _, o := range s.obstacles {
+		if o.kind != "wall" {
+			continue
+		}
+		d, cx, cy := segmentDistance(x, y, o)
+		if d >= s.radiusMM {
+			continue
+		}
+		bearing := math.Remainder(math.Atan2(cy-y, cx-x)-theta, 2*math.Pi)
+		if math.Abs(bearing) < math.Pi/2 {
+			// Contact ahead: the bumper covers the front half.
+			s.bumpLeft = s.bumpLeft || bearing > -math.Pi/9
+			s.bumpRight = s.bumpRight || bearing < math.Pi/9
+		}
+		if prev, _, _ := segmentDistance(s.xMM, s.yMM, o); d < prev {
+			x, y, ds = s.xMM, s.yMM, 0
+		}
+	}
+
+	// The robot stops itself the moment a cliff sensor sees a drop.
+	cliffs := s.cliffsAt(x, y, theta)
+	for name, seen := range cliffs {
+		if seen && !s.cliffs[name] {
+			s.velocity, s.omega = 0, 0
+			s.requestedVelocity, s.requestedRadius = 0, 32767
+			s.cliffs = cliffs
+			return
+		}
+	}
+	s.cliffs = cliffs
+
+	s.xMM, s.yMM, s.thetaRad = x, y, theta
+	s.distanceMM += ds
+	s.angleDeg += dTheta * 180 / math.Pi
+	half := dTheta * s.widthMM / 2
+	s.leftCounts += (ds - half) / s.wheelCircumferenceMM * encoderCountsPerRev
+	s.rightCounts += (ds + half) / s.wheelCircumferenceMM * encoderCountsPerRev
+}
+
+// cliffsAt reports which cliff sensors would see a virtual cliff with the
+// robot at the given pose. Callers must hold s.mu.
+func (s *simulation) cliffsAt(x, y, theta float64) map[string]bool {
+	cliffs := map[string]bool{}
+	for _, name := range cliffReadings {
+		px, py := defaultSensorOffsets[name].toOdometryFrame(x, y, theta*180/math.Pi)
+		for _, o := range s.obstacles {
+			if d, _, _ := segmentDistance(px, py, o); o.kind == "cliff" && d < simCliffRangeMM {
+				cliffs[name] = true
+			}
+		}
+	}
+	return cliffs
+}
+
+// wallSeen reports whether the right-side wall sensor sees a virtual wall.
+// Callers must hold s.mu.
+func (s *simulation) wallSeen() bool {
+	px, py := defaultSensorOffsets["wall"].toOdometryFrame(s.xMM, s.yMM, s.thetaRad*180/math.Pi)
+	for _, o := range s.obstacles {
+		if d, _, _ := segmentDistance(px, py, o); o.kind == "wall" && d < simWallRangeMM {
+			return true
+		}
+	}
+	return false
+}
+
+// segmentDistance returns the distance from (x, y) to an obstacle and the
+// closest point on it.
+func segmentDistance(x, y float64, o simObstacle) (float64, float64, float64) {
+	dx, dy := o.x2-o.x1, o.y2-o.y1
+	t := 0.0
+	if l2 := dx*dx + dy*dy; l2 > 0 {
+		t = math.Max(0, math.Min(1, ((x-o.x1)*dx+(y-o.y1)*dy)/l2))
+	}
+	cx, cy := o.x1+t*dx, o.y1+t*dy
+	return math.Hypot(x-cx, y-cy), cx, cy
+}
+
+func (s *simulation) addObstacle(kind string, x1, y1, x2, y2 float64) (int, error) {
+	if kind != "wall" && kind != "cliff" {
+		return 0, fmt.Errorf("type must be wall or cliff, got %q", kind)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance()
+	s.nextObstacleID++
+	s.obstacles = append(s.obstacles, simObstacle{id: s.nextObstacleID, kind: kind, x1: x1, y1: y1, x2: x2, y2: y2})
+	return s.nextObstacleID, nil
+}
+
+func (s *simulation) clearObstacles() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance()
+	s.obstacles = nil
+}
+
+// setPose moves the simulated robot without driving it there.
+func (s *simulation) setPose(x, y, thetaDeg float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance()
+	s.xMM, s.yMM = x, y
+	s.thetaRad = math.Remainder(thetaDeg*math.Pi/180, 2*math.Pi)
+	s.cliffs = s.cliffsAt(s.xMM, s.yMM, s.thetaRad)
+}
+
+func (s *simulation) pose() map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance()
+	return map[string]any{
+		"x_mm":      s.xMM,
+		"y_mm":      s.yMM,
+		"theta_deg": s.thetaRad * 180 / math.Pi,
+	}
+}
+
+// readings returns sensor readings like the real sensor's, for the readings
+// the simulation models. Like the robot's packets 19 and 20, distance_mm and
+// angle_deg are reset by every read.
+func (s *simulation) readings() map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance()
+	distance := int(math.Round(s.distanceMM))
+	angle := int(math.Round(s.angleDeg))
+	// Keep the remainder so rounding doesn't drift over many reads.
+	s.distanceMM -= float64(distance)
+	s.angleDeg -= float64(angle)
+	return map[string]any{
+		"bump_left":              s.bumpLeft,
+		"bump_right":             s.bumpRight,
+		"wheel_drop_left":        false,
+		"wheel_drop_right":       false,
+		"wall":                   s.wallSeen(),
+		"cliff_left":             s.cliffs["cliff_left"],
+		"cliff_front_left":       s.cliffs["cliff_front_left"],
+		"cliff_front_right":      s.cliffs["cliff_front_right"],
+		"cliff_right":            s.cliffs["cliff_right"],
+		"distance_mm":            distance,
+		"angle_deg":              angle,
+		"left_encoder_counts":    int(uint16(int64(s.leftCounts))),
+		"right_encoder_counts":   int(uint16(int64(s.rightCounts))),
+		"requested_velocity_mms": int(s.requestedVelocity),
+		"requested_radius_mm":    int(s.requestedRadius),
+		"oi_mode":                oiSafe.String(),
+		"sim_x_mm":               s.xMM,
+		"sim_y_mm":               s.yMM,
+		"sim_theta_deg":          s.thetaRad * 180 / math.Pi,
+	}
+}
@@ -0,0 +1,77 @@
+package viamroomba
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	defaultSlipThreshold = 0.5
+	defaultSlipWindow    = 2 * time.Second
+	// minSlipTravelMM is the commanded travel a wheel needs over the window
+	// before its slip is judged, so creeping or stopped wheels never count.
+	minSlipTravelMM = 50.0
+)
+
+// slipSample is the commanded and measured travel of each wheel over the
+// interval between two readings.
+type slipSample struct {
+	at          time.Time
+	commandedMM [2]float64
+	measuredMM  [2]float64
+}
+
+// slipDetector compares how far each wheel was commanded to turn with how
+// far its encoder says it did, over a rolling window. A wheel held back by
+// a cable or rug fringe falls behind its command. Guarded by the sensor's
+// conn.mu.
+type slipDetector struct {
+	threshold float64
+	window    time.Duration
+
+	samples []slipSample
+	// prevCommanded is what the wheels were commanded at the previous
+	// reading, which is what they were driving toward since then.
+	prevCommanded [2]float64
+	prevTime      time.Time
+}
+
+// update feeds one reading's commanded and measured wheel velocities (left,
+// right; mm/s) into the window and returns the slip ratio: the largest
+// fraction of its commanded travel that either wheel failed to cover, from
+// 0 (no slip) to 1 (stalled). Wheels commanded too little travel to judge
+// count as not slipping.
+func (d *slipDetector) update(now time.Time, commanded, measured [2]float64) float64 {
+	if !d.prevTime.IsZero() {
+		dt := now.Sub(d.prevTime).Seconds()
+		d.samples = append(d.samples, slipSample{
+			at:          now,
+			commandedMM: [2]float64{d.prevCommanded[0] * dt, d.prevCommanded[1] * dt},
+			measuredMM:  [2]float64{measured[0] * dt, measured[1] * dt},
+		})
+	}
+	d.prevCommanded, d.prevTime = commanded, now
+
+	for len(d.samples) > 0 && now.Sub(d.samples[0].at) > d.window {
+		d.samples = d.samples[1:]
+	}
+
+	var commandedMM, measuredMM [2]float64
+	for _, s := range d.samples {
+		for w := 0; w < 2; w++ {
+			commandedMM[w] += s.commandedMM[w]
+			measuredMM[w] += s.measuredMM[w]
+		}
+	}
+	ratio := 0.0
+	for w := 0; w < 2; w++ {
+		if math.Abs(commandedMM[w]) < minSlipTravelMM {
+			continue
+		}
+		// Travel in the commanded direction only; a wheel pushed backwards
+		// has slipped completely.
+		covered := max(0, measuredMM[w]/commandedMM[w])
+		ratio = max(ratio, 1-min(1, covered))
+	}
+	return math.Round(ratio*100) / 100
+}
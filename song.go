@@ -0,0 +1,59 @@
+package viamroomba
+
+import (
+	"fmt"
+	"time"
+)
+
+// OI song opcodes. go-roomba doesn't wrap these.
+const (
+	opSong = 140
+	opPlay = 141
+)
+
+// Song slots reserved by the module. The 600 series stores songs 0-4.
+const (
+	reverseBeepSong byte = 4
+)
+
+// songNote is a MIDI note number (31-107, or 0 for a rest) and a duration in
+// 1/64ths of a second.
+type songNote struct {
+	note     byte
+	duration byte
+}
+
+var reverseBeepNotes = []songNote{{note: 84, duration: 8}}
+
+// songLength is how long notes take to play.
+func songLength(notes []songNote) time.Duration {
+	var length time.Duration
+	for _, n := range notes {
+		length += time.Duration(n.duration) * time.Second / 64
+	}
+	return length
+}
+
+// defineSong stores notes in the given song slot. Callers must hold c.mu.
+func (c *roombaConn) defineSong(number byte, notes []songNote) error {
+	if len(notes) == 0 || len(notes) > 16 {
+		return fmt.Errorf("song must have between 1 and 16 notes, got %d", len(notes))
+	}
+	payload := []byte{number, byte(len(notes))}
+	for _, n := range notes {
+		payload = append(payload, n.note, n.duration)
+	}
+	if err := c.write(opSong, payload); err != nil {
+		return fmt.Errorf("failed to define song %d: %w", number, err)
+	}
+	return nil
+}
+
+// playSong plays a previously defined song. The OI must be in Safe or Full
+// mode. Callers must hold c.mu.
+func (c *roombaConn) playSong(number byte) error {
+	if err := c.write(opPlay, []byte{number}); err != nil {
+		return fmt.Errorf("failed to play song %d: %w", number, err)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package viamroomba
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCarpetMaxVelocity       = 200
+	defaultWheelCurrentLimitMA     = 500
+	adaptiveSpeedInterval          = 500 * time.Millisecond
+	adaptiveSpeedSettleReadings    = 3
+	adaptiveSpeedUnlimitedVelocity = 500
+)
+
+// speedLimiter caps drive speed while the robot is on thick carpet, where
+// the wheels slip (throwing off odometry) and strain toward an overcurrent
+// fault. It changes state only after adaptiveSpeedSettleReadings consecutive
+// readings agree, so a rug edge or a single noisy reading doesn't flap it.
+type speedLimiter struct {
+	mu       sync.Mutex
+	limited  bool
+	streak   int
+	maxSpeed int16 // velocity cap while limited, mm/s
+}
+
+// observe feeds one floor reading into the limiter and reports whether the
+// limit changed.
+func (l *speedLimiter) observe(carpet bool) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if carpet == l.limited {
+		l.streak = 0
+		return false
+	}
+	l.streak++
+	if l.streak < adaptiveSpeedSettleReadings {
+		return false
+	}
+	l.limited = carpet
+	l.streak = 0
+	return true
+}
+
+// limit returns the current maximum wheel speed in mm/s.
+func (l *speedLimiter) limit() int16 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limited {
+		return l.maxSpeed
+	}
+	return adaptiveSpeedUnlimitedVelocity
+}
+
+// clamp limits velocity to the current maximum, keeping its sign.
+func (l *speedLimiter) clamp(velocity int16) int16 {
+	limit := l.limit()
+	return max(-limit, min(limit, velocity))
+}
+
+// monitorFloor polls the cliff signals (packets 28-31) and, if the robot
+// reports them, the wheel motor currents (packets 54-55) until the base is
+// closed, limiting speed while either says the robot is on thick carpet.
+// The limit applies from the next drive command. While the robot rests it
+// reads idlePollFactor times less often.
+func (s *viamRoombaBase) monitorFloor() {
+	packets := []byte{28, 29, 30, 31}
+	if s.conn.caps.hasPacket(54) {
+		packets = append(packets, 54, 55)
+	}
+	ticker := s.clk.Ticker(adaptiveSpeedInterval)
+	defer ticker.Stop()
+	var throttle pollThrottle
+	for {
+		select {
+		case <-s.cancelCtx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !throttle.due(&s.conn.activity) {
+			continue
+		}
+
+		if err := s.conn.mu.LockContext(s.cancelCtx); err != nil {
+			return
+		}
+		data, err := s.conn.query(packets)
+		s.conn.mu.Unlock()
+		if err != nil {
+			s.logger.Debugf("Adaptive speed: failed to read floor: %v", err)
+			continue
+		}
+
+		var signals [4]int
+		for i := range signals {
+			signals[i] = int(binary.BigEndian.Uint16(data[i]))
+		}
+		floor := classifyFloor(signals, s.carpetSignalThreshold, defaultEdgeSignalThreshold)
+		if floor == "edge" {
+			// A wheel drop or lift says nothing about the floor; keep the current state.
+			continue
+		}
+		carpet := floor == "carpet"
+		if len(data) > 4 {
+			for _, raw := range data[4:] {
+				current := int(int16(binary.BigEndian.Uint16(raw)))
+				if current < 0 {
+					current = -current
+				}
+				if current > s.wheelCurrentLimitMA {
+					carpet = true
+				}
+			}
+		}
+
+		if s.speedLimit.observe(carpet) {
+			if carpet {
+				s.logger.Infof("Thick carpet detected; limiting speed to %d mm/s", s.speedLimit.limit())
+			} else {
+				s.logger.Info("Left thick carpet; speed limit lifted")
+			}
+		}
+	}
+}
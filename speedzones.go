@@ -0,0 +1,234 @@
+package viamroomba
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// speedZoneInterval is how often the base checks which speed zone the robot
+// is in while it drives. Like the geofence, it reads odometry only when
+// nothing else has for this long.
+const speedZoneInterval = geofenceInterval
+
+// SpeedZoneConfig is a rectangle in the odometry frame, in mm, inside which
+// the base drives no faster than MaxSpeedMMs, such as a doorway threshold
+// or the edge of a rug.
+type SpeedZoneConfig struct {
+	Name        string  `json:"name,omitempty"`
+	MinXMM      float64 `json:"min_x_mm"`
+	MinYMM      float64 `json:"min_y_mm"`
+	MaxXMM      float64 `json:"max_x_mm"`
+	MaxYMM      float64 `json:"max_y_mm"`
+	MaxSpeedMMs float64 `json:"max_speed_mm_s"`
+}
+
+// validateSpeedZones checks the speed_zones attribute.
+func validateSpeedZones(zones []SpeedZoneConfig) error {
+	names := map[string]bool{}
+	for i, z := range zones {
+		if z.MaxXMM <= z.MinXMM || z.MaxYMM <= z.MinYMM {
+			return fmt.Errorf("speed_zones[%d]: max_x_mm and max_y_mm must be greater than min_x_mm and min_y_mm", i)
+		}
+		// A zone that stopped the robot would hold it there for good.
+		if z.MaxSpeedMMs < 1 || z.MaxSpeedMMs > 500 {
+			return fmt.Errorf("speed_zones[%d]: max_speed_mm_s must be in [1, 500]", i)
+		}
+		if z.Name != "" {
+			if names[z.Name] {
+				return fmt.Errorf("speed_zones[%d]: the name %q is used twice", i, z.Name)
+			}
+			names[z.Name] = true
+		}
+	}
+	return nil
+}
+
+// speedZone is a configured zone, named "zone <n>" if the config doesn't
+// name it.
+type speedZone struct {
+	name                   string
+	minX, minY, maxX, maxY float64
+	maxSpeed               int16
+}
+
+func (z speedZone) contains(x, y float64) bool {
+	return x >= z.minX && x <= z.maxX && y >= z.minY && y <= z.maxY
+}
+
+// buildSpeedZones converts the speed_zones attribute.
+func buildSpeedZones(cfg []SpeedZoneConfig) []speedZone {
+	zones := make([]speedZone, 0, len(cfg))
+	for i, z := range cfg {
+		name := z.Name
+		if name == "" {
+			name = fmt.Sprintf("zone %d", i)
+		}
+		zones = append(zones, speedZone{
+			name: name,
+			minX: z.MinXMM, minY: z.MinYMM, maxX: z.MaxXMM, maxY: z.MaxYMM,
+			maxSpeed: int16(z.MaxSpeedMMs),
+		})
+	}
+	return zones
+}
+
+// speedZoneState is the base's speed zones and where the robot is among
+// them.
+type speedZoneState struct {
+	zones []speedZone
+
+	// velocity and radius are the last Drive command the base was asked
+	// for, before any caps, while activityID was running, so the watcher
+	// can send it again with the new cap when the robot crosses into or
+	// out of a zone. velocity is zero when there is nothing to resend, as
+	// while heading hold steers (it applies the cap itself each cycle).
+	// Guarded by conn.mu.
+	velocity, radius int16
+	activityID       string
+
+	mu sync.Mutex
+	// inside names the zones the robot was in when last checked, and
+	// limit is the lowest of their speeds, or zero outside every zone.
+	inside []string
+	limit  int16
+}
+
+// zoneLimit returns the speed cap at the robot's current pose and the zones
+// that set it: the lowest max_speed_mm_s of the zones the robot is in, or
+// zero if it is in none.
+func (s *viamRoombaBase) zoneLimit() (int16, []string) {
+	if len(s.speedZones.zones) == 0 {
+		return 0, nil
+	}
+	x, y, _ := s.planarPose()
+	var limit int16
+	var inside []string
+	for _, z := range s.speedZones.zones {
+		if !z.contains(x, y) {
+			continue
+		}
+		inside = append(inside, z.name)
+		if len(inside) == 1 || z.maxSpeed < limit {
+			limit = z.maxSpeed
+		}
+	}
+	return limit, inside
+}
+
+// zoneClamp caps velocity to the speed zone the robot is in, keeping its
+// sign. Callers must hold s.conn.mu.
+func (s *viamRoombaBase) zoneClamp(velocity int16) int16 {
+	limit, inside := s.zoneLimit()
+	if len(inside) == 0 {
+		return velocity
+	}
+	return max(-limit, min(limit, velocity))
+}
+
+// noteDrive remembers the Drive command velocity and radius for the speed
+// zone watcher to resend. Callers must hold s.conn.mu.
+func (s *viamRoombaBase) noteDrive(velocity, radius int16) {
+	if len(s.speedZones.zones) == 0 {
+		return
+	}
+	_, id := s.conn.activity.current()
+	s.speedZones.velocity, s.speedZones.radius, s.speedZones.activityID = velocity, radius, id
+}
+
+// watchSpeedZones checks which speed zone the robot is in every
+// speedZoneInterval while the base drives it, until the base is closed.
+// When the robot crosses into or out of a zone mid-motion, the running
+// Drive command is sent again so the new cap takes effect at once; motions
+// that steer in a loop (paths, heading hold, closed-loop motion) pick it up
+// on their next cycle. Cleaning cycles and dock searches, which the robot
+// drives by itself, are left alone.
+func (s *viamRoombaBase) watchSpeedZones() {
+	ticker := s.clk.Ticker(speedZoneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.cancelCtx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		switch kind, _ := s.conn.activity.current(); kind {
+		case "idle", "clean", "docking":
+			continue
+		}
+		if err := s.conn.mu.LockContext(s.cancelCtx); err != nil {
+			return
+		}
+		if s.dryRun == nil && s.conn.odom.age() >= speedZoneInterval {
+			if _, _, err := s.conn.readOdometry(); err != nil {
+				s.conn.mu.Unlock()
+				s.logger.Debugf("Speed zones failed to read odometry: %v", err)
+				continue
+			}
+		}
+		if s.checkSpeedZone() {
+			z := &s.speedZones
+			if _, id := s.conn.activity.current(); z.velocity != 0 && id == z.activityID {
+				if err := s.drive(z.velocity, z.radius); err != nil {
+					s.warnings.Warnf("speed_zone", "Failed to change speed for the speed zone: %v", err)
+				}
+			}
+		}
+		s.conn.mu.Unlock()
+	}
+}
+
+// checkSpeedZone updates the zones the robot is in and reports whether the
+// speed cap changed. Callers must hold s.conn.mu.
+func (s *viamRoombaBase) checkSpeedZone() bool {
+	limit, inside := s.zoneLimit()
+	z := &s.speedZones
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	changed := (len(inside) > 0) != (len(z.inside) > 0) || limit != z.limit
+	if strings.Join(inside, ",") != strings.Join(z.inside, ",") {
+		if len(inside) > 0 {
+			s.logger.Infof("Robot is in speed zone %s; limiting speed to %d mm/s", strings.Join(inside, ", "), limit)
+		} else {
+			s.logger.Info("Robot left the speed zones; speed limit lifted")
+		}
+	}
+	z.inside, z.limit = inside, limit
+	return changed
+}
+
+// speedZonesSnapshot serves get_speed_zones.
+func (s *viamRoombaBase) speedZonesSnapshot(context.Context, noArgs) (map[string]any, error) {
+	if len(s.speedZones.zones) == 0 {
+		return nil, errors.New("get_speed_zones needs speed_zones")
+	}
+	zones := make([]any, 0, len(s.speedZones.zones))
+	for _, z := range s.speedZones.zones {
+		zones = append(zones, map[string]any{
+			"name":           z.name,
+			"min_x_mm":       z.minX,
+			"min_y_mm":       z.minY,
+			"max_x_mm":       z.maxX,
+			"max_y_mm":       z.maxY,
+			"max_speed_mm_s": z.maxSpeed,
+		})
+	}
+	x, y, _ := s.planarPose()
+	limit, inside := s.zoneLimit()
+	names := make([]any, 0, len(inside))
+	for _, name := range inside {
+		names = append(names, name)
+	}
+	out := map[string]any{
+		"zones":  zones,
+		"pose":   map[string]any{"x_mm": x, "y_mm": y},
+		"inside": names,
+	}
+	if len(inside) > 0 {
+		out["max_speed_mm_s"] = limit
+	}
+	return out, nil
+}
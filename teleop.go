@@ -0,0 +1,28 @@
+package viamroomba
+
+import "math"
+
+// shapePower maps a raw [-1, 1] power input through a deadband, an expo
+// curve, and a scale. Inputs inside the deadband return 0, and the remaining
+// range is stretched back to [0, 1] so full stick still reaches full power.
+// expo blends linear (0) and cubic (1) response for finer low-speed control.
+func shapePower(v, deadband, expo, scale float64) float64 {
+	mag := math.Min(math.Abs(v), 1)
+	if mag <= deadband {
+		return 0
+	}
+	mag = (mag - deadband) / (1 - deadband)
+	mag = (1-expo)*mag + expo*mag*mag*mag
+	return math.Copysign(mag*scale, v)
+}
+
+// curvatureDrive maps shaped linear and angular power to "cheesy drive":
+// angular power scales with linear power, so the stick sets how tightly the
+// robot curves regardless of speed instead of how fast it turns. With no
+// linear power it turns in place at full angular power (quick-turn).
+func curvatureDrive(linear, angular float64) float64 {
+	if linear == 0 {
+		return angular
+	}
+	return math.Abs(linear) * angular
+}
@@ -0,0 +1,50 @@
+package viamroomba
+
+import (
+	"math"
+	"testing"
+)
+
+func TestShapePower(t *testing.T) {
+	for _, tc := range []struct {
+		name                     string
+		v, deadband, expo, scale float64
+		want                     float64
+	}{
+		{"linear", 0.5, 0, 0, 1, 0.5},
+		{"inside the deadband", 0.05, 0.1, 0, 1, 0},
+		{"on the deadband", -0.1, 0.1, 0, 1, 0},
+		{"past the deadband is stretched", 0.55, 0.1, 0, 1, 0.5},
+		{"full stick is full power", -1, 0.1, 0.5, 1, -1},
+		{"past full stick is clamped", 2, 0, 0, 1, 1},
+		{"cubic", 0.5, 0, 1, 1, 0.125},
+		{"half expo", -0.5, 0, 0.5, 1, -0.3125},
+		{"scaled", 1, 0, 0, 0.5, 0.5},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := shapePower(tc.v, tc.deadband, tc.expo, tc.scale); math.Abs(got-tc.want) > 1e-9 {
+				t.Errorf("shapePower(%v, %v, %v, %v) = %v, want %v", tc.v, tc.deadband, tc.expo, tc.scale, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCurvatureDrive(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		linear, angular float64
+		want            float64
+	}{
+		{"turns in place when stopped", 0, 0.8, 0.8},
+		{"full speed turns fully", 1, 0.5, 0.5},
+		{"half speed halves the turn", 0.5, 1, 0.5},
+		{"reversing turns the same way", -0.5, 1, 0.5},
+		{"straight", 0.7, 0, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := curvatureDrive(tc.linear, tc.angular); got != tc.want {
+				t.Errorf("curvatureDrive(%v, %v) = %v, want %v", tc.linear, tc.angular, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package viamroomba
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	// thermalInterval is how often thermal protection reads the battery
+	// temperature, which changes over minutes.
+	thermalInterval = 5 * time.Second
+	// defaultThermalHysteresisC is how far the battery must cool below
+	// thermal_limit_c before motion is allowed again, unless
+	// thermal_resume_c is set.
+	defaultThermalHysteresisC = 5
+)
+
+// thermalState is the base's thermal protection, guarded by conn.mu.
+type thermalState struct {
+	limitC  int // zero when disabled
+	resumeC int
+
+	tempC      int
+	read       bool
+	overheated bool
+	since      time.Time
+}
+
+// errOverheated refuses motion while thermal protection holds the robot.
+func (t *thermalState) errOverheated() error {
+	return fmt.Errorf("battery temperature %d°C is over the %d°C limit; motion is refused until it cools to %d°C",
+		t.tempC, t.limitC, t.resumeC)
+}
+
+// watchThermal reads the battery temperature (packet 24) every
+// thermalInterval until the base is closed. Above thermal_limit_c it halts
+// the robot and refuses motion; at or below thermal_resume_c it allows
+// motion again. While the robot rests it reads idlePollFactor times less
+// often.
+func (s *viamRoombaBase) watchThermal() {
+	ticker := s.clk.Ticker(thermalInterval)
+	defer ticker.Stop()
+	var throttle pollThrottle
+	for {
+		select {
+		case <-s.cancelCtx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !throttle.due(&s.conn.activity) {
+			continue
+		}
+
+		if err := s.conn.mu.LockContext(s.cancelCtx); err != nil {
+			return
+		}
+		data, err := s.conn.sensor(24)
+		if err != nil || len(data) < 1 {
+			s.conn.mu.Unlock()
+			s.logger.Debugf("Thermal protection failed to read the battery temperature: %v", err)
+			continue
+		}
+		t := &s.thermal
+		t.tempC, t.read = int(int8(data[0])), true
+		switch {
+		case !t.overheated && t.tempC > t.limitC:
+			t.overheated, t.since = true, time.Now()
+			s.logger.Errorf("Battery temperature %d°C is over the %d°C limit; stopping the robot until it cools to %d°C",
+				t.tempC, t.limitC, t.resumeC)
+			s.conn.events.record("thermal_stop", map[string]any{"temperature_c": t.tempC})
+			s.conn.mu.Unlock()
+			s.halt("Thermal protection")
+			continue
+		case t.overheated && t.tempC <= t.resumeC:
+			t.overheated = false
+			s.logger.Infof("Battery has cooled to %d°C; motion allowed again", t.tempC)
+			s.conn.events.record("thermal_resume", map[string]any{
+				"temperature_c": t.tempC,
+				"stopped_sec":   time.Since(t.since).Seconds(),
+			})
+		}
+		s.conn.mu.Unlock()
+	}
+}
+
+// halt cancels the running motion, takes control back from a cleaning
+// cycle or dock search by entering Safe mode, and switches off the brush
+// and vacuum motors (or the Create's low side drivers) and the wheels. The
+// OI is left in Safe mode, in which the robot sits still. who names the
+// protection halting the robot in the log.
+func (s *viamRoombaBase) halt(who string) {
+	s.opMgr.CancelRunning(s.cancelCtx)
+	if err := s.conn.mu.LockContext(s.cancelCtx); err != nil {
+		return
+	}
+	defer s.conn.mu.Unlock()
+	if s.conn.mode == oiPassive {
+		if err := s.conn.setMode(oiSafe); err != nil {
+			s.logger.Errorf("%s failed to take control of the robot: %v", who, err)
+			return
+		}
+	}
+	if s.conn.mode == oiSafe || s.conn.mode == oiFull {
+		if err := s.conn.write(opLowSideDrivers, []byte{0}); err != nil {
+			s.logger.Warnf("%s failed to switch off the motors: %v", who, err)
+		} else if s.conn.outputs != nil {
+			s.conn.outputs[opLowSideDrivers] = 0
+		}
+	}
+	if err := s.stopVerified(); err != nil {
+		s.logger.Errorf("%s failed to stop the robot: %v", who, err)
+	}
+	s.conn.activity.set("idle")
+}
+
+// checkThermal refuses a motion or cleaning command while the robot is
+// overheated. Callers must hold s.conn.mu.
+func (s *viamRoombaBase) checkThermal() error {
+	if s.thermal.overheated {
+		return s.thermal.errOverheated()
+	}
+	return nil
+}
+
+// thermalSnapshot serves get_thermal_state.
+func (s *viamRoombaBase) thermalSnapshot(ctx context.Context, _ noArgs) (map[string]any, error) {
+	if err := s.conn.mu.LockContext(ctx); err != nil {
+		return nil, err
+	}
+	defer s.conn.mu.Unlock()
+	t := s.thermal
+	out := map[string]any{
+		"enabled":    t.limitC > 0,
+		"overheated": t.overheated,
+	}
+	if t.limitC > 0 {
+		out["limit_c"] = t.limitC
+		out["resume_c"] = t.resumeC
+	}
+	if t.read {
+		out["temperature_c"] = t.tempC
+	}
+	if t.overheated {
+		out["since"] = t.since.Format(time.RFC3339)
+	}
+	return out, nil
+}
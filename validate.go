@@ -0,0 +1,110 @@
+package viamroomba
+
+import (
+	"fmt"
+
+	"github.com/xa4a/go-roomba/constants"
+)
+
+// signedPackets are the 2-byte packets the OI reports as signed values, plus
+// the signed 1-byte temperature.
+var signedPackets = map[byte]bool{
+	19: true, 20: true, 23: true, 24: true, 39: true, 40: true, 41: true, 42: true,
+	54: true, 55: true, 56: true, 57: true,
+}
+
+// packetRanges are the values each packet can plausibly take, from the OI
+// spec where it defines a range and from what a 600-series battery can do
+// otherwise. A stale or dropped byte shifts every later packet in a Query
+// List response, which almost always pushes one of these out of range.
+// Packets not listed (e.g. IR opcodes, buttons) can take any value.
+var packetRanges = map[byte][2]int{
+	7:  {0, 15},
+	8:  {0, 1},
+	9:  {0, 1},
+	10: {0, 1},
+	11: {0, 1},
+	12: {0, 1},
+	13: {0, 1},
+	14: {0, 31},
+	21: {0, 5},
+	22: {0, 20000},
+	24: {-40, 90},
+	25: {0, 10000},
+	26: {0, 10000},
+	27: {0, 4095},
+	28: {0, 4095},
+	29: {0, 4095},
+	30: {0, 4095},
+	31: {0, 4095},
+	34: {0, 3},
+	35: {0, 3},
+	36: {0, 15},
+	37: {0, 1},
+	39: {-500, 500},
+	41: {-500, 500},
+	42: {-500, 500},
+	45: {0, 63},
+	46: {0, 4095},
+	47: {0, 4095},
+	48: {0, 4095},
+	49: {0, 4095},
+	50: {0, 4095},
+	51: {0, 4095},
+	58: {0, 3},
+}
+
+// validateResponse checks that a sensor response has the expected number of
+// packets, that each has the length the OI defines for it, and that every
+// value is plausible.
+func validateResponse(packets []byte, data [][]byte) error {
+	if len(data) != len(packets) {
+		return fmt.Errorf("got %d packets, want %d", len(data), len(packets))
+	}
+	for i, id := range packets {
+		if err := checkPacket(id, data[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// packetErrors checks each packet of a response with the expected number of
+// packets, returning what is wrong with each one that fails, or nil if none
+// does.
+func packetErrors(packets []byte, data [][]byte) map[byte]error {
+	var bad map[byte]error
+	for i, id := range packets {
+		if err := checkPacket(id, data[i]); err != nil {
+			if bad == nil {
+				bad = map[byte]error{}
+			}
+			bad[id] = err
+		}
+	}
+	return bad
+}
+
+// blankPacket is a zeroed packet of the length the OI defines for id. It
+// stands in for a bad packet, so decoding can't read past the end of one
+// that came back short.
+func blankPacket(id byte) []byte {
+	return make([]byte, constants.SENSOR_PACKET_LENGTH[id])
+}
+
+// checkPacket checks that one packet has the length the OI defines for it
+// and a plausible value.
+func checkPacket(id byte, data []byte) error {
+	want := int(constants.SENSOR_PACKET_LENGTH[id])
+	if len(data) != want {
+		return fmt.Errorf("packet %d (%s) is %d bytes, want %d", id, packetName(id), len(data), want)
+	}
+	r, ok := packetRanges[id]
+	if !ok {
+		return nil
+	}
+	if v := decodePacket(id, data); v < r[0] || v > r[1] {
+		return fmt.Errorf("packet %d (%s) value %d is outside [%d, %d]", id, packetName(id), v, r[0], r[1])
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package viamroomba
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// irVirtualWall is the IR character a Virtual Wall beacon sends
+	// (packets 17, 52, 53).
+	irVirtualWall = 162
+	// virtualWallMergeMM is how close a detection must be to a mapped wall to
+	// extend it rather than start a new one. A beam is a few meters long, so
+	// a wall is built up from detections along it.
+	virtualWallMergeMM = 300.0
+	// virtualWallSpacingMM is how far apart a wall's points are kept, so a
+	// robot sitting in the beam doesn't fill the wall with one spot.
+	virtualWallSpacingMM = 50.0
+	// maxVirtualWalls and maxVirtualWallPoints bound the persisted map; the
+	// least recently seen walls and oldest points are dropped first.
+	maxVirtualWalls      = 100
+	maxVirtualWallPoints = 50
+)
+
+// wallPoint is where a virtual wall beam was detected, in the odometry frame.
+type wallPoint struct {
+	XMM float64 `json:"x_mm"`
+	YMM float64 `json:"y_mm"`
+}
+
+// virtualWall is a cluster of detections of one beam.
+type virtualWall struct {
+	Points     []wallPoint `json:"points"`
+	Sensors    []string    `json:"sensors"`
+	Detections int         `json:"detections"`
+	FirstSeen  time.Time   `json:"first_seen"`
+	LastSeen   time.Time   `json:"last_seen"`
+}
+
+// virtualWallMap collects where the robot has seen virtual wall beams, so
+// navigation can keep out of them without relying on the robot's own
+// reaction, which only applies while it is cleaning. It is persisted with
+// the sensor's state.
+type virtualWallMap struct {
+	mu    sync.Mutex
+	walls []virtualWall
+}
+
+// record adds a detection at (x, y) by the named receivers to the nearest
+// mapped wall within virtualWallMergeMM, or starts a new wall.
+func (m *virtualWallMap) record(sensors []string, x, y float64, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	best, bestDist := -1, virtualWallMergeMM
+	for i, w := range m.walls {
+		for _, p := range w.Points {
+			if d := math.Hypot(p.XMM-x, p.YMM-y); d <= bestDist {
+				best, bestDist = i, d
+			}
+		}
+	}
+	if best < 0 {
+		if len(m.walls) >= maxVirtualWalls {
+			m.walls = m.walls[1:]
+		}
+		m.walls = append(m.walls, virtualWall{
+			Points:     []wallPoint{{x, y}},
+			Sensors:    append([]string(nil), sensors...),
+			Detections: 1,
+			FirstSeen:  now,
+			LastSeen:   now,
+		})
+		return
+	}
+
+	w := m.walls[best]
+	w.Detections++
+	w.LastSeen = now
+	for _, s := range sensors {
+		known := false
+		for _, have := range w.Sensors {
+			known = known || have == s
+		}
+		if !known {
+			w.Sensors = append(w.Sensors, s)
+		}
+	}
+	if bestDist >= virtualWallSpacingMM {
+		if len(w.Points) >= maxVirtualWallPoints {
+			w.Points = w.Points[1:]
+		}
+		w.Points = append(w.Points, wallPoint{x, y})
+	}
+	// Keep the most recently seen wall last, so the oldest is dropped first.
+	copy(m.walls[best:], m.walls[best+1:])
+	m.walls[len(m.walls)-1] = w
+}
+
+// restore replaces the map with saved walls, skipping any without points.
+func (m *virtualWallMap) restore(saved []virtualWall) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var walls []virtualWall
+	for _, w := range saved {
+		if len(w.Points) > 0 {
+			walls = append(walls, w)
+		}
+	}
+	if len(walls) > maxVirtualWalls {
+		walls = walls[len(walls)-maxVirtualWalls:]
+	}
+	m.walls = walls
+}
+
+// snapshot returns a copy of the walls for persisting.
+func (m *virtualWallMap) snapshot() []virtualWall {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	walls := make([]virtualWall, len(m.walls))
+	for i, w := range m.walls {
+		w.Points = append([]wallPoint(nil), w.Points...)
+		w.Sensors = append([]string(nil), w.Sensors...)
+		walls[i] = w
+	}
+	return walls
+}
+
+// get lists the mapped walls. Each is given as a line segment between its
+// two farthest-apart points, for beams crossed or followed, and as a region
+// (center and radius), for beams only touched at one spot.
+func (m *virtualWallMap) get(context.Context, noArgs) (map[string]any, error) {
+	list := []any{}
+	for _, w := range m.snapshot() {
+		var cx, cy float64
+		for _, p := range w.Points {
+			cx += p.XMM
+			cy += p.YMM
+		}
+		cx /= float64(len(w.Points))
+		cy /= float64(len(w.Points))
+		radius := 0.0
+		a, b := w.Points[0], w.Points[0]
+		for i, p := range w.Points {
+			radius = max(radius, math.Hypot(p.XMM-cx, p.YMM-cy))
+			for _, q := range w.Points[i+1:] {
+				if math.Hypot(p.XMM-q.XMM, p.YMM-q.YMM) > math.Hypot(a.XMM-b.XMM, a.YMM-b.YMM) {
+					a, b = p, q
+				}
+			}
+		}
+		points := make([]any, 0, len(w.Points))
+		for _, p := range w.Points {
+			points = append(points, map[string]any{"x_mm": p.XMM, "y_mm": p.YMM})
+		}
+		sensors := make([]any, 0, len(w.Sensors))
+		for _, s := range w.Sensors {
+			sensors = append(sensors, s)
+		}
+		list = append(list, map[string]any{
+			"start":      map[string]any{"x_mm": a.XMM, "y_mm": a.YMM},
+			"end":        map[string]any{"x_mm": b.XMM, "y_mm": b.YMM},
+			"center":     map[string]any{"x_mm": cx, "y_mm": cy},
+			"radius_mm":  radius,
+			"points":     points,
+			"sensors":    sensors,
+			"detections": w.Detections,
+			"first_seen": w.FirstSeen.Format(time.RFC3339Nano),
+			"last_seen":  w.LastSeen.Format(time.RFC3339Nano),
+		})
+	}
+	return map[string]any{"virtual_walls": list}, nil
+}
+
+func (m *virtualWallMap) clear(context.Context, noArgs) (map[string]any, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := len(m.walls)
+	m.walls = nil
+	return map[string]any{"cleared": n}, nil
+}
+
+// virtualWallSensors names the receivers in a reading that see a virtual
+// wall: the virtual wall detector (packet 13) and any IR receiver decoding
+// the Virtual Wall character.
+func virtualWallSensors(readings map[string]any) []string {
+	var sensors []string
+	if seen, _ := readings["virtual_wall"].(bool); seen {
+		sensors = append(sensors, "virtual_wall")
+	}
+	for _, name := range []string{"ir_opcode", "ir_opcode_left", "ir_opcode_right"} {
+		if code, ok := readings[name].(int); ok && code == irVirtualWall {
+			sensors = append(sensors, name)
+		}
+	}
+	return sensors
+}
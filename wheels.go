@@ -0,0 +1,198 @@
+package viamroomba
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+// encoderCountsPerRev is the resolution of the Roomba's wheel encoders
+// (packets 43-44).
+const encoderCountsPerRev = 508.8
+
+// commandedWheelVelocities splits a Drive command's velocity and radius into
+// the wheel velocities the robot aims for, in mm/s. Positive radii turn
+// left, and the OI's special radii drive straight or spin in place. A
+// radius of 0, which stop sends and the robot reports until the next Drive,
+// is taken as straight.
+func commandedWheelVelocities(velocity, radius int16, widthMM float64) (left, right float64) {
+	v := float64(velocity)
+	switch radius {
+	case 0, 32767, -32768:
+		return v, v
+	case 1:
+		return -v, v
+	case -1:
+		return v, -v
+	}
+	r := float64(radius)
+	return v * (r - widthMM/2) / r, v * (r + widthMM/2) / r
+}
+
+// wheelTracker turns successive encoder counts into measured wheel
+// velocities. It is guarded by the connection's mu, like the sensor reads
+// that feed it.
+type wheelTracker struct {
+	mmPerCount float64
+
+	prevLeft, prevRight uint16
+	prevTime            time.Time
+}
+
+func newWheelTracker(wheelCircumferenceMM int) *wheelTracker {
+	return &wheelTracker{mmPerCount: float64(wheelCircumferenceMM) / encoderCountsPerRev}
+}
+
+// update records a new pair of encoder counts and returns each wheel's
+// velocity since the previous pair, in mm/s. ok is false for the first pair,
+// or if the reads were too close together to measure.
+func (w *wheelTracker) update(now time.Time, left, right uint16) (leftMMs, rightMMs float64, ok bool) {
+	prevLeft, prevRight, prevTime := w.prevLeft, w.prevRight, w.prevTime
+	w.prevLeft, w.prevRight, w.prevTime = left, right, now
+	dt := now.Sub(prevTime).Seconds()
+	if prevTime.IsZero() || dt <= 0 {
+		return 0, 0, false
+	}
+	// The counters wrap at 16 bits; a signed difference handles the wrap in
+	// either direction as long as a wheel turns less than half the range
+	// (about 64 turns) between reads.
+	leftMMs = float64(int16(left-prevLeft)) * w.mmPerCount / dt
+	rightMMs = float64(int16(right-prevRight)) * w.mmPerCount / dt
+	return math.Round(leftMMs), math.Round(rightMMs), true
+}
+
+// encoderSample is the cumulative travel of each wheel, in encoder counts,
+// at one read.
+type encoderSample struct {
+	at          time.Time
+	left, right int64
+}
+
+// encoderVelocity measures the base's linear and angular velocity from the
+// encoder counts over a rolling window, which smooths the count resolution
+// without lagging far behind a change in speed. Guarded by its owner.
+type encoderVelocity struct {
+	mmPerCount float64
+	widthMM    float64
+	window     time.Duration
+
+	samples             []encoderSample
+	prevLeft, prevRight uint16
+}
+
+func newEncoderVelocity(widthMM, wheelCircumferenceMM int, window time.Duration) *encoderVelocity {
+	return &encoderVelocity{
+		mmPerCount: float64(wheelCircumferenceMM) / encoderCountsPerRev,
+		widthMM:    float64(widthMM),
+		window:     window,
+	}
+}
+
+// update records a new pair of encoder counts and returns the velocities
+// over the window: forward in mm/s and counterclockwise in degrees per
+// second. ok is false until there are two reads to measure between. If
+// reads are further apart than the window, the last two are used.
+func (e *encoderVelocity) update(now time.Time, left, right uint16) (linearMMs, angularDegSec float64, ok bool) {
+	next := encoderSample{at: now}
+	if n := len(e.samples); n > 0 {
+		last := e.samples[n-1]
+		next.left = last.left + int64(int16(left-e.prevLeft))
+		next.right = last.right + int64(int16(right-e.prevRight))
+	}
+	e.prevLeft, e.prevRight = left, right
+	e.samples = append(e.samples, next)
+	// Keep the newest sample at or before the start of the window.
+	for len(e.samples) > 2 && now.Sub(e.samples[1].at) >= e.window {
+		e.samples = e.samples[1:]
+	}
+
+	first := e.samples[0]
+	dt := now.Sub(first.at).Seconds()
+	if len(e.samples) < 2 || dt <= 0 {
+		return 0, 0, false
+	}
+	leftMM := float64(next.left-first.left) * e.mmPerCount
+	rightMM := float64(next.right-first.right) * e.mmPerCount
+	linearMMs = (leftMM + rightMM) / 2 / dt
+	angularDegSec = (rightMM - leftMM) / e.widthMM / dt * 180 / math.Pi
+	return linearMMs, angularDegSec, true
+}
+
+const (
+	// movingInterval is the shortest time over which IsMoving compares
+	// encoder counts, and movingMaxAge the longest: an earlier read within
+	// it is reused, so polling IsMoving doesn't wait on every call.
+	movingInterval = 100 * time.Millisecond
+	movingMaxAge   = time.Second
+	// movingThresholdMMs is the wheel speed above which the base counts as
+	// moving, the same as for the requested velocity.
+	movingThresholdMMs = 5.0
+)
+
+// countsSample is a pair of raw encoder counts and when they were read.
+type countsSample struct {
+	at          time.Time
+	left, right uint16
+}
+
+// nextCounts takes s.conn.mu to read the encoder counts, and returns them
+// along with the read before, which they replace as s.lastCounts.
+func (s *viamRoombaBase) nextCounts(ctx context.Context) (now, prev countsSample, err error) {
+	if err := s.conn.mu.LockContext(ctx); err != nil {
+		return countsSample{}, countsSample{}, err
+	}
+	defer s.conn.mu.Unlock()
+	if now, err = s.readCounts(); err != nil {
+		return countsSample{}, countsSample{}, err
+	}
+	prev, s.lastCounts = s.lastCounts, now
+	return now, prev, nil
+}
+
+// readCounts reads the encoder counts (packets 43-44). Callers must hold
+// s.conn.mu.
+func (s *viamRoombaBase) readCounts() (countsSample, error) {
+	data, err := s.conn.query([]byte{43, 44})
+	if err != nil {
+		return countsSample{}, err
+	}
+	return countsSample{
+		at:    time.Now(),
+		left:  binary.BigEndian.Uint16(data[0]),
+		right: binary.BigEndian.Uint16(data[1]),
+	}, nil
+}
+
+// wheelsTurning reports whether either wheel turned faster than
+// movingThresholdMMs between the previous encoder read, if it was recent
+// enough, and a new one, reading twice movingInterval apart otherwise. It
+// takes s.conn.mu for each read and releases it while it waits between
+// them, so polling IsMoving doesn't hold up teleop or the sensor.
+func (s *viamRoombaBase) wheelsTurning(ctx context.Context) (bool, error) {
+	now, prev, err := s.nextCounts(ctx)
+	if err != nil {
+		return false, err
+	}
+	if prev.at.IsZero() || now.at.Sub(prev.at) > movingMaxAge {
+		prev = now
+	}
+	if wait := movingInterval - now.at.Sub(prev.at); wait > 0 {
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(wait):
+		}
+		if now, _, err = s.nextCounts(ctx); err != nil {
+			return false, err
+		}
+	}
+
+	dt := now.at.Sub(prev.at).Seconds()
+	mmPerCount := float64(s.wheelCircumferenceMM) / encoderCountsPerRev
+	leftMMs := math.Abs(float64(int16(now.left-prev.left))) * mmPerCount / dt
+	rightMMs := math.Abs(float64(int16(now.right-prev.right))) * mmPerCount / dt
+	moving := max(leftMMs, rightMMs) > movingThresholdMMs
+	s.logger.Debugf("IsMoving: wheels at %.0f and %.0f mm/s, moving=%v", leftMMs, rightMMs, moving)
+	return moving, nil
+}
@@ -0,0 +1,26 @@
+package viamroomba
+
+import "testing"
+
+func TestCommandedWheelVelocities(t *testing.T) {
+	for _, tc := range []struct {
+		name                string
+		velocity, radius    int16
+		wantLeft, wantRight float64
+	}{
+		{"straight", 200, 32767, 200, 200},
+		{"straight other sign", 200, -32768, 200, 200},
+		{"stopped", 0, 0, 0, 0},
+		{"spin left", 100, 1, -100, 100},
+		{"spin right", 100, -1, 100, -100},
+		{"arc left", 100, 235, 50, 150},
+		{"arc right", 100, -235, 150, 50},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			left, right := commandedWheelVelocities(tc.velocity, tc.radius, 235)
+			if left != tc.wantLeft || right != tc.wantRight {
+				t.Errorf("got %v, %v, want %v, %v", left, right, tc.wantLeft, tc.wantRight)
+			}
+		})
+	}
+}